@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"go.yaml.in/yaml/v3"
+	edprovider "sigs.k8s.io/external-dns/provider"
+)
+
+var tenantName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// defaultAccount names the account configured by the --inwx-username and --inwx-password flags.
+const defaultAccount = "default"
+
+// accountConfig is an INWX account of the accounts file. Its username and password are expanded
+// with environment variables, e.g. ${INWX_PASSWORD_CUSTOMER_A}, keeping secrets out of the file.
+type accountConfig struct {
+	Name string `yaml:"name"`
+	// Tenant serves the account below /tenants/<tenant> instead of the root path, if set
+	Tenant         string   `yaml:"tenant"`
+	Username       string   `yaml:"username"`
+	Password       string   `yaml:"password"`
+	Sandbox        bool     `yaml:"sandbox"`
+	DomainFilter   []string `yaml:"domain-filter"`
+	ExcludeDomains []string `yaml:"exclude-domains"`
+	Zones          []string `yaml:"zones"`
+}
+
+func readAccountsFile(path string) ([]accountConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	file := struct {
+		Accounts []accountConfig `yaml:"accounts"`
+	}{}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	errs := []error{}
+	names := []string{}
+	for i := range file.Accounts {
+		account := &file.Accounts[i]
+		account.Username = os.ExpandEnv(account.Username)
+		account.Password = os.ExpandEnv(account.Password)
+		switch {
+		case account.Name == "":
+			errs = append(errs, fmt.Errorf("account %d: missing name", i+1))
+			continue
+		case account.Name == defaultAccount || slices.Contains(names, account.Name):
+			errs = append(errs, fmt.Errorf("account %s: duplicate name", account.Name))
+		case account.Username == "" || account.Password == "":
+			errs = append(errs, fmt.Errorf("account %s: missing username or password", account.Name))
+		}
+		if account.Tenant != "" && !tenantName.MatchString(account.Tenant) {
+			errs = append(errs, fmt.Errorf("account %s: invalid tenant %q, expected lower case letters, digits and dashes", account.Name, account.Tenant))
+		}
+		names = append(names, account.Name)
+		for _, domain := range slices.Concat(account.DomainFilter, account.ExcludeDomains, account.Zones) {
+			if err := validateDomain(domain); err != nil {
+				errs = append(errs, fmt.Errorf("account %s: invalid domain %q: %w", account.Name, domain, err))
+			}
+		}
+	}
+	if len(file.Accounts) == 0 {
+		errs = append(errs, fmt.Errorf("no accounts"))
+	}
+	return file.Accounts, errors.Join(errs...)
+}
+
+// defaultProvider returns the provider of the default account of accounts, nil if there is none.
+func defaultProvider(accounts []provider.Account) *provider.INWXProvider {
+	for _, account := range accounts {
+		if account.Name == defaultAccount {
+			return account.Provider
+		}
+	}
+	return nil
+}
+
+// newAccounts returns the provider of every configured account: the default account, if credentials
+// are given by flags, followed by those of the accounts file.
+func (cfg *config) newAccounts(logger *slog.Logger) []provider.Account {
+	accounts := []provider.Account{}
+	if cfg.username != "" {
+		accounts = append(accounts, provider.Account{Name: defaultAccount, Provider: cfg.newProvider(logger)})
+	}
+	for _, account := range cfg.accountConfigs {
+		options := cfg.clientOptions()
+		options.Username, options.Password, options.Sandbox = account.Username, account.Password, account.Sandbox
+		journalFile := ""
+		if cfg.journalFile != "" {
+			journalFile = cfg.journalFile + "." + account.Name
+		}
+		options.Journal = cfg.newJournal(journalFile, account.Name)
+		cacheFile := ""
+		if cfg.recordsCacheFile != "" {
+			// every account keeps its own records next to those of the default account
+			cacheFile = cfg.recordsCacheFile + "." + account.Name
+		}
+		p := provider.NewINWXProvider(provider.Config{
+			Client:              options,
+			DomainFilter:        account.DomainFilter,
+			ExcludeDomains:      account.ExcludeDomains,
+			Zones:               account.Zones,
+			DefaultTTL:          cfg.defaultTTL,
+			DeletionGracePeriod: cfg.deletionGracePeriod,
+			SubdomainsOnly:      cfg.subdomainsOnly,
+			ZoneRecordLimit:     cfg.zoneRecordLimit,
+			MaxErrorRatio:       cfg.maxErrorRatio,
+			MaxApplyCalls:       cfg.maxSyncAPICalls,
+			MaxApplyDuration:    cfg.maxSyncDuration,
+			DedupWindow:         cfg.dedupWindow,
+			RetryQueueSize:      cfg.retryQueueSize,
+			RetryInterval:       cfg.retryQueueInterval,
+			PausedZones:         cfg.pausedZones,
+			ReadOnly:            cfg.readOnly,
+			Ownership:           cfg.ownership(),
+			RegistryLabels:      cfg.registryLabels(),
+			LogEndpoints:        cfg.logEndpoints,
+			Snapshots:           cfg.snapshots,
+			ZoneCreation:        cfg.zoneCreation(),
+			RecordsCacheFile:    cacheFile,
+			SharedCache:         cfg.sharedCache(account.Username, account.Sandbox),
+			Events:              cfg.events,
+			Account:             account.Name,
+			Logger:              logger.With("account", account.Name),
+		})
+		accounts = append(accounts, provider.Account{Name: account.Name, Provider: p})
+	}
+	return accounts
+}
+
+// groupAccounts returns the provider of the accounts served at the root path, nil if there are none,
+// and the providers of the tenants. Several accounts of a group are served by a MultiAccountProvider.
+func (cfg *config) groupAccounts(accounts []provider.Account, logger *slog.Logger) (edprovider.Provider, map[string]edprovider.Provider) {
+	tenantOf := map[string]string{}
+	for _, account := range cfg.accountConfigs {
+		tenantOf[account.Name] = account.Tenant
+	}
+	groups := map[string][]provider.Account{}
+	for _, account := range accounts {
+		groups[tenantOf[account.Name]] = append(groups[tenantOf[account.Name]], account)
+	}
+
+	providers := map[string]edprovider.Provider{}
+	for tenant, group := range groups {
+		if len(group) == 1 {
+			providers[tenant] = group[0].Provider
+		} else {
+			providers[tenant] = provider.NewMultiAccountProvider(group, logger.With("tenant", tenant))
+			logger.Info("managing multiple INWX accounts", "tenant", tenant, "accounts", len(group))
+		}
+	}
+	root := providers[""]
+	delete(providers, "")
+	return root, providers
+}
+
+// reloadAccounts applies the reloadable settings of newCfg to accounts, which must be those of newCfg,
+// failing without applying any if a setting requiring a restart changed from cfg, the configuration of
+// accounts.
+func reloadAccounts(accounts []provider.Account, cfg *config, newCfg *config) error {
+	if err := cfg.restartRequired(newCfg); err != nil {
+		return err
+	}
+	newAccounts := map[string]accountConfig{}
+	if newCfg.username != "" {
+		newAccounts[defaultAccount] = accountConfig{Username: newCfg.username, Password: newCfg.password, DomainFilter: newCfg.domainFilter, ExcludeDomains: newCfg.excludeDomains, Zones: newCfg.zones}
+	}
+	for _, account := range newCfg.accountConfigs {
+		newAccounts[account.Name] = account
+	}
+	if len(newAccounts) != len(accounts) {
+		return fmt.Errorf("the set of accounts changed, a restart is required")
+	}
+	for _, account := range accounts {
+		if _, ok := newAccounts[account.Name]; !ok {
+			return fmt.Errorf("the set of accounts changed, a restart is required")
+		}
+	}
+	for _, account := range cfg.accountConfigs {
+		if newAccount := newAccounts[account.Name]; newAccount.Sandbox != account.Sandbox || newAccount.Tenant != account.Tenant {
+			return fmt.Errorf("the sandbox or tenant of account %s changed, a restart is required", account.Name)
+		}
+	}
+	for _, account := range accounts {
+		newAccount := newAccounts[account.Name]
+		account.Provider.SetCredentials(newAccount.Username, newAccount.Password)
+		account.Provider.Reload(provider.Config{
+			DomainFilter:     newAccount.DomainFilter,
+			ExcludeDomains:   newAccount.ExcludeDomains,
+			Zones:            newAccount.Zones,
+			Ownership:        newCfg.ownership(),
+			DefaultTTL:       newCfg.defaultTTL,
+			SubdomainsOnly:   newCfg.subdomainsOnly,
+			MaxApplyCalls:    newCfg.maxSyncAPICalls,
+			MaxApplyDuration: newCfg.maxSyncDuration,
+			MaxErrorRatio:    newCfg.maxErrorRatio,
+		})
+		account.Provider.SetPausedZones(newCfg.pausedZones)
+	}
+	return nil
+}
+
+// reloadableFlags are the global flags whose changes reloadAccounts applies; changes of any other
+// flag require a restart, as they are only read on start.
+var reloadableFlags = []string{
+	configFileFlag, envFileFlag, "accounts-file", "inwx-username", "inwx-password",
+	"domain-filter", "exclude-domains", "zone", "paused-zone", "default-ttl", "subdomains-only",
+	"max-sync-api-calls", "max-sync-duration", "max-error-ratio",
+	"ownership-guard", "ownership-txt-prefix", "ownership-owner-id",
+}
+
+// restartRequired fails if a flag of newCfg that is not reloadable differs from cfg.
+func (cfg *config) restartRequired(newCfg *config) error {
+	changed := []string{}
+	for name, value := range newCfg.flagValues {
+		if value != cfg.flagValues[name] && !slices.Contains(reloadableFlags, name) {
+			changed = append(changed, "--"+name)
+		}
+	}
+	if len(changed) > 0 {
+		slices.Sort(changed)
+		return fmt.Errorf("%s changed, a restart is required", strings.Join(changed, ", "))
+	}
+	return nil
+}
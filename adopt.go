@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// runAdopt creates the ownership TXT records of --ownership-owner-id for the orphaned records of the
+// default account, so that external-dns adopts them instead of ignoring them.
+func runAdopt(cfg *config, logger *slog.Logger) int {
+	// orphaned records are owned by no one, and must be listed from INWX rather than a cache
+	cfg.ownershipGuard, cfg.recordsCacheFile, cfg.sharedStore = false, "", nil
+	p := cfg.newProvider(logger)
+	registry := provider.NewOwnershipGuard(cfg.ownershipTXTPrefix, cfg.ownershipOwnerID)
+	ctx := context.Background()
+	orphans, err := p.OrphanedRecords(ctx, registry)
+	if err != nil {
+		logger.Error("failed to list orphaned records", "error", err.Error())
+		return 1
+	}
+	adoptions := registry.AdoptionRecords(orphans)
+	if len(adoptions) == 0 {
+		logger.Info("no orphaned records found")
+		return 0
+	}
+
+	views := []orphanView{}
+	for _, ep := range adoptions {
+		views = append(views, orphanView{Name: ep.DNSName, Type: ep.RecordType, TTL: int64(ep.RecordTTL), Target: strings.Join(ep.Targets, ",")})
+	}
+	if code := printOutput(cfg.output, logger, views, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tTYPE\tTTL\tTARGET")
+		for _, view := range views {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", view.Name, view.Type, view.TTL, view.Target)
+		}
+	}); code != 0 {
+		return code
+	}
+	if cfg.dryRun {
+		logger.Info("dry run, not creating ownership records", "records", len(adoptions), "orphans", len(orphans))
+		return 0
+	}
+	if !cfg.yes && !confirm(fmt.Sprintf("Create these %d ownership records for owner %s?", len(adoptions), cfg.ownershipOwnerID)) {
+		logger.Info("not creating ownership records", "records", len(adoptions))
+		return 1
+	}
+
+	results, err := p.ApplyChangesWithResults(ctx, &plan.Changes{Create: adoptions})
+	if err != nil {
+		logger.Error("failed to create ownership records", "error", err.Error())
+		return 1
+	}
+	failed, code := printChangeResults(cfg.output, logger, results)
+	if code != 0 {
+		return code
+	}
+	if failed > 0 {
+		logger.Error("failed to create ownership records", "failed", failed, "total", len(results))
+		return 1
+	}
+	logger.Info("created ownership records, external-dns adopts the records on its next sync", "records", len(results), "owner", cfg.ownershipOwnerID)
+	return 0
+}
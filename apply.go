@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+type changeResultView struct {
+	Action  string   `json:"action"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Targets []string `json:"targets"`
+	Error   string   `json:"error,omitempty"`
+	// Class is the provider.ErrorClass of Error
+	Class string `json:"class,omitempty"`
+}
+
+type applyErrorView struct {
+	Error   string             `json:"error"`
+	Class   string             `json:"class,omitempty"`
+	Results []changeResultView `json:"results,omitempty"`
+}
+
+// resultsApplier is implemented by the providers of a single and of several accounts.
+type resultsApplier interface {
+	ApplyChangesWithResults(ctx context.Context, changes *plan.Changes) ([]provider.ChangeResult, error)
+}
+
+func runApply(cfg *config, logger *slog.Logger) int {
+	changes, err := readChanges(cfg.changesFile)
+	if err != nil {
+		logger.Error("failed to read change set", "file", cfg.changesFile, "error", err.Error())
+		return 1
+	}
+
+	results, err := cfg.newProvider(logger).ApplyChangesWithResults(context.Background(), changes)
+	if err != nil {
+		logger.Error("failed to apply change set", "error", err.Error())
+		return 1
+	}
+
+	failed, code := printChangeResults(cfg.output, logger, results)
+	if code != 0 {
+		return code
+	}
+	if failed > 0 {
+		logger.Error("failed to apply changes", "failed", failed, "total", len(results))
+		return 1
+	}
+	return 0
+}
+
+// printChangeResults writes the result of every change in the output format, returning the number
+// of failed changes and the exit code of writing them.
+func printChangeResults(output string, logger *slog.Logger, results []provider.ChangeResult) (int, int) {
+	views, failed := changeResultViews(results)
+	return failed, printOutput(output, logger, views, func(w io.Writer) {
+		fmt.Fprintln(w, "ACTION\tNAME\tTYPE\tTARGETS\tRESULT")
+		for _, view := range views {
+			result := "ok"
+			if view.Error != "" {
+				result = view.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", view.Action, view.Name, view.Type, strings.Join(view.Targets, ","), result)
+		}
+	})
+}
+
+// changeResultViews returns the views of results and the number of failed changes.
+func changeResultViews(results []provider.ChangeResult) ([]changeResultView, int) {
+	failed := 0
+	views := []changeResultView{}
+	for _, result := range results {
+		view := changeResultView{Action: result.Action, Name: result.Endpoint.DNSName, Type: result.Endpoint.RecordType, Targets: result.Endpoint.Targets}
+		if result.Err != nil {
+			view.Error, view.Class = result.Err.Error(), provider.ErrorClass(result.Err)
+			failed++
+		}
+		views = append(views, view)
+	}
+	return views, failed
+}
+
+// applyResultsHandler serves the records of next, and applies the changes posted like external-dns
+// expects, with the result of every change in the JSON body of the response if any failed.
+func applyResultsHandler(p resultsApplier, next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		changes, err := decodeChanges(r.Body)
+		if err != nil {
+			logger.Error("failed to decode changes", "error", err.Error())
+			writeApplyError(w, http.StatusBadRequest, applyErrorView{Error: "invalid change set: " + err.Error()}, logger)
+			return
+		}
+		results, err := p.ApplyChangesWithResults(r.Context(), changes)
+		if err != nil {
+			logger.Error("failed to apply changes", "error", err.Error())
+			writeApplyError(w, http.StatusInternalServerError, applyErrorView{Error: err.Error(), Class: provider.ErrorClass(err)}, logger)
+			return
+		}
+		views, failed := changeResultViews(results)
+		if failed > 0 {
+			writeApplyError(w, http.StatusInternalServerError, applyErrorView{Error: fmt.Sprintf("failed to apply %d of %d changes", failed, len(results)), Results: views}, logger)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func writeApplyError(w http.ResponseWriter, status int, view applyErrorView, logger *slog.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(view); err != nil {
+		logger.Error("failed to encode apply results", "error", err.Error())
+	}
+}
+
+// readChanges decodes a change set from path, or from stdin if path is -.
+func readChanges(path string) (*plan.Changes, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+	return decodeChanges(r)
+}
+
+// decodeChanges decodes a change set, rejecting unknown fields and updates without their old endpoints.
+func decodeChanges(r io.Reader) (*plan.Changes, error) {
+	changes := &plan.Changes{}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(changes); err != nil {
+		return nil, err
+	}
+	if len(changes.UpdateOld) != len(changes.UpdateNew) {
+		return nil, errors.New("updateOld and updateNew differ in length")
+	}
+	return changes, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// runCheck validates the credentials, zone access and the --required-permissions of every configured
+// account, returning the exit code.
+func runCheck(cfg *config, logger *slog.Logger) int {
+	api := cfg.apiName()
+
+	code := 0
+	for _, account := range cfg.newAccounts(logger) {
+		zones, err := account.Provider.Zones()
+		if err != nil {
+			logger.Error("check failed", "account", account.Name, "api", api, "error", err.Error())
+			code = 1
+			continue
+		}
+		if len(zones) == 0 {
+			logger.Error("check failed, no zones match the domain filter", "account", account.Name, "api", api)
+			code = 1
+			continue
+		}
+
+		fmt.Fprintf(os.Stdout, "Logged into the INWX %s API as account %s\n", api, account.Name)
+		fmt.Fprintf(os.Stdout, "%d managed zones: %s\n", len(zones), strings.Join(zones, ", "))
+		if len(cfg.requiredPermissions) > 0 {
+			if err := account.Provider.CheckPermissions(cfg.requiredPermissions); err != nil {
+				logger.Error("check failed, the account lacks the required permissions", "account", account.Name, "api", api, "permissions", cfg.requiredPermissions, "error", err.Error())
+				code = 1
+				continue
+			}
+			fmt.Fprintf(os.Stdout, "Permitted to %s records\n", strings.Join(cfg.requiredPermissions, " and "))
+		}
+	}
+	return code
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/orbit-online/external-dns-inwx-webhook/journal"
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"github.com/orbit-online/external-dns-inwx-webhook/sessionstore"
+	"github.com/orbit-online/external-dns-inwx-webhook/sharedcache"
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+	"github.com/orbit-online/external-dns-inwx-webhook/vault"
+	"github.com/prometheus/exporter-toolkit/web"
+	"go.yaml.in/yaml/v3"
+)
+
+const configFileFlag = "config-file"
+
+// Flags that make no sense to set from a configuration file.
+var configFileIgnoredFlags = []string{configFileFlag, envFileFlag, "help", "help-long", "help-man", "completion-bash", "completion-script-bash", "completion-script-zsh", "version"}
+
+// applyConfigFile looks up the configuration file given in args or the environment and installs its
+// values as flag defaults, so that they are overridden by both flags and environment variables.
+func applyConfigFile(app *kingpin.Application, args []string, getenv func(string) string) error {
+	path, err := flagArgValue(app, args, configFileFlag, getenv)
+	if err != nil || path == "" {
+		return err
+	}
+
+	values, err := readConfigFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	if err := setFlagDefaults(app, values); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// flagArgValue returns the value of the named flag as given in args, or else in its environment
+// variable, before the command line is parsed.
+func flagArgValue(app *kingpin.Application, args []string, name string, getenv func(string) string) (string, error) {
+	value := getenv(app.GetFlag(name).Model().Envar)
+	if context, err := app.ParseContext(args); context != nil {
+		for _, element := range context.Elements {
+			if flag, ok := element.Clause.(*kingpin.FlagClause); ok && flag.Model().Name == name && element.Value != nil {
+				value = *element.Value
+			}
+		}
+	} else if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// flagValues returns the values of the global flags of app after parsing, secrets included.
+func flagValues(app *kingpin.Application) map[string]string {
+	values := map[string]string{}
+	for _, flag := range app.Model().Flags {
+		values[flag.Name] = flag.Value.String()
+	}
+	return values
+}
+
+func readConfigFile(path string) (map[string]any, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// setFlagDefaults installs the valid values and reports every problem at once, so that the
+// values installed can be validated along with the rest of the configuration.
+func setFlagDefaults(app *kingpin.Application, values map[string]any) error {
+	errs := []error{}
+	unknown := []string{}
+	defaults := map[*kingpin.FlagClause][]string{}
+	for key, value := range values {
+		flag := app.GetFlag(key)
+		if flag == nil || slices.Contains(configFileIgnoredFlags, key) {
+			unknown = append(unknown, key)
+			continue
+		}
+		flagDefaults, err := configValueStrings(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("key %s: %w", key, err))
+			continue
+		}
+		if cumulative, ok := flag.Model().Value.(interface{ IsCumulative() bool }); len(flagDefaults) > 1 && (!ok || !cumulative.IsCumulative()) {
+			errs = append(errs, fmt.Errorf("key %s: expected a single value, got a list", key))
+			continue
+		}
+		defaults[flag] = flagDefaults
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		errs = append(errs, fmt.Errorf("unknown keys: %s", strings.Join(unknown, ", ")))
+	}
+	for flag, flagDefaults := range defaults {
+		flag.Default(flagDefaults...)
+	}
+	return errors.Join(errs...)
+}
+
+func configValueStrings(value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("missing value")
+	case []any:
+		values := []string{}
+		for _, item := range v {
+			itemValues, err := configValueStrings(item)
+			if err != nil {
+				return nil, err
+			}
+			if len(itemValues) != 1 {
+				return nil, fmt.Errorf("expected a scalar list item, got %v", item)
+			}
+			values = append(values, itemValues...)
+		}
+		return values, nil
+	case map[string]any:
+		return nil, fmt.Errorf("expected a scalar or list, got a mapping")
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
+
+// domainLabel matches a single label of a domain name, allowing internationalized and underscore labels
+// and the slashes of classless reverse zones.
+var domainLabel = regexp.MustCompile(`^[\p{L}\p{N}_]([\p{L}\p{N}_/-]{0,61}[\p{L}\p{N}_])?$`)
+
+// validate checks the resolved values that flag parsing does not, and resolves the snapshot store.
+func (cfg *config) validate() error {
+	errs := []error{}
+	if cfg.tlsConfig != "" {
+		if err := web.Validate(cfg.tlsConfig); err != nil {
+			errs = append(errs, fmt.Errorf("invalid TLS config file %s: %w", cfg.tlsConfig, err))
+		}
+	}
+	if cfg.metricsTLSConfig != "" {
+		if err := web.Validate(cfg.metricsTLSConfig); err != nil {
+			errs = append(errs, fmt.Errorf("invalid metrics TLS config file %s: %w", cfg.metricsTLSConfig, err))
+		}
+	}
+	for flag, domains := range map[string][]string{"domain-filter": cfg.domainFilter, "exclude-domains": cfg.excludeDomains, "zone": cfg.zones, "auto-create-zones-nameserver": cfg.zoneNameservers, "dyndns-hostname": cfg.dyndnsHostnames, "paused-zone": cfg.pausedZones} {
+		for _, domain := range domains {
+			if err := validateDomain(domain); err != nil {
+				errs = append(errs, fmt.Errorf("invalid --%s %q: %w", flag, domain, err))
+			}
+		}
+	}
+	for flag, value := range map[string]string{"inwx-api-url": cfg.apiURL, "inwx-proxy-url": cfg.proxyURL, "pushgateway-url": cfg.pushgatewayURL} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --%s: %w", flag, err))
+		} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid --%s %s: expected an http or https URL", flag, value))
+		}
+	}
+	for flag, addresses := range map[string][]string{"listen-address": cfg.listenAddrs, "metrics-listen-address": cfg.metricsListenAddrs} {
+		if len(addresses) == 0 {
+			errs = append(errs, fmt.Errorf("missing --%s", flag))
+		}
+		for _, address := range addresses {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				errs = append(errs, fmt.Errorf("invalid --%s %q: %w", flag, address, err))
+			}
+		}
+	}
+	if (cfg.dyndnsToken == "") != (len(cfg.dyndnsHostnames) == 0) {
+		errs = append(errs, fmt.Errorf("--dyndns-token and --dyndns-hostname require each other"))
+	}
+	var err error
+	if cfg.clientTLSConfig, err = cfg.newClientTLSConfig(); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.transport.MaxIdleConns < 0 || cfg.transport.MaxConnsPerHost < 0 {
+		errs = append(errs, fmt.Errorf("invalid INWX HTTP connection limits: must not be negative"))
+	}
+	if cfg.accountsFile != "" {
+		if cfg.accountConfigs, err = readAccountsFile(cfg.accountsFile); err != nil {
+			errs = append(errs, fmt.Errorf("invalid accounts file %s: %w", cfg.accountsFile, err))
+		}
+	}
+	if cfg.zoneTemplateFile != "" {
+		if cfg.zoneTemplate, err = readZoneTemplate(cfg.zoneTemplateFile); err != nil {
+			errs = append(errs, fmt.Errorf("invalid zone template %s: %w", cfg.zoneTemplateFile, err))
+		}
+	}
+	if cfg.mockFixtureFile != "" {
+		if err := readYAMLFile(cfg.mockFixtureFile, &cfg.mockFixture); err != nil {
+			errs = append(errs, fmt.Errorf("invalid mock fixture %s: %w", cfg.mockFixtureFile, err))
+		} else if err := provider.NewMockClientWrapper().LoadFixture(cfg.fixture()); err != nil {
+			errs = append(errs, fmt.Errorf("invalid mock fixture %s: %w", cfg.mockFixtureFile, err))
+		}
+	}
+	if cfg.zoneCloneFrom != "" {
+		if err := validateDomain(cfg.zoneCloneFrom); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --auto-create-zones-clone-from %q: %w", cfg.zoneCloneFrom, err))
+		}
+	}
+	if cfg.discoverDomainFilterInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid --discover-domain-filter-interval %s: must be positive", cfg.discoverDomainFilterInterval))
+	}
+	if cfg.manageDNSSECInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid --manage-dnssec-interval %s: must be positive", cfg.manageDNSSECInterval))
+	}
+	if cfg.domainExpiryInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid --domain-expiry-metrics-interval %s: must be positive", cfg.domainExpiryInterval))
+	}
+	if cfg.detectDriftInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid --detect-drift-interval %s: must be positive", cfg.detectDriftInterval))
+	}
+	if cfg.maintenanceRetry <= 0 {
+		errs = append(errs, fmt.Errorf("invalid --maintenance-mode-retry-after %s: must be positive", cfg.maintenanceRetry))
+	}
+	if cfg.reconcileInterval < 0 {
+		errs = append(errs, fmt.Errorf("invalid --reconcile-interval %s: must not be negative", cfg.reconcileInterval))
+	}
+	if cfg.pollMessagesInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid --poll-messages-interval %s: must be positive", cfg.pollMessagesInterval))
+	}
+	if cfg.maxLoginFailures <= 0 {
+		errs = append(errs, fmt.Errorf("invalid --inwx-max-login-failures %d: must be positive", cfg.maxLoginFailures))
+	}
+	if cfg.createConcurrency <= 0 {
+		errs = append(errs, fmt.Errorf("invalid --inwx-create-concurrency %d: must be positive", cfg.createConcurrency))
+	}
+	if cfg.zoneRecordLimit < 0 {
+		errs = append(errs, fmt.Errorf("invalid --zone-record-limit %d: must not be negative", cfg.zoneRecordLimit))
+	}
+	if cfg.retryQueueSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid --retry-queue-size %d: must not be negative", cfg.retryQueueSize))
+	}
+	if cfg.retryQueueInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid --retry-queue-interval %s: must be positive", cfg.retryQueueInterval))
+	}
+	if cfg.maxSyncAPICalls < 0 {
+		errs = append(errs, fmt.Errorf("invalid --max-sync-api-calls %d: must not be negative", cfg.maxSyncAPICalls))
+	}
+	if cfg.maxSyncDuration < 0 {
+		errs = append(errs, fmt.Errorf("invalid --max-sync-duration %s: must not be negative", cfg.maxSyncDuration))
+	}
+	if cfg.dedupWindow < 0 {
+		errs = append(errs, fmt.Errorf("invalid --dedup-window %s: must not be negative", cfg.dedupWindow))
+	}
+	if cfg.maxErrorRatio < 0 || cfg.maxErrorRatio > 1 {
+		errs = append(errs, fmt.Errorf("invalid --max-error-ratio %g: must be between 0 and 1", cfg.maxErrorRatio))
+	}
+	if cfg.defaultTTL < 0 {
+		errs = append(errs, fmt.Errorf("invalid --default-ttl %d: must not be negative", cfg.defaultTTL))
+	}
+	if cfg.deletionGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("invalid --deletion-grace-period %s: must not be negative", cfg.deletionGracePeriod))
+	}
+	if cfg.sessionKeepAlive < 0 {
+		errs = append(errs, fmt.Errorf("invalid --inwx-session-keep-alive-interval %s: must not be negative", cfg.sessionKeepAlive))
+	}
+	if cfg.credentialsSecret != "" {
+		if cfg.vault.Addr != "" {
+			errs = append(errs, fmt.Errorf("--inwx-credentials-secret and --vault-addr are mutually exclusive"))
+		}
+		if err := cfg.parseCredentialsSecret(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --inwx-credentials-secret: %w", err))
+		}
+	}
+	if cfg.vault.Addr != "" {
+		if cfg.vaultSecretPath == "" {
+			errs = append(errs, fmt.Errorf("--vault-addr requires --vault-secret-path"))
+		}
+		if cfg.vaultRefreshInterval < 0 {
+			errs = append(errs, fmt.Errorf("invalid --vault-refresh-interval %s: must not be negative", cfg.vaultRefreshInterval))
+		}
+		if cfg.vault.TLSConfig, err = cfg.newVaultTLSConfig(); err != nil {
+			errs = append(errs, err)
+		} else if err := vault.Check(cfg.vault); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --vault-addr: %w", err))
+		}
+	}
+	for _, location := range cfg.journalSinkLocations {
+		if err := journal.CheckSink(location); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --journal-sink: %w", err))
+		}
+	}
+	for _, header := range cfg.journalSinkHeaders {
+		if name, _, ok := strings.Cut(header, ":"); !ok || strings.TrimSpace(name) == "" {
+			errs = append(errs, fmt.Errorf("invalid --journal-sink-header %q: expected \"Name: value\"", header))
+		}
+	}
+	if cfg.sessionStoreLocation != "" {
+		if !cfg.persistentSession {
+			errs = append(errs, fmt.Errorf("--inwx-session-store requires --inwx-persistent-session"))
+		}
+		if err := sessionstore.Check(cfg.sessionStoreLocation, cfg.sessionStoreKey); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --inwx-session-store: %w", err))
+		}
+	}
+	if cfg.sharedCacheURL != "" {
+		if _, err := newCATLSConfig("shared-cache-ca-file", cfg.sharedCacheCAFile); err != nil {
+			errs = append(errs, err)
+		}
+		if err := sharedcache.Check(cfg.sharedCacheURL); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --shared-cache-url: %w", err))
+		}
+		if cfg.sharedCacheTTL <= 0 {
+			errs = append(errs, fmt.Errorf("invalid --shared-cache-ttl %s: must be positive", cfg.sharedCacheTTL))
+		}
+	}
+	if faults := cfg.mockFaults; faults.ErrorRate < 0 || faults.RateLimitRate < 0 || faults.ErrorRate+faults.RateLimitRate > 1 {
+		errs = append(errs, fmt.Errorf("invalid mock fault rates: must not be negative or sum up to more than 1"))
+	}
+	if cfg.from < 0 || cfg.to < 0 || (cfg.to > 0 && cfg.to < cfg.from) {
+		errs = append(errs, fmt.Errorf("invalid journal range %d to %d", cfg.from, cfg.to))
+	}
+	if cfg.snapshotBeforeApply {
+		if err := snapshot.CheckStore(cfg.snapshotLocation); err != nil {
+			errs = append(errs, fmt.Errorf("invalid --snapshot-location: %w", err))
+		}
+	}
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// newClients constructs the clients of the credential sources and stores checked by validate. It is
+// called once the command runs, so that validating the configuration connects to nothing.
+func (cfg *config) newClients() error {
+	var err error
+	if cfg.credentialsSecret != "" {
+		if err = cfg.newSecretClient(); err != nil {
+			return fmt.Errorf("failed to set up --inwx-credentials-secret: %w", err)
+		}
+	}
+	if cfg.vault.Addr != "" {
+		if cfg.vaultClient, err = vault.New(cfg.vault); err != nil {
+			return fmt.Errorf("invalid --vault-addr: %w", err)
+		}
+	}
+	if cfg.sessionStoreLocation != "" {
+		if cfg.sessionStore, err = sessionstore.New(cfg.sessionStoreLocation, cfg.sessionStoreKey); err != nil {
+			return fmt.Errorf("failed to set up --inwx-session-store: %w", err)
+		}
+	}
+	if cfg.sharedCacheURL != "" {
+		tlsConfig, err := newCATLSConfig("shared-cache-ca-file", cfg.sharedCacheCAFile)
+		if err != nil {
+			return err
+		}
+		if cfg.sharedStore, err = sharedcache.New(cfg.sharedCacheURL, tlsConfig); err != nil {
+			return fmt.Errorf("invalid --shared-cache-url: %w", err)
+		}
+	}
+	if cfg.snapshotBeforeApply {
+		if cfg.snapshots, err = snapshot.NewStore(cfg.snapshotLocation, cfg.snapshotS3); err != nil {
+			return fmt.Errorf("invalid --snapshot-location: %w", err)
+		}
+	}
+	return nil
+}
+
+// reuseClients takes over the clients of current, the configuration in use, on reload. The settings
+// they are constructed from require a restart to change.
+func (cfg *config) reuseClients(current *config) {
+	cfg.secretClient, cfg.credentialsSecretNamespace = current.secretClient, current.credentialsSecretNamespace
+	cfg.vaultClient = current.vaultClient
+	cfg.sessionStore = current.sessionStore
+	cfg.sharedStore = current.sharedStore
+	cfg.snapshots = current.snapshots
+}
+
+// readCredentials replaces the credentials of the default account with those of Vault or the
+// Secret of --inwx-credentials-secret, if either is configured.
+func (cfg *config) readCredentials(ctx context.Context) error {
+	if cfg.providerName == fakeProvider {
+		return nil
+	}
+	if cfg.vaultClient != nil {
+		return cfg.readVaultCredentials(ctx)
+	}
+	if cfg.secretClient != nil {
+		return cfg.readSecretCredentials(ctx)
+	}
+	return nil
+}
+
+// metricsWebConfig returns the web config file of the metrics listener, that of both listeners unless
+// the metrics listener has one of its own.
+func (cfg *config) metricsWebConfig() string {
+	if cfg.metricsTLSConfig != "" {
+		return cfg.metricsTLSConfig
+	}
+	return cfg.tlsConfig
+}
+
+func (cfg *config) newClientTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.tlsMinVersion == "1.3" {
+		config.MinVersion = tls.VersionTLS13
+	}
+	if cfg.caFile == "" {
+		return config, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	content, err := os.ReadFile(cfg.caFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --inwx-ca-file: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("invalid --inwx-ca-file %s: no PEM certificates found", cfg.caFile)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+func (cfg *config) newVaultTLSConfig() (*tls.Config, error) {
+	return newCATLSConfig("vault-ca-file", cfg.vaultCAFile)
+}
+
+// newCATLSConfig returns a TLS configuration trusting the PEM bundle of CA certificates at path, given
+// by --<flag>, in addition to the system ones.
+func newCATLSConfig(flag string, path string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if path == "" {
+		return config, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --%s: %w", flag, err)
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("invalid --%s %s: no PEM certificates found", flag, path)
+	}
+	config.RootCAs = pool
+	return config, nil
+}
+
+func readZoneTemplate(path string) ([]provider.TemplateRecord, error) {
+	records := []provider.TemplateRecord{}
+	if err := readYAMLFile(path, &records); err != nil {
+		return nil, err
+	}
+	for i, rec := range records {
+		if rec.Type == "" || rec.Content == "" {
+			return nil, fmt.Errorf("record %d: missing type or content", i+1)
+		}
+	}
+	return records, nil
+}
+
+// readYAMLFile decodes a YAML or JSON file into v, rejecting unknown fields.
+func readYAMLFile(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	return decoder.Decode(v)
+}
+
+// validateDomain accepts domain names with an optional leading dot, as supported by domain filters.
+func validateDomain(domain string) error {
+	name := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(domain), "."), ".")
+	if name == "" {
+		return fmt.Errorf("empty domain")
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("longer than 253 characters")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !domainLabel.MatchString(label) {
+			return fmt.Errorf("invalid label %q", label)
+		}
+	}
+	return nil
+}
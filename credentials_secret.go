@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/kubesecret"
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+)
+
+// parseCredentialsSecret resolves the namespace and name of --inwx-credentials-secret, the namespace
+// being empty for the namespace of the pod.
+func (cfg *config) parseCredentialsSecret() error {
+	namespace, name, found := strings.Cut(cfg.credentialsSecret, "/")
+	if !found {
+		namespace, name = "", namespace
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("expected namespace/name or the name of a Secret, got %s", cfg.credentialsSecret)
+	}
+	cfg.credentialsSecretNamespace, cfg.credentialsSecretName = namespace, name
+	return nil
+}
+
+// newSecretClient resolves the client of the Kubernetes API reading --inwx-credentials-secret with
+// the service account of the pod, along with the namespace of the pod if the secret has none.
+func (cfg *config) newSecretClient() error {
+	config, err := kubesecret.InClusterConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.credentialsSecretNamespace == "" {
+		if cfg.credentialsSecretNamespace, err = kubesecret.PodNamespace(); err != nil {
+			return err
+		}
+	}
+	cfg.secretClient = kubesecret.New(config)
+	return nil
+}
+
+// readSecretCredentials replaces the credentials of the default account with those of the Secret of
+// --inwx-credentials-secret.
+func (cfg *config) readSecretCredentials(ctx context.Context) error {
+	secret, found, err := cfg.secretClient.Get(ctx, cfg.credentialsSecretNamespace, cfg.credentialsSecretName)
+	if err != nil {
+		return fmt.Errorf("failed to read the INWX credentials Secret: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("the INWX credentials Secret %s/%s does not exist", cfg.credentialsSecretNamespace, cfg.credentialsSecretName)
+	}
+	cfg.username, cfg.password, err = cfg.secretCredentials(secret)
+	return err
+}
+
+// secretCredentials returns the credentials of secret, --inwx-username if it holds no username.
+func (cfg *config) secretCredentials(secret *kubesecret.Secret) (string, string, error) {
+	password := string(secret.Data[cfg.credentialsSecretPasswordKey])
+	if password == "" {
+		return "", "", fmt.Errorf("the INWX credentials Secret %s/%s has no password %s", secret.Namespace, secret.Name, cfg.credentialsSecretPasswordKey)
+	}
+	username := string(secret.Data[cfg.credentialsSecretUsernameKey])
+	if username == "" {
+		username = cfg.username
+	}
+	return username, password, nil
+}
+
+// watchCredentialsSecret watches the Secret of --inwx-credentials-secret until ctx is done, replacing
+// the credentials of the default account as soon as the Secret is changed. The credentials in use
+// are kept while the Secret is deleted or invalid.
+func watchCredentialsSecret(ctx context.Context, cfg *config, accounts []provider.Account, logger *slog.Logger) error {
+	p := defaultProvider(accounts)
+	if p == nil {
+		return nil
+	}
+	username, password := cfg.username, cfg.password
+	logger = logger.With("secret", cfg.credentialsSecretNamespace+"/"+cfg.credentialsSecretName)
+	cfg.secretClient.Watch(ctx, cfg.credentialsSecretNamespace, cfg.credentialsSecretName, func(secret *kubesecret.Secret) {
+		if secret == nil {
+			logger.Warn("the INWX credentials Secret was deleted, keeping the credentials in use")
+			return
+		}
+		newUsername, newPassword, err := cfg.secretCredentials(secret)
+		if err != nil {
+			logger.Warn("invalid INWX credentials Secret, keeping the credentials in use", "err", err)
+			return
+		}
+		if newUsername == username && newPassword == password {
+			return
+		}
+		username, password = newUsername, newPassword
+		logger.Info("the INWX credentials Secret changed, logging in with the new credentials", "resourceVersion", secret.ResourceVersion)
+		p.SetCredentials(username, password)
+	}, func(err error) {
+		logger.Warn("failed to watch the INWX credentials Secret, watching it again", "err", err)
+	})
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+// redacted replaces the values of secrets in the configuration dump.
+const redacted = "<redacted>"
+
+// secretFlagWords mark the flags holding secrets by a word of their name.
+var secretFlagWords = []string{"password", "username", "token", "secret", "store-key", "sink-header"}
+
+type accountView struct {
+	Name           string   `json:"name"`
+	Tenant         string   `json:"tenant,omitempty"`
+	Username       string   `json:"username"`
+	Password       string   `json:"password"`
+	Sandbox        bool     `json:"sandbox"`
+	DomainFilter   []string `json:"domainFilter"`
+	ExcludeDomains []string `json:"excludeDomains"`
+	Zones          []string `json:"zones"`
+}
+
+type configView struct {
+	Flags    map[string]any `json:"flags"`
+	Accounts []accountView  `json:"accounts"`
+}
+
+// resolvedFlags returns the values of the global flags of app after parsing, as merged from the
+// command line, the environment, the env file and the config file, with secrets redacted.
+func resolvedFlags(app *kingpin.Application) map[string]any {
+	flags := map[string]any{}
+	for _, flag := range app.Model().Flags {
+		if flag.Hidden || flag.Name == "help" || flag.Name == "version" {
+			continue
+		}
+		var value any = flag.Value.String()
+		if getter, ok := flag.Value.(kingpin.Getter); ok {
+			value = getter.Get()
+		}
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case string:
+			value = redactValue(flag.Name, v)
+		case *[]string:
+			// the values of repeatable flags
+			values := []string{}
+			for _, s := range *v {
+				values = append(values, redactValue(flag.Name, s))
+			}
+			value = values
+		}
+		flags[flag.Name] = value
+	}
+	return flags
+}
+
+// redactValue redacts the values of secret flags and the passwords of URLs.
+func redactValue(name string, value string) string {
+	if value == "" {
+		return value
+	}
+	for _, word := range secretFlagWords {
+		if strings.Contains(name, word) {
+			return redacted
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return value
+}
+
+// configHandler answers the configuration of current, the configuration last loaded, as JSON with
+// the credentials redacted.
+func configHandler(current func() *config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		cfg := current()
+		view := configView{Flags: cfg.resolved, Accounts: []accountView{}}
+		for _, account := range cfg.accountConfigs {
+			view.Accounts = append(view.Accounts, accountView{
+				Name:           account.Name,
+				Tenant:         account.Tenant,
+				Username:       redactValue("username", account.Username),
+				Password:       redactValue("password", account.Password),
+				Sandbox:        account.Sandbox,
+				DomainFilter:   account.DomainFilter,
+				ExcludeDomains: account.ExcludeDomains,
+				Zones:          account.Zones,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(view)
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// The ANSI escape sequences coloring the differences.
+const (
+	colorRemoved = "\x1b[31m"
+	colorAdded   = "\x1b[32m"
+	colorReset   = "\x1b[0m"
+)
+
+type diffView struct {
+	Action   string           `json:"action"`
+	Record   snapshot.Record  `json:"record"`
+	Previous *snapshot.Record `json:"previous,omitempty"`
+}
+
+// runDiff prints the differences of a zone from the desired state of a zone file or of a JSON array
+// of endpoints, and returns 1 if there are differences and 2 on failure, like diff(1).
+func runDiff(cfg *config, logger *slog.Logger) int {
+	content, err := readFileArg(cfg.zoneFile)
+	if err != nil {
+		logger.Error("failed to read desired state", "path", cfg.zoneFile, "error", err.Error())
+		return 2
+	}
+	p := cfg.newProvider(logger)
+	var records []snapshot.Record
+	if trimmed := bytes.TrimSpace(content); bytes.HasPrefix(trimmed, []byte("[")) {
+		endpoints := []*endpoint.Endpoint{}
+		if err := json.Unmarshal(trimmed, &endpoints); err != nil {
+			logger.Error("failed to decode endpoints", "path", cfg.zoneFile, "error", err.Error())
+			return 2
+		}
+		records = p.EndpointRecords(cfg.zone, endpoints)
+	} else if records, err = parseZoneFile(content, cfg.zone); err != nil {
+		logger.Error("failed to parse zone file", "path", cfg.zoneFile, "error", err.Error())
+		return 2
+	}
+
+	operations, err := p.DiffZone(cfg.zone, records, cfg.onlyListed)
+	if err != nil {
+		logger.Error("failed to compare zone", "zone", cfg.zone, "error", err.Error())
+		return 2
+	}
+	views := []diffView{}
+	for _, op := range operations {
+		views = append(views, diffView{Action: op.Action, Record: op.Record, Previous: op.Previous})
+	}
+	path := cfg.zoneFile
+	if path == "" {
+		path = "(standard input)"
+	}
+	if cfg.output == "json" {
+		if printOutput("json", logger, views, nil) != 0 {
+			return 2
+		}
+	} else if err := printDiff(os.Stdout, cfg.zone, path, views, useColor(cfg.color)); err != nil {
+		logger.Error("failed to write output", "error", err.Error())
+		return 2
+	}
+	if len(views) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printDiff writes the differences in the style of a unified diff, the records removed from the zone
+// prefixed by - and the ones added by +, an update removing the record before and adding the one after.
+func printDiff(out io.Writer, zone string, path string, views []diffView, color bool) error {
+	if len(views) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "--- %s (INWX)\n+++ %s\n", zone, path)
+	line := func(sign string, code string, rec snapshot.Record) {
+		name := rec.Name
+		if name == "" {
+			name = "@"
+		}
+		content := rec.Content
+		if rec.Priority != 0 || rec.Type == "MX" || rec.Type == "SRV" {
+			content = fmt.Sprintf("%d %s", rec.Priority, content)
+		}
+		text := fmt.Sprintf("%s %s\t%d\tIN\t%s\t%s", sign, name, rec.TTL, rec.Type, content)
+		if color {
+			text = code + text + colorReset
+		}
+		fmt.Fprintln(w, text)
+	}
+	for _, view := range views {
+		switch view.Action {
+		case "create":
+			line("+", colorAdded, view.Record)
+		case "delete":
+			line("-", colorRemoved, view.Record)
+		case "update":
+			line("-", colorRemoved, *view.Previous)
+			line("+", colorAdded, view.Record)
+		}
+	}
+	return w.Flush()
+}
+
+// useColor reports whether to color the output for the --color flag, auto coloring a terminal.
+func useColor(flag string) bool {
+	switch flag {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == ""
+}
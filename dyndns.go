@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	edprovider "sigs.k8s.io/external-dns/provider"
+)
+
+// dyndnsHandler answers DynDNS updates of the configured hostnames in the dyndns2 protocol spoken by
+// most routers: hostname and myip are comma-separated lists, myip defaulting to the address of the
+// client, and every hostname is answered on its own line with good, nochg, nohost, notfqdn or 911.
+// Clients authenticate with the token as bearer token or as the password of basic authentication.
+func dyndnsHandler(p edprovider.Provider, token string, hostnames []string, logger *slog.Logger) http.Handler {
+	allowed := []string{}
+	for _, hostname := range hostnames {
+		allowed = append(allowed, strings.ToLower(strings.TrimSuffix(hostname, ".")))
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if !dyndnsAuthorized(r, token) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dyndns"`)
+			http.Error(w, "badauth", http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query()
+		addrs, err := dyndnsAddrs(query.Get("myip"), r.RemoteAddr)
+		if err != nil {
+			http.Error(w, "911 "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		addrList := []string{}
+		for _, addr := range addrs {
+			addrList = append(addrList, addr.String())
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, hostname := range strings.Split(query.Get("hostname"), ",") {
+			hostname = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+			switch {
+			case !strings.Contains(hostname, "."):
+				fmt.Fprintln(w, "notfqdn")
+			case !slices.Contains(allowed, hostname):
+				logger.Warn("refusing DynDNS update of a hostname not configured", "hostname", hostname)
+				fmt.Fprintln(w, "nohost")
+			default:
+				changed, err := provider.UpdateAddresses(r.Context(), p, hostname, addrs)
+				switch {
+				case err != nil && provider.ErrorClass(err) == "no_zone":
+					logger.Error("no managed zone for DynDNS hostname", "hostname", hostname, "error", err.Error())
+					fmt.Fprintln(w, "nohost")
+				case err != nil:
+					logger.Error("failed to apply DynDNS update", "hostname", hostname, "addresses", addrList, "error", err.Error())
+					fmt.Fprintln(w, "911")
+				case changed:
+					logger.Info("applied DynDNS update", "hostname", hostname, "addresses", addrList)
+					fmt.Fprintln(w, "good", strings.Join(addrList, ","))
+				default:
+					fmt.Fprintln(w, "nochg", strings.Join(addrList, ","))
+				}
+			}
+		}
+	})
+}
+
+func dyndnsAuthorized(r *http.Request, token string) bool {
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if _, password, ok := r.BasicAuth(); ok {
+		given = password
+	}
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// dyndnsAddrs parses the comma-separated addresses of myip, or the address of the client if empty.
+func dyndnsAddrs(myip string, remoteAddr string) ([]netip.Addr, error) {
+	if myip == "" {
+		host, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			return nil, err
+		}
+		myip = host
+	}
+	addrs := []netip.Addr{}
+	for _, value := range strings.Split(myip, ",") {
+		addr, err := netip.ParseAddr(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q", value)
+		}
+		addrs = append(addrs, addr.Unmap())
+	}
+	return addrs, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// e2eTTL is the TTL of the records of the end-to-end test, the lowest INWX accepts.
+const e2eTTL = 300
+
+type e2eStepView struct {
+	Step  string `json:"step"`
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+// e2eRecords returns the records of every type tested below base, at version 1 or 2 of their targets.
+func e2eRecords(base string, version int) []*endpoint.Endpoint {
+	a := "a." + base
+	targets := map[string][2]string{
+		endpoint.RecordTypeA:     {"192.0.2.1", "192.0.2.2"},
+		endpoint.RecordTypeAAAA:  {"2001:db8::1", "2001:db8::2"},
+		endpoint.RecordTypeCNAME: {a, "aaaa." + base},
+		endpoint.RecordTypeTXT:   {"external-dns-inwx e2e test 1", "external-dns-inwx e2e test 2"},
+		endpoint.RecordTypeMX:    {"10 " + a, "20 " + a},
+		endpoint.RecordTypeSRV:   {"10 5 5060 " + a, "10 5 5061 " + a},
+		endpoint.RecordTypeNS:    {"ns.inwx.de", "ns2.inwx.de"},
+	}
+	endpoints := []*endpoint.Endpoint{}
+	for _, recordType := range slices.Sorted(func(yield func(string) bool) {
+		for recordType := range targets {
+			if !yield(recordType) {
+				return
+			}
+		}
+	}) {
+		name := strings.ToLower(recordType) + "." + base
+		if recordType == endpoint.RecordTypeSRV {
+			name = "_e2e._tcp." + base
+		}
+		endpoints = append(endpoints, endpoint.NewEndpointWithTTL(name, recordType, e2eTTL, targets[recordType][version-1]))
+	}
+	return endpoints
+}
+
+// runE2ETest creates, reads back, updates and deletes a throwaway record of every type in a zone,
+// through the same code as the webhook, and reports every step. Remaining records are deleted at the end.
+func runE2ETest(cfg *config, logger *slog.Logger) int {
+	if !cfg.sandbox && cfg.apiURL == "" && cfg.providerName != fakeProvider && !cfg.allowProduction {
+		logger.Error("refusing to test against the INWX production API, set --inwx-sandbox or --allow-production")
+		return 1
+	}
+	// test the API itself, without the caches and guards in front of it
+	cfg.zones, cfg.domainFilter, cfg.excludeDomains = []string{cfg.zone}, []string{cfg.zone}, nil
+	cfg.recordsCacheFile, cfg.sharedStore, cfg.snapshots, cfg.ownershipGuard, cfg.readOnly = "", nil, nil, false, false
+	p := cfg.newProvider(logger)
+
+	token := make([]byte, 4)
+	_, _ = rand.Read(token)
+	base := "e2e-" + hex.EncodeToString(token) + "." + cfg.zone
+	v1, v2 := e2eRecords(base, 1), e2eRecords(base, 2)
+	logger.Info("running end-to-end test", "api", cfg.apiName(), "zone", cfg.zone, "records", base)
+
+	views := []e2eStepView{}
+	failed := 0
+	report := func(step string, ep *endpoint.Endpoint, err error) {
+		view := e2eStepView{Step: step, Type: ep.RecordType, Name: ep.DNSName}
+		if err != nil {
+			view.Error = err.Error()
+			failed++
+		}
+		views = append(views, view)
+	}
+	apply := func(step string, changes *plan.Changes) {
+		results, err := p.ApplyChangesWithResults(context.Background(), changes)
+		if err != nil {
+			for _, ep := range slices.Concat(changes.Create, changes.UpdateNew, changes.Delete) {
+				report(step, ep, err)
+			}
+			return
+		}
+		for _, result := range results {
+			report(step, result.Endpoint, result.Err)
+		}
+	}
+	verify := func(step string, want []*endpoint.Endpoint, present bool) {
+		records, err := p.Records(context.Background())
+		for _, ep := range want {
+			if err == nil {
+				err = e2eVerify(records, ep, present)
+			}
+			report(step, ep, err)
+		}
+	}
+
+	apply("create", &plan.Changes{Create: v1})
+	verify("read", v1, true)
+	apply("update", &plan.Changes{UpdateOld: v1, UpdateNew: v2})
+	verify("read-updated", v2, true)
+	apply("delete", &plan.Changes{Delete: v2})
+	verify("read-deleted", v2, false)
+	if failed > 0 {
+		cleanupE2ERecords(p, base, logger)
+	}
+
+	if code := printOutput(cfg.output, logger, views, func(w io.Writer) {
+		fmt.Fprintln(w, "STEP\tTYPE\tNAME\tRESULT")
+		for _, view := range views {
+			result := "pass"
+			if view.Error != "" {
+				result = "FAIL: " + view.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", view.Step, view.Type, view.Name, result)
+		}
+	}); code != 0 {
+		return code
+	}
+	if failed > 0 {
+		logger.Error("end-to-end test failed", "failed", failed, "steps", len(views))
+		return 1
+	}
+	logger.Info("end-to-end test passed", "steps", len(views))
+	return 0
+}
+
+// e2eVerify checks that the records of ep are present with its targets or absent.
+func e2eVerify(records []*endpoint.Endpoint, ep *endpoint.Endpoint, present bool) error {
+	targets := []string{}
+	for _, rec := range records {
+		if rec.DNSName == ep.DNSName && rec.RecordType == ep.RecordType {
+			for _, target := range rec.Targets {
+				targets = append(targets, strings.Trim(target, `"`))
+			}
+		}
+	}
+	switch {
+	case !present && len(targets) > 0:
+		return fmt.Errorf("still present with %s", strings.Join(targets, ", "))
+	case present && len(targets) == 0:
+		return errors.New("not found")
+	case present && !slices.Equal(targets, ep.Targets):
+		return fmt.Errorf("read back %s instead of %s", strings.Join(targets, ", "), strings.Join(ep.Targets, ", "))
+	}
+	return nil
+}
+
+// cleanupE2ERecords deletes the records below base left by failed steps.
+func cleanupE2ERecords(p *provider.INWXProvider, base string, logger *slog.Logger) {
+	records, err := p.Records(context.Background())
+	if err != nil {
+		logger.Error("failed to list records left by the end-to-end test, delete the records below the name manually", "name", base, "error", err.Error())
+		return
+	}
+	left := []*endpoint.Endpoint{}
+	for _, rec := range records {
+		if strings.HasSuffix(rec.DNSName, "."+base) {
+			left = append(left, rec)
+		}
+	}
+	if len(left) == 0 {
+		return
+	}
+	if err := p.ApplyChanges(context.Background(), &plan.Changes{Delete: left}); err != nil {
+		logger.Error("failed to delete records left by the end-to-end test, delete the records below the name manually", "name", base, "error", err.Error())
+		return
+	}
+	logger.Info("deleted records left by the end-to-end test", "records", len(left))
+}
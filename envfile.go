@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+const envFileFlag = "env-file"
+
+var envFileKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envFileValues returns the variables of the env file given in args or the environment, if any.
+func envFileValues(app *kingpin.Application, args []string) (map[string]string, error) {
+	path, err := flagArgValue(app, args, envFileFlag, os.Getenv)
+	if err != nil || path == "" {
+		return nil, err
+	}
+	values, err := readEnvFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// applyEnvFile installs the env file values of flag environment variables as flag defaults, so that they
+// take precedence over the configuration file but not over flags and the environment. Other variables,
+// such as the AWS credentials of the snapshot store, are exported to the environment unless already set.
+func applyEnvFile(app *kingpin.Application, values map[string]string) error {
+	flags := map[string]*kingpin.FlagClause{}
+	for _, model := range app.Model().Flags {
+		if model.Envar != "" {
+			flags[model.Envar] = app.GetFlag(model.Name)
+		}
+	}
+	errs := []error{}
+	for key, value := range values {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if flag, ok := flags[key]; ok {
+			flag.Default(strings.Split(value, "\n")...)
+		} else if err := os.Setenv(key, value); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readEnvFile parses KEY=VALUE lines in the common dotenv format: blank lines and lines starting with #
+// are skipped, an export prefix is allowed, and values may be single quoted (literally) or double quoted
+// (with Go escapes, e.g. \n separating the values of a repeatable flag).
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || !envFileKey.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case strings.HasPrefix(value, `"`):
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid double quoted value: %w", n, err)
+			}
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
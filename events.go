@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+)
+
+// eventsHeartbeat is the interval of the comments keeping idle event streams open through proxies.
+const eventsHeartbeat = 30 * time.Second
+
+// eventsHandler streams the change events of broker as server-sent events to clients authenticating
+// with token as bearer token, e.g. dashboards and chatops bots. Every event is a change event with
+// the ChangeEvent JSON as data, optionally filtered by the account and result query parameters.
+func eventsHandler(broker *provider.EventBroker, token string, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		account, result := r.URL.Query().Get("account"), r.URL.Query().Get("result")
+		if result != "" && result != provider.EventApplied && result != provider.EventFailed {
+			http.Error(w, fmt.Sprintf("invalid result %q: expected %s or %s", result, provider.EventApplied, provider.EventFailed), http.StatusBadRequest)
+			return
+		}
+
+		events, unsubscribe := broker.Subscribe()
+		defer unsubscribe()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// keeps nginx from buffering the stream
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		logger.Debug("event stream subscribed", "remote", r.RemoteAddr, "account", account, "result", result)
+
+		heartbeat := time.NewTicker(eventsHeartbeat)
+		defer heartbeat.Stop()
+		for id := 1; ; {
+			select {
+			case <-r.Context().Done():
+				logger.Debug("event stream closed", "remote", r.RemoteAddr)
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case e := <-events:
+				if (account != "" && e.Account != account) || (result != "" && e.Result != result) {
+					continue
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: change\nid: %d\ndata: %s\n\n", id, data); err != nil {
+					return
+				}
+				id++
+			}
+			flusher.Flush()
+		}
+	})
+}
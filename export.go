@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+	"github.com/orbit-online/external-dns-inwx-webhook/zonefile"
+)
+
+func runExportZone(cfg *config, logger *slog.Logger) int {
+	records, err := cfg.newProvider(logger).ZoneRecords(cfg.zone)
+	if err != nil {
+		logger.Error("failed to export zone", "zone", cfg.zone, "error", err.Error())
+		return 1
+	}
+
+	zoneRecords := []zonefile.Record{}
+	for _, rec := range records {
+		zoneRecords = append(zoneRecords, zonefile.Record{Name: rec.Name, Type: rec.Type, TTL: rec.TTL, Priority: rec.Priority, Content: rec.Content})
+	}
+	fmt.Fprintf(os.Stdout, "; zone %s exported from INWX at %s\n", cfg.zone, time.Now().UTC().Format(time.RFC3339))
+	if err := zonefile.Write(os.Stdout, cfg.zone, zoneRecords); err != nil {
+		logger.Error("failed to write zone file", "zone", cfg.zone, "error", err.Error())
+		return 1
+	}
+	return 0
+}
+
+func runCloneZone(cfg *config, logger *slog.Logger) int {
+	rewrites, err := cfg.newProvider(logger).CloneZone(cfg.zone, cfg.targetZone, cfg.rewrite)
+	if err != nil {
+		logger.Error("failed to clone zone", "zone", cfg.zone, "target", cfg.targetZone, "error", err.Error())
+		return 1
+	}
+	if len(rewrites) == 0 {
+		return 0
+	}
+
+	return printOutput("table", logger, nil, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tTYPE\tBEFORE\tAFTER")
+		for _, rewrite := range rewrites {
+			name := rewrite.Record.Name
+			if name == "" {
+				name = "@"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, rewrite.Record.Type, rewrite.Before, rewrite.Record.Content)
+		}
+	})
+}
+
+func runImportZone(cfg *config, logger *slog.Logger) int {
+	content, err := readFileArg(cfg.zoneFile)
+	if err != nil {
+		logger.Error("failed to read zone file", "path", cfg.zoneFile, "error", err.Error())
+		return 1
+	}
+	records, err := parseZoneFile(content, cfg.zone)
+	if err != nil {
+		logger.Error("failed to parse zone file", "path", cfg.zoneFile, "error", err.Error())
+		return 1
+	}
+	operations, err := cfg.newProvider(logger).ImportZone(cfg.zone, records, cfg.dryRun)
+	if err != nil {
+		logger.Error("failed to import zone file", "zone", cfg.zone, "path", cfg.zoneFile, "error", err.Error())
+		return 1
+	}
+	if len(operations) == 0 {
+		logger.Info("zone already matches zone file", "zone", cfg.zone, "path", cfg.zoneFile)
+		return 0
+	}
+	return printRestoreOperations(logger, operations)
+}
+
+// readFileArg reads the file of a path argument, the standard input if the path is not set.
+func readFileArg(path string) ([]byte, error) {
+	if path == "" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// parseZoneFile returns the records of zone in a zone file.
+func parseZoneFile(content []byte, zone string) ([]snapshot.Record, error) {
+	zoneRecords, err := zonefile.Parse(bytes.NewReader(content), zone)
+	if err != nil {
+		return nil, err
+	}
+	records := []snapshot.Record{}
+	for _, rec := range zoneRecords {
+		records = append(records, snapshot.Record{Name: rec.Name, Type: rec.Type, TTL: rec.TTL, Priority: rec.Priority, Content: rec.Content})
+	}
+	return records, nil
+}
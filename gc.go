@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+type orphanView struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	TTL    int64  `json:"ttl"`
+	Target string `json:"target"`
+}
+
+// runGC deletes the records of the default account without an ownership TXT record, once or every
+// --interval until interrupted.
+func runGC(cfg *config, logger *slog.Logger) int {
+	if cfg.interval > 0 && !cfg.dryRun && !cfg.yes {
+		logger.Error("refusing to delete orphaned records periodically without confirmation, set --yes or --dry-run")
+		return 1
+	}
+	// orphaned records are owned by no one, and must be listed from INWX rather than a cache
+	cfg.ownershipGuard, cfg.recordsCacheFile, cfg.sharedStore = false, "", nil
+	p := cfg.newProvider(logger)
+	registry := provider.NewOwnershipGuard(cfg.ownershipTXTPrefix, cfg.ownershipOwnerID)
+	if cfg.interval == 0 {
+		return collectGarbage(context.Background(), cfg, p, registry, logger)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+	for {
+		collectGarbage(ctx, cfg, p, registry, logger)
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectGarbage prints the orphaned records and deletes them unless this is a dry run or the
+// deletion is not confirmed, returning the exit code.
+func collectGarbage(ctx context.Context, cfg *config, p *provider.INWXProvider, registry *provider.OwnershipGuard, logger *slog.Logger) int {
+	orphans, err := p.OrphanedRecords(ctx, registry)
+	if err != nil {
+		logger.Error("failed to list orphaned records", "error", err.Error())
+		return 1
+	}
+	if len(orphans) == 0 {
+		logger.Info("no orphaned records found")
+		return 0
+	}
+
+	views := []orphanView{}
+	for _, ep := range orphans {
+		views = append(views, orphanView{Name: ep.DNSName, Type: ep.RecordType, TTL: int64(ep.RecordTTL), Target: strings.Join(ep.Targets, ",")})
+	}
+	if code := printOutput(cfg.output, logger, views, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tTYPE\tTTL\tTARGET")
+		for _, view := range views {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", view.Name, view.Type, view.TTL, view.Target)
+		}
+	}); code != 0 {
+		return code
+	}
+	if cfg.dryRun {
+		logger.Info("dry run, not deleting orphaned records", "records", len(orphans))
+		return 0
+	}
+	if !cfg.yes && !confirm(fmt.Sprintf("Delete these %d records?", len(orphans))) {
+		logger.Info("not deleting orphaned records", "records", len(orphans))
+		return 1
+	}
+
+	results, err := p.ApplyChangesWithResults(ctx, &plan.Changes{Delete: orphans})
+	if err != nil {
+		logger.Error("failed to delete orphaned records", "error", err.Error())
+		return 1
+	}
+	failed, code := printChangeResults(cfg.output, logger, results)
+	if code != 0 {
+		return code
+	}
+	if failed > 0 {
+		logger.Error("failed to delete orphaned records", "failed", failed, "total", len(results))
+		return 1
+	}
+	logger.Info("deleted orphaned records", "records", len(results))
+	return 0
+}
+
+// confirm asks question on stderr and reports whether it is answered with yes on stdin.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
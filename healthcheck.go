@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// runHealthcheck probes the metrics server of a webhook running with the same configuration on its
+// first listen address, returning the exit code. It writes to stderr only, keeping container health logs short.
+func runHealthcheck(cfg *config) int {
+	// the listen addresses are validated by loadConfig
+	host, port, _ := net.SplitHostPort(cfg.metricsListenAddrs[0])
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http"
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if webConfig := cfg.metricsWebConfig(); webConfig != "" && servesTLS(webConfig) {
+		// The certificate is not issued for the loopback address we connect to, and we only probe ourselves.
+		scheme = "https"
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402
+	}
+	client := &http.Client{Transport: transport, Timeout: cfg.timeout}
+
+	for _, path := range cfg.checkPaths {
+		url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, port), path)
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", url, err)
+			return 1
+		}
+		if cfg.healthcheckUsername != "" {
+			req.SetBasicAuth(cfg.healthcheckUsername, cfg.healthcheckPassword)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", url, err)
+			return 1
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", url, resp.Status)
+			return 1
+		}
+	}
+	return 0
+}
+
+// servesTLS tells whether the web config file enables TLS rather than only basic auth. A file that
+// cannot be read is assumed to, as it does unless it is a basic auth only config.
+func servesTLS(webConfig string) bool {
+	content, err := os.ReadFile(webConfig)
+	if err != nil {
+		return true
+	}
+	config := struct {
+		TLSServerConfig map[string]any `yaml:"tls_server_config"`
+	}{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return true
+	}
+	return len(config.TLSServerConfig) > 0
+}
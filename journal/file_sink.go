@@ -0,0 +1,122 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultMaxSize    = 100 << 20
+	defaultMaxBackups = 5
+)
+
+// fileSink appends the entries to a file, one JSON object per line, renaming it to path.1 once it
+// exceeds maxSize and keeping maxBackups rotated files, path.1 being the newest.
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	mu         sync.Mutex
+}
+
+func newFileSink(u *url.URL) (*fileSink, error) {
+	if u.Path == "" {
+		return nil, fmt.Errorf("missing path in journal sink %s", redactURL(u))
+	}
+	s := &fileSink{path: u.Path, maxSize: defaultMaxSize, maxBackups: defaultMaxBackups}
+	query := u.Query()
+	if value := query.Get("max-size"); value != "" {
+		size, err := parseSize(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max-size %q of journal sink %s: %w", value, redactURL(u), err)
+		}
+		s.maxSize = size
+	}
+	if value := query.Get("max-backups"); value != "" {
+		backups, err := strconv.Atoi(value)
+		if err != nil || backups < 0 {
+			return nil, fmt.Errorf("invalid max-backups %q of journal sink %s: expected a number of files", value, redactURL(u))
+		}
+		s.maxBackups = backups
+	}
+	return s, nil
+}
+
+func (s *fileSink) String() string {
+	return "file://" + s.path
+}
+
+func (s *fileSink) Ship(_ context.Context, e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(s.path); err == nil && info.Size() > 0 && info.Size()+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", s.path, err)
+		}
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close does nothing, as the file is only open while shipping.
+func (s *fileSink) Close() error {
+	return nil
+}
+
+// rotate shifts path.N to path.N+1, dropping the oldest file, and renames the file to path.1.
+func (s *fileSink) rotate() error {
+	if s.maxBackups == 0 {
+		return os.Remove(s.path)
+	}
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(s.backup(i), s.backup(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(s.path, s.backup(1))
+}
+
+func (s *fileSink) backup(i int) string {
+	return s.path + "." + strconv.Itoa(i)
+}
+
+// parseSize parses a size in bytes with an optional K, M or G suffix of powers of 1024.
+func parseSize(value string) (int64, error) {
+	shift := 0
+	switch {
+	case strings.HasSuffix(value, "K"):
+		shift = 10
+	case strings.HasSuffix(value, "M"):
+		shift = 20
+	case strings.HasSuffix(value, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		value = value[:len(value)-1]
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("expected a positive number of bytes, optionally with a K, M or G suffix")
+	}
+	return size << shift, nil
+}
@@ -0,0 +1,74 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// httpSink posts every entry as a JSON object to an endpoint, e.g. the HTTP event collector of a
+// SIEM. Credentials of the URL are sent as basic auth.
+type httpSink struct {
+	url      string
+	redacted string
+	username string
+	password string
+	headers  http.Header
+	client   *http.Client
+}
+
+func newHTTPSink(u *url.URL, headers http.Header) *httpSink {
+	s := &httpSink{redacted: redactURL(u), headers: headers, client: &http.Client{}}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+	}
+	endpoint := *u
+	endpoint.User = nil
+	s.url = endpoint.String()
+	return s
+}
+
+func (s *httpSink) String() string {
+	return s.redacted
+}
+
+func (s *httpSink) Ship(ctx context.Context, e Entry) error {
+	content, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	for name, values := range s.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package journal keeps an append-only log of the record changes applied to INWX, one JSON object per line,
+// and ships the entries to external sinks.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+)
+
+// Actions of journal entries.
+const (
+	Create = "create"
+	Update = "update"
+	Delete = "delete"
+)
+
+// Entry is a record change applied to a zone.
+type Entry struct {
+	// Seq numbers the entries of a journal from 1
+	Seq  int       `json:"seq"`
+	Time time.Time `json:"time"`
+	Zone string    `json:"zone"`
+	// Action is one of create, update or delete
+	Action string `json:"action"`
+	// Record is the record created or the record updated to, nil for deletions
+	Record *snapshot.Record `json:"record,omitempty"`
+	// Previous is the record updated or deleted, nil for creations and if the record was unknown
+	Previous *snapshot.Record `json:"previous,omitempty"`
+	// Redacted is set if the record content is replaced by its hash, so that the entry cannot be replayed
+	Redacted bool `json:"redacted,omitempty"`
+	// Account is the INWX account of the journal, only set in the entries shipped to sinks
+	Account string `json:"account,omitempty"`
+}
+
+// Invert returns the entry undoing e: creations become deletions and vice versa, updates are reversed.
+func (e Entry) Invert() Entry {
+	switch e.Action {
+	case Create:
+		e.Action = Delete
+	case Delete:
+		e.Action = Create
+	}
+	e.Record, e.Previous = e.Previous, e.Record
+	return e
+}
+
+// Journal appends entries to a file and ships them to the sinks of a Shipper, if set. Entries are
+// numbered in order of appending.
+type Journal struct {
+	path string
+	mu   sync.Mutex
+	// seq is the number of the last entry, -1 until read from the file
+	seq     int
+	shipper *Shipper
+	account string
+}
+
+// New returns the journal of the file at path, which is created on the first entry appended. Without a
+// path, entries are only shipped and numbered from 1 on every start.
+func New(path string) *Journal {
+	return &Journal{path: path, seq: -1}
+}
+
+// ShipTo ships the entries appended from now on with s, marked as changes of account.
+func (j *Journal) ShipTo(s *Shipper, account string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.shipper, j.account = s, account
+}
+
+// Path returns the path of the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Append numbers e, stamps it with the current time unless set and appends it to the journal.
+func (j *Journal) Append(e *Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.seq < 0 {
+		entries, err := Read(j.path, 0, 0)
+		if err != nil {
+			return err
+		}
+		j.seq = 0
+		if len(entries) > 0 {
+			j.seq = entries[len(entries)-1].Seq
+		}
+	}
+	e.Seq = j.seq + 1
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if j.path != "" {
+		if err := j.write(e); err != nil {
+			return err
+		}
+	}
+	j.seq = e.Seq
+	if j.shipper != nil {
+		shipped := *e
+		shipped.Account = j.account
+		j.shipper.enqueue(shipped)
+	}
+	return nil
+}
+
+func (j *Journal) write(e *Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns the entries of the journal file at path numbered from from to to, both included;
+// a bound of 0 leaves the range open. A missing file has no entries.
+func Read(path string, from, to int) ([]Entry, error) {
+	entries := []Entry{}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if (from == 0 || e.Seq >= from) && (to == 0 || e.Seq <= to) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
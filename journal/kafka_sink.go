@@ -0,0 +1,103 @@
+package journal
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+const (
+	kafkaClientID    = "external-dns-inwx-webhook"
+	kafkaDefaultPort = "9092"
+)
+
+// kafkaSink produces every entry as a record of a Kafka topic, keyed by zone so that the changes of a
+// zone stay in order. The client looks up the partition leaders itself and follows them when they move.
+type kafkaSink struct {
+	brokers []string
+	topic   string
+	tls     bool
+	opts    []kgo.Opt
+	// client is the client of opts, started by start
+	client *kgo.Client
+}
+
+func newKafkaSink(u *url.URL) (*kafkaSink, error) {
+	s := &kafkaSink{topic: strings.Trim(u.Path, "/"), tls: u.Scheme == "kafka+tls"}
+	for _, broker := range strings.Split(u.Host, ",") {
+		if broker == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			broker = net.JoinHostPort(broker, kafkaDefaultPort)
+		}
+		s.brokers = append(s.brokers, broker)
+	}
+	if len(s.brokers) == 0 || s.topic == "" || strings.Contains(s.topic, "/") {
+		return nil, fmt.Errorf("expected kafka://broker[,broker...]/topic, got %s", redactURL(u))
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(s.brokers...),
+		kgo.DefaultProduceTopic(s.topic),
+		kgo.ClientID(kafkaClientID),
+	}
+	switch acks := u.Query().Get("acks"); acks {
+	case "", "all", "-1":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "1":
+		// idempotent writes require the acknowledgement of all in-sync replicas
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	default:
+		return nil, fmt.Errorf("invalid acks %q of journal sink %s: expected all or 1", acks, redactURL(u))
+	}
+	if s.tls {
+		// the client sets the server name of every broker dialed
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		opts = append(opts, kgo.SASL(plain.Auth{User: u.User.Username(), Pass: password}.AsMechanism()))
+	}
+	s.opts = opts
+	return s, nil
+}
+
+func (s *kafkaSink) start() error {
+	client, err := kgo.NewClient(s.opts...)
+	if err != nil {
+		return fmt.Errorf("journal sink %s: %w", s, err)
+	}
+	s.client = client
+	return nil
+}
+
+func (s *kafkaSink) String() string {
+	scheme := "kafka"
+	if s.tls {
+		scheme += "+tls"
+	}
+	return scheme + "://" + strings.Join(s.brokers, ",") + "/" + s.topic
+}
+
+func (s *kafkaSink) Ship(ctx context.Context, e Entry) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	record := &kgo.Record{Key: []byte(e.Zone), Value: value, Timestamp: e.Time}
+	return s.client.ProduceSync(ctx, record).FirstErr()
+}
+
+func (s *kafkaSink) Close() error {
+	if s.client != nil {
+		s.client.Close()
+	}
+	return nil
+}
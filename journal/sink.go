@@ -0,0 +1,192 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// shipQueueSize is the number of entries a sink may fall behind before entries are dropped
+	shipQueueSize = 1000
+	// shipAttempts is the number of attempts to ship an entry to a sink before it is dropped
+	shipAttempts = 3
+	// shipRetry is the pause after the first failed attempt, doubling with every further one
+	shipRetry = time.Second
+	// shipTimeout bounds every attempt to ship an entry
+	shipTimeout = 10 * time.Second
+)
+
+// Sink ships journal entries to an external system, e.g. the SIEM of an organization.
+type Sink interface {
+	Ship(ctx context.Context, e Entry) error
+	// String describes the sink in logs, without credentials
+	String() string
+	// Close releases the connections of the sink once no more entries are shipped
+	Close() error
+}
+
+// SinkOptions configures the sinks of NewSink.
+type SinkOptions struct {
+	// Headers are sent with every request of HTTP sinks, e.g. an Authorization header of the SIEM
+	Headers http.Header
+	// Hostname is the host name of syslog messages, the host name of the machine if empty
+	Hostname string
+}
+
+// NewSink returns the sink of location:
+//   - file:///path[?max-size=100M&max-backups=5] appends the entries to a file rotated by size
+//   - syslog://host:port, syslog+tcp:// or syslog+tls:// sends RFC 5424 messages, over UDP by default
+//   - http:// or https:// posts every entry as JSON, credentials of the URL sent as basic auth
+//   - kafka://broker[,broker...]/topic or kafka+tls:// produces the entries to a Kafka topic keyed
+//     by zone, credentials of the URL authenticating with SASL PLAIN
+func NewSink(location string, options SinkOptions) (Sink, error) {
+	sink, err := parseSink(location, options)
+	if err != nil {
+		return nil, err
+	}
+	// the other sinks only connect when shipping
+	if s, ok := sink.(*kafkaSink); ok {
+		if err := s.start(); err != nil {
+			return nil, err
+		}
+	}
+	return sink, nil
+}
+
+// CheckSink reports the problems of location as NewSink does, without starting a client of the sink,
+// e.g. when validating the configuration.
+func CheckSink(location string) error {
+	_, err := parseSink(location, SinkOptions{})
+	return err
+}
+
+func parseSink(location string, options SinkOptions) (Sink, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return newFileSink(u)
+	case "syslog", "syslog+udp", "syslog+tcp", "syslog+tls":
+		return newSyslogSink(u, options.Hostname)
+	case "http", "https":
+		return newHTTPSink(u, options.Headers), nil
+	case "kafka", "kafka+tls":
+		return newKafkaSink(u)
+	}
+	return nil, fmt.Errorf("unsupported journal sink %s, expected a file://, syslog://, http(s):// or kafka:// URL", redactURL(u))
+}
+
+// Shipper ships the entries appended to journals to sinks in the background, so that a slow or
+// unreachable sink does not delay the changes. Every sink has a queue of its own; entries are dropped
+// once a sink falls too far behind or keeps failing, and reported to failed.
+type Shipper struct {
+	queues []sinkQueue
+	failed func(sink Sink, e Entry, err error)
+	wg     sync.WaitGroup
+	// mu guards closed, set by Close, after which entries are no longer queued
+	mu     sync.RWMutex
+	closed bool
+}
+
+type sinkQueue struct {
+	sink    Sink
+	entries chan Entry
+}
+
+// NewShipper starts shipping to sinks, reporting the entries dropped to failed, if set.
+func NewShipper(sinks []Sink, failed func(sink Sink, e Entry, err error)) *Shipper {
+	s := &Shipper{failed: failed}
+	for _, sink := range sinks {
+		queue := sinkQueue{sink: sink, entries: make(chan Entry, shipQueueSize)}
+		s.queues = append(s.queues, queue)
+		s.wg.Go(func() {
+			for e := range queue.entries {
+				s.ship(sink, e)
+			}
+		})
+	}
+	return s
+}
+
+func (s *Shipper) ship(sink Sink, e Entry) {
+	var err error
+	for attempt := range shipAttempts {
+		if attempt > 0 {
+			time.Sleep(shipRetry << (attempt - 1))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), shipTimeout)
+		err = sink.Ship(ctx, e)
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+	if s.failed != nil {
+		s.failed(sink, e, err)
+	}
+}
+
+// enqueue queues e for every sink, dropping it for sinks whose queue is full.
+func (s *Shipper) enqueue(e Entry) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	for _, queue := range s.queues {
+		select {
+		case queue.entries <- e:
+		default:
+			if s.failed != nil {
+				s.failed(queue.sink, e, fmt.Errorf("the sink is %d entries behind", shipQueueSize))
+			}
+		}
+	}
+}
+
+// Close ships the entries queued, waits until they are shipped or ctx is done and closes the sinks.
+func (s *Shipper) Close(ctx context.Context) error {
+	s.mu.Lock()
+	first := !s.closed
+	if first {
+		s.closed = true
+		for _, queue := range s.queues {
+			close(queue.entries)
+		}
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	errs := []error{}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("entries left to ship to the journal sinks: %w", ctx.Err()))
+	}
+	if first {
+		for _, queue := range s.queues {
+			if err := queue.sink.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("failed to close journal sink %s: %w", queue.sink, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// redactURL returns u without its password and query, which may hold credentials.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.RawQuery = ""
+	return strings.TrimSuffix(redacted.Redacted(), "?")
+}
@@ -0,0 +1,144 @@
+package journal
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// syslogAppName is the APP-NAME of the messages
+	syslogAppName = "external-dns-inwx-webhook"
+	// syslogMsgID is the MSGID of the messages, identifying them as record changes
+	syslogMsgID = "record-change"
+	// syslogSeverity is the severity of the messages, notice
+	syslogSeverity = 5
+	// defaultSyslogFacility is local0
+	defaultSyslogFacility = 16
+)
+
+// syslogFacilities are the facility keywords accepted by the facility query parameter.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "daemon": 3, "auth": 4, "syslog": 5, "authpriv": 10,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogSink sends every entry as an RFC 5424 message, the entry as JSON being the message, over UDP
+// or over TCP or TLS with octet-counting framing (RFC 6587). Stream connections are kept open and
+// dialed again after an error.
+type syslogSink struct {
+	network  string
+	tls      bool
+	addr     string
+	hostname string
+	facility int
+	mu       sync.Mutex
+	conn     net.Conn
+}
+
+func newSyslogSink(u *url.URL, hostname string) (*syslogSink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in journal sink %s", redactURL(u))
+	}
+	s := &syslogSink{network: "udp", addr: u.Host, hostname: hostname, facility: defaultSyslogFacility}
+	switch u.Scheme {
+	case "syslog+tcp":
+		s.network = "tcp"
+	case "syslog+tls":
+		s.network, s.tls = "tcp", true
+	}
+	if u.Port() == "" {
+		port := "514"
+		if s.tls {
+			port = "6514"
+		}
+		s.addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	if facility := u.Query().Get("facility"); facility != "" {
+		var ok bool
+		if s.facility, ok = syslogFacilities[facility]; !ok {
+			return nil, fmt.Errorf("invalid facility %q of journal sink %s", facility, redactURL(u))
+		}
+	}
+	if s.hostname == "" {
+		s.hostname, _ = os.Hostname()
+	}
+	if s.hostname == "" {
+		s.hostname = "-"
+	}
+	return s, nil
+}
+
+func (s *syslogSink) String() string {
+	scheme := "syslog"
+	if s.tls {
+		scheme += "+tls"
+	} else if s.network == "tcp" {
+		scheme += "+tcp"
+	}
+	return scheme + "://" + s.addr
+}
+
+func (s *syslogSink) Ship(ctx context.Context, e Entry) error {
+	message, err := s.message(e)
+	if err != nil {
+		return err
+	}
+	if s.network == "tcp" {
+		message = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if s.conn, err = s.dial(ctx); err != nil {
+			return err
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	}
+	if _, err := s.conn.Write(message); err != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// message formats e as an RFC 5424 message without structured data.
+func (s *syslogSink) message(e Entry) ([]byte, error) {
+	content, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ", s.facility*8+syslogSeverity, e.Time.UTC().Format(time.RFC3339Nano), s.hostname, syslogAppName, os.Getpid(), syslogMsgID)
+	return append([]byte(header), content...), nil
+}
+
+func (s *syslogSink) dial(ctx context.Context) (net.Conn, error) {
+	if s.tls {
+		host, _, _ := net.SplitHostPort(s.addr)
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+		return dialer.DialContext(ctx, s.network, s.addr)
+	}
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, s.network, s.addr)
+}
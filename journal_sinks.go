@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/journal"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// journalShipTimeout bounds shipping the entries left when a one-shot command ends.
+const journalShipTimeout = 30 * time.Second
+
+var journalEntriesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "external_dns_inwx",
+	Name:      "journal_entries_dropped_total",
+	Help:      "The journal entries not shipped to a journal sink, as it kept failing or fell behind, by sink.",
+}, []string{"sink"})
+
+// newJournal returns the journal of account at path shipping to the sinks of --journal-sink, nil if
+// there is neither a path nor a sink.
+func (cfg *config) newJournal(path string, account string) *journal.Journal {
+	if path == "" && len(cfg.journalSinks) == 0 {
+		return nil
+	}
+	j := journal.New(path)
+	if len(cfg.journalSinks) > 0 {
+		if cfg.journalShipper == nil {
+			logger := cfg.newLogger()
+			cfg.journalShipper = journal.NewShipper(cfg.journalSinks, func(sink journal.Sink, e journal.Entry, err error) {
+				journalEntriesDropped.WithLabelValues(sink.String()).Inc()
+				logger.Error("failed to ship journal entry", "sink", sink.String(), "account", e.Account, "seq", e.Seq, "zone", e.Zone, "action", e.Action, "error", err.Error())
+			})
+		}
+		j.ShipTo(cfg.journalShipper, account)
+	}
+	return j
+}
+
+// openJournalSinks opens the sinks of --journal-sink, checked by loadConfig. It is called once the
+// command runs, so that loading the configuration, e.g. on reload, connects to no sink.
+func (cfg *config) openJournalSinks() error {
+	for _, location := range cfg.journalSinkLocations {
+		sink, err := journal.NewSink(location, journal.SinkOptions{Headers: cfg.journalSinkHeader()})
+		if err != nil {
+			return fmt.Errorf("invalid --journal-sink: %w", err)
+		}
+		cfg.journalSinks = append(cfg.journalSinks, sink)
+	}
+	return nil
+}
+
+// closeJournalShipper ships the journal entries left and closes the sinks, if any were opened.
+func (cfg *config) closeJournalShipper(logger *slog.Logger) {
+	if cfg.journalShipper == nil {
+		// no journal was started, e.g. by a command listing records
+		for _, sink := range cfg.journalSinks {
+			_ = sink.Close()
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), journalShipTimeout)
+	defer cancel()
+	if err := cfg.journalShipper.Close(ctx); err != nil {
+		logger.Error("failed to ship journal entries", "error", err.Error())
+	}
+}
+
+// journalSinkHeader returns the headers of --journal-sink-header.
+func (cfg *config) journalSinkHeader() http.Header {
+	header := http.Header{}
+	for _, value := range cfg.journalSinkHeaders {
+		if name, value, ok := strings.Cut(value, ":"); ok {
+			header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+	return header
+}
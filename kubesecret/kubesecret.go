@@ -0,0 +1,309 @@
+// Package kubesecret reads, writes and watches Kubernetes Secrets through the Kubernetes API, with
+// the service account of the pod when running in a cluster.
+package kubesecret
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// serviceAccountDir holds the token, the CA certificate and the namespace of the pod
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount/"
+	// requestTimeout bounds the requests other than watches
+	requestTimeout = 30 * time.Second
+	// watchTimeout is how long the API server keeps a watch open before it is opened again
+	watchTimeout = 5 * time.Minute
+	// watchRetry is the pause before a failed watch is opened again
+	watchRetry = 5 * time.Second
+)
+
+// Config configures the access to the Kubernetes API.
+type Config struct {
+	// API is the URL of the Kubernetes API, e.g. https://10.0.0.1:443
+	API string
+	// TLSConfig configures the TLS connections to the API, e.g. with the CA of the cluster, if set
+	TLSConfig *tls.Config
+	// TokenFile is the bearer token of the requests, read for every request as it is rotated
+	TokenFile string
+}
+
+// Secret is a Secret of the Kubernetes API.
+type Secret struct {
+	Name            string
+	Namespace       string
+	ResourceVersion string
+	Data            map[string][]byte
+}
+
+type secretObject struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Metadata   objectMeta        `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string][]byte `json:"data"`
+}
+
+type objectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type secretList struct {
+	Metadata objectMeta     `json:"metadata"`
+	Items    []secretObject `json:"items"`
+}
+
+type watchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Client is a minimal client of the Kubernetes API that only handles Secrets.
+type Client struct {
+	config Config
+	http   *http.Client
+}
+
+// New returns the client of config.
+func New(config Config) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config.TLSConfig
+	return &Client{config: config, http: &http.Client{Transport: transport}}
+}
+
+// InClusterConfig returns the configuration of the service account of the pod.
+func InClusterConfig() (Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return Config{}, fmt.Errorf("the Kubernetes API is only reachable in a pod, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "ca.crt")
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read the CA certificate of the cluster: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return Config{}, fmt.Errorf("invalid CA certificate %sca.crt", serviceAccountDir)
+	}
+	return Config{
+		API:       "https://" + net.JoinHostPort(host, port),
+		TLSConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		TokenFile: serviceAccountDir + "token",
+	}, nil
+}
+
+// PodNamespace returns the namespace of the pod.
+func PodNamespace() (string, error) {
+	content, err := os.ReadFile(serviceAccountDir + "namespace")
+	if err != nil {
+		return "", fmt.Errorf("failed to read the namespace of the pod: %w", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// Get returns the Secret name of namespace, false if it does not exist.
+func (c *Client) Get(ctx context.Context, namespace string, name string) (*Secret, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	status, content, err := c.do(ctx, http.MethodGet, secretPath(namespace, name), "", nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if status == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if status != http.StatusOK {
+		return nil, false, statusError(http.MethodGet, namespace, name, status, content)
+	}
+	object := secretObject{}
+	if err := json.Unmarshal(content, &object); err != nil {
+		return nil, false, fmt.Errorf("invalid Secret %s/%s: %w", namespace, name, err)
+	}
+	return object.secret(), true, nil
+}
+
+// Patch merges data into the data of the Secret name of namespace, false if it does not exist.
+func (c *Client) Patch(ctx context.Context, namespace string, name string, data map[string][]byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	patch, err := json.Marshal(map[string]any{"data": data})
+	if err != nil {
+		return false, err
+	}
+	status, content, err := c.do(ctx, http.MethodPatch, secretPath(namespace, name), "application/merge-patch+json", patch)
+	if err != nil {
+		return false, err
+	}
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	if status != http.StatusOK {
+		return false, statusError(http.MethodPatch, namespace, name, status, content)
+	}
+	return true, nil
+}
+
+// Create creates the Opaque Secret name of namespace holding data.
+func (c *Client) Create(ctx context.Context, namespace string, name string, data map[string][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	created, err := json.Marshal(secretObject{APIVersion: "v1", Kind: "Secret", Metadata: objectMeta{Name: name, Namespace: namespace}, Type: "Opaque", Data: data})
+	if err != nil {
+		return err
+	}
+	status, content, err := c.do(ctx, http.MethodPost, "/api/v1/namespaces/"+url.PathEscape(namespace)+"/secrets", "application/json", created)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return statusError(http.MethodPost, namespace, name, status, content)
+	}
+	return nil
+}
+
+// Watch calls changed with the Secret name of namespace whenever it is created or changed, and with
+// nil when it is deleted, until ctx is done. Failed watches are logged by failed, if set, and opened
+// again after a pause. The service account needs the list and watch verbs on Secrets.
+func (c *Client) Watch(ctx context.Context, namespace string, name string, changed func(*Secret), failed func(error)) {
+	resourceVersion := ""
+	for ctx.Err() == nil {
+		var err error
+		if resourceVersion, err = c.watch(ctx, namespace, name, resourceVersion, changed); err != nil && ctx.Err() == nil {
+			if failed != nil {
+				failed(err)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(watchRetry):
+			}
+		}
+	}
+}
+
+// watch lists the Secret if resourceVersion is empty and watches it from the version listed, returning
+// the version last seen when the watch ends, empty if the watch expired and the Secret must be listed again.
+func (c *Client) watch(ctx context.Context, namespace string, name string, resourceVersion string, changed func(*Secret)) (string, error) {
+	selector := "fieldSelector=" + url.QueryEscape("metadata.name="+name)
+	if resourceVersion == "" {
+		listCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+		status, content, err := c.do(listCtx, http.MethodGet, "/api/v1/namespaces/"+url.PathEscape(namespace)+"/secrets?"+selector, "", nil)
+		if err != nil {
+			return "", err
+		}
+		if status != http.StatusOK {
+			return "", statusError("LIST", namespace, name, status, content)
+		}
+		list := secretList{}
+		if err := json.Unmarshal(content, &list); err != nil {
+			return "", fmt.Errorf("invalid Secret list of %s: %w", namespace, err)
+		}
+		if len(list.Items) == 0 {
+			changed(nil)
+		} else {
+			changed(list.Items[0].secret())
+		}
+		resourceVersion = list.Metadata.ResourceVersion
+	}
+
+	path := fmt.Sprintf("/api/v1/namespaces/%s/secrets?%s&watch=true&allowWatchBookmarks=true&resourceVersion=%s&timeoutSeconds=%d", url.PathEscape(namespace), selector, url.QueryEscape(resourceVersion), int(watchTimeout.Seconds()))
+	req, err := c.newRequest(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return resourceVersion, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		content, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusGone {
+			return "", nil
+		}
+		return resourceVersion, statusError("WATCH", namespace, name, resp.StatusCode, content)
+	}
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		event := watchEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return resourceVersion, nil
+			}
+			return resourceVersion, err
+		}
+		object := secretObject{}
+		if event.Type == "ERROR" {
+			// the version watched from expired, e.g. 410 Gone after a long disconnect
+			return "", nil
+		}
+		if err := json.Unmarshal(event.Object, &object); err != nil {
+			return resourceVersion, fmt.Errorf("invalid watch event of Secret %s/%s: %w", namespace, name, err)
+		}
+		resourceVersion = object.Metadata.ResourceVersion
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			changed(object.secret())
+		case "DELETED":
+			changed(nil)
+		}
+	}
+}
+
+func (o secretObject) secret() *Secret {
+	return &Secret{Name: o.Metadata.Name, Namespace: o.Metadata.Namespace, ResourceVersion: o.Metadata.ResourceVersion, Data: o.Data}
+}
+
+func secretPath(namespace string, name string) string {
+	return "/api/v1/namespaces/" + url.PathEscape(namespace) + "/secrets/" + url.PathEscape(name)
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, contentType string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.config.API, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.config.TokenFile != "" {
+		token, err := os.ReadFile(c.config.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, contentType string, body []byte) (int, []byte, error) {
+	req, err := c.newRequest(ctx, method, path, contentType, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	content, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, content, err
+}
+
+func statusError(method string, namespace string, name string, status int, content []byte) error {
+	return fmt.Errorf("%s Secret %s/%s: unexpected status %d: %s", method, namespace, name, status, strings.TrimSpace(string(content)))
+}
@@ -0,0 +1,121 @@
+package kubesecret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeAPI lists a Secret and streams the events of events to the first watch, then expires the
+// version watched from.
+type fakeAPI struct {
+	mu      sync.Mutex
+	events  []string
+	watches []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path != "/api/v1/namespaces/dns/secrets" || r.URL.Query().Get("fieldSelector") != "metadata.name=inwx" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.URL.Query().Get("watch") != "true" {
+		_, _ = fmt.Fprint(w, `{"metadata":{"resourceVersion":"1"},"items":[{"metadata":{"name":"inwx","namespace":"dns","resourceVersion":"1"},"data":{"password":"b25l"}}]}`)
+		return
+	}
+	f.watches = append(f.watches, r.URL.Query().Get("resourceVersion"))
+	if len(f.watches) > 1 {
+		w.WriteHeader(http.StatusGone)
+		return
+	}
+	for _, event := range f.events {
+		_, _ = fmt.Fprintln(w, event)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	api := &fakeAPI{events: []string{
+		`{"type":"MODIFIED","object":{"metadata":{"name":"inwx","namespace":"dns","resourceVersion":"2"},"data":{"password":"dHdv"}}}`,
+		`{"type":"BOOKMARK","object":{"metadata":{"resourceVersion":"3"}}}`,
+		`{"type":"DELETED","object":{"metadata":{"name":"inwx","namespace":"dns","resourceVersion":"4"}}}`,
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+	client := New(Config{API: server.URL})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	passwords := []string{}
+	client.Watch(ctx, "dns", "inwx", func(secret *Secret) {
+		if secret == nil {
+			passwords = append(passwords, "<deleted>")
+		} else {
+			passwords = append(passwords, string(secret.Data["password"]))
+		}
+		if len(passwords) == 4 {
+			cancel()
+		}
+	}, func(err error) { t.Errorf("unexpected watch failure: %s", err) })
+
+	assert.Equal(t, []string{"one", "two", "<deleted>", "one"}, passwords, "the Secret is listed again once the version watched from expired")
+	assert.Equal(t, []string{"1", "4"}, api.watches[:2])
+}
+
+func TestGetPatchCreate(t *testing.T) {
+	secrets := map[string]map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer", r.Header.Get("Authorization")[:6])
+		object := secretObject{}
+		_ = json.NewDecoder(r.Body).Decode(&object)
+		switch r.Method {
+		case http.MethodPost:
+			secrets[object.Metadata.Name] = object.Data
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPatch:
+			data, ok := secrets["inwx"]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			for key, value := range object.Data {
+				data[key] = value
+			}
+		case http.MethodGet:
+			data, ok := secrets["inwx"]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(secretObject{Metadata: objectMeta{Name: "inwx", Namespace: "dns"}, Data: data})
+		}
+	}))
+	defer server.Close()
+	tokenFile := t.TempDir() + "/token"
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("token"), 0o600))
+	client := New(Config{API: server.URL, TokenFile: tokenFile})
+
+	_, found, err := client.Get(context.TODO(), "dns", "inwx")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	found, err = client.Patch(context.TODO(), "dns", "inwx", map[string][]byte{"a": []byte("1")})
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.NoError(t, client.Create(context.TODO(), "dns", "inwx", map[string][]byte{"a": []byte("1")}))
+	found, err = client.Patch(context.TODO(), "dns", "inwx", map[string][]byte{"b": []byte("2")})
+	assert.NoError(t, err)
+	assert.True(t, found)
+	secret, found, err := client.Get(context.TODO(), "dns", "inwx")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("2")}, secret.Data)
+}
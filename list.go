@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+)
+
+type zoneView struct {
+	Zone    string `json:"zone"`
+	Type    string `json:"type"`
+	Managed bool   `json:"managed"`
+}
+
+type recordView struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"prio,omitempty"`
+}
+
+func runListZones(cfg *config, logger *slog.Logger) int {
+	zones, err := cfg.newProvider(logger).ListZones()
+	if err != nil {
+		logger.Error("failed to list zones", "error", err.Error())
+		return 1
+	}
+
+	views := []zoneView{}
+	for _, zone := range zones {
+		views = append(views, zoneView{Zone: zone.Name, Type: zone.Type, Managed: zone.Managed})
+	}
+	return printOutput(cfg.output, logger, views, func(w io.Writer) {
+		fmt.Fprintln(w, "ZONE\tTYPE\tMANAGED")
+		for _, view := range views {
+			fmt.Fprintf(w, "%s\t%s\t%t\n", view.Zone, view.Type, view.Managed)
+		}
+	})
+}
+
+func runListRecords(cfg *config, logger *slog.Logger) int {
+	records, err := cfg.newProvider(logger).ZoneRecords(cfg.zone)
+	if err != nil {
+		logger.Error("failed to list records", "zone", cfg.zone, "error", err.Error())
+		return 1
+	}
+
+	views := []recordView{}
+	for _, rec := range records {
+		views = append(views, recordView{ID: rec.ID, Name: rec.Name, Type: rec.Type, Content: rec.Content, TTL: rec.TTL, Priority: rec.Priority})
+	}
+	return printOutput(cfg.output, logger, views, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tTYPE\tTTL\tPRIO\tCONTENT")
+		for _, view := range views {
+			name := view.Name
+			if name == "" {
+				name = "@"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%s\n", view.ID, name, view.Type, view.TTL, view.Priority, view.Content)
+		}
+	})
+}
+
+// printOutput writes v to stdout as JSON, or as the table written by table, returning the exit code.
+func printOutput(output string, logger *slog.Logger, v any, table func(w io.Writer)) int {
+	if output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(v); err != nil {
+			logger.Error("failed to encode output", "error", err.Error())
+			return 1
+		}
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	table(w)
+	if err := w.Flush(); err != nil {
+		logger.Error("failed to write output", "error", err.Error())
+		return 1
+	}
+	return 0
+}
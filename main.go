@@ -1,14 +1,29 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/orbit-online/external-dns-inwx-webhook/journal"
+	"github.com/orbit-online/external-dns-inwx-webhook/kubesecret"
 	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"github.com/orbit-online/external-dns-inwx-webhook/sessionstore"
+	"github.com/orbit-online/external-dns-inwx-webhook/sharedcache"
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+	"github.com/orbit-online/external-dns-inwx-webhook/vault"
 	"github.com/prometheus/client_golang/prometheus"
 	cversion "github.com/prometheus/client_golang/prometheus/collectors/version"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -17,71 +32,809 @@ import (
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
 	"golang.org/x/sync/errgroup"
+	edprovider "sigs.k8s.io/external-dns/provider"
 	webhook "sigs.k8s.io/external-dns/provider/webhook/api"
 )
 
-var (
+// config holds the resolved values of all flags.
+type config struct {
+	listenAddrs        []string
+	metricsListenAddrs []string
+	tlsConfig          string
+	metricsTLSConfig   string
+	configFile         string
+	envFile            string
+	accountsFile       string
+	// resolved are the values of the global flags with secrets redacted, resolved by loadConfig
+	resolved map[string]any
+	// flagValues are the values of the global flags as strings, compared by reloads
+	flagValues       map[string]string
+	adminToken       string
+	dyndnsToken      string
+	eventsToken      string
+	maintenance      bool
+	maintenanceRetry time.Duration
+	pushgatewayURL   string
+	pushgatewayJob   string
+	dyndnsHostnames  []string
+
+	domainFilter                 []string
+	excludeDomains               []string
+	zones                        []string
+	defaultTTL                   int
+	deletionGracePeriod          time.Duration
+	subdomainsOnly               bool
+	zoneRecordLimit              int
+	maxErrorRatio                float64
+	maxSyncAPICalls              int
+	maxSyncDuration              time.Duration
+	dedupWindow                  time.Duration
+	retryQueueSize               int
+	retryQueueInterval           time.Duration
+	pausedZones                  []string
+	discoverDomainFilter         bool
+	discoverDomainFilterInterval time.Duration
+	manageDNSSEC                 string
+	manageDNSSECInterval         time.Duration
+	domainExpiryMetrics          bool
+	domainExpiryInterval         time.Duration
+	detectDrift                  bool
+	detectDriftInterval          time.Duration
+	reconcileInterval            time.Duration
+	pollMessages                 bool
+	pollMessagesInterval         time.Duration
+	readOnly                     bool
+	ownershipGuard               bool
+	ownershipTXTPrefix           string
+	ownershipOwnerID             string
+	registryLabelsEnabled        bool
+	recordsCacheFile             string
+	prefetch                     bool
+	sharedCacheURL               string
+	sharedCacheTTL               time.Duration
+	sharedCacheCAFile            string
+	journalFile                  string
+	journalSinkLocations         []string
+	journalSinkHeaders           []string
+	snapshotLocation             string
+	snapshotBeforeApply          bool
+	snapshotS3                   snapshot.S3Config
+	autoCreateZones              bool
+	zoneNameservers              []string
+	zoneCloneFrom                string
+	zoneTemplateFile             string
+	providerName                 string
+	mockZones                    []string
+	mockFixtureFile              string
+	sandbox                      bool
+	apiURL                       string
+	proxyURL                     string
+	caFile                       string
+	vault                        vault.Config
+	vaultCAFile                  string
+	vaultSecretPath              string
+	vaultUsernameKey             string
+	vaultPasswordKey             string
+	vaultRefreshInterval         time.Duration
+	credentialsSecret            string
+	credentialsSecretUsernameKey string
+	credentialsSecretPasswordKey string
+	tlsMinVersion                string
+	transport                    provider.TransportOptions
+	keepAlives                   bool
+	http2                        bool
+	logPayloads                  bool
+	logConnections               bool
+	logEndpoints                 bool
+	redactContent                bool
+	persistentSession            bool
+	maxLoginFailures             int
+	requiredPermissions          []string
+	createConcurrency            int
+	sessionKeepAlive             time.Duration
+	sessionStoreLocation         string
+	sessionStoreKey              string
+	username                     string
+	password                     string
+
+	promslog *promslog.Config
+
+	// snapshots is the store of --snapshot-before-apply, constructed by newClients
+	snapshots snapshot.Store
+	// sharedStore is the store of --shared-cache-url, constructed by newClients
+	sharedStore sharedcache.Store
+	// vaultClient reads the credentials of --vault-secret-path, constructed by newClients
+	vaultClient *vault.Client
+	// secretClient and credentialsSecretNamespace, credentialsSecretName read --inwx-credentials-secret,
+	// resolved by loadConfig and newClients
+	secretClient               *kubesecret.Client
+	credentialsSecretNamespace string
+	credentialsSecretName      string
+	// journalSinks are the sinks of --journal-sink, opened by openJournalSinks
+	journalSinks []journal.Sink
+	// journalShipper ships the journal entries of all accounts to journalSinks, started with the first journal
+	journalShipper *journal.Shipper
+	// events publishes the change events streamed with --events-token, created by runServe
+	events *provider.EventBroker
+	// sessionStore is the store of --inwx-session-store, constructed by newClients
+	sessionStore sessionstore.Store
+	// clientTLSConfig is the TLS configuration of the INWX client, resolved by loadConfig
+	clientTLSConfig *tls.Config
+	// accountConfigs are the accounts of the accounts file, resolved by loadConfig
+	accountConfigs []accountConfig
+	// zoneTemplate are the records of the zone template file, resolved by loadConfig
+	zoneTemplate []provider.TemplateRecord
+	// mockFixture is the initial state of the mock-server account, resolved by loadConfig
+	mockFixture provider.MockFixture
+
+	// Command flags and arguments
+	output          string
+	zone            string
+	targetZone      string
+	zoneFile        string
+	onlyListed      bool
+	color           string
+	rewrite         bool
+	snapshotRef     string
+	dryRun          bool
+	force           bool
+	invert          bool
+	mockAddress     string
+	allowProduction bool
+	mockFaults      provider.MockFaults
+	from            int
+	to              int
+	changesFile     string
+	checkPaths      []string
+	timeout         time.Duration
+	// healthcheckUsername and healthcheckPassword authenticate the probes of the healthcheck command
+	healthcheckUsername string
+	healthcheckPassword string
+	yes                 bool
+	interval            time.Duration
+}
+
+const (
+	serveCommand       = "serve"
+	checkCommand       = "check"
+	listZonesCommand   = "list-zones"
+	listRecordsCommand = "list-records"
+	exportZoneCommand  = "export-zone"
+	cloneZoneCommand   = "clone-zone"
+	importZoneCommand  = "import-zone"
+	diffCommand        = "diff"
+	snapshotCommand    = "snapshot"
+	restoreCommand     = "restore"
+	applyCommand       = "apply"
+	replayCommand      = "replay"
+	mockServerCommand  = "mock-server"
+	e2eTestCommand     = "e2e-test"
+	healthcheckCommand = "healthcheck"
+	validateCommand    = "validate-config"
+	gcCommand          = "gc"
+	adoptCommand       = "adopt"
+)
+
+// newApplication defines the command line of the webhook. It is called for every (re)load of the configuration.
+func newApplication() (*kingpin.Application, *config) {
+	app := kingpin.New("external-dns-inwx-webhook", "external-dns webhook provider for INWX")
+	cfg := &config{promslog: &promslog.Config{}}
+
 	// The default recommended port for the provider endpoints is 8888, and should listen only on localhost (ie: only accessible for external-dns).
-	listenAddr = kingpin.Flag("listen-address", "The address this plugin listens on").Default("localhost:8888").Envar("INWX_LISTEN_ADDRESS").String()
+	app.Flag("listen-address", "The address this plugin listens on; specify multiple times for several addresses").Default("localhost:8888").Envar("INWX_LISTEN_ADDRESS").StringsVar(&cfg.listenAddrs)
 	// The default recommended port for the exposed endpoints is 8080, and it should be bound to all interfaces (0.0.0.0)
-	metricsListenAddr = kingpin.Flag("metrics-listen-address", "The address this plugin provides metrics on").Default(":8080").Envar("INWX_METRICS_LISTEN_ADDRESS").String()
-	tlsConfig         = kingpin.Flag("tls-config", "Path to TLS config file.").Envar("INWX_TLS_CONFIG").Default("").String()
+	app.Flag("metrics-listen-address", "The address this plugin provides metrics on; specify multiple times for several addresses").Default(":8080").Envar("INWX_METRICS_LISTEN_ADDRESS").StringsVar(&cfg.metricsListenAddrs)
+	app.Flag("tls-config", "Path to TLS config file.").Envar("INWX_TLS_CONFIG").Default("").StringVar(&cfg.tlsConfig)
+	app.Flag("metrics-tls-config", "Path to the TLS config file of the metrics listener, --tls-config if unset").Envar("INWX_METRICS_TLS_CONFIG").Default("").StringVar(&cfg.metricsTLSConfig)
+	app.Flag(configFileFlag, "Path to a YAML file of flag values, reloaded on SIGHUP").Envar("INWX_CONFIG_FILE").Default("").StringVar(&cfg.configFile)
+	app.Flag(envFileFlag, "Path to a file of KEY=VALUE environment variables").Envar("INWX_ENV_FILE").Default("").StringVar(&cfg.envFile)
+	app.Flag("admin-token", "The bearer token of the operator endpoints on the metrics server").Envar("INWX_ADMIN_TOKEN").Default("").StringVar(&cfg.adminToken)
 
-	domainFilter = kingpin.Flag("domain-filter", "Limit possible target zones by a domain suffix; specify multiple times for multiple domains").Envar("INWX_DOMAIN_FILTER").Strings()
-	sandbox      = kingpin.Flag("inwx-sandbox", "Operate on the INWX sandbox database").Default("false").Envar("INWX_SANDBOX").Bool()
-	username     = kingpin.Flag("inwx-username", "The login username for the INWX API").Required().Envar("INWX_USERNAME").String()
-	password     = kingpin.Flag("inwx-password", "The login password for the INWX API").Required().Envar("INWX_PASSWORD").String()
-)
+	app.Flag("maintenance-mode", "Start in maintenance mode, refusing changes of DNS records").Default("false").Envar("INWX_MAINTENANCE_MODE").BoolVar(&cfg.maintenance)
+	app.Flag("maintenance-mode-retry-after", "The Retry-After of changes refused in maintenance mode enabled without a duration").Default("5m").Envar("INWX_MAINTENANCE_MODE_RETRY_AFTER").DurationVar(&cfg.maintenanceRetry)
+	app.Flag("pushgateway-url", "URL of a Prometheus Pushgateway the metrics of one-shot commands are pushed to").Envar("INWX_PUSHGATEWAY_URL").Default("").StringVar(&cfg.pushgatewayURL)
+	app.Flag("pushgateway-job", "The job the metrics of one-shot commands are pushed as, grouped by command").Envar("INWX_PUSHGATEWAY_JOB").Default("external-dns-inwx-webhook").StringVar(&cfg.pushgatewayJob)
+	app.Flag("events-token", "The bearer token of the /events endpoint on the metrics server").Envar("INWX_EVENTS_TOKEN").Default("").StringVar(&cfg.eventsToken)
+	app.Flag("dyndns-token", "The token of the /dyndns endpoint on the metrics server").Envar("INWX_DYNDNS_TOKEN").Default("").StringVar(&cfg.dyndnsToken)
+	app.Flag("dyndns-hostname", "A hostname whose A and AAAA records DynDNS clients may update; specify multiple times for multiple hostnames").Envar("INWX_DYNDNS_HOSTNAMES").StringsVar(&cfg.dyndnsHostnames)
+
+	app.Flag("domain-filter", "Limit possible target zones by a domain suffix; specify multiple times for multiple domains").Envar("INWX_DOMAIN_FILTER").StringsVar(&cfg.domainFilter)
+	app.Flag("exclude-domains", "Exclude subdomains from the domain filter; specify multiple times for multiple domains").Envar("INWX_EXCLUDE_DOMAINS").StringsVar(&cfg.excludeDomains)
+	app.Flag("zone", "Manage this INWX zone instead of discovering the zones; specify multiple times for multiple zones").Envar("INWX_ZONES").StringsVar(&cfg.zones)
+	app.Flag("default-ttl", "The TTL of records of endpoints without a TTL, the INWX default if 0").Default("0").Envar("INWX_DEFAULT_TTL").IntVar(&cfg.defaultTTL)
+	app.Flag("deletion-grace-period", "How long deleted records are kept in case they are created again, 0 to delete them at once").Default("0s").Envar("INWX_DELETION_GRACE_PERIOD").DurationVar(&cfg.deletionGracePeriod)
+	app.Flag("subdomains-only", "Never change the records of a zone apex").Default("false").Envar("INWX_SUBDOMAINS_ONLY").BoolVar(&cfg.subdomainsOnly)
+	app.Flag("paused-zone", "A zone whose records are never changed; specify multiple times for multiple zones").Envar("INWX_PAUSED_ZONES").StringsVar(&cfg.pausedZones)
+	app.Flag("zone-record-limit", "The number of records INWX allows in a zone, 0 to disable the warnings").Default("0").Envar("INWX_ZONE_RECORD_LIMIT").IntVar(&cfg.zoneRecordLimit)
+	app.Flag("max-error-ratio", "Abort a sync once this ratio of its changes failed, 0 to never abort").Default("0").Envar("INWX_MAX_ERROR_RATIO").Float64Var(&cfg.maxErrorRatio)
+	app.Flag("max-sync-api-calls", "Abort a sync once it made this number of INWX API calls, 0 to never abort").Default("0").Envar("INWX_MAX_SYNC_API_CALLS").IntVar(&cfg.maxSyncAPICalls)
+	app.Flag("max-sync-duration", "Abort a sync once it ran this long, 0 to never abort").Default("0s").Envar("INWX_MAX_SYNC_DURATION").DurationVar(&cfg.maxSyncDuration)
+	app.Flag("dedup-window", "Skip a change set identical to the last one applied within this window, 0 to disable").Default("0s").Envar("INWX_DEDUP_WINDOW").DurationVar(&cfg.dedupWindow)
+	app.Flag("retry-queue-size", "The number of failed changes queued for retrying between syncs, 0 to disable").Default("0").Envar("INWX_RETRY_QUEUE_SIZE").IntVar(&cfg.retryQueueSize)
+	app.Flag("retry-queue-interval", "The backoff of the first retry of a queued change, doubled for every further retry").Default("1m").Envar("INWX_RETRY_QUEUE_INTERVAL").DurationVar(&cfg.retryQueueInterval)
+	app.Flag("discover-domain-filter", "Negotiate a domain filter of the zones of the INWX account if none is configured").Default("false").Envar("INWX_DISCOVER_DOMAIN_FILTER").BoolVar(&cfg.discoverDomainFilter)
+	app.Flag("discover-domain-filter-interval", "How often the discovered domain filter is refreshed from the INWX account").Default("1h").Envar("INWX_DISCOVER_DOMAIN_FILTER_INTERVAL").DurationVar(&cfg.discoverDomainFilterInterval)
+	app.Flag("manage-dnssec", "The DNSSEC handling of managed zones: auto, report or off").Default("off").Envar("INWX_MANAGE_DNSSEC").EnumVar(&cfg.manageDNSSEC, "off", "report", "auto")
+	app.Flag("manage-dnssec-interval", "How often the DNSSEC signing of managed zones is checked").Default("1h").Envar("INWX_MANAGE_DNSSEC_INTERVAL").DurationVar(&cfg.manageDNSSECInterval)
+	app.Flag("domain-expiry-metrics", "Export the expiry date of every domain of the INWX account").Default("false").Envar("INWX_DOMAIN_EXPIRY_METRICS").BoolVar(&cfg.domainExpiryMetrics)
+	app.Flag("domain-expiry-metrics-interval", "How often the domain expiry dates are refreshed from the INWX account").Default("1h").Envar("INWX_DOMAIN_EXPIRY_METRICS_INTERVAL").DurationVar(&cfg.domainExpiryInterval)
+	app.Flag("detect-drift", "Periodically compare the records last applied with those INWX serves").Default("false").Envar("INWX_DETECT_DRIFT").BoolVar(&cfg.detectDrift)
+	app.Flag("detect-drift-interval", "How often the records last applied are compared with those INWX serves").Default("10m").Envar("INWX_DETECT_DRIFT_INTERVAL").DurationVar(&cfg.detectDriftInterval)
+	app.Flag("reconcile-interval", "How often the managed zones are listed independent of syncs, 0 to disable").Default("0s").Envar("INWX_RECONCILE_INTERVAL").DurationVar(&cfg.reconcileInterval)
+	app.Flag("poll-messages", "Log and acknowledge the messages of the INWX account").Default("false").Envar("INWX_POLL_MESSAGES").BoolVar(&cfg.pollMessages)
+	app.Flag("poll-messages-interval", "How often the messages of the INWX account are polled").Default("5m").Envar("INWX_POLL_MESSAGES_INTERVAL").DurationVar(&cfg.pollMessagesInterval)
+	app.Flag("read-only", "Only log the changes that would be applied to INWX instead of applying them").Default("false").Envar("INWX_READ_ONLY").BoolVar(&cfg.readOnly)
+	app.Flag("ownership-guard", "Refuse to update or delete records without a matching external-dns ownership TXT record in the zone").Default("false").Envar("INWX_OWNERSHIP_GUARD").BoolVar(&cfg.ownershipGuard)
+	app.Flag("ownership-txt-prefix", "The prefix of the ownership TXT records, as configured by the external-dns --txt-prefix flag").Default("").Envar("INWX_OWNERSHIP_TXT_PREFIX").StringVar(&cfg.ownershipTXTPrefix)
+	app.Flag("ownership-owner-id", "The owner ID of the ownership TXT records, as configured by the external-dns --txt-owner-id flag").Default("default").Envar("INWX_OWNERSHIP_OWNER_ID").StringVar(&cfg.ownershipOwnerID)
+	app.Flag("registry-labels", "Set the labels of the external-dns TXT registry records on the records they own").Default("false").Envar("INWX_REGISTRY_LABELS").BoolVar(&cfg.registryLabelsEnabled)
+	app.Flag("records-cache-file", "Path to a file keeping the records last listed, served after a restart").Default("").Envar("INWX_RECORDS_CACHE_FILE").StringVar(&cfg.recordsCacheFile)
+	app.Flag("prefetch-zones-on-startup", "List the zones and their records in the background on startup").Default("false").Envar("INWX_PREFETCH_ZONES_ON_STARTUP").BoolVar(&cfg.prefetch)
+	app.Flag("shared-cache-url", "URL of a Redis server shared between replicas, redis:// or rediss://").Default("").Envar("INWX_SHARED_CACHE_URL").StringVar(&cfg.sharedCacheURL)
+	app.Flag("shared-cache-ttl", "How long records listed by one replica are served to the others from the shared cache").Default("1m").Envar("INWX_SHARED_CACHE_TTL").DurationVar(&cfg.sharedCacheTTL)
+	app.Flag("shared-cache-ca-file", "Path to a PEM bundle of CA certificates trusted for the shared cache").Default("").Envar("INWX_SHARED_CACHE_CA_FILE").StringVar(&cfg.sharedCacheCAFile)
+	app.Flag("journal-file", "Path to a file journaling every record change applied to INWX").Default("").Envar("INWX_JOURNAL_FILE").StringVar(&cfg.journalFile)
+	app.Flag("journal-sink", "A URL every record change applied to INWX is shipped to; specify multiple times for several sinks").Envar("INWX_JOURNAL_SINKS").StringsVar(&cfg.journalSinkLocations)
+	app.Flag("journal-sink-header", "A header sent to HTTP journal sinks, \"Name: value\"; specify multiple times for several headers").Envar("INWX_JOURNAL_SINK_HEADERS").StringsVar(&cfg.journalSinkHeaders)
+	app.Flag("snapshot-location", "Where zone snapshots are saved, a directory or an s3://bucket/prefix URL").Default("").Envar("INWX_SNAPSHOT_LOCATION").StringVar(&cfg.snapshotLocation)
+	app.Flag("snapshot-before-apply", "Save a snapshot of every zone before changing it").Default("false").Envar("INWX_SNAPSHOT_BEFORE_APPLY").BoolVar(&cfg.snapshotBeforeApply)
+	app.Flag("snapshot-s3-endpoint", "The endpoint of an S3-compatible service storing snapshots, AWS S3 if unset").Default("").Envar("INWX_SNAPSHOT_S3_ENDPOINT").StringVar(&cfg.snapshotS3.Endpoint)
+	app.Flag("snapshot-s3-region", "The region of the bucket storing snapshots").Default("us-east-1").Envar("INWX_SNAPSHOT_S3_REGION").StringVar(&cfg.snapshotS3.Region)
+	app.Flag("auto-create-zones", "Create the missing zone of an endpoint if its domain is registered with the INWX account").Default("false").Envar("INWX_AUTO_CREATE_ZONES").BoolVar(&cfg.autoCreateZones)
+	app.Flag("auto-create-zones-nameserver", "The nameservers of created zones; specify multiple times for multiple nameservers").Default(provider.DefaultNameservers...).Envar("INWX_AUTO_CREATE_ZONES_NAMESERVERS").StringsVar(&cfg.zoneNameservers)
+	app.Flag("auto-create-zones-clone-from", "A zone whose records, except for SOA and NS records, are copied into created zones").Default("").Envar("INWX_AUTO_CREATE_ZONES_CLONE_FROM").StringVar(&cfg.zoneCloneFrom)
+	app.Flag("auto-create-zones-template", "Path to a YAML list of records created in created zones").Default("").Envar("INWX_AUTO_CREATE_ZONES_TEMPLATE").StringVar(&cfg.zoneTemplateFile)
+	app.Flag("provider", "The DNS provider, inwx or fake for in-memory accounts").Default("inwx").Envar("INWX_PROVIDER").EnumVar(&cfg.providerName, "inwx", fakeProvider)
+	app.Flag("mock-zone", "A zone the mock account starts with; specify multiple times for several zones").Envar("INWX_MOCK_ZONES").StringsVar(&cfg.mockZones)
+	app.Flag("mock-fixture", "Path to a YAML or JSON file of the zones and domains the mock account starts with").Default("").Envar("INWX_MOCK_FIXTURE").StringVar(&cfg.mockFixtureFile)
+	app.Flag("inwx-sandbox", "Operate on the INWX sandbox database").Default("false").Envar("INWX_SANDBOX").BoolVar(&cfg.sandbox)
+	app.Flag("inwx-api-url", "The URL of the INWX XML-RPC API, overriding --inwx-sandbox").Default("").Envar("INWX_API_URL").StringVar(&cfg.apiURL)
+	app.Flag("inwx-proxy-url", "The proxy for INWX API requests, overriding HTTP_PROXY and HTTPS_PROXY").Default("").Envar("INWX_PROXY_URL").StringVar(&cfg.proxyURL)
+	app.Flag("inwx-ca-file", "Path to a PEM bundle of CA certificates trusted for the INWX API").Default("").Envar("INWX_CA_FILE").StringVar(&cfg.caFile)
+	app.Flag("inwx-tls-min-version", "The minimum TLS version of connections to the INWX API, 1.2 or 1.3").Default("1.2").Envar("INWX_TLS_MIN_VERSION").EnumVar(&cfg.tlsMinVersion, "1.2", "1.3")
+	app.Flag("inwx-http-keep-alives", "Reuse connections to the INWX API").Default("true").Envar("INWX_HTTP_KEEP_ALIVES").BoolVar(&cfg.keepAlives)
+	app.Flag("inwx-http2", "Use HTTP/2 for the INWX API if offered").Default("true").Envar("INWX_HTTP2").BoolVar(&cfg.http2)
+	app.Flag("inwx-http-max-idle-conns", "The maximum number of idle connections to the INWX API").Default("2").Envar("INWX_HTTP_MAX_IDLE_CONNS").IntVar(&cfg.transport.MaxIdleConns)
+	app.Flag("inwx-http-max-conns", "The maximum number of connections to the INWX API, 0 for no limit").Default("0").Envar("INWX_HTTP_MAX_CONNS").IntVar(&cfg.transport.MaxConnsPerHost)
+	app.Flag("inwx-http-idle-conn-timeout", "How long idle connections to the INWX API are kept open").Default("90s").Envar("INWX_HTTP_IDLE_CONN_TIMEOUT").DurationVar(&cfg.transport.IdleConnTimeout)
+	app.Flag("inwx-http-response-header-timeout", "How long to wait for the response headers of an INWX API request, 0 for no limit").Default("60s").Envar("INWX_HTTP_RESPONSE_HEADER_TIMEOUT").DurationVar(&cfg.transport.ResponseHeaderTimeout)
+	app.Flag("log-inwx-payloads", "Log the INWX API request and response bodies at debug level, with secrets redacted").Default("false").Envar("INWX_LOG_INWX_PAYLOADS").BoolVar(&cfg.logPayloads)
+	app.Flag("log-inwx-connections", "Log how the connections of INWX API requests are obtained at debug level").Default("false").Envar("INWX_LOG_INWX_CONNECTIONS").BoolVar(&cfg.logConnections)
+	app.Flag("log-endpoints", "Log every endpoint listed from INWX at debug level").Default("false").Envar("INWX_LOG_ENDPOINTS").BoolVar(&cfg.logEndpoints)
+	app.Flag("redact-record-content", "Replace the record content in logs and journal entries by a hash").Default("false").Envar("INWX_REDACT_RECORD_CONTENT").BoolVar(&cfg.redactContent)
+	app.Flag("inwx-persistent-session", "Keep the INWX API session logged in between syncs instead of logging in and out for every sync").Default("false").Envar("INWX_PERSISTENT_SESSION").BoolVar(&cfg.persistentSession)
+	app.Flag("inwx-session-keep-alive-interval", "How often a persistent INWX API session is pinged so that it does not expire between syncs, 0 to disable").Default("5m").Envar("INWX_SESSION_KEEP_ALIVE_INTERVAL").DurationVar(&cfg.sessionKeepAlive)
+	app.Flag("inwx-session-store", "Where the persistent INWX API session is saved encrypted, a file or a kubernetes:// URL").Default("").Envar("INWX_SESSION_STORE").StringVar(&cfg.sessionStoreLocation)
+	app.Flag("inwx-session-store-key", "The key encrypting the sessions of --inwx-session-store, at least 16 characters").Default("").Envar("INWX_SESSION_STORE_KEY").StringVar(&cfg.sessionStoreKey)
+	app.Flag("inwx-max-login-failures", "Stop logging into INWX after this many refused logins until the credentials change").Default("3").Envar("INWX_MAX_LOGIN_FAILURES").IntVar(&cfg.maxLoginFailures)
+	app.Flag("required-permissions", "A permission every INWX account must have, read or write; specify multiple times for both").Envar("INWX_REQUIRED_PERMISSIONS").EnumsVar(&cfg.requiredPermissions, provider.PermissionRead, provider.PermissionWrite)
+	app.Flag("inwx-create-concurrency", "The number of records of a zone created at once").Default("1").Envar("INWX_CREATE_CONCURRENCY").IntVar(&cfg.createConcurrency)
+	app.Flag("accounts-file", "Path to a YAML file of further INWX accounts").Default("").Envar("INWX_ACCOUNTS_FILE").StringVar(&cfg.accountsFile)
+	app.Flag("inwx-username", "The login username for the INWX API").Envar("INWX_USERNAME").StringVar(&cfg.username)
+	app.Flag("inwx-password", "The login password for the INWX API").Envar("INWX_PASSWORD").StringVar(&cfg.password)
+	app.Flag("inwx-credentials-secret", "The Kubernetes Secret holding the INWX credentials, namespace/name or name").Default("").Envar("INWX_CREDENTIALS_SECRET").StringVar(&cfg.credentialsSecret)
+	app.Flag("inwx-credentials-secret-username-key", "The key of the username in the credentials Secret; --inwx-username is used if the Secret holds none").Default("username").Envar("INWX_CREDENTIALS_SECRET_USERNAME_KEY").StringVar(&cfg.credentialsSecretUsernameKey)
+	app.Flag("inwx-credentials-secret-password-key", "The key of the password in the credentials Secret").Default("password").Envar("INWX_CREDENTIALS_SECRET_PASSWORD_KEY").StringVar(&cfg.credentialsSecretPasswordKey)
+	app.Flag("vault-addr", "The address of a HashiCorp Vault the INWX credentials are read from").Default("").Envar("INWX_VAULT_ADDR").StringVar(&cfg.vault.Addr)
+	app.Flag("vault-secret-path", "The path of the Vault secret holding the INWX credentials, e.g. secret/data/inwx").Default("").Envar("INWX_VAULT_SECRET_PATH").StringVar(&cfg.vaultSecretPath)
+	app.Flag("vault-username-key", "The key of the username in the Vault secret; --inwx-username is used if the secret holds none").Default("username").Envar("INWX_VAULT_USERNAME_KEY").StringVar(&cfg.vaultUsernameKey)
+	app.Flag("vault-password-key", "The key of the password in the Vault secret").Default("password").Envar("INWX_VAULT_PASSWORD_KEY").StringVar(&cfg.vaultPasswordKey)
+	app.Flag("vault-token", "The token authenticating with Vault, the Kubernetes auth method is used if unset").Default("").Envar("INWX_VAULT_TOKEN").StringVar(&cfg.vault.Token)
+	app.Flag("vault-kubernetes-role", "The role of the Kubernetes auth method of Vault").Default("").Envar("INWX_VAULT_KUBERNETES_ROLE").StringVar(&cfg.vault.KubernetesRole)
+	app.Flag("vault-kubernetes-mount", "The mount path of the Kubernetes auth method of Vault").Default("kubernetes").Envar("INWX_VAULT_KUBERNETES_MOUNT").StringVar(&cfg.vault.KubernetesMount)
+	app.Flag("vault-namespace", "The Vault Enterprise namespace of the secret and the auth method").Default("").Envar("INWX_VAULT_NAMESPACE").StringVar(&cfg.vault.Namespace)
+	app.Flag("vault-ca-file", "Path to a PEM bundle of CA certificates trusted for Vault in addition to the system ones").Default("").Envar("INWX_VAULT_CA_FILE").StringVar(&cfg.vaultCAFile)
+	app.Flag("vault-refresh-interval", "How often the INWX credentials are read from Vault again, 0 to disable").Default("5m").Envar("INWX_VAULT_REFRESH_INTERVAL").DurationVar(&cfg.vaultRefreshInterval)
+
+	flag.AddFlags(app, cfg.promslog)
+	app.Version(version.Info())
+
+	app.Command(serveCommand, "Serve the external-dns webhook provider.").Default()
+	app.Command(checkCommand, "Log into INWX, list the managed zones and exit non-zero on failure.")
+	listZones := app.Command(listZonesCommand, "List the zones visible to the INWX account.")
+	listZones.Flag("output", "Output format, table or json").Short('o').Default("table").EnumVar(&cfg.output, "table", "json")
+	listRecords := app.Command(listRecordsCommand, "List the records of a zone.")
+	listRecords.Flag("output", "Output format, table or json").Short('o').Default("table").EnumVar(&cfg.output, "table", "json")
+	listRecords.Arg("zone", "The zone to list the records of").Required().StringVar(&cfg.zone)
+	exportZone := app.Command(exportZoneCommand, "Print a zone in BIND zone file format.")
+	exportZone.Arg("zone", "The zone to export").Required().StringVar(&cfg.zone)
+	cloneZone := app.Command(cloneZoneCommand, "Create a zone with a copy of all records of another zone of the account with the INWX nameserver clone API, e.g. for moving a service onto a new domain, and print the records rewritten.")
+	cloneZone.Flag("rewrite", "Rewrite the host names under SOURCE in the content of the cloned CNAME, MX, NS, SRV and PTR records to TARGET").Default("false").BoolVar(&cfg.rewrite)
+	cloneZone.Arg("source", "The zone to clone").Required().StringVar(&cfg.zone)
+	cloneZone.Arg("target", "The zone to create, which must not exist yet").Required().StringVar(&cfg.targetZone)
+	importZone := app.Command(importZoneCommand, "Import the records of a BIND zone file into a zone, making the records of every name and type of the file match it while leaving the others alone, and print the changes; SOA records and the NS records of the apex are skipped.")
+	importZone.Flag("dry-run", "Only print the changes importing the zone file").Default("false").BoolVar(&cfg.dryRun)
+	importZone.Arg("zone", "The zone to import the records into").Required().StringVar(&cfg.zone)
+	importZone.Arg("file", "The zone file to import, the standard input if not set").StringVar(&cfg.zoneFile)
+	diff := app.Command(diffCommand, "Print the differences of a zone from a desired state, a BIND zone file or a JSON array of external-dns endpoints, as the changes making the zone match it, and exit 1 if there are any or 2 on failure.")
+	diff.Flag("only-listed", "Only compare the records of the names and types of the desired state, e.g. of the endpoints managed by external-dns").Default("false").BoolVar(&cfg.onlyListed)
+	diff.Flag("color", "Color the differences, auto if the output is a terminal").Default("auto").EnumVar(&cfg.color, "auto", "always", "never")
+	diff.Flag("output", "Output format, diff or json").Short('o').Default("diff").EnumVar(&cfg.output, "diff", "json")
+	diff.Arg("zone", "The zone to compare").Required().StringVar(&cfg.zone)
+	diff.Arg("file", "The desired state, the standard input if not set").StringVar(&cfg.zoneFile)
+	snapshotZone := app.Command(snapshotCommand, "Save a snapshot of a zone to the snapshot location, or print it if no location is configured.")
+	snapshotZone.Arg("zone", "The zone to snapshot").Required().StringVar(&cfg.zone)
+	restore := app.Command(restoreCommand, "Restore a zone to a snapshot.")
+	restore.Flag("dry-run", "Only print the changes restoring the snapshot").Default("false").BoolVar(&cfg.dryRun)
+	restore.Flag("force", "Restore the zone of the snapshot even if it is not a managed zone, e.g. outside the domain filter").Default("false").BoolVar(&cfg.force)
+	restore.Arg("snapshot", "The snapshot to restore, a file path or an s3://bucket/key URL").Required().StringVar(&cfg.snapshotRef)
+	apply := app.Command(applyCommand, "Apply an external-dns change set (plan.Changes JSON) once, print the result of every change and exit non-zero if any failed.").Alias("once")
+	apply.Flag("output", "Output format, table or json").Short('o').Default("table").EnumVar(&cfg.output, "table", "json")
+	apply.Arg("changes", "The file to read the change set from, - for stdin").Default("-").StringVar(&cfg.changesFile)
+	replay := app.Command(replayCommand, "Apply the changes of the journal numbered from FROM to TO again, or undo them with --invert, and print the changes applied.")
+	replay.Flag("invert", "Undo the changes in reverse order instead of applying them again").Default("false").BoolVar(&cfg.invert)
+	replay.Flag("dry-run", "Only print the changes replaying the journal").Default("false").BoolVar(&cfg.dryRun)
+	replay.Flag("output", "Output format, table or json").Short('o').Default("table").EnumVar(&cfg.output, "table", "json")
+	replay.Arg("from", "The number of the first journal entry to replay").Required().IntVar(&cfg.from)
+	replay.Arg("to", "The number of the last journal entry to replay, the last entry of the journal if not set").IntVar(&cfg.to)
+	mockServer := app.Command(mockServerCommand, "Serve an in-memory mock of the INWX XML-RPC API for end-to-end tests, accepting the --inwx-username and --inwx-password credentials or any if not set; point --inwx-api-url at it.")
+	mockServer.Flag("address", "The address the mock API listens on").Default("localhost:8889").StringVar(&cfg.mockAddress)
+	mockServer.Flag("fault-error-rate", "The share of calls failing with a command error, from 0 to 1").Default("0").Float64Var(&cfg.mockFaults.ErrorRate)
+	mockServer.Flag("fault-rate-limit-rate", "The share of calls refused for exceeding the request limit, from 0 to 1").Default("0").Float64Var(&cfg.mockFaults.RateLimitRate)
+	mockServer.Flag("fault-rate-limit-pause", "The retry hint of calls refused for exceeding the request limit").Default("1s").DurationVar(&cfg.mockFaults.RateLimitPause)
+	mockServer.Flag("fault-latency", "The delay of every call").Default("0s").DurationVar(&cfg.mockFaults.Latency)
+	mockServer.Flag("fault-session-expiry", "End sessions this long after their login, 0 to keep them").Default("0s").DurationVar(&cfg.mockFaults.SessionExpiry)
+	mockServer.Flag("fault-seed", "The seed of the random faults, reproducing the faults of a run").Default("1").Uint64Var(&cfg.mockFaults.Seed)
+	e2eTest := app.Command(e2eTestCommand, "Create, read back, update and delete a throwaway record of every supported type in a zone of the INWX sandbox, print the result of every step and exit non-zero if any failed.")
+	e2eTest.Flag("allow-production", "Run the test against the INWX production API").Default("false").BoolVar(&cfg.allowProduction)
+	e2eTest.Flag("output", "Output format, table or json").Short('o').Default("table").EnumVar(&cfg.output, "table", "json")
+	e2eTest.Arg("zone", "The zone to create the test records in").Required().StringVar(&cfg.zone)
+	gc := app.Command(gcCommand, "Delete the records of the managed zones without an external-dns ownership TXT record of any owner, as found with --ownership-txt-prefix, after printing them and asking for confirmation; records not created by external-dns are deleted as well, so narrow the zones with --domain-filter and review a --dry-run first.")
+	gc.Flag("dry-run", "Only print the orphaned records").Default("false").BoolVar(&cfg.dryRun)
+	gc.Flag("yes", "Delete the orphaned records without asking for confirmation").Short('y').Default("false").BoolVar(&cfg.yes)
+	gc.Flag("interval", "Collect the orphaned records every interval until interrupted instead of once, requiring --yes or --dry-run").Default("0s").DurationVar(&cfg.interval)
+	gc.Flag("output", "Output format, table or json").Short('o').Default("table").EnumVar(&cfg.output, "table", "json")
+	adopt := app.Command(adoptCommand, "Create the external-dns ownership TXT records of --ownership-owner-id for the records of the managed zones without one of any owner, after printing them and asking for confirmation, so that external-dns adopts them; narrow the zones with --domain-filter and review a --dry-run first.")
+	adopt.Flag("dry-run", "Only print the ownership records").Default("false").BoolVar(&cfg.dryRun)
+	adopt.Flag("yes", "Create the ownership records without asking for confirmation").Short('y').Default("false").BoolVar(&cfg.yes)
+	adopt.Flag("output", "Output format, table or json").Short('o').Default("table").EnumVar(&cfg.output, "table", "json")
+	app.Command(validateCommand, "Validate the configuration, including the config and TLS config files, and exit non-zero reporting all problems.")
+	healthcheck := app.Command(healthcheckCommand, "Probe the health endpoint of the local metrics server and exit non-zero unless it is healthy, e.g. for a container HEALTHCHECK.")
+	healthcheck.Flag("path", "The path to probe on the metrics listen address; specify multiple times to probe several, e.g. /healthz and /readyz").Default("/healthz").StringsVar(&cfg.checkPaths)
+	healthcheck.Flag("timeout", "The timeout of every probe").Default("5s").DurationVar(&cfg.timeout)
+	healthcheck.Flag("basic-auth-username", "The basic auth username of the probes, if the metrics listener requires basic auth").Default("").Envar("INWX_HEALTHCHECK_BASIC_AUTH_USERNAME").StringVar(&cfg.healthcheckUsername)
+	healthcheck.Flag("basic-auth-password", "The basic auth password of the probes").Default("").Envar("INWX_HEALTHCHECK_BASIC_AUTH_PASSWORD").StringVar(&cfg.healthcheckPassword)
+	return app, cfg
+}
+
+// loadConfig resolves the configuration from args, the environment, the env file and the configuration file.
+// It returns the selected command along with the configuration.
+// All problems with the configuration file and the resolved values are reported at once.
+func loadConfig(args []string) (string, *config, error) {
+	app, cfg := newApplication()
+	envValues, envErr := envFileValues(app, args)
+	fileErr := applyConfigFile(app, args, func(key string) string {
+		if value, ok := os.LookupEnv(key); ok {
+			return value
+		}
+		return envValues[key]
+	})
+	envErr = errors.Join(envErr, applyEnvFile(app, envValues))
+	command, err := app.Parse(args)
+	if err != nil {
+		return "", nil, errors.Join(envErr, fileErr, err)
+	}
+	if err := errors.Join(envErr, fileErr, cfg.validate()); err != nil {
+		return "", nil, err
+	}
+	cfg.resolved = resolvedFlags(app)
+	cfg.flagValues = flagValues(app)
+	if cfg.providerName == fakeProvider {
+		cfg.useFakeProvider()
+	}
+	return command, cfg, nil
+}
+
+// requireCredentials checks the credentials of the default account, which commands operating
+// on a single account use. The accounts of the accounts file suffice for the others.
+func (cfg *config) requireCredentials(accounts bool) error {
+	if accounts && len(cfg.accountConfigs) > 0 && cfg.username == "" && cfg.password == "" {
+		return nil
+	}
+	if cfg.username == "" || cfg.password == "" {
+		return fmt.Errorf("the INWX credentials are required, set --inwx-username and --inwx-password or provide them in the config file")
+	}
+	return nil
+}
+
+func (cfg *config) newProvider(logger *slog.Logger) *provider.INWXProvider {
+	return provider.NewINWXProvider(provider.Config{
+		Client:              cfg.clientOptions(),
+		DomainFilter:        cfg.domainFilter,
+		ExcludeDomains:      cfg.excludeDomains,
+		Zones:               cfg.zones,
+		DefaultTTL:          cfg.defaultTTL,
+		DeletionGracePeriod: cfg.deletionGracePeriod,
+		SubdomainsOnly:      cfg.subdomainsOnly,
+		ZoneRecordLimit:     cfg.zoneRecordLimit,
+		MaxErrorRatio:       cfg.maxErrorRatio,
+		MaxApplyCalls:       cfg.maxSyncAPICalls,
+		MaxApplyDuration:    cfg.maxSyncDuration,
+		DedupWindow:         cfg.dedupWindow,
+		RetryQueueSize:      cfg.retryQueueSize,
+		RetryInterval:       cfg.retryQueueInterval,
+		PausedZones:         cfg.pausedZones,
+		ReadOnly:            cfg.readOnly,
+		Ownership:           cfg.ownership(),
+		RegistryLabels:      cfg.registryLabels(),
+		LogEndpoints:        cfg.logEndpoints,
+		Snapshots:           cfg.snapshots,
+		ZoneCreation:        cfg.zoneCreation(),
+		RecordsCacheFile:    cfg.recordsCacheFile,
+		SharedCache:         cfg.sharedCache(cfg.username, cfg.sandbox),
+		Events:              cfg.events,
+		Account:             defaultAccount,
+		Logger:              logger,
+	})
+}
+
+// newLogger returns the logger of the log flags, redacting record content if configured, and routes
+// the output of the standard log package through it.
+func (cfg *config) newLogger() *slog.Logger {
+	logger := promslog.New(cfg.promslog)
+	if cfg.redactContent {
+		logger = slog.New(provider.NewRedactingHandler(logger.Handler()))
+	}
+	provider.BridgeClientLog(logger)
+	return logger
+}
+
+func (cfg *config) clientOptions() provider.ClientOptions {
+	options := provider.ClientOptions{Username: cfg.username, Password: cfg.password, Sandbox: cfg.sandbox, TLSConfig: cfg.clientTLSConfig, Transport: cfg.transport}
+	options.Transport.DisableKeepAlives = !cfg.keepAlives
+	options.Transport.DisableHTTP2 = !cfg.http2
+	options.LogPayloads = cfg.logPayloads
+	options.LogConnections = cfg.logConnections
+	options.RedactContent = cfg.redactContent
+	options.PersistentSession = cfg.persistentSession
+	options.SessionStore = cfg.sessionStore
+	options.MaxLoginFailures = cfg.maxLoginFailures
+	options.CreateConcurrency = cfg.createConcurrency
+	if cfg.providerName == fakeProvider {
+		options.Backend, options.Middleware = cfg.fakeBackend()
+	}
+	options.Journal = cfg.newJournal(cfg.journalFile, defaultAccount)
+	// the URLs are validated by loadConfig
+	if cfg.apiURL != "" {
+		options.APIURL, _ = url.Parse(cfg.apiURL)
+	}
+	if cfg.proxyURL != "" {
+		options.ProxyURL, _ = url.Parse(cfg.proxyURL)
+	}
+	return options
+}
+
+// apiName describes the INWX API the configuration connects to.
+func (cfg *config) apiName() string {
+	switch {
+	case cfg.apiURL != "":
+		return cfg.apiURL
+	case cfg.sandbox:
+		return "sandbox"
+	default:
+		return "production"
+	}
+}
+
+func (cfg *config) zoneCreation() *provider.ZoneCreation {
+	if !cfg.autoCreateZones {
+		return nil
+	}
+	return &provider.ZoneCreation{Nameservers: cfg.zoneNameservers, CloneFrom: cfg.zoneCloneFrom, Records: cfg.zoneTemplate}
+}
+
+// sharedCache keys the shared cache by the INWX database and account, so that replicas only share
+// the records of the same account.
+func (cfg *config) sharedCache(username string, sandbox bool) *provider.SharedCache {
+	if cfg.sharedStore == nil {
+		return nil
+	}
+	database := "production"
+	if cfg.apiURL != "" {
+		database = cfg.apiURL
+	} else if sandbox {
+		database = "sandbox"
+	}
+	return &provider.SharedCache{Store: cfg.sharedStore, Key: "external-dns-inwx/" + database + "/" + username, TTL: cfg.sharedCacheTTL}
+}
+
+func (cfg *config) registryLabels() *provider.OwnershipGuard {
+	if !cfg.registryLabelsEnabled {
+		return nil
+	}
+	return provider.NewOwnershipGuard(cfg.ownershipTXTPrefix, cfg.ownershipOwnerID)
+}
+
+func (cfg *config) ownership() *provider.OwnershipGuard {
+	if !cfg.ownershipGuard {
+		return nil
+	}
+	return provider.NewOwnershipGuard(cfg.ownershipTXTPrefix, cfg.ownershipOwnerID)
+}
 
 func main() {
+	command, cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		kingpin.Fatalf("%s, try --help", err)
+	}
+	if command == validateCommand {
+		fmt.Fprintln(os.Stdout, "configuration is valid")
+		os.Exit(0)
+	}
+	if command == healthcheckCommand {
+		os.Exit(runHealthcheck(cfg))
+	}
+	if command == mockServerCommand {
+		os.Exit(runMockServer(cfg, cfg.newLogger()))
+	}
+	if err := cfg.newClients(); err != nil {
+		kingpin.Fatalf("%s, try --help", err)
+	}
+	if err := cfg.readCredentials(context.Background()); err != nil {
+		kingpin.Fatalf("%s, try --help", err)
+	}
+	if err := cfg.requireCredentials(command == serveCommand || command == checkCommand); err != nil {
+		kingpin.Fatalf("%s, try --help", err)
+	}
 
-	promslogConfig := &promslog.Config{}
-	flag.AddFlags(kingpin.CommandLine, promslogConfig)
-	kingpin.Version(version.Info())
-	kingpin.Parse()
+	if command != serveCommand {
+		// one-shot commands end their sessions rather than leave them to expire
+		cfg.persistentSession = false
+	}
 
-	var logger = promslog.New(promslogConfig)
+	var logger = cfg.newLogger()
+	if cfg.configFile != "" {
+		logger.Info("loaded configuration file", "path", cfg.configFile)
+	}
+	if cfg.envFile != "" {
+		logger.Info("loaded env file", "path", cfg.envFile)
+	}
+
+	if err := cfg.openJournalSinks(); err != nil {
+		logger.Error("failed to open journal sinks", "error", err.Error())
+		os.Exit(1)
+	}
+	if command != serveCommand {
+		os.Exit(runPushingMetrics(cfg, command, logger, runOneShot))
+	}
+	runServe(cfg, logger)
+}
+
+// runOneShot runs a command other than serve, returning the exit code.
+func runOneShot(cfg *config, command string, logger *slog.Logger) int {
+	defer cfg.closeJournalShipper(logger)
+	switch command {
+	case checkCommand:
+		return runCheck(cfg, logger)
+	case listZonesCommand:
+		return runListZones(cfg, logger)
+	case listRecordsCommand:
+		return runListRecords(cfg, logger)
+	case exportZoneCommand:
+		return runExportZone(cfg, logger)
+	case cloneZoneCommand:
+		return runCloneZone(cfg, logger)
+	case importZoneCommand:
+		return runImportZone(cfg, logger)
+	case diffCommand:
+		return runDiff(cfg, logger)
+	case snapshotCommand:
+		return runSnapshot(cfg, logger)
+	case restoreCommand:
+		return runRestore(cfg, logger)
+	case applyCommand:
+		return runApply(cfg, logger)
+	case replayCommand:
+		return runReplay(cfg, logger)
+	case e2eTestCommand:
+		return runE2ETest(cfg, logger)
+	case gcCommand:
+		return runGC(cfg, logger)
+	case adoptCommand:
+		return runAdopt(cfg, logger)
+	}
+	logger.Error("unknown command", "command", command)
+	return 1
+}
+
+func runServe(cfg *config, logger *slog.Logger) {
 	logger.Info("starting external-dns INWX webhook plugin", "version", version.Version, "revision", version.Revision)
-	logger.Debug("configuration", "api-key", strings.Repeat("*", len(*username)), "api-password", strings.Repeat("*", len(*password)))
+	if cfg.providerName == fakeProvider {
+		logger.Warn("fake provider enabled, the records are kept in memory instead of INWX and lost on exit")
+	}
+	if cfg.readOnly {
+		logger.Warn("read-only mode enabled, changes will not be applied to INWX")
+	}
+	if cfg.snapshotBeforeApply {
+		logger.Info("saving zone snapshots before applying changes", "location", cfg.snapshotLocation)
+	}
+	logger.Debug("configuration", "api-key", strings.Repeat("*", len(cfg.username)), "api-password", strings.Repeat("*", len(cfg.password)))
 
 	prometheus.DefaultRegisterer.MustRegister(cversion.NewCollector("external_dns_inwx"))
+	provider.RegisterMetrics(prometheus.DefaultRegisterer)
+
+	if cfg.eventsToken != "" {
+		cfg.events = provider.NewEventBroker()
+	}
+	accounts := cfg.newAccounts(logger)
+	if len(cfg.requiredPermissions) > 0 {
+		for _, account := range accounts {
+			if err := account.Provider.CheckPermissions(cfg.requiredPermissions); err != nil {
+				logger.Error("INWX account lacks the required permissions", "account", account.Name, "permissions", cfg.requiredPermissions, "class", provider.ErrorClass(err), "error", err.Error())
+				os.Exit(1)
+			}
+		}
+		logger.Info("checked the permissions of the INWX accounts", "permissions", cfg.requiredPermissions)
+	}
+	p, tenants := cfg.groupAccounts(accounts, logger)
+	// current is the configuration last loaded
+	var current atomic.Pointer[config]
+	current.Store(cfg)
+	reload := func() error {
+		_, newCfg, err := loadConfig(os.Args[1:])
+		if err == nil {
+			newCfg.reuseClients(current.Load())
+			err = newCfg.readCredentials(context.Background())
+		}
+		if err == nil {
+			err = reloadAccounts(accounts, current.Load(), newCfg)
+		}
+		if err != nil {
+			logger.Error("failed to reload configuration", "error", err.Error())
+			return err
+		}
+		current.Store(newCfg)
+		logger.Info("reloaded configuration")
+		return nil
+	}
 
-	metricsMux := buildMetricsServer(prometheus.DefaultGatherer, logger)
+	ready := func() error {
+		for _, account := range accounts {
+			if until, ok := account.Provider.Maintenance(); ok {
+				return fmt.Errorf("INWX account %s is in maintenance until %s", account.Name, until.Format(time.RFC3339))
+			}
+			if account.Provider.LoginLocked() {
+				return fmt.Errorf("INWX account %s refused the credentials repeatedly, not logging in until they change", account.Name)
+			}
+		}
+		return nil
+	}
+	var dyndns http.Handler
+	if cfg.dyndnsToken != "" {
+		dyndns = dyndnsHandler(p, cfg.dyndnsToken, cfg.dyndnsHostnames, logger)
+	}
+	var events http.Handler
+	if cfg.events != nil {
+		events = eventsHandler(cfg.events, cfg.eventsToken, logger)
+	}
+	prometheus.DefaultRegisterer.MustRegister(maintenanceModeEnabled, journalEntriesDropped)
+	maintenance := newMaintenanceMode(cfg.maintenance, cfg.maintenanceRetry)
+	if cfg.maintenance {
+		logger.Warn("maintenance mode enabled, changes of DNS records are refused")
+	}
+	operator := operatorHandlers{
+		preview:     previewHandler(p, tenants),
+		maintenance: maintenance.handler(logger),
+		config:      configHandler(current.Load),
+	}
+	metricsMux := buildMetricsServer(prometheus.DefaultGatherer, cfg.adminToken, reload, ready, operator, dyndns, events, logger)
 	metricsServer := http.Server{
 		Handler:           metricsMux,
 		ReadHeaderTimeout: 5 * time.Second}
 
+	metricsWebConfig := cfg.metricsWebConfig()
 	metricsFlags := web.FlagConfig{
-		WebListenAddresses: &[]string{*metricsListenAddr},
+		WebListenAddresses: &cfg.metricsListenAddrs,
 		WebSystemdSocket:   new(bool),
-		WebConfigFile:      tlsConfig,
+		WebConfigFile:      &metricsWebConfig,
+	}
+
+	if cfg.prefetch {
+		for _, account := range accounts {
+			account.Provider.Prefetch()
+		}
 	}
 
-	webhookMux, err := buildWebhookServer(logger)
+	webhookMux, err := buildWebhookServer(p, tenants, logger)
 	if err != nil {
 		logger.Error("Failed to create provider", "error", err.Error())
 		os.Exit(1)
 	}
 	webhookServer := http.Server{
-		Handler:           webhookMux,
+		Handler:           provider.InstrumentWebhook(provider.NegotiateWebhookVersion(maintenance.freeze(webhookMux, logger), logger)),
 		ReadHeaderTimeout: 5 * time.Second}
 
 	webhookFlags := web.FlagConfig{
-		WebListenAddresses: &[]string{*listenAddr},
+		WebListenAddresses: &cfg.listenAddrs,
 		WebSystemdSocket:   new(bool),
-		WebConfigFile:      tlsConfig,
+		WebConfigFile:      &cfg.tlsConfig,
 	}
 
 	var wg errgroup.Group
 
 	wg.Go(func() error {
-		logger.Info("Started external-dns-inwx-webhook metrics server", "address", metricsListenAddr)
+		logger.Info("Started external-dns-inwx-webhook metrics server", "addresses", cfg.metricsListenAddrs)
 		return web.ListenAndServe(&metricsServer, &metricsFlags, logger)
 	})
 	wg.Go(func() error {
-		logger.Info("Started external-dns-inwx-webhook webhook server", "address", listenAddr)
+		logger.Info("Started external-dns-inwx-webhook webhook server", "addresses", cfg.listenAddrs)
 		return web.ListenAndServe(&webhookServer, &webhookFlags, logger)
 	})
+	if cfg.discoverDomainFilter {
+		for _, account := range accounts {
+			wg.Go(func() error {
+				return account.Provider.DiscoverDomainFilter(context.Background(), cfg.discoverDomainFilterInterval)
+			})
+		}
+	}
+	if cfg.manageDNSSEC != "off" {
+		for _, account := range accounts {
+			wg.Go(func() error {
+				return account.Provider.ManageDNSSEC(context.Background(), cfg.manageDNSSECInterval, cfg.manageDNSSEC == "auto")
+			})
+		}
+	}
+	if cfg.domainExpiryMetrics {
+		for _, account := range accounts {
+			wg.Go(func() error {
+				return account.Provider.ReportDomainExpiry(context.Background(), cfg.domainExpiryInterval)
+			})
+		}
+	}
+	if cfg.detectDrift {
+		for _, account := range accounts {
+			wg.Go(func() error {
+				return account.Provider.DetectDrift(context.Background(), cfg.detectDriftInterval)
+			})
+		}
+	}
+	if cfg.reconcileInterval > 0 {
+		for _, account := range accounts {
+			wg.Go(func() error {
+				return account.Provider.Reconcile(context.Background(), cfg.reconcileInterval)
+			})
+		}
+	}
+	if cfg.retryQueueSize > 0 {
+		for _, account := range accounts {
+			wg.Go(func() error {
+				return account.Provider.RetryFailedChanges(context.Background(), cfg.retryQueueInterval)
+			})
+		}
+	}
+	if cfg.pollMessages {
+		for _, account := range accounts {
+			wg.Go(func() error {
+				return account.Provider.PollMessages(context.Background(), cfg.pollMessagesInterval)
+			})
+		}
+	}
+	if cfg.secretClient != nil {
+		wg.Go(func() error {
+			return watchCredentialsSecret(context.Background(), cfg, accounts, logger)
+		})
+	}
+	if cfg.vaultClient != nil && cfg.vaultRefreshInterval > 0 {
+		wg.Go(func() error {
+			return refreshVaultCredentials(context.Background(), cfg, accounts, logger)
+		})
+	}
+	if cfg.persistentSession && cfg.sessionKeepAlive > 0 {
+		for _, account := range accounts {
+			wg.Go(func() error {
+				return account.Provider.KeepSessionAlive(context.Background(), cfg.sessionKeepAlive)
+			})
+		}
+	}
+	wg.Go(func() error {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			logger.Info("received SIGHUP, reloading configuration")
+			_ = reload()
+		}
+		return nil
+	})
 
 	if err = wg.Wait(); err != nil {
 		logger.Error("run server group error", "error", err.Error())
@@ -89,11 +842,27 @@ func main() {
 	}
 }
 
-func buildMetricsServer(registry prometheus.Gatherer, logger *slog.Logger) *http.ServeMux {
+// operatorHandlers are the operator endpoints of the metrics server besides /-/reload, only reachable
+// with the admin token.
+type operatorHandlers struct {
+	preview     http.Handler
+	maintenance http.Handler
+	config      http.Handler
+}
+
+func buildMetricsServer(registry prometheus.Gatherer, adminToken string, reload func() error, ready func() error, operator operatorHandlers, dyndns http.Handler, events http.Handler, logger *slog.Logger) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	var healthzPath = "/healthz"
+	var readyzPath = "/readyz"
 	var metricsPath = "/metrics"
+	var reloadPath = "/-/reload"
+	var maintenancePath = "/-/maintenance"
+	var previewPath = "/preview"
+	var configPath = "/debug/config"
+	var openAPIPath = "/openapi.json"
+	var dyndnsPath = "/dyndns"
+	var eventsPath = "/events"
 	var rootPath = "/"
 
 	// Add the exposed "/healthz" endpoint that is used by liveness and readiness probes.
@@ -104,6 +873,16 @@ func buildMetricsServer(registry prometheus.Gatherer, logger *slog.Logger) *http
 		_, _ = w.Write([]byte(http.StatusText(http.StatusOK)))
 	})
 
+	// Add the "/readyz" endpoint, degraded while INWX is in maintenance or logins are locked
+	mux.HandleFunc(readyzPath, func(w http.ResponseWriter, r *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(http.StatusText(http.StatusOK)))
+	})
+
 	// Add metricsPath
 	mux.Handle(metricsPath, promhttp.HandlerFor(
 		registry,
@@ -111,6 +890,41 @@ func buildMetricsServer(registry prometheus.Gatherer, logger *slog.Logger) *http
 			EnableOpenMetrics: true,
 		}))
 
+	// Add openAPIPath, describing the webhook API and the operator endpoints
+	mux.HandleFunc(openAPIPath, openAPIHandler)
+
+	// Add reloadPath, only reachable with the admin token
+	if adminToken != "" {
+		mux.Handle(reloadPath, requireAdminToken(adminToken, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost && r.Method != http.MethodPut {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			if err := reload(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(http.StatusText(http.StatusOK)))
+		})))
+		// Add maintenancePath, freezing the changes of DNS records
+		mux.Handle(maintenancePath, requireAdminToken(adminToken, operator.maintenance))
+		// Add previewPath, answering the INWX operations of a change set without applying it
+		mux.Handle(previewPath, requireAdminToken(adminToken, operator.preview))
+		// Add configPath, answering the resolved configuration with the credentials redacted
+		mux.Handle(configPath, requireAdminToken(adminToken, operator.config))
+	}
+
+	// Add dyndnsPath, authenticating DynDNS clients by the DynDNS token
+	if dyndns != nil {
+		mux.Handle(dyndnsPath, dyndns)
+	}
+
+	// Add eventsPath, streaming the change events to clients authenticating with the events token
+	if events != nil {
+		mux.Handle(eventsPath, events)
+	}
+
 	// Add index
 	landingConfig := web.LandingConfig{
 		Name:        "external-dns-inwx-webhook",
@@ -132,23 +946,71 @@ func buildMetricsServer(registry prometheus.Gatherer, logger *slog.Logger) *http
 	return mux
 }
 
-func buildWebhookServer(logger *slog.Logger) (*http.ServeMux, error) {
+func buildWebhookServer(inwxProvider edprovider.Provider, tenants map[string]edprovider.Provider, logger *slog.Logger) (*http.ServeMux, error) {
 	mux := http.NewServeMux()
 
+	if inwxProvider != nil {
+		addWebhookHandlers(mux, inwxProvider, logger)
+	}
+
+	// Add openAPIPath, describing the webhook API of the root path and of every tenant
+	var openAPIPath = "/openapi.json"
+	mux.HandleFunc(openAPIPath, openAPIHandler)
+
+	// Add the tenants below tenantsPath, each serving the webhook API on its own prefix
+	var tenantsPath = "/tenants/"
+	for name, tenantProvider := range tenants {
+		tenantMux := http.NewServeMux()
+		addWebhookHandlers(tenantMux, tenantProvider, logger.With("tenant", name))
+		prefix := tenantsPath + name
+		handler := stripPrefix(prefix, tenantMux)
+		mux.Handle(prefix, handler)
+		mux.Handle(prefix+"/", handler)
+		logger.Debug("serving tenant", "tenant", name, "path", prefix)
+	}
+
+	return mux, nil
+}
+
+func addWebhookHandlers(mux *http.ServeMux, inwxProvider edprovider.Provider, logger *slog.Logger) {
 	var rootPath = "/"
 	var recordsPath = "/records"
 	var adjustEndpointsPath = "/adjustendpoints"
 
 	p := webhook.WebhookServer{
-		Provider: provider.NewINWXProvider(domainFilter, *username, *password, *sandbox, logger),
+		Provider: inwxProvider,
 	}
 
 	// Add negotiatePath
-	mux.HandleFunc(rootPath, p.NegotiateHandler)
+	mux.HandleFunc(rootPath, negotiateHandler(inwxProvider, logger))
 	// Add adjustEndpointsPath
 	mux.HandleFunc(adjustEndpointsPath, p.AdjustEndpointsHandler)
-	// Add recordsPath
-	mux.HandleFunc(recordsPath, p.RecordsHandler)
+	// Add recordsPath, answering the result of every change if applying changes partially failed
+	if applier, ok := inwxProvider.(resultsApplier); ok {
+		mux.Handle(recordsPath, applyResultsHandler(applier, http.HandlerFunc(p.RecordsHandler), logger))
+	} else {
+		mux.HandleFunc(recordsPath, p.RecordsHandler)
+	}
+}
 
-	return mux, nil
+// stripPrefix is http.StripPrefix serving the prefix itself as the root path, as external-dns
+// negotiates on the configured webhook URL without a trailing slash.
+func stripPrefix(prefix string, next http.Handler) http.Handler {
+	return http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" {
+			r.URL.Path = "/"
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// requireAdminToken rejects requests not carrying the admin token as bearer token.
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
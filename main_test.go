@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockProvider(zones ...string) (*provider.MockClientWrapper, *provider.INWXProvider) {
+	mock := provider.NewMockClientWrapper()
+	for _, zone := range zones {
+		mock.AddZone(zone)
+	}
+	return mock, provider.NewINWXProvider(provider.Config{Client: provider.ClientOptions{Backend: mock}, Logger: slog.Default()})
+}
+
+func TestApplyResultsHandler(t *testing.T) {
+	mock, p := newMockProvider("example.com")
+	handler := applyResultsHandler(p, http.NotFoundHandler(), slog.Default())
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"updateOld":[{"dnsName":"www.example.com","recordType":"A","targets":["192.0.2.1"]},{"dnsName":"api.example.com","recordType":"A","targets":["192.0.2.2"]}],"updateNew":[{"dnsName":"www.example.com","recordType":"A","targets":["192.0.2.3"]}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "updates without their new endpoints are refused")
+	assert.Contains(t, w.Body.String(), "differ in length")
+	records, _ := mock.GetRecords("example.com")
+	assert.Empty(t, *records)
+
+	assert.Equal(t, http.StatusBadRequest, post(`not json`).Code)
+	assert.Equal(t, http.StatusNoContent, post(`{"create":[{"dnsName":"www.example.com","recordType":"A","targets":["192.0.2.1"]}]}`).Code)
+	records, _ = mock.GetRecords("example.com")
+	assert.Len(t, *records, 1)
+}
+
+func TestReloadAccounts(t *testing.T) {
+	dir := t.TempDir()
+	accountsFile := filepath.Join(dir, "accounts.yaml")
+	writeAccounts := func(sandbox bool) {
+		content := fmt.Sprintf("accounts:\n  - name: customer\n    username: customer\n    password: secret\n    sandbox: %t\n", sandbox)
+		assert.NoError(t, os.WriteFile(accountsFile, []byte(content), 0o600))
+	}
+	writeAccounts(false)
+	load := func(args ...string) *config {
+		_, cfg, err := loadConfig(append([]string{serveCommand, "--inwx-username=user", "--inwx-password=password", "--accounts-file=" + accountsFile}, args...))
+		assert.NoError(t, err)
+		return cfg
+	}
+	_, p := newMockProvider("example.com")
+	_, customer := newMockProvider("example.org")
+	accounts := []provider.Account{{Name: defaultAccount, Provider: p}, {Name: "customer", Provider: customer}}
+	cfg := load()
+	app, _ := newApplication()
+	for _, name := range reloadableFlags {
+		assert.NotNil(t, app.GetFlag(name), name)
+	}
+
+	// the settings only read on start
+	for _, args := range [][]string{
+		{"--inwx-http-max-conns=2"},
+		{"--inwx-create-concurrency=4"},
+		{"--inwx-tls-min-version=1.3"},
+		{"--log-inwx-payloads"},
+		{"--log-inwx-connections"},
+		{"--redact-record-content"},
+		{"--journal-file=" + filepath.Join(dir, "journal.jsonl")},
+		{"--journal-sink=kafka://broker/audit"},
+		{"--journal-sink-header=Authorization: Splunk token"},
+		{"--inwx-persistent-session"},
+		{"--shared-cache-url=redis://localhost"},
+		{"--snapshot-location=" + dir},
+		{"--records-cache-file=" + filepath.Join(dir, "records.json")},
+		{"--read-only"},
+		{"--deletion-grace-period=1m"},
+		{"--retry-queue-size=10"},
+		{"--dedup-window=1m"},
+		{"--admin-token=rotated"},
+		{"--events-token=rotated"},
+		{"--dyndns-token=rotated", "--dyndns-hostname=home.example.com"},
+	} {
+		flag, _, _ := strings.Cut(args[0], "=")
+		assert.ErrorContains(t, reloadAccounts(accounts, cfg, load(args...)), flag, "%s is not reloadable", flag)
+	}
+	assert.EqualError(t, reloadAccounts(accounts, cfg, load("--admin-token=rotated", "--read-only")), "--admin-token, --read-only changed, a restart is required")
+
+	assert.NoError(t, reloadAccounts(accounts, cfg, load("--default-ttl=600", "--domain-filter=example.com", "--max-sync-api-calls=10", "--max-error-ratio=0.5", "--subdomains-only", "--ownership-guard")))
+	assert.True(t, p.GetDomainFilter().Match("www.example.com"))
+	assert.False(t, p.GetDomainFilter().Match("www.example.org"))
+
+	writeAccounts(true)
+	assert.EqualError(t, reloadAccounts(accounts, cfg, load()), "the sandbox or tenant of account customer changed, a restart is required")
+	newCfg := load()
+	newCfg.username = ""
+	assert.ErrorContains(t, reloadAccounts(accounts, cfg, newCfg), "the set of accounts changed")
+}
+
+func TestEventsHandler(t *testing.T) {
+	broker := provider.NewEventBroker()
+	server := httptest.NewServer(eventsHandler(broker, "secret", slog.Default()))
+	defer server.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+	get := func(token string, query string) *http.Response {
+		r, err := http.NewRequest(http.MethodGet, server.URL+"/events"+query, nil)
+		assert.NoError(t, err)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(r)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := get("", "")
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = get("wrong", "")
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	resp = get("secret", "?result=skipped")
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, string(body), `invalid result "skipped"`)
+
+	// the headers are sent once subscribed, so the events published afterwards are streamed
+	resp = get("secret", "?account=customer&result=failed")
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	broker.Publish(provider.ChangeEvent{Account: "other", Action: "create", Name: "www.example.com", Result: provider.EventFailed})
+	broker.Publish(provider.ChangeEvent{Account: "customer", Action: "create", Name: "www.example.com", Result: provider.EventApplied})
+	broker.Publish(provider.ChangeEvent{Account: "customer", Action: "delete", Name: "api.example.com", Result: provider.EventFailed, Error: "unreachable"})
+	scanner := bufio.NewScanner(resp.Body)
+	lines := []string{}
+	for len(lines) < 3 && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if !assert.Len(t, lines, 3) {
+		return
+	}
+	assert.Equal(t, []string{"event: change", "id: 1"}, lines[:2])
+	e := provider.ChangeEvent{}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &e))
+	assert.Equal(t, "api.example.com", e.Name)
+	assert.Equal(t, "unreachable", e.Error)
+}
+
+func TestDyndnsHandler(t *testing.T) {
+	mock, p := newMockProvider("example.com")
+	handler := dyndnsHandler(p, "secret", []string{"home.example.com."}, slog.Default())
+	update := func(query string, authorize func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/nic/update?"+query, nil)
+		r.RemoteAddr = "[::ffff:198.51.100.7]:4321"
+		if authorize != nil {
+			authorize(r)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	basic := func(password string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth("router", password) }
+	}
+
+	w := update("hostname=home.example.com", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "badauth\n", w.Body.String())
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, update("hostname=home.example.com", basic("wrong")).Code)
+	assert.Equal(t, http.StatusUnauthorized, update("hostname=home.example.com", func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer wrong")
+	}).Code)
+
+	w = update("hostname=home.example.com&myip=192.0.2.1,%202001:db8::1", basic("secret"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "good 192.0.2.1,2001:db8::1\n", w.Body.String())
+	records, _ := mock.GetRecords("example.com")
+	assert.Len(t, *records, 2)
+	w = update("hostname=HOME.example.com.,other.example.com,home&myip=192.0.2.1", func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer secret")
+	})
+	assert.Equal(t, "nochg 192.0.2.1\nnohost\nnotfqdn\n", w.Body.String())
+
+	// without myip, the address of the client is used, unmapped from IPv6
+	w = update("hostname=home.example.com", basic("secret"))
+	assert.Equal(t, "good 198.51.100.7\n", w.Body.String())
+	records, _ = mock.GetRecords("example.com")
+	assert.Len(t, *records, 2)
+
+	w = update("hostname=home.example.com&myip=192.0.2.300", basic("secret"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "911 invalid address \"192.0.2.300\"\n", w.Body.String())
+}
+
+func TestLoadConfig(t *testing.T) {
+	_, cfg, err := loadConfig([]string{validateCommand, "--journal-sink=kafka://broker/audit"})
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.journalSinks, "the sinks are only opened by the commands shipping to them")
+	_, _, err = loadConfig([]string{validateCommand, "--journal-sink=kafka://broker"})
+	assert.ErrorContains(t, err, "invalid --journal-sink")
+
+	// validating constructs no client, neither reading Vault nor connecting to Redis
+	_, cfg, err = loadConfig([]string{validateCommand, "--vault-addr=https://vault.invalid", "--vault-token=token", "--vault-secret-path=secret/data/inwx",
+		"--shared-cache-url=redis://cache.invalid", "--snapshot-before-apply", "--snapshot-location=s3://bucket/snapshots",
+		"--inwx-persistent-session", "--inwx-session-store=kubernetes://sessions", "--inwx-session-store-key=0123456789abcdef"})
+	assert.NoError(t, err)
+	assert.Nil(t, cfg.vaultClient)
+	assert.Nil(t, cfg.sharedStore)
+	assert.Nil(t, cfg.snapshots)
+	assert.Nil(t, cfg.sessionStore)
+	_, cfg, err = loadConfig([]string{validateCommand, "--inwx-credentials-secret=inwx"})
+	assert.NoError(t, err, "the Secret is only read outside of a cluster by the commands using it")
+	assert.Nil(t, cfg.secretClient)
+	assert.Equal(t, "inwx", cfg.credentialsSecretName)
+	_, _, err = loadConfig([]string{validateCommand, "--shared-cache-url=redis://cache/db", "--snapshot-before-apply", "--snapshot-location=s3://", "--inwx-credentials-secret=a/b/c"})
+	assert.ErrorContains(t, err, "invalid --shared-cache-url")
+	assert.ErrorContains(t, err, "invalid --snapshot-location")
+	assert.ErrorContains(t, err, "invalid --inwx-credentials-secret")
+
+	assert.ErrorContains(t, cfg.newClients(), "failed to set up --inwx-credentials-secret", "the commands using the Secret require a cluster")
+
+	// the clients are constructed by the commands using them and taken over on reload
+	args := []string{serveCommand, "--shared-cache-url=redis://cache.invalid", "--snapshot-before-apply", "--snapshot-location=" + t.TempDir()}
+	_, cfg, err = loadConfig(args)
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.newClients())
+	assert.NotNil(t, cfg.sharedStore)
+	assert.NotNil(t, cfg.snapshots)
+	_, reloaded, err := loadConfig(args)
+	assert.NoError(t, err)
+	reloaded.reuseClients(cfg)
+	assert.Same(t, cfg.sharedStore, reloaded.sharedStore)
+	assert.Equal(t, cfg.snapshots, reloaded.snapshots)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var maintenanceModeEnabled = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "external_dns_inwx",
+	Name:      "maintenance_mode",
+	Help:      "Whether the maintenance mode freezes the changes of DNS records; 1 if enabled, 0 otherwise.",
+})
+
+// maintenanceMode freezes the changes of DNS records by operators, e.g. during an incident response,
+// while the records are still served.
+type maintenanceMode struct {
+	mu      sync.Mutex
+	enabled bool
+	// until ends the maintenance mode, never if zero
+	until time.Time
+	// retryAfter is the Retry-After of refused changes without an end of the maintenance mode
+	retryAfter time.Duration
+}
+
+type maintenanceView struct {
+	Enabled bool       `json:"enabled"`
+	Until   *time.Time `json:"until,omitempty"`
+}
+
+func newMaintenanceMode(enabled bool, retryAfter time.Duration) *maintenanceMode {
+	m := &maintenanceMode{retryAfter: retryAfter}
+	m.set(enabled, time.Time{})
+	return m
+}
+
+func (m *maintenanceMode) set(enabled bool, until time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled, m.until = enabled, until
+	if enabled {
+		maintenanceModeEnabled.Set(1)
+	} else {
+		maintenanceModeEnabled.Set(0)
+	}
+}
+
+// state returns the state of the maintenance mode, ending it once its end has passed.
+func (m *maintenanceMode) state(now time.Time) maintenanceView {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.enabled && !m.until.IsZero() && !now.Before(m.until) {
+		m.enabled, m.until = false, time.Time{}
+		maintenanceModeEnabled.Set(0)
+	}
+	view := maintenanceView{Enabled: m.enabled}
+	if m.enabled && !m.until.IsZero() {
+		until := m.until
+		view.Until = &until
+	}
+	return view
+}
+
+// freeze refuses the changes posted to the records endpoints of next, the tenants included, with 503
+// Service Unavailable and a Retry-After while the maintenance mode is enabled.
+func (m *maintenanceMode) freeze(next http.Handler, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/records") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := time.Now()
+		state := m.state(now)
+		if !state.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		retryAfter := m.retryAfter
+		if state.Until != nil {
+			retryAfter = state.Until.Sub(now)
+		}
+		logger.Warn("refusing changes in maintenance mode", "path", r.URL.Path)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		writeApplyError(w, http.StatusServiceUnavailable, applyErrorView{Error: "the changes of DNS records are frozen by the maintenance mode", Class: "maintenance_mode"}, logger)
+	})
+}
+
+// handler answers the state of the maintenance mode to GET, enables it on POST or PUT, for the
+// duration of the duration query parameter if set, and disables it on DELETE.
+func (m *maintenanceMode) handler(logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			var until time.Time
+			if value := r.URL.Query().Get("duration"); value != "" {
+				duration, err := time.ParseDuration(value)
+				if err != nil || duration <= 0 {
+					http.Error(w, "invalid duration "+value+": expected a positive duration, e.g. 30m", http.StatusBadRequest)
+					return
+				}
+				until = time.Now().Add(duration)
+			}
+			m.set(true, until)
+			logger.Warn("enabled maintenance mode, changes of DNS records are refused", "until", until)
+		case http.MethodDelete:
+			m.set(false, time.Time{})
+			logger.Info("disabled maintenance mode")
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(m.state(time.Now()))
+	})
+}
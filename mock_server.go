@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+)
+
+func runMockServer(cfg *config, logger *slog.Logger) int {
+	mock := provider.NewMockClientWrapper()
+	fixture := cfg.fixture()
+	if err := mock.LoadFixture(fixture); err != nil {
+		logger.Error("failed to load mock fixture", "path", cfg.mockFixtureFile, "error", err.Error())
+		return 1
+	}
+	zones := []string{}
+	for _, zone := range fixture.Zones {
+		zones = append(zones, zone.Name)
+	}
+	handler := provider.NewMockServer(mock, cfg.username, cfg.password, logger)
+	handler.SetFaults(cfg.mockFaults)
+	server := &http.Server{
+		Addr:              cfg.mockAddress,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	logger.Info("serving mock INWX API", "address", cfg.mockAddress, "url", "http://"+cfg.mockAddress+"/xmlrpc/", "zones", zones)
+	if err := server.ListenAndServe(); err != nil {
+		logger.Error("mock INWX API failed", "error", err.Error())
+		return 1
+	}
+	return 0
+}
+
+// fakeProvider is the --provider keeping the records in memory instead of INWX.
+const fakeProvider = "fake"
+
+// useFakeProvider gives the default account placeholder credentials, which the fake provider ignores,
+// unless accounts are configured.
+func (cfg *config) useFakeProvider() {
+	if cfg.username == "" && cfg.password == "" && len(cfg.accountConfigs) == 0 {
+		cfg.username, cfg.password = fakeProvider, fakeProvider
+	}
+}
+
+// fakeBackend returns a mock account started from the fixture and the mock zones, along with the
+// middleware serializing the concurrent calls of the webhook, which the mock is not safe for.
+func (cfg *config) fakeBackend() (provider.AbstractClientWrapper, []provider.Middleware) {
+	mock := provider.NewMockClientWrapper()
+	// the fixture was loaded without errors by validate
+	_ = mock.LoadFixture(cfg.fixture())
+	mu := &sync.Mutex{}
+	return mock, []provider.Middleware{provider.Intercept(func(_ string, call func() error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return call()
+	})}
+}
+
+// fixture returns the fixture of --mock-fixture with the zones of --mock-zone added.
+func (cfg *config) fixture() *provider.MockFixture {
+	fixture := cfg.mockFixture
+	fixture.Zones = slices.Clone(fixture.Zones)
+	for _, zone := range cfg.mockZones {
+		if !slices.ContainsFunc(fixture.Zones, func(z provider.MockFixtureZone) bool { return z.Name == zone }) {
+			fixture.Zones = append(fixture.Zones, provider.MockFixtureZone{Name: zone})
+		}
+	}
+	return &fixture
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	edprovider "sigs.k8s.io/external-dns/provider"
+	webhookapi "sigs.k8s.io/external-dns/provider/webhook/api"
+)
+
+// negotiation is the serialized negotiation response of a domain filter.
+type negotiation struct {
+	filter *endpoint.DomainFilter
+	body   []byte
+	etag   string
+}
+
+// negotiateHandler answers the negotiation of external-dns with the domain filter of p like
+// webhookapi.WebhookServer.NegotiateHandler, serializing it only when the provider returns another
+// filter, as after a reload or a domain filter discovery. Clients revalidate the response by its ETag.
+func negotiateHandler(p edprovider.Provider, logger *slog.Logger) http.HandlerFunc {
+	var mu sync.Mutex
+	var cached *negotiation
+	return func(w http.ResponseWriter, r *http.Request) {
+		df, ok := p.GetDomainFilter().(*endpoint.DomainFilter)
+		if !ok {
+			// only the filters of the providers of this webhook are known to be immutable
+			(&webhookapi.WebhookServer{Provider: p}).NegotiateHandler(w, r)
+			return
+		}
+		mu.Lock()
+		current := cached
+		if current == nil || current.filter != df {
+			body, err := json.Marshal(df)
+			if err != nil {
+				mu.Unlock()
+				logger.Error("failed to encode the domain filter", "error", err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			sum := sha256.Sum256(body)
+			current = &negotiation{filter: df, body: append(body, '\n'), etag: `"` + hex.EncodeToString(sum[:8]) + `"`}
+			cached = current
+		}
+		mu.Unlock()
+
+		w.Header().Set(webhookapi.ContentTypeHeader, webhookapi.MediaTypeFormatAndVersion)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", current.etag)
+		if r.Header.Get("If-None-Match") == current.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write(current.body)
+	}
+}
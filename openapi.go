@@ -0,0 +1,21 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPIDocument describes the webhook API and the operator endpoints.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// openAPIHandler answers the OpenAPI document, e.g. to generate clients and gateway configs.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPIDocument)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	inwx "github.com/nrdcg/goinwx"
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"sigs.k8s.io/external-dns/plan"
+	edprovider "sigs.k8s.io/external-dns/provider"
+)
+
+// previewer is implemented by the providers of a single and of several accounts.
+type previewer interface {
+	PreviewChanges(ctx context.Context, changes *plan.Changes) ([]provider.ChangeResult, []provider.PreviewOperation, error)
+}
+
+type operationView struct {
+	Account string      `json:"account,omitempty"`
+	Zone    string      `json:"zone"`
+	Action  string      `json:"action"`
+	ID      int         `json:"id,omitempty"`
+	Before  *recordView `json:"before,omitempty"`
+	After   *recordView `json:"after,omitempty"`
+}
+
+type previewView struct {
+	Results    []changeResultView `json:"results"`
+	Operations []operationView    `json:"operations"`
+}
+
+// previewHandler answers a change set (plan.Changes JSON) posted with the result of every change and
+// the INWX record operations applying it would execute, without applying it. The change set is
+// previewed by the provider of the tenant query parameter, or of the root path if not set.
+func previewHandler(root edprovider.Provider, tenants map[string]edprovider.Provider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		p := root
+		if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+			p = tenants[tenant]
+		}
+		preview, ok := p.(previewer)
+		if !ok {
+			http.Error(w, "unknown tenant", http.StatusNotFound)
+			return
+		}
+		changes, err := decodeChanges(r.Body)
+		if err != nil {
+			http.Error(w, "invalid change set: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, operations, err := preview.PreviewChanges(r.Context(), changes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		view := previewView{Operations: []operationView{}}
+		view.Results, _ = changeResultViews(results)
+		for _, operation := range operations {
+			view.Operations = append(view.Operations, operationView{
+				Account: operation.Account,
+				Zone:    operation.Zone,
+				Action:  operation.Action,
+				ID:      operation.ID,
+				Before:  previewRecordView(operation.Before),
+				After:   previewRecordView(operation.After),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(view)
+	})
+}
+
+func previewRecordView(rec *inwx.NameserverRecord) *recordView {
+	if rec == nil {
+		return nil
+	}
+	return &recordView{ID: max(rec.ID, 0), Name: rec.Name, Type: rec.Type, Content: rec.Content, TTL: rec.TTL, Priority: rec.Priority}
+}
@@ -0,0 +1,26 @@
+package inwx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// AdoptionRecords returns the ownership TXT records of the owner of g that make external-dns adopt
+// records, one for every name and type among them in the current format of the TXT registry, e.g.
+// for the orphaned records of existing zones.
+func (g *OwnershipGuard) AdoptionRecords(records []*endpoint.Endpoint) []*endpoint.Endpoint {
+	content := fmt.Sprintf(`"heritage=external-dns,external-dns/owner=%s"`, g.ownerID)
+	adoptions := []*endpoint.Endpoint{}
+	for _, ep := range records {
+		name := g.txtNames(ep.DNSName, ep.RecordType)[0]
+		if slices.ContainsFunc(adoptions, func(txt *endpoint.Endpoint) bool { return txt.DNSName == name }) {
+			continue
+		}
+		adoptions = append(adoptions, endpoint.NewEndpointWithTTL(name, endpoint.RecordTypeTXT, ep.RecordTTL, content))
+	}
+	slices.SortFunc(adoptions, func(a, b *endpoint.Endpoint) int { return strings.Compare(a.DNSName, b.DNSName) })
+	return adoptions
+}
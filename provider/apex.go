@@ -0,0 +1,34 @@
+package inwx
+
+import (
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// isApex tells whether dnsName is the apex of zone.
+func isApex(zone string, dnsName string) bool {
+	return strings.EqualFold(strings.TrimSuffix(dnsName, "."), zone)
+}
+
+// withoutApex drops the endpoints at the apex of the pinned or last listed zones if only subdomains
+// are managed. Changes of endpoints at the apex of other zones are refused when applied.
+func (p *INWXProvider) withoutApex(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	p.configMu.RLock()
+	subdomainsOnly := p.subdomainsOnly
+	p.configMu.RUnlock()
+	if !subdomainsOnly {
+		return endpoints
+	}
+	p.sessionMu.Lock()
+	zones := slices.Concat(p.zones, p.soaZones)
+	p.sessionMu.Unlock()
+	return slices.DeleteFunc(endpoints, func(ep *endpoint.Endpoint) bool {
+		if !slices.ContainsFunc(zones, func(zone string) bool { return isApex(zone, ep.DNSName) }) {
+			return false
+		}
+		p.logger.Warn("ignoring endpoint at a zone apex, only subdomains are managed", "name", ep.DNSName, "type", ep.RecordType)
+		return true
+	})
+}
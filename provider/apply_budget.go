@@ -0,0 +1,99 @@
+package inwx
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errorBudgetMinChanges is the number of changes attempted before the error ratio aborts an apply,
+// so that the first failures of an apply do not abort it.
+const errorBudgetMinChanges = 10
+
+// refusedClasses are the classes of changes refused by the provider itself rather than failed by INWX,
+// which do not indicate a systemic failure.
+var refusedClasses = []string{"not_owned", "no_zone", "apex", "paused", "invalid_content", "record_not_found"}
+
+// applyBudget aborts the remaining changes of an apply once more than maxRatio of the changes
+// attempted failed, e.g. for expired credentials, instead of failing thousands of API calls, or once
+// the apply made maxCalls API calls or ran until deadline, so that a huge plan does not hold the
+// session for long. The changes aborted fail with the class aborted for external-dns to retry them
+// in its next sync.
+type applyBudget struct {
+	// maxRatio is the ratio of failed changes aborting the apply, 0 if never aborted
+	maxRatio float64
+	// maxCalls is the number of API calls aborting the apply, 0 if unlimited
+	maxCalls int64
+	// deadline aborts the apply, never if zero
+	deadline time.Time
+	calls    atomic.Int64
+	// mu guards the counts, as creates are attempted concurrently
+	mu                sync.Mutex
+	attempted, failed int
+	aborted           bool
+}
+
+// newApplyBudget returns the budget of an apply of p started at start.
+func (p *INWXProvider) newApplyBudget(start time.Time) *applyBudget {
+	b := &applyBudget{maxRatio: p.maxErrorRatio, maxCalls: int64(p.maxApplyCalls)}
+	if p.maxApplyDuration > 0 {
+		b.deadline = start.Add(p.maxApplyDuration)
+	}
+	return b
+}
+
+// count returns client counting its calls against the budget.
+func (b *applyBudget) count(client AbstractClientWrapper) AbstractClientWrapper {
+	return Intercept(func(_ string, call func() error) error {
+		b.calls.Add(1)
+		return call()
+	})(client)
+}
+
+// record counts the result of a change attempted.
+func (b *applyBudget) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempted++
+	if err != nil && !slices.Contains(refusedClasses, ErrorClass(err)) {
+		b.failed++
+	}
+}
+
+// exhausted returns whether the remaining changes are aborted.
+func (b *applyBudget) exhausted() bool {
+	return b.exhaustedError() != nil
+}
+
+// exhaustedError returns the error of the changes aborted, nil unless the budget is exhausted.
+func (b *applyBudget) exhaustedError() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.maxRatio > 0 && b.attempted >= errorBudgetMinChanges && float64(b.failed) > b.maxRatio*float64(b.attempted):
+		return fmt.Errorf("%d of %d changes failed, more than the maximum error ratio of %g, %w", b.failed, b.attempted, b.maxRatio, errAborted)
+	case b.maxCalls > 0 && b.calls.Load() >= b.maxCalls:
+		return fmt.Errorf("the sync made the maximum of %d API calls, %w", b.maxCalls, errAborted)
+	case !b.deadline.IsZero() && !time.Now().Before(b.deadline):
+		return fmt.Errorf("the sync ran for its maximum duration, %w", errAborted)
+	}
+	return nil
+}
+
+// abort fails changes as aborted by the exhausted budget, logging the first abort of the apply.
+func (b *applyBudget) abort(changes []zoneChange, results []ChangeResult, logger *slog.Logger) {
+	err := b.exhaustedError()
+	b.mu.Lock()
+	first := !b.aborted
+	b.aborted = true
+	b.mu.Unlock()
+	if first {
+		logger.Error("aborting the remaining changes of the sync", "changes", len(changes), "err", err)
+	}
+	for _, change := range changes {
+		results[change.result].Err = err
+	}
+}
@@ -0,0 +1,312 @@
+package inwx
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	inwx "github.com/nrdcg/goinwx"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// zoneChange is the change of an endpoint in a zone batch, with the index of its result.
+type zoneChange struct {
+	result int
+	// old is the endpoint replaced by ep for updates
+	old *endpoint.Endpoint
+	ep  *endpoint.Endpoint
+}
+
+// zoneBatch are the changes of the endpoints of a zone, applied together with the records of the
+// zone fetched once: the deletes, then the creates, then the updates.
+type zoneBatch struct {
+	zone    string
+	deletes []zoneChange
+	creates []zoneChange
+	updates []zoneChange
+}
+
+// zoneBatches returns the result of every change, in the order of changes, and the batches of the
+// zones of the changes, in the order of their first change. The results of the changes of endpoints
+// without a zone, and of updates missing their old or new endpoint, are failed already.
+func (p *INWXProvider) zoneBatches(index zoneIndex, changes *plan.Changes) ([]ChangeResult, []*zoneBatch) {
+	results := []ChangeResult{}
+	batches := []*zoneBatch{}
+	byZone := map[string]*zoneBatch{}
+	add := func(action string, old *endpoint.Endpoint, ep *endpoint.Endpoint) {
+		results = append(results, ChangeResult{Action: action, Endpoint: ep})
+		zone, err := p.getZone(index, old)
+		if err != nil {
+			results[len(results)-1].Err = err
+			p.logger.Error("failed to find the zone of the endpoint", "action", action, "ep", ep, "err", err)
+			return
+		}
+		if p.subdomainsOnly && isApex(zone, ep.DNSName) {
+			results[len(results)-1].Err = fmt.Errorf("refusing to change endpoint %s at the apex of zone %s, %w", ep, zone, errApex)
+			p.logger.Error("refusing to change endpoint at a zone apex", "action", action, "ep", ep, "zone", zone)
+			return
+		}
+		if action != "delete" {
+			if err := validateContent(ep); err != nil {
+				results[len(results)-1].Err = err
+				p.logger.Error("refusing to apply endpoint with an invalid target", "action", action, "ep", ep, "err", err)
+				return
+			}
+		}
+		batch, ok := byZone[zone]
+		if !ok {
+			batch = &zoneBatch{zone: zone}
+			byZone[zone] = batch
+			batches = append(batches, batch)
+		}
+		change := zoneChange{result: len(results) - 1, old: old, ep: ep}
+		switch action {
+		case "delete":
+			batch.deletes = append(batch.deletes, change)
+		case "create":
+			batch.creates = append(batch.creates, change)
+		default:
+			batch.updates = append(batch.updates, change)
+		}
+	}
+	for _, ep := range changes.Delete {
+		add("delete", ep, ep)
+	}
+	for _, ep := range changes.Create {
+		add("create", ep, ep)
+	}
+	for i := range max(len(changes.UpdateOld), len(changes.UpdateNew)) {
+		if i >= len(changes.UpdateOld) || i >= len(changes.UpdateNew) {
+			var ep *endpoint.Endpoint
+			if i < len(changes.UpdateOld) {
+				ep = changes.UpdateOld[i]
+			} else {
+				ep = changes.UpdateNew[i]
+			}
+			results = append(results, ChangeResult{Action: "update", Endpoint: ep, Err: errUnpairedUpdate})
+			p.logger.Error("refusing to apply an update without both endpoints", "ep", ep)
+			continue
+		}
+		add("update", changes.UpdateOld[i], changes.UpdateNew[i])
+	}
+	return results, batches
+}
+
+// applyZoneBatch applies the changes of a zone like applyBatch, counting and logging them.
+func (p *INWXProvider) applyZoneBatch(batch *zoneBatch, results []ChangeResult, budget *applyBudget) {
+	p.applyBatch(batch, results, budget)
+
+	failed := 0
+	for _, change := range batch.changes() {
+		result := results[change.result]
+		outcome := "success"
+		if result.Err != nil {
+			outcome = "error"
+			failed++
+		}
+		zoneChangesTotal.WithLabelValues(batch.zone, result.Action, outcome).Inc()
+	}
+	p.logger.Info("applied zone changes", "zone", batch.zone, "deletes", len(batch.deletes), "creates", len(batch.creates), "updates", len(batch.updates), "failed", failed)
+}
+
+// applyBatch applies the changes of a zone, setting their results, unless the zone is paused. A
+// failure to fetch the records of the zone fails the deletes and updates of the zone only. Once the
+// budget of the apply is exhausted, the remaining changes are aborted.
+func (p *INWXProvider) applyBatch(batch *zoneBatch, results []ChangeResult, budget *applyBudget) {
+	logger := p.logger.With("zone", batch.zone)
+	if budget.exhausted() {
+		budget.abort(batch.changes(), results, logger)
+		return
+	}
+	var records *zoneRecords
+	var recordsErr error
+	// zoneRecords fetches the records of the zone once, and again after creates, which may have
+	// created the ownership records of updated endpoints
+	zoneRecords := func() (*zoneRecords, error) {
+		if records == nil && recordsErr == nil {
+			var recs *[]inwx.NameserverRecord
+			if recs, recordsErr = p.client.GetRecords(batch.zone); recordsErr != nil {
+				logger.Error("failed to query DNS zone info", "err", recordsErr)
+			} else {
+				records = newZoneRecords(batch.zone, recs)
+				records.protectApex = p.subdomainsOnly
+			}
+		}
+		return records, recordsErr
+	}
+
+	if reason, ok := p.pause(batch.zone, zoneRecords); ok {
+		p.pauseBatch(batch, results, reason)
+		return
+	}
+	apply := func(changes []zoneChange, f func(change zoneChange) error) {
+		for i, change := range changes {
+			if budget.exhausted() {
+				budget.abort(changes[i:], results, logger)
+				return
+			}
+			results[change.result].Err = f(change)
+			budget.record(results[change.result].Err)
+		}
+	}
+	apply(batch.deletes, func(change zoneChange) error {
+		return p.applyDelete(batch.zone, change.ep, zoneRecords, logger)
+	})
+	create := func(change zoneChange) error {
+		return p.applyCreate(batch.zone, change.ep, zoneRecords, logger)
+	}
+	if p.createConcurrency > 1 && len(batch.creates) > 1 {
+		// the records are fetched before, as zoneRecords is not safe for concurrent calls
+		if p.deletionGracePeriod > 0 {
+			_, _ = zoneRecords()
+		}
+		p.applyCreates(batch.creates, create, results, budget, logger)
+	} else {
+		apply(batch.creates, create)
+	}
+	if len(batch.creates) > 0 {
+		records, recordsErr = nil, nil
+	}
+	apply(batch.updates, func(change zoneChange) error {
+		return p.applyUpdate(batch.zone, change.old, change.ep, zoneRecords, logger)
+	})
+}
+
+// changes returns all changes of the batch.
+func (batch *zoneBatch) changes() []zoneChange {
+	changes := append([]zoneChange{}, batch.deletes...)
+	changes = append(changes, batch.creates...)
+	return append(changes, batch.updates...)
+}
+
+// applyDelete deletes the records of ep from zone.
+func (p *INWXProvider) applyDelete(zone string, ep *endpoint.Endpoint, zoneRecords func() (*zoneRecords, error), logger *slog.Logger) error {
+	records, err := zoneRecords()
+	if err != nil {
+		return err
+	}
+	if p.ownership != nil && !p.ownership.owns(records, ep) {
+		logger.Error("refusing to delete records not owned by external-dns", "ep", ep)
+		return fmt.Errorf("refusing to delete endpoint %s %w", ep, errNotOwned)
+	}
+	if p.deletionGracePeriod > 0 {
+		return p.softDelete(zone, ep, records, logger)
+	}
+	errs := []error{}
+	recIDs, err := getRecIDs(records, *ep)
+	if err != nil {
+		errs = append(errs, err)
+		logger.Error("failed to look up records to delete", "err", err)
+	}
+	for _, id := range append(recIDs, duplicateRecIDs(records, *ep)...) {
+		if err := p.client.DeleteRecord(id); err != nil {
+			errs = append(errs, err)
+			logger.Error("failed to delete record", "id", id, "ep", ep, "err", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyCreate creates a record of every target of ep in zone, restoring the records of ep instead if
+// they are soft-deleted, or only validates their creation in the testing mode of INWX.
+func (p *INWXProvider) applyCreate(zone string, ep *endpoint.Endpoint, zoneRecords func() (*zoneRecords, error), logger *slog.Logger) error {
+	if testingMode(ep) {
+		return p.testCreate(zone, ep, logger)
+	}
+	if p.deletionGracePeriod > 0 {
+		records, err := zoneRecords()
+		if err != nil {
+			return err
+		}
+		if deletion, markerIDs, ok := records.softDeletion(ep); ok {
+			return p.restoreSoftDeleted(zone, ep, records, deletion, markerIDs, logger)
+		}
+	}
+	errs := []error{}
+	for _, target := range ep.Targets {
+		rec := p.recordRequest(zone, ep, target, 0)
+		if err := p.client.CreateRecord(rec); err != nil {
+			errs = append(errs, err)
+			logger.Error("failed to create record", "rec", rec, "err", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// testCreate validates the creation of a record of every target of ep in zone in the testing mode of
+// INWX without creating them.
+func (p *INWXProvider) testCreate(zone string, ep *endpoint.Endpoint, logger *slog.Logger) error {
+	errs := []error{}
+	for _, target := range ep.Targets {
+		rec := p.recordRequest(zone, ep, target, 0)
+		if err := p.client.TestRecord(rec); err != nil {
+			errs = append(errs, err)
+			logger.Error("failed to validate record in testing mode", "rec", rec, "err", err)
+		} else {
+			logger.Info("validated record in testing mode without creating it", "rec", rec)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyUpdate updates the records of the targets of oldEp to the targets of newEp in zone, creating
+// or deleting the records of the targets added or removed.
+func (p *INWXProvider) applyUpdate(zone string, oldEp *endpoint.Endpoint, newEp *endpoint.Endpoint, zoneRecords func() (*zoneRecords, error), logger *slog.Logger) error {
+	records, err := zoneRecords()
+	if err != nil {
+		return err
+	}
+	if p.ownership != nil && !p.ownership.owns(records, oldEp) {
+		logger.Error("refusing to update records not owned by external-dns", "ep", oldEp)
+		return fmt.Errorf("refusing to update endpoint %s %w", oldEp, errNotOwned)
+	}
+	recIDs, err := getRecIDs(records, *oldEp)
+	if err != nil {
+		logger.Error("failed to look up records to update", "ep", oldEp, "err", err)
+		return err
+	}
+	errs := []error{}
+	for j := range max(len(oldEp.Targets), len(newEp.Targets)) {
+		switch {
+		case j >= len(newEp.Targets):
+			if err := p.client.DeleteRecord(recIDs[j]); err != nil {
+				errs = append(errs, err)
+				logger.Error("failed to delete record", "target", oldEp.Targets[j], "ep", oldEp, "err", err)
+			}
+		case j >= len(oldEp.Targets):
+			rec := p.recordRequest(zone, newEp, newEp.Targets[j], 0)
+			if err := p.client.CreateRecord(rec); err != nil {
+				errs = append(errs, err)
+				logger.Error("failed to create record", "rec", rec, "err", err)
+			}
+		default:
+			rec := p.recordRequest(zone, newEp, newEp.Targets[j], int(oldEp.RecordTTL))
+			if err := p.client.UpdateRecord(recIDs[j], rec); err != nil {
+				errs = append(errs, err)
+				logger.Error("failed to update record", "rec", rec, "err", err)
+			}
+		}
+	}
+	for _, id := range duplicateRecIDs(records, *oldEp) {
+		if err := p.client.DeleteRecord(id); err != nil {
+			errs = append(errs, err)
+			logger.Error("failed to delete duplicate record", "id", id, "ep", oldEp, "err", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// recordRequest returns the request of the record of a target of ep in zone, with the TTL of the
+// record updated as current.
+func (p *INWXProvider) recordRequest(zone string, ep *endpoint.Endpoint, target string, current int) *inwx.NameserverRecordRequest {
+	content, priority := splitPriority(ep.RecordType, target)
+	return &inwx.NameserverRecordRequest{
+		Domain:   zone,
+		Name:     relativeName(zone, ep.DNSName),
+		Type:     ep.RecordType,
+		TTL:      p.recordTTL(ep, current),
+		Content:  content,
+		Priority: priority,
+	}
+}
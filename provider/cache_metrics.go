@@ -0,0 +1,28 @@
+package inwx
+
+import "time"
+
+// The caches reported by the cache metrics.
+const (
+	// cacheRecordsFile is the records cache file serving the records after a start
+	cacheRecordsFile = "records_file"
+	// cacheSharedRecords are the records shared with other replicas
+	cacheSharedRecords = "shared_records"
+	// cacheZoneIndex is the index resolving DNS names to their zones
+	cacheZoneIndex = "zone_index"
+)
+
+// reportCacheLookup counts a lookup of cache as a hit or a miss.
+func reportCacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookupsTotal.WithLabelValues(cache, result).Inc()
+}
+
+// reportCacheUpdate exports the number of entries of cache and when they were updated.
+func reportCacheUpdate(cache string, entries int, updated time.Time) {
+	cacheEntries.WithLabelValues(cache).Set(float64(entries))
+	cacheUpdated.WithLabelValues(cache).Set(float64(updated.UnixNano()) / 1e9)
+}
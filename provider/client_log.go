@@ -0,0 +1,42 @@
+package inwx
+
+import (
+	"crypto/tls"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// BridgeClientLog routes the output of the standard log package through logger at warn level. The
+// INWX API client has no logger of its own, but net/http and its HTTP/2 transport log there, e.g.
+// unsolicited responses and, with GODEBUG=http2debug=1, the frames.
+func BridgeClientLog(logger *slog.Logger) {
+	log.SetFlags(0)
+	log.SetOutput(slog.NewLogLogger(logger.Handler(), slog.LevelWarn).Writer())
+}
+
+// traceConnections adds a trace to r logging how the connection of the API request to method was
+// obtained at debug level: reused or dialed, the DNS lookup and the TLS handshake.
+func (t *instrumentedTransport) traceConnections(r *http.Request, method string) *http.Request {
+	var dnsStart, connectStart, tlsStart time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			t.logger.Debug("INWX API DNS lookup", "method", method, "addrs", len(info.Addrs), "duration", time.Since(dnsStart), "err", info.Err)
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(network string, addr string, err error) {
+			t.logger.Debug("INWX API connect", "method", method, "network", network, "addr", addr, "duration", time.Since(connectStart), "err", err)
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			t.logger.Debug("INWX API TLS handshake", "method", method, "version", tls.VersionName(state.Version), "protocol", state.NegotiatedProtocol, "resumed", state.DidResume, "duration", time.Since(tlsStart), "err", err)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.logger.Debug("INWX API connection", "method", method, "addr", info.Conn.RemoteAddr(), "reused", info.Reused, "idle", info.IdleTime)
+		},
+	}
+	return r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+}
@@ -1,34 +1,139 @@
 package inwx
 
 import (
+	"crypto/tls"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
 
+	"github.com/fatih/structs"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/kolo/xmlrpc"
 	inwx "github.com/nrdcg/goinwx"
+	"github.com/orbit-online/external-dns-inwx-webhook/journal"
+	"github.com/orbit-online/external-dns-inwx-webhook/sessionstore"
 )
 
+// ClientOptions configures the connection to the INWX API.
+type ClientOptions struct {
+	Username string
+	Password string
+	// Sandbox selects the INWX sandbox (OT&E) API instead of the production API
+	Sandbox bool
+	// APIURL overrides the API endpoint selected by Sandbox, e.g. for an API gateway or a mock, if set
+	APIURL *url.URL
+	// ProxyURL is the proxy for API requests instead of the one configured by HTTP_PROXY and HTTPS_PROXY, if set
+	ProxyURL *url.URL
+	// TLSConfig configures the TLS connections to the API, e.g. with a corporate CA, if set
+	TLSConfig *tls.Config
+	Transport TransportOptions
+	// LogPayloads logs the API request and response bodies at debug level, with secrets redacted
+	LogPayloads bool
+	// LogConnections logs how the connections of the API requests are obtained at debug level
+	LogConnections bool
+	// RedactContent redacts the record content of the logged bodies and of the journal entries
+	RedactContent bool
+	// PersistentSession keeps the API session logged in between calls instead of logging in for every call
+	PersistentSession bool
+	// SessionStore keeps the persistent session across restarts, so that a restarted webhook reuses the
+	// session rather than logging in again, if set. It requires PersistentSession and no Backend
+	SessionStore sessionstore.Store
+	// MaxLoginFailures is the number of logins refused for invalid credentials after which no login is
+	// attempted until the credentials change, as INWX locks accounts; 3 if not set
+	MaxLoginFailures int
+	// CreateConcurrency is the number of records of a zone created concurrently, each by an RPC client
+	// of its own sharing the session; 1 if not set. The creates are rate limited like all calls
+	CreateConcurrency int
+	// Journal records every record change applied, if set
+	Journal *journal.Journal
+	// Middleware wraps the client calling the API, the first middleware being called first
+	Middleware []Middleware
+	// Backend is called instead of the INWX API if set, e.g. a MockClientWrapper serving an account
+	// from memory, and makes the credentials optional
+	Backend AbstractClientWrapper
+	// sessionCookies holds the session cookie saved to the SessionStore, set by NewINWXProvider
+	sessionCookies *sessionCookieTransport
+}
+
+// ClientWrapper is the client calling the INWX API.
 type ClientWrapper struct {
 	client *inwx.Client
+	// creators are the clients creating records concurrently, if ClientOptions.CreateConcurrency is above 1
+	creators chan *inwx.Client
+}
+
+func newClientWrapper(options ClientOptions, logger *slog.Logger) *ClientWrapper {
+	transport := newTransport(options, logger)
+	cookies := options.sessionCookies
+	if cookies == nil && options.CreateConcurrency > 1 {
+		cookies = &sessionCookieTransport{}
+	}
+	if cookies != nil {
+		cookies.setNext(transport)
+		transport = cookies
+	}
+	if options.CreateConcurrency <= 1 {
+		return &ClientWrapper{client: options.newClient(transport)}
+	}
+	w := &ClientWrapper{client: options.newClient(transport), creators: make(chan *inwx.Client, options.CreateConcurrency)}
+	for range options.CreateConcurrency {
+		w.creators <- options.newClient(transport)
+	}
+	return w
+}
+
+func (options ClientOptions) newClient(transport http.RoundTripper) *inwx.Client {
+	client := inwx.NewClient(options.Username, options.Password, &inwx.ClientOptions{Sandbox: options.Sandbox, BaseURL: options.APIURL})
+	// goinwx offers no way to set the transport, so replace the RPC client with one using ours
+	client.RPCClient, _ = xmlrpc.NewClient(options.apiURL(), transport)
+	return client
+}
+
+func (options ClientOptions) apiURL() string {
+	switch {
+	case options.APIURL != nil:
+		return options.APIURL.String()
+	case options.Sandbox:
+		return inwx.APISandboxBaseURL
+	default:
+		return inwx.APIBaseURL
+	}
 }
 
+// AbstractClientWrapper is the client of the INWX API used by the provider. Implementations are
+// wrapped by Middleware, and by the provider to journal changes and to enforce the read-only mode.
 type AbstractClientWrapper interface {
-	login() (*inwx.LoginResponse, error)
-	logout() error
-	getRecords(domain string) (*[]inwx.NameserverRecord, error)
-	getZones() (*[]string, error)
-	createRecord(request *inwx.NameserverRecordRequest) error
-	updateRecord(recID int, request *inwx.NameserverRecordRequest) error
-	deleteRecord(recID int) error
+	Login() (*inwx.LoginResponse, error)
+	Logout() error
+	GetRecords(domain string) (*[]inwx.NameserverRecord, error)
+	GetZones() (*[]inwx.NameserverDomain, error)
+	GetDomains() (*[]inwx.DomainInfoResponse, error)
+	CreateZone(request *inwx.NameserverCreateRequest) error
+	// CloneZone creates the zone target with a copy of all records of the zone source
+	CloneZone(source string, target string) error
+	GetDNSSECStatus(domains []string) (map[string]string, error)
+	GetDNSKeys(domain string) ([]inwx.DNSSecServiceListResponse, error)
+	EnableDNSSEC(domain string) error
+	Ping() error
+	PollMessage() (*AccountMessage, error)
+	AckMessage(id int) error
+	CreateRecord(request *inwx.NameserverRecordRequest) error
+	// TestRecord validates the creation of a record in the testing mode of INWX without creating it
+	TestRecord(request *inwx.NameserverRecordRequest) error
+	UpdateRecord(recID int, request *inwx.NameserverRecordRequest) error
+	DeleteRecord(recID int) error
 }
 
-func (w *ClientWrapper) login() (*inwx.LoginResponse, error) {
+func (w *ClientWrapper) Login() (*inwx.LoginResponse, error) {
 	return w.client.Account.Login()
 }
 
-func (w *ClientWrapper) logout() error {
+func (w *ClientWrapper) Logout() error {
 	return w.client.Account.Logout()
 }
 
-func (w *ClientWrapper) getRecords(domain string) (*[]inwx.NameserverRecord, error) {
+func (w *ClientWrapper) GetRecords(domain string) (*[]inwx.NameserverRecord, error) {
 	zone, err := w.client.Nameservers.Info(&inwx.NameserverInfoRequest{Domain: domain})
 	if err != nil {
 		return nil, fmt.Errorf("unable to retrieve records for zone %s: %w", domain, err)
@@ -36,27 +141,122 @@ func (w *ClientWrapper) getRecords(domain string) (*[]inwx.NameserverRecord, err
 	return &zone.Records, nil
 }
 
-func (w *ClientWrapper) getZones() (*[]string, error) {
-	zones := []string{}
+func (w *ClientWrapper) GetZones() (*[]inwx.NameserverDomain, error) {
 	response, err := w.client.Nameservers.ListWithParams(&inwx.NameserverListRequest{})
 	if err != nil {
 		return nil, fmt.Errorf("no domain filter supplied, failed to list nameserver zones: %w", err)
 	}
-	for _, domain := range response.Domains {
-		zones = append(zones, domain.Domain)
+	return &response.Domains, nil
+}
+
+// GetDomains lists the domains registered with the account, page by page.
+func (w *ClientWrapper) GetDomains() (*[]inwx.DomainInfoResponse, error) {
+	domains := []inwx.DomainInfoResponse{}
+	for page := 1; ; page++ {
+		response, err := w.client.Domains.List(&inwx.DomainListRequest{Page: page, PageLimit: 1000})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list domains: %w", err)
+		}
+		domains = append(domains, response.Domains...)
+		if len(response.Domains) == 0 || len(domains) >= response.Count {
+			return &domains, nil
+		}
+	}
+}
+
+func (w *ClientWrapper) CreateZone(request *inwx.NameserverCreateRequest) error {
+	_, err := w.client.Nameservers.Create(request)
+	return err
+}
+
+func (w *ClientWrapper) CloneZone(source string, target string) error {
+	// goinwx offers no nameserver.clone
+	_, err := w.client.Do(w.client.NewRequest("nameserver.clone", map[string]interface{}{"sourceDomain": source, "targetDomain": target}))
+	return err
+}
+
+// GetDNSSECStatus returns the DNSSEC status of the signed domains among domains, e.g. AUTO.
+func (w *ClientWrapper) GetDNSSECStatus(domains []string) (map[string]string, error) {
+	response, err := w.client.Dnssec.Info(domains)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query DNSSEC status: %w", err)
+	}
+	statuses := map[string]string{}
+	for _, info := range response.Data {
+		statuses[info.Domain] = info.DNSSecStatus
 	}
-	return &zones, nil
+	return statuses, nil
+}
+
+func (w *ClientWrapper) GetDNSKeys(domain string) ([]inwx.DNSSecServiceListResponse, error) {
+	response, err := w.client.Dnssec.List(&inwx.DNSSecServiceListRequest{DomainName: domain})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DNSSEC keys of %s: %w", domain, err)
+	}
+	return response.DNSKeys, nil
+}
+
+func (w *ClientWrapper) EnableDNSSEC(domain string) error {
+	return w.client.Dnssec.Enable(domain)
 }
 
-func (w *ClientWrapper) createRecord(request *inwx.NameserverRecordRequest) error {
-	_, err := w.client.Nameservers.CreateRecord(request)
+// Ping calls account.info, e.g. to keep the session alive.
+func (w *ClientWrapper) Ping() error {
+	_, err := w.client.Do(w.client.NewRequest("account.info", map[string]interface{}{}))
+	return err
+}
+
+// PollMessage returns the oldest unacknowledged message of the account, nil if there is none.
+func (w *ClientWrapper) PollMessage() (*AccountMessage, error) {
+	response, err := w.client.Do(w.client.NewRequest("message.poll", map[string]interface{}{}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to poll account messages: %w", err)
+	}
+	var result struct {
+		Count   int             `mapstructure:"count"`
+		Message *AccountMessage `mapstructure:"msg"`
+	}
+	if err := mapstructure.Decode(response, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode account message: %w", err)
+	}
+	if result.Count == 0 {
+		return nil, nil
+	}
+	return result.Message, nil
+}
+
+func (w *ClientWrapper) AckMessage(id int) error {
+	_, err := w.client.Do(w.client.NewRequest("message.ack", map[string]interface{}{"id": id}))
+	return err
+}
+
+func (w *ClientWrapper) CreateRecord(request *inwx.NameserverRecordRequest) error {
+	client := w.client
+	if w.creators != nil {
+		client = <-w.creators
+		defer func() { w.creators <- client }()
+	}
+	_, err := client.Nameservers.CreateRecord(request)
+	return err
+}
+
+func (w *ClientWrapper) TestRecord(request *inwx.NameserverRecordRequest) error {
+	client := w.client
+	if w.creators != nil {
+		client = <-w.creators
+		defer func() { w.creators <- client }()
+	}
+	// goinwx offers no testing flag for records, so send the request of CreateRecord with it
+	args := structs.Map(request)
+	args["testing"] = true
+	_, err := client.Do(client.NewRequest("nameserver.createRecord", args))
 	return err
 }
 
-func (w *ClientWrapper) updateRecord(recID int, request *inwx.NameserverRecordRequest) error {
+func (w *ClientWrapper) UpdateRecord(recID int, request *inwx.NameserverRecordRequest) error {
 	return w.client.Nameservers.UpdateRecord(recID, request)
 }
 
-func (w *ClientWrapper) deleteRecord(recID int) error {
+func (w *ClientWrapper) DeleteRecord(recID int) error {
 	return w.client.Nameservers.DeleteRecord(recID)
 }
@@ -0,0 +1,93 @@
+package inwx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+// rewrittenTypes are the record types whose content ends with a host name rewritten by CloneZone.
+var rewrittenTypes = []string{"CNAME", "MX", "NS", "SRV", "PTR"}
+
+// CloneRewrite is the content of a record of a cloned zone rewritten from the source zone to the
+// target zone.
+type CloneRewrite struct {
+	Record inwx.NameserverRecord
+	// Before is the content of the record as cloned
+	Before string
+}
+
+// CloneZone logs into INWX and clones the zone source to the new zone target with the nameserver clone
+// API of INWX, which copies all records of source. If rewrite is set, the host names under source in
+// the content of the CNAME, MX, NS, SRV and PTR records of target are rewritten to target afterwards,
+// e.g. so that www.new.example is a CNAME of app.new.example rather than of app.old.example, and the
+// records rewritten are returned.
+func (p *INWXProvider) CloneZone(source, target string, rewrite bool) ([]CloneRewrite, error) {
+	source, target = strings.TrimSuffix(strings.ToLower(source), "."), strings.TrimSuffix(strings.ToLower(target), ".")
+	if source == target {
+		return nil, fmt.Errorf("cannot clone zone %s to itself", source)
+	}
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	if err := p.client.CloneZone(source, target); err != nil {
+		return nil, fmt.Errorf("failed to clone zone %s to %s: %w", source, target, err)
+	}
+	p.logger.Info("cloned zone", "zone", source, "target", target)
+	if !rewrite {
+		return nil, nil
+	}
+	records, err := p.client.GetRecords(target)
+	if err != nil {
+		return nil, err
+	}
+	rewrites := []CloneRewrite{}
+	for _, rec := range *records {
+		content, ok := rewriteHost(rec, source, target)
+		if !ok {
+			continue
+		}
+		request := &inwx.NameserverRecordRequest{Domain: target, Name: rec.Name, Type: rec.Type, Content: content, TTL: rec.TTL, Priority: rec.Priority}
+		if err := p.client.UpdateRecord(rec.ID, request); err != nil {
+			return rewrites, fmt.Errorf("failed to rewrite record %s %s %s: %w", rec.Name, rec.Type, rec.Content, err)
+		}
+		before := rec.Content
+		rec.Content = content
+		rewrites = append(rewrites, CloneRewrite{Record: rec, Before: before})
+	}
+	p.logger.Info("rewrote cloned records", "target", target, "records", len(rewrites))
+	return rewrites, nil
+}
+
+// rewriteHost returns the content of rec with its host name, the last field, moved from under the zone
+// source to under the zone target, if rec is of a rewritten type and its host name is under source.
+func rewriteHost(rec inwx.NameserverRecord, source, target string) (string, bool) {
+	if !slices.Contains(rewrittenTypes, rec.Type) {
+		return "", false
+	}
+	fields := strings.Fields(rec.Content)
+	if len(fields) == 0 {
+		return "", false
+	}
+	host := fields[len(fields)-1]
+	name, dot := strings.CutSuffix(strings.ToLower(host), ".")
+	var rewritten string
+	switch {
+	case name == source:
+		rewritten = target
+	case strings.HasSuffix(name, "."+source):
+		rewritten = strings.TrimSuffix(name, source) + target
+	default:
+		return "", false
+	}
+	if dot {
+		rewritten += "."
+	}
+	fields[len(fields)-1] = rewritten
+	return strings.Join(fields, " "), true
+}
@@ -0,0 +1,92 @@
+package inwx
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// sessionCookie is the name of the cookie of an INWX API session.
+const sessionCookie = "domrobot"
+
+// sessionCookieTransport shares the session cookie of the INWX API between the RPC clients of a
+// ClientWrapper. Every RPC client keeps cookies of its own and calls the API one call at a time, so
+// the clients creating records concurrently reuse the session logged in by the main client. It also
+// holds the session saved to and restored from a session store.
+type sessionCookieTransport struct {
+	next   http.RoundTripper
+	mu     sync.Mutex
+	cookie *http.Cookie
+}
+
+func (t *sessionCookieTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	cookie, next := t.cookie, t.next
+	t.mu.Unlock()
+	if _, err := r.Cookie(sessionCookie); err != nil && cookie != nil {
+		r = r.Clone(r.Context())
+		r.AddCookie(cookie)
+	}
+	resp, err := next.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name == sessionCookie {
+			t.mu.Lock()
+			t.cookie = &http.Cookie{Name: c.Name, Value: c.Value}
+			t.mu.Unlock()
+		}
+	}
+	return resp, nil
+}
+
+// setNext sets the transport of the requests, replaced when the client is rebuilt for new credentials.
+func (t *sessionCookieTransport) setNext(next http.RoundTripper) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.next = next
+}
+
+// session returns the value of the session cookie, empty if there is no session.
+func (t *sessionCookieTransport) session() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cookie == nil {
+		return ""
+	}
+	return t.cookie.Value
+}
+
+// setSession sets the value of the session cookie sent with requests lacking one, none if empty.
+func (t *sessionCookieTransport) setSession(value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cookie = nil
+	if value != "" {
+		t.cookie = &http.Cookie{Name: sessionCookie, Value: value}
+	}
+}
+
+// applyCreates applies the creates of a zone batch with up to p.createConcurrency creates at once,
+// aborting the creates not started yet once the budget of the apply is exhausted.
+func (p *INWXProvider) applyCreates(creates []zoneChange, apply func(change zoneChange) error, results []ChangeResult, budget *applyBudget, logger *slog.Logger) {
+	slots := make(chan struct{}, p.createConcurrency)
+	wg := sync.WaitGroup{}
+	for i, change := range creates {
+		slots <- struct{}{}
+		if budget.exhausted() {
+			<-slots
+			wg.Wait()
+			budget.abort(creates[i:], results, logger)
+			return
+		}
+		wg.Go(func() {
+			defer func() { <-slots }()
+			// every goroutine sets the result of its change only
+			results[change.result].Err = apply(change)
+			budget.record(results[change.result].Err)
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+package inwx
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+	"sigs.k8s.io/external-dns/provider"
+)
+
+// Config configures a provider built by NewProvider or NewINWXProvider. Only the credentials of Client are required,
+// unless it has a Backend.
+type Config struct {
+	// Client configures the credentials of the INWX account and the connection to the API
+	Client ClientOptions
+	// DomainFilter and ExcludeDomains limit the zones managed, all zones of the account if empty
+	DomainFilter   []string
+	ExcludeDomains []string
+	// Zones pins the managed zones, skipping zone discovery, if not empty
+	Zones []string
+	// DefaultTTL is the TTL of the records of endpoints without a TTL; if 0, created records get the
+	// default TTL of INWX and updated records keep their TTL
+	DefaultTTL int
+	// DeletionGracePeriod keeps deleted records with a low TTL and marked by a TXT record for this
+	// long before deleting them, restoring them if they are created again meanwhile; 0 deletes at once
+	DeletionGracePeriod time.Duration
+	// SubdomainsOnly never changes the records of a zone apex, e.g. if they are managed manually
+	SubdomainsOnly bool
+	// ZoneRecordLimit is the number of records INWX allows in a zone, warned about when a zone comes
+	// close to it; 0 disables the warnings
+	ZoneRecordLimit int
+	// PausedZones are zones whose records are listed but never changed, e.g. during a maintenance
+	// freeze; zones are paused by a TXT record _external-dns-inwx-paused.<zone> as well
+	PausedZones []string
+	// RetryQueueSize is the number of failed creates and deletes queued for retrying between syncs
+	// until they succeed, are changed by a sync again or failed 5 retries; 0 disables the queue
+	RetryQueueSize int
+	// RetryInterval is the backoff of the first retry of a failed change, doubled for every further
+	// retry; RetryFailedChanges retries the changes due
+	RetryInterval time.Duration
+	// MaxApplyCalls aborts the remaining changes of an apply once it made this number of API calls,
+	// failing them for external-dns to retry in its next sync; 0 never aborts
+	MaxApplyCalls int
+	// MaxApplyDuration aborts the remaining changes of an apply once it ran this long; 0 never aborts
+	MaxApplyDuration time.Duration
+	// DedupWindow is how long a change set applied without failures is remembered, so that the same
+	// change set sent again, e.g. by external-dns retrying an apply that timed out, is acknowledged
+	// without applying it twice; 0 disables this
+	DedupWindow time.Duration
+	// MaxErrorRatio aborts the remaining changes of an apply once more than this ratio of the changes
+	// attempted failed, at least 10 changes having been attempted; 0 never aborts
+	MaxErrorRatio float64
+	// ReadOnly only logs the changes instead of applying them
+	ReadOnly bool
+	// Ownership guards updates and deletes against records not owned by external-dns, if set
+	Ownership *OwnershipGuard
+	// RegistryLabels sets the labels of the external-dns TXT registry records found by the names the
+	// guard derives, e.g. owner and resource, on the listed endpoints they own, if set
+	RegistryLabels *OwnershipGuard
+	// LogEndpoints logs every listed endpoint at debug level instead of a summary of each listing
+	LogEndpoints bool
+	// Snapshots receives a snapshot of every zone about to be changed, if set
+	Snapshots snapshot.Store
+	// ZoneCreation enables the creation of missing zones, if set
+	ZoneCreation *ZoneCreation
+	// RecordsCacheFile keeps the records last listed for cold starts, if set
+	RecordsCacheFile string
+	// SharedCache shares listed records and an apply lock with other replicas, if set
+	SharedCache *SharedCache
+	// Events receives the result of every change applied, if set
+	Events *EventBroker
+	// Account names the account in the change events
+	Account string
+	// Logger is slog.Default() if not set
+	Logger *slog.Logger
+}
+
+// NewProvider returns the external-dns provider of the INWX account of cfg, reporting all problems with cfg at once.
+// The provider is an *INWXProvider, which offers the background tasks of the webhook on top of provider.Provider.
+func NewProvider(cfg Config) (provider.Provider, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return NewINWXProvider(cfg), nil
+}
+
+func (cfg *Config) validate() error {
+	errs := []error{}
+	if cfg.Client.Backend == nil && (cfg.Client.Username == "" || cfg.Client.Password == "") {
+		errs = append(errs, errors.New("missing INWX username or password"))
+	}
+	if cfg.Client.CreateConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("invalid CreateConcurrency %d: must not be negative", cfg.Client.CreateConcurrency))
+	}
+	if cfg.Client.MaxLoginFailures < 0 {
+		errs = append(errs, fmt.Errorf("invalid MaxLoginFailures %d: must not be negative", cfg.Client.MaxLoginFailures))
+	}
+	if cfg.DefaultTTL < 0 {
+		errs = append(errs, fmt.Errorf("invalid DefaultTTL %d: must not be negative", cfg.DefaultTTL))
+	}
+	if cfg.DeletionGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("invalid DeletionGracePeriod %s: must not be negative", cfg.DeletionGracePeriod))
+	}
+	if cfg.ZoneRecordLimit < 0 {
+		errs = append(errs, fmt.Errorf("invalid ZoneRecordLimit %d: must not be negative", cfg.ZoneRecordLimit))
+	}
+	if cfg.RetryQueueSize < 0 {
+		errs = append(errs, fmt.Errorf("invalid RetryQueueSize %d: must not be negative", cfg.RetryQueueSize))
+	}
+	if cfg.RetryQueueSize > 0 && cfg.RetryInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid RetryInterval %s: must be positive", cfg.RetryInterval))
+	}
+	if cfg.MaxApplyCalls < 0 {
+		errs = append(errs, fmt.Errorf("invalid MaxApplyCalls %d: must not be negative", cfg.MaxApplyCalls))
+	}
+	if cfg.MaxApplyDuration < 0 {
+		errs = append(errs, fmt.Errorf("invalid MaxApplyDuration %s: must not be negative", cfg.MaxApplyDuration))
+	}
+	if cfg.DedupWindow < 0 {
+		errs = append(errs, fmt.Errorf("invalid DedupWindow %s: must not be negative", cfg.DedupWindow))
+	}
+	if cfg.MaxErrorRatio < 0 || cfg.MaxErrorRatio > 1 {
+		errs = append(errs, fmt.Errorf("invalid MaxErrorRatio %g: must be between 0 and 1", cfg.MaxErrorRatio))
+	}
+	if cfg.SharedCache != nil && (cfg.SharedCache.Store == nil || cfg.SharedCache.TTL <= 0) {
+		errs = append(errs, errors.New("invalid SharedCache: missing store or non-positive TTL"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,121 @@
+package inwx
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// maxCharacterString is the length limit of a TXT character-string, a quoted part of a TXT record.
+const maxCharacterString = 255
+
+// validateContent checks the targets of an endpoint against the syntax of its record type, so that
+// invalid targets are refused with the reason rather than with an error code of INWX: A and AAAA
+// targets must be addresses of their family, CNAME and MX targets host names and TXT targets split
+// into quoted strings of at most 255 characters.
+func validateContent(ep *endpoint.Endpoint) error {
+	for _, target := range ep.Targets {
+		if err := validateTarget(ep.RecordType, target); err != nil {
+			return fmt.Errorf("invalid target %q of endpoint %s %s: %w", target, ep.DNSName, ep.RecordType, err)
+		}
+	}
+	return nil
+}
+
+func validateTarget(recordType string, target string) error {
+	switch recordType {
+	case endpoint.RecordTypeA:
+		if addr, err := netip.ParseAddr(target); err != nil || !addr.Is4() {
+			return fmt.Errorf("expected an IPv4 address, %w", errInvalidContent)
+		}
+	case endpoint.RecordTypeAAAA:
+		if addr, err := netip.ParseAddr(target); err != nil || !addr.Is6() || addr.Zone() != "" {
+			return fmt.Errorf("expected an IPv6 address, %w", errInvalidContent)
+		}
+	case endpoint.RecordTypeCNAME:
+		if err := validateHostname(target); err != nil {
+			return fmt.Errorf("expected a host name, %w: %w", errInvalidContent, err)
+		}
+	case endpoint.RecordTypeMX:
+		fields := strings.Fields(target)
+		if len(fields) == 1 && strings.HasSuffix(target, " ") {
+			// the root of a null MX record, RFC 7505, is left as an empty host name with the trailing dot trimmed
+			fields = append(fields, "")
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("expected a priority and a host name, %w", errInvalidContent)
+		}
+		if _, err := strconv.ParseUint(fields[0], 10, 16); err != nil {
+			return fmt.Errorf("expected a priority from 0 to 65535, %w", errInvalidContent)
+		}
+		if fields[1] != "." && fields[1] != "" {
+			if err := validateHostname(fields[1]); err != nil {
+				return fmt.Errorf("expected a host name, %w: %w", errInvalidContent, err)
+			}
+		}
+	case endpoint.RecordTypeTXT:
+		for _, part := range txtParts(target) {
+			if len(part) > maxCharacterString {
+				return fmt.Errorf("a TXT string is %d characters long, split it into quoted strings of at most %d characters, %w", len(part), maxCharacterString, errInvalidContent)
+			}
+		}
+	}
+	return nil
+}
+
+// validateHostname checks the syntax of a host name, an underscore being allowed as in service names.
+func validateHostname(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("the name must be 1 to 253 characters long")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("the label %q must be 1 to 63 characters long", label)
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return fmt.Errorf("the label %q must not start or end with a hyphen", label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("the label %q holds %q, expected letters, digits, hyphens or underscores", label, c)
+			}
+		}
+	}
+	return nil
+}
+
+// txtParts returns the character-strings of a TXT target, the quoted strings if it is quoted, or else
+// the whole target.
+func txtParts(target string) []string {
+	if !strings.HasPrefix(strings.TrimSpace(target), `"`) {
+		return []string{target}
+	}
+	parts := []string{}
+	var part strings.Builder
+	quoted, escaped := false, false
+	for _, c := range target {
+		switch {
+		case escaped:
+			part.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			if quoted {
+				parts = append(parts, part.String())
+				part.Reset()
+			}
+			quoted = !quoted
+		case quoted:
+			part.WriteRune(c)
+		}
+	}
+	if quoted {
+		parts = append(parts, part.String())
+	}
+	return parts
+}
@@ -0,0 +1,60 @@
+package inwx
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// changeSetDedup remembers the change set applied last without failures, so that the same change
+// set sent again within window, e.g. by external-dns retrying an apply that timed out, is
+// acknowledged with the results of the first apply instead of being applied twice.
+type changeSetDedup struct {
+	window  time.Duration
+	mu      sync.Mutex
+	key     [sha256.Size]byte
+	applied time.Time
+	results []ChangeResult
+}
+
+func newChangeSetDedup(window time.Duration) *changeSetDedup {
+	if window <= 0 {
+		return nil
+	}
+	return &changeSetDedup{window: window}
+}
+
+// changeSetKey returns the hash of a change set, the same for equal change sets.
+func changeSetKey(changes *plan.Changes) [sha256.Size]byte {
+	// the JSON encoding of endpoints is deterministic, with labels sorted by key
+	content, _ := json.Marshal(changes)
+	return sha256.Sum256(content)
+}
+
+// lookup returns the results of the change set of key if it was applied last, within the window before now.
+func (d *changeSetDedup) lookup(key [sha256.Size]byte, now time.Time) ([]ChangeResult, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.results == nil || d.key != key || now.Sub(d.applied) > d.window {
+		return nil, false
+	}
+	return slices.Clone(d.results), true
+}
+
+// remember records the results of the change set of key applied at now, or forgets the change set
+// applied last if a change failed, as the records may differ from both.
+func (d *changeSetDedup) remember(key [sha256.Size]byte, results []ChangeResult, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, result := range results {
+		if result.Err != nil {
+			d.results = nil
+			return
+		}
+	}
+	d.key, d.applied, d.results = key, now, slices.Clone(results)
+}
@@ -0,0 +1,45 @@
+package inwx
+
+import (
+	"strings"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// DiffZone logs into INWX and returns the operations that would make the records of zone match
+// records, as a dry run of RestoreZone does. With onlyListed set, the records of the names and types
+// absent from records are left out, as ImportZone leaves them alone.
+func (p *INWXProvider) DiffZone(zone string, records []snapshot.Record, onlyListed bool) ([]RestoreOperation, error) {
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	current, err := p.client.GetRecords(zone)
+	if err != nil {
+		return nil, err
+	}
+	if onlyListed {
+		return restoreOperations(listedRecords(*current, records), records), nil
+	}
+	return restoreOperations(*current, records), nil
+}
+
+// EndpointRecords returns the records of the endpoints in zone as they are written to INWX, with the
+// default TTL of INWX if neither the endpoint nor the provider sets one, e.g. to compare the endpoints
+// of external-dns with the zone. The endpoints of other zones are left out.
+func (p *INWXProvider) EndpointRecords(zone string, endpoints []*endpoint.Endpoint) []snapshot.Record {
+	records := []snapshot.Record{}
+	for _, ep := range endpoints {
+		if relativeName(zone, ep.DNSName) == strings.TrimSuffix(ep.DNSName, ".") {
+			continue
+		}
+		for _, target := range ep.Targets {
+			rec := p.recordRequest(zone, ep, target, 3600)
+			records = append(records, snapshot.Record{Name: rec.Name, Type: rec.Type, Content: rec.Content, TTL: rec.TTL, Priority: rec.Priority})
+		}
+	}
+	return records
+}
@@ -0,0 +1,96 @@
+package inwx
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+// dnssecSigned tells whether an INWX DNSSEC status means the zone is (being) signed.
+func dnssecSigned(status string) bool {
+	return status == "AUTO" || status == "MANUAL" || status == "UPDATE"
+}
+
+// dsPublished tells whether one of the DNSSEC keys of a zone is active with its DS record published.
+func dsPublished(keys []inwx.DNSSecServiceListResponse) bool {
+	return slices.ContainsFunc(keys, func(key inwx.DNSSecServiceListResponse) bool {
+		return key.Active == 1 && key.Status == "OK"
+	})
+}
+
+// ManageDNSSEC reports the DNSSEC signing status of the managed zones every interval and after a
+// zone has been created until ctx is done; if enable is set, it also enables the INWX automatic
+// DNSSEC signing of the zones that are not signed.
+func (p *INWXProvider) ManageDNSSEC(ctx context.Context, interval time.Duration, enable bool) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.checkDNSSEC(enable); err != nil {
+			p.logger.Error("failed to check DNSSEC of managed zones", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-p.zoneCreated:
+		}
+	}
+}
+
+func (p *INWXProvider) checkDNSSEC(enable bool) error {
+	logout, err := p.login()
+	if err != nil {
+		return err
+	}
+	defer logout()
+
+	zones, err := p.getZones()
+	if err != nil {
+		return err
+	}
+	statuses := map[string]string{}
+	if len(*zones) > 0 {
+		if statuses, err = p.client.GetDNSSECStatus(*zones); err != nil {
+			return err
+		}
+	}
+	for _, zone := range *zones {
+		status := statuses[zone]
+		if !dnssecSigned(status) && enable {
+			if err := p.client.EnableDNSSEC(zone); err != nil {
+				p.logger.Error("failed to enable DNSSEC", "zone", zone, "status", status, "err", err)
+			} else {
+				p.logger.Info("enabled automatic DNSSEC", "zone", zone, "previous_status", status)
+			}
+		}
+		published := false
+		if dnssecSigned(status) {
+			keys, err := p.client.GetDNSKeys(zone)
+			if err != nil {
+				p.logger.Error("failed to list DNSSEC keys", "zone", zone, "err", err)
+				continue
+			}
+			published = dsPublished(keys)
+			p.logger.Debug("zone is signed", "zone", zone, "status", status, "ds_published", published)
+		}
+		dnssecSignedZones.WithLabelValues(zone).Set(boolGauge(dnssecSigned(status)))
+		dnssecDSPublished.WithLabelValues(zone).Set(boolGauge(published))
+	}
+	for _, zone := range p.dnssecZones {
+		if !slices.Contains(*zones, zone) {
+			dnssecSignedZones.DeleteLabelValues(zone)
+			dnssecDSPublished.DeleteLabelValues(zone)
+		}
+	}
+	p.dnssecZones = slices.Clone(*zones)
+	return nil
+}
+
+func boolGauge(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package inwx
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// ReportDomainExpiry exports the expiry date of every domain registered with the account every
+// interval until ctx is done.
+func (p *INWXProvider) ReportDomainExpiry(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.reportDomainExpiry(); err != nil {
+			p.logger.Error("failed to report domain expiry", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *INWXProvider) reportDomainExpiry() error {
+	logout, err := p.login()
+	if err != nil {
+		return err
+	}
+	defer logout()
+
+	domains, err := p.client.GetDomains()
+	if err != nil {
+		return err
+	}
+	reported := []string{}
+	for _, domain := range *domains {
+		if domain.ExDate.IsZero() {
+			continue
+		}
+		domainExpiry.WithLabelValues(domain.Domain).Set(float64(domain.ExDate.Unix()))
+		reported = append(reported, domain.Domain)
+	}
+	for _, domain := range p.expiryDomains {
+		if !slices.Contains(reported, domain) {
+			domainExpiry.DeleteLabelValues(domain)
+		}
+	}
+	p.expiryDomains = reported
+	p.logger.Debug("reported domain expiry", "domains", len(reported))
+	return nil
+}
@@ -0,0 +1,102 @@
+package inwx
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// desiredRecords are the endpoints last applied to a zone, keyed by DNS name and record type.
+type desiredRecords map[string]*endpoint.Endpoint
+
+func desiredKey(dnsName string, recordType string) string {
+	return dnsName + " " + recordType
+}
+
+// recordDesired remembers the endpoints successfully applied, forgetting the deleted ones; nothing is
+// applied in read-only mode.
+func (p *INWXProvider) recordDesired(zones zoneIndex, results []ChangeResult) {
+	if _, ok := p.client.(*ReadOnlyClientWrapper); ok {
+		return
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		zone, err := zones.zoneOf(result.Endpoint)
+		if err != nil {
+			continue
+		}
+		if p.desired == nil {
+			p.desired = map[string]desiredRecords{}
+		}
+		if p.desired[zone] == nil {
+			p.desired[zone] = desiredRecords{}
+		}
+		key := desiredKey(result.Endpoint.DNSName, result.Endpoint.RecordType)
+		if result.Action == "delete" {
+			delete(p.desired[zone], key)
+		} else {
+			p.desired[zone][key] = result.Endpoint
+		}
+	}
+}
+
+// DetectDrift compares the endpoints last applied with the records INWX serves every interval until
+// ctx is done, logging and counting records changed out of band, e.g. in the INWX console.
+func (p *INWXProvider) DetectDrift(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if err := p.detectDrift(); err != nil {
+			p.logger.Error("failed to detect drift of managed records", "err", err)
+		}
+	}
+}
+
+func (p *INWXProvider) detectDrift() error {
+	logout, err := p.login()
+	if err != nil {
+		return err
+	}
+	defer logout()
+
+	for zone, desired := range p.desired {
+		if len(desired) == 0 {
+			continue
+		}
+		records, err := p.client.GetRecords(zone)
+		if err != nil {
+			return fmt.Errorf("unable to query DNS zone info for zone '%v': %w", zone, err)
+		}
+		live := map[string][]string{}
+		for _, rec := range *records {
+			key := desiredKey(recordDNSName(zone, rec.Name), rec.Type)
+			live[key] = append(live[key], recordTarget(rec.Type, rec.Content, rec.Priority))
+		}
+		for key, ep := range desired {
+			ep = normalizeEndpoints([]*endpoint.Endpoint{ep.DeepCopy()})[0]
+			missing := slices.DeleteFunc(slices.Clone(ep.Targets), func(target string) bool { return slices.Contains(live[key], target) })
+			unexpected := slices.DeleteFunc(slices.Clone(live[key]), func(content string) bool { return slices.Contains(ep.Targets, content) })
+			if len(missing) > 0 {
+				recordsDriftTotal.WithLabelValues(zone, "missing").Add(float64(len(missing)))
+			}
+			if len(unexpected) > 0 {
+				recordsDriftTotal.WithLabelValues(zone, "unexpected").Add(float64(len(unexpected)))
+			}
+			if len(missing) > 0 || len(unexpected) > 0 {
+				p.logger.Warn("managed records drifted from the last applied state", "zone", zone, "name", ep.DNSName, "type", ep.RecordType,
+					"desired", ep.Targets, "missing", missing, "unexpected", unexpected)
+			}
+		}
+	}
+	return nil
+}
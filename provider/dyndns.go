@@ -0,0 +1,79 @@
+package inwx
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+)
+
+// UpdateAddresses points hostname at addrs like a DynDNS update: the A or AAAA records of every
+// address family in addrs are replaced by its addresses, or created, and the records of the other
+// family are kept. It returns whether any record changed. p is the provider of a single or of
+// several accounts; the records are changed through ApplyChanges, with the same checks as the
+// changes of external-dns.
+func UpdateAddresses(ctx context.Context, p provider.Provider, hostname string, addrs []netip.Addr) (bool, error) {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	targets := map[string]endpoint.Targets{}
+	for _, addr := range addrs {
+		recordType := endpoint.RecordTypeA
+		if addr.Unmap().Is6() {
+			recordType = endpoint.RecordTypeAAAA
+		}
+		if target := addr.Unmap().String(); !slices.Contains(targets[recordType], target) {
+			targets[recordType] = append(targets[recordType], target)
+		}
+	}
+
+	records, err := p.Records(ctx)
+	if err != nil {
+		return false, err
+	}
+	changes := &plan.Changes{}
+	for _, recordType := range []string{endpoint.RecordTypeA, endpoint.RecordTypeAAAA} {
+		want, ok := targets[recordType]
+		if !ok {
+			continue
+		}
+		i := slices.IndexFunc(records, func(ep *endpoint.Endpoint) bool {
+			return ep.RecordType == recordType && ep.SetIdentifier == "" && strings.EqualFold(strings.TrimSuffix(ep.DNSName, "."), hostname)
+		})
+		if i < 0 {
+			changes.Create = append(changes.Create, endpoint.NewEndpoint(hostname, recordType, want...))
+			continue
+		}
+		current := records[i]
+		if current.Targets.Same(want) {
+			continue
+		}
+		changes.UpdateOld = append(changes.UpdateOld, current)
+		changes.UpdateNew = append(changes.UpdateNew, endpoint.NewEndpointWithTTL(current.DNSName, recordType, current.RecordTTL, want...))
+	}
+	if !changes.HasChanges() {
+		return false, nil
+	}
+	applier, ok := p.(interface {
+		ApplyChangesWithResults(ctx context.Context, changes *plan.Changes) ([]ChangeResult, error)
+	})
+	if !ok {
+		err := p.ApplyChanges(ctx, changes)
+		return err == nil, err
+	}
+	// the errors of the changes are returned rather than their count, to be told apart by ErrorClass
+	results, err := applier.ApplyChangesWithResults(ctx, changes)
+	if err != nil {
+		return false, err
+	}
+	errs := []error{}
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	return len(errs) < len(results), errors.Join(errs...)
+}
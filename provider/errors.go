@@ -0,0 +1,70 @@
+package inwx
+
+import (
+	"errors"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+var (
+	// errNotOwned fails the updates and deletes refused by the ownership guard
+	errNotOwned = errors.New("without ownership record")
+	// errNoZone and errNotMatched fail the changes of endpoints outside the managed zones
+	errNoZone     = errors.New("unable find matching zone")
+	errNotMatched = errors.New("not matched by the domain filter")
+	// errApex fails the changes of endpoints at a zone apex if only subdomains are managed
+	errApex = errors.New("only subdomains are managed")
+	// errPaused fails the changes of paused zones
+	errPaused = errors.New("the management of the zone is paused")
+	// errInvalidContent fails the creates and updates of endpoints with targets invalid for their type
+	errInvalidContent = errors.New("invalid record content")
+	// errRecordNotFound fails the updates and deletes of records missing in INWX
+	errRecordNotFound = errors.New("failed to map all endpoint targets to entries")
+	// errUnpairedUpdate fails the updates of change sets whose UpdateOld and UpdateNew differ in length
+	errUnpairedUpdate = errors.New("update without both its old and its new endpoint")
+	// errAborted fails the changes left after too many changes of an apply failed
+	errAborted = errors.New("aborted the remaining changes")
+)
+
+// ErrorClass returns the class of the error of a change, e.g. for clients telling apart failures
+// to retry from failures of the change itself: maintenance, login_locked, authentication,
+// permission_denied, rate_limited, not_owned, no_zone, apex, paused, invalid_content, record_not_found, aborted, api for other
+// INWX errors, or unknown.
+// It is empty if err is nil.
+func ErrorClass(err error) string {
+	var maintenance *MaintenanceError
+	var locked *LoginLockedError
+	var permission *PermissionError
+	var response *inwx.ErrorResponse
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &maintenance):
+		return "maintenance"
+	case errors.As(err, &locked):
+		return "login_locked"
+	case credentialError(err):
+		return "authentication"
+	case errors.As(err, &permission):
+		return "permission_denied"
+	case errors.Is(err, errNotOwned):
+		return "not_owned"
+	case errors.Is(err, errNoZone), errors.Is(err, errNotMatched):
+		return "no_zone"
+	case errors.Is(err, errApex):
+		return "apex"
+	case errors.Is(err, errPaused):
+		return "paused"
+	case errors.Is(err, errInvalidContent):
+		return "invalid_content"
+	case errors.Is(err, errRecordNotFound):
+		return "record_not_found"
+	case errors.Is(err, errAborted):
+		return "aborted"
+	case errors.As(err, &response) && response.Code == rateLimitCode:
+		return "rate_limited"
+	case errors.As(err, &response):
+		return "api"
+	}
+	return "unknown"
+}
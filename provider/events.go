@@ -0,0 +1,110 @@
+package inwx
+
+import (
+	"sync"
+	"time"
+)
+
+// eventsBufferSize is the number of events a subscriber may fall behind before events are dropped for it.
+const eventsBufferSize = 100
+
+// Results of change events.
+const (
+	EventApplied = "applied"
+	EventFailed  = "failed"
+)
+
+// ChangeEvent is the result of an endpoint change applied to INWX, published to the subscribers of
+// an EventBroker.
+type ChangeEvent struct {
+	Time time.Time `json:"time"`
+	// Account is the account of the provider applying the change, empty unless configured
+	Account string `json:"account,omitempty"`
+	// Action is one of create, update or delete
+	Action string `json:"action"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	// Targets are the targets of the endpoint, redacted if the provider redacts record content
+	Targets []string `json:"targets"`
+	TTL     int64    `json:"ttl,omitempty"`
+	// Result is applied or failed
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+	// Class is the ErrorClass of Error
+	Class string `json:"class,omitempty"`
+}
+
+// EventBroker publishes the change events of providers to subscribers, e.g. the clients of an event
+// stream. Publishing never blocks: events are dropped for subscribers falling too far behind.
+type EventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan ChangeEvent]struct{}
+}
+
+// NewEventBroker returns a broker without subscribers.
+func NewEventBroker() *EventBroker {
+	return &EventBroker{subscribers: map[chan ChangeEvent]struct{}{}}
+}
+
+// Subscribe returns the events published from now on and a function ending the subscription, which
+// closes the channel.
+func (b *EventBroker) Subscribe() (<-chan ChangeEvent, func()) {
+	events := make(chan ChangeEvent, eventsBufferSize)
+	b.mu.Lock()
+	b.subscribers[events] = struct{}{}
+	eventSubscribers.Set(float64(len(b.subscribers)))
+	b.mu.Unlock()
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, events)
+			eventSubscribers.Set(float64(len(b.subscribers)))
+			b.mu.Unlock()
+			close(events)
+		})
+	}
+}
+
+// Publish sends e to every subscriber with room for it.
+func (b *EventBroker) Publish(e ChangeEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for events := range b.subscribers {
+		select {
+		case events <- e:
+		default:
+			eventsDroppedTotal.Inc()
+		}
+	}
+}
+
+// publishResults publishes the results of an apply to the event broker, if set.
+func (p *INWXProvider) publishResults(results []ChangeResult) {
+	if p.events == nil {
+		return
+	}
+	now := time.Now().UTC()
+	for _, result := range results {
+		e := ChangeEvent{
+			Time:    now,
+			Account: p.account,
+			Action:  result.Action,
+			Name:    result.Endpoint.DNSName,
+			Type:    result.Endpoint.RecordType,
+			Targets: []string{},
+			TTL:     int64(result.Endpoint.RecordTTL),
+			Result:  EventApplied,
+		}
+		for _, target := range result.Endpoint.Targets {
+			if p.clientOptions.RedactContent {
+				target = RedactContent(target)
+			}
+			e.Targets = append(e.Targets, target)
+		}
+		if result.Err != nil {
+			e.Result, e.Error, e.Class = EventFailed, result.Err.Error(), ErrorClass(result.Err)
+		}
+		p.events.Publish(e)
+	}
+}
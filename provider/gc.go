@@ -0,0 +1,43 @@
+package inwx
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// OrphanedRecords returns the records of the managed zones matched by the domain filter without an
+// ownership TXT record of any owner in the TXT registry of registry, one endpoint per record, e.g.
+// records left behind by a deleted cluster whose registry records were removed. The SOA and NS
+// records of the zones and the registry records themselves are never orphaned.
+func (p *INWXProvider) OrphanedRecords(ctx context.Context, registry *OwnershipGuard) ([]*endpoint.Endpoint, error) {
+	zones, err := p.Zones()
+	if err != nil {
+		return nil, err
+	}
+	records, err := p.Records(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	txt := map[string][]string{}
+	for _, ep := range records {
+		if ep.RecordType == endpoint.RecordTypeTXT {
+			name := strings.ToLower(ep.DNSName)
+			txt[name] = append(txt[name], ep.Targets...)
+		}
+	}
+	orphans := []*endpoint.Endpoint{}
+	for _, ep := range records {
+		switch {
+		case ep.RecordType == "SOA":
+		case ep.RecordType == endpoint.RecordTypeNS && slices.Contains(zones, strings.ToLower(ep.DNSName)):
+		case registry.registered(txt, ep):
+		default:
+			orphans = append(orphans, ep)
+		}
+	}
+	return orphans, nil
+}
@@ -0,0 +1,48 @@
+package inwx
+
+import (
+	"slices"
+
+	inwx "github.com/nrdcg/goinwx"
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+)
+
+// ImportZone logs into INWX and imports records into zone, e.g. the records of a zone file: for every
+// name and type among records, the records of that name and type are created, updated or deleted to
+// match them, while the records of other names and types are left alone. SOA records and the NS
+// records of the apex are skipped, as they are maintained by INWX. It returns the operations applied;
+// with dryRun set, the operations are only computed.
+func (p *INWXProvider) ImportZone(zone string, records []snapshot.Record, dryRun bool) ([]RestoreOperation, error) {
+	wanted := slices.DeleteFunc(slices.Clone(records), func(rec snapshot.Record) bool {
+		return rec.Type == "SOA" || rec.Type == "NS" && rec.Name == ""
+	})
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	current, err := p.client.GetRecords(zone)
+	if err != nil {
+		return nil, err
+	}
+	operations := restoreOperations(listedRecords(*current, wanted), wanted)
+	if dryRun {
+		return operations, nil
+	}
+	if err := p.applyRestoreOperations(zone, operations); err != nil {
+		return nil, err
+	}
+	return operations, nil
+}
+
+// listedRecords returns the records among current of the names and types among records.
+func listedRecords(current []inwx.NameserverRecord, records []snapshot.Record) []inwx.NameserverRecord {
+	listed := []inwx.NameserverRecord{}
+	for _, rec := range current {
+		if slices.ContainsFunc(records, func(r snapshot.Record) bool { return r.Name == rec.Name && r.Type == rec.Type }) {
+			listed = append(listed, rec)
+		}
+	}
+	return listed
+}
@@ -1,246 +1,706 @@
+// Package inwx implements an external-dns provider for the nameservers of INWX, served by the
+// webhook of this module and embeddable in other programs and custom external-dns builds:
+//
+//	p, err := inwx.NewProvider(inwx.Config{
+//		Client:       inwx.ClientOptions{Username: username, Password: password},
+//		DomainFilter: []string{"example.com"},
+//	})
 package inwx
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	inwx "github.com/nrdcg/goinwx"
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
 
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
 )
 
+// INWXProvider manages the records of the zones of an INWX account.
 type INWXProvider struct {
 	provider.BaseProvider
 	client       AbstractClientWrapper
 	domainFilter *endpoint.DomainFilter
-	logger       *slog.Logger
+	// excludeDomains is kept to build discovered domain filters with the same exclusions
+	excludeDomains []string
+	// discoveredDomainFilter is negotiated instead of domainFilter once discovered from the account zones
+	discoveredDomainFilter atomic.Pointer[endpoint.DomainFilter]
+	// discovering is set while DiscoverDomainFilter runs
+	discovering atomic.Bool
+	// sessionMu serializes API sessions, as a logout ends the session for every caller
+	sessionMu sync.Mutex
+	// configMu guards the reloadable settings against readers not holding a session; writers hold both
+	configMu sync.RWMutex
+	// zones pins the managed zones, skipping zone discovery when non-empty
+	zones []string
+	// defaultTTL is the TTL of the records of endpoints without a TTL, 0 to leave it to INWX
+	defaultTTL int
+	// deletionGracePeriod is how long deleted records are kept soft-deleted, 0 to delete them at once
+	deletionGracePeriod time.Duration
+	// subdomainsOnly refuses to change the records of zone apexes
+	subdomainsOnly bool
+	// dedup skips a change set identical to the one applied last, if set
+	dedup *changeSetDedup
+	// createConcurrency is the number of creates of a zone applied at once
+	createConcurrency int
+	// retries queues failed creates and deletes for retrying between syncs, if set
+	retries *retryQueue
+	// maxErrorRatio aborts the remaining changes of an apply once exceeded, 0 if never
+	maxErrorRatio float64
+	// maxApplyCalls and maxApplyDuration abort the remaining changes of an apply once reached, 0 if never
+	maxApplyCalls    int
+	maxApplyDuration time.Duration
+	// pausedZones are the zones paused by configuration, guarded by sessionMu
+	pausedZones []string
+	// zoneRecordLimit is the number of records INWX allows in a zone, 0 if unknown
+	zoneRecordLimit int
+	// ownership guards updates and deletes against records not owned by external-dns, if set
+	ownership *OwnershipGuard
+	// registryLabels sets the labels of the TXT registry records on the listed endpoints, if set
+	registryLabels *OwnershipGuard
+	// logEndpoints logs every listed endpoint and duplicate record instead of summaries per listing
+	logEndpoints bool
+	// snapshots receives a snapshot of every zone about to be changed, if set
+	snapshots snapshot.Store
+	// zoneCreation enables the creation of missing zones, if set
+	zoneCreation *ZoneCreation
+	// cache keeps the endpoints last listed in a file for cold starts, if set
+	cache *recordsCache
+	// shared shares listed records and an apply lock with other replicas, if set
+	shared *SharedCache
+	// prefetched is the listing of the records started by Prefetch, until taken by Records
+	prefetched atomic.Pointer[prefetch]
+	// zoneCreated wakes ManageDNSSEC when a zone has been created
+	zoneCreated chan struct{}
+	// dnssecZones are the zones of the last DNSSEC status report, guarded by sessionMu
+	dnssecZones []string
+	// expiryDomains are the domains of the last expiry report, guarded by sessionMu
+	expiryDomains []string
+	// listedZones is the number of zones last listed from INWX
+	listedZones atomic.Int64
+	// soaZones are the zones whose SOA serial was last reported, the zones last listed, guarded by sessionMu
+	soaZones []string
+	// desired are the endpoints last applied by zone, guarded by sessionMu
+	desired map[string]desiredRecords
+	// lastMessageID is the ID of the account message last logged, guarded by sessionMu
+	lastMessageID int
+	// persistentSession keeps the session logged in between calls instead of logging out
+	persistentSession bool
+	// loggedIn and sessionUsed track the persistent session, guarded by sessionMu
+	loggedIn    bool
+	sessionUsed time.Time
+	// sessionRestoreTried is set once the session saved to the session store was tried, guarded by sessionMu
+	sessionRestoreTried bool
+	// clientOptions and readOnly rebuild the client when the credentials change
+	clientOptions ClientOptions
+	readOnly      bool
+	// loginFailures and loginBackoffUntil track the logins refused for invalid credentials, guarded by sessionMu
+	loginFailures     int
+	loginBackoffUntil time.Time
+	// loginLocked is set once the credentials were refused too often
+	loginLocked atomic.Bool
+	// maintenanceUntil is the end of the INWX maintenance being backed off for, in Unix nanoseconds
+	maintenanceUntil atomic.Int64
+	// zoneIndex is the index of indexedZones, guarded by sessionMu
+	zoneIndex    zoneIndex
+	indexedZones []string
+	// slaveZones are the slave zones last skipped, guarded by sessionMu
+	slaveZones []string
+	// events receives the results of the changes applied as account, if set
+	events  *EventBroker
+	account string
+	logger  *slog.Logger
 }
 
-func NewINWXProvider(domainFilter *[]string, username string, password string, sandbox bool, logger *slog.Logger) *INWXProvider {
+// NewINWXProvider returns the provider of the account of cfg. Unlike NewProvider, it does not validate cfg.
+func NewINWXProvider(cfg Config) *INWXProvider {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.Client.SessionStore != nil && cfg.Client.PersistentSession && cfg.Client.Backend == nil {
+		cfg.Client.sessionCookies = &sessionCookieTransport{}
+	}
 	return &INWXProvider{
-		client:       &ClientWrapper{client: inwx.NewClient(username, password, &inwx.ClientOptions{Sandbox: sandbox})},
-		domainFilter: endpoint.NewDomainFilter(*domainFilter),
-		logger:       logger,
+		client:              newClient(cfg.Client, cfg.ReadOnly, logger),
+		domainFilter:        endpoint.NewDomainFilterWithExclusions(cfg.DomainFilter, cfg.ExcludeDomains),
+		excludeDomains:      cfg.ExcludeDomains,
+		zones:               normalizeZones(cfg.Zones),
+		defaultTTL:          cfg.DefaultTTL,
+		deletionGracePeriod: cfg.DeletionGracePeriod,
+		subdomainsOnly:      cfg.SubdomainsOnly,
+		zoneRecordLimit:     cfg.ZoneRecordLimit,
+		maxErrorRatio:       cfg.MaxErrorRatio,
+		maxApplyCalls:       cfg.MaxApplyCalls,
+		maxApplyDuration:    cfg.MaxApplyDuration,
+		retries:             newRetryQueue(cfg.RetryQueueSize, cfg.RetryInterval),
+		createConcurrency:   max(cfg.Client.CreateConcurrency, 1),
+		dedup:               newChangeSetDedup(cfg.DedupWindow),
+		pausedZones:         normalizeZones(cfg.PausedZones),
+		ownership:           cfg.Ownership,
+		registryLabels:      cfg.RegistryLabels,
+		logEndpoints:        cfg.LogEndpoints,
+		snapshots:           cfg.Snapshots,
+		zoneCreation:        cfg.ZoneCreation,
+		cache:               newRecordsCache(cfg.RecordsCacheFile),
+		shared:              cfg.SharedCache,
+		zoneCreated:         make(chan struct{}, 1),
+		persistentSession:   cfg.Client.PersistentSession,
+		clientOptions:       cfg.Client,
+		readOnly:            cfg.ReadOnly,
+		events:              cfg.Events,
+		account:             cfg.Account,
+		logger:              logger,
 	}
 }
 
-func (p *INWXProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
-	endpoints := make([]*endpoint.Endpoint, 0)
+func newClient(options ClientOptions, readOnly bool, logger *slog.Logger) AbstractClientWrapper {
+	client := options.Backend
+	if client == nil {
+		client = newClientWrapper(options, logger)
+	}
+	client = chainMiddleware(client, append([]Middleware{permissionErrors()}, options.Middleware...))
+	if options.Journal != nil {
+		client = newJournalingClientWrapper(client, options.Journal, options.RedactContent, logger)
+	}
+	if readOnly {
+		client = &ReadOnlyClientWrapper{AbstractClientWrapper: client, logger: logger}
+	}
+	return client
+}
+
+func normalizeZones(zones []string) []string {
+	normalized := []string{}
+	for _, zone := range zones {
+		if zone = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(zone), ".")); zone != "" && !slices.Contains(normalized, zone) {
+			normalized = append(normalized, zone)
+		}
+	}
+	return normalized
+}
+
+// GetDomainFilter returns the domain filter negotiated with external-dns, the discovered one if any.
+func (p *INWXProvider) GetDomainFilter() endpoint.DomainFilterInterface {
+	if df := p.discoveredDomainFilter.Load(); df != nil {
+		return df
+	}
+	p.configMu.RLock()
+	defer p.configMu.RUnlock()
+	return p.domainFilter
+}
+
+// Reload replaces the reloadable settings by those of cfg: the domain filter, excluded domains and
+// zones, the ownership guard, the default TTL, whether only subdomains are managed and the limits of
+// an apply. The other settings of cfg are ignored. It waits for the running sync, if any, to finish.
+func (p *INWXProvider) Reload(cfg Config) {
+	p.sessionMu.Lock()
+	p.configMu.Lock()
+	p.domainFilter = endpoint.NewDomainFilterWithExclusions(cfg.DomainFilter, cfg.ExcludeDomains)
+	p.excludeDomains = cfg.ExcludeDomains
+	p.zones = normalizeZones(cfg.Zones)
+	p.ownership = cfg.Ownership
+	p.defaultTTL = cfg.DefaultTTL
+	p.subdomainsOnly = cfg.SubdomainsOnly
+	p.maxApplyCalls = cfg.MaxApplyCalls
+	p.maxApplyDuration = cfg.MaxApplyDuration
+	p.maxErrorRatio = cfg.MaxErrorRatio
+	p.discoveredDomainFilter.Store(nil)
+	p.configMu.Unlock()
+	p.sessionMu.Unlock()
+
+	if p.discovering.Load() {
+		if err := p.refreshDomainFilter(); err != nil {
+			p.logger.Error("failed to discover domain filter from account zones", "err", err)
+		}
+	}
+}
+
+// DiscoverDomainFilter derives the negotiated domain filter from the zones of the account and
+// refreshes it every interval until ctx is done, as long as no domain filter is configured.
+func (p *INWXProvider) DiscoverDomainFilter(ctx context.Context, interval time.Duration) error {
+	p.discovering.Store(true)
+	defer p.discovering.Store(false)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.refreshDomainFilter(); err != nil {
+			p.logger.Error("failed to discover domain filter from account zones", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
 
-	if _, err := p.client.login(); err != nil {
+func (p *INWXProvider) refreshDomainFilter() error {
+	logout, err := p.login()
+	if err != nil {
+		return err
+	}
+	defer logout()
+
+	if len(p.domainFilter.Filters) > 0 {
+		p.logger.Debug("domain filter configured, skipping domain filter discovery")
+		p.discoveredDomainFilter.Store(nil)
+		return nil
+	}
+	zones, err := p.getZones()
+	if err != nil {
+		return err
+	}
+	p.discoveredDomainFilter.Store(endpoint.NewDomainFilterWithExclusions(*zones, p.excludeDomains))
+	p.logger.Info("discovered domain filter from account zones", "zones", len(*zones))
+	return nil
+}
+
+// login starts an API session and returns the function ending it. Sessions are exclusive.
+func (p *INWXProvider) login() (func(), error) {
+	if until, ok := p.Maintenance(); ok {
+		return nil, &MaintenanceError{Until: until}
+	}
+	p.sessionMu.Lock()
+	end, err := p.startSession()
+	if err != nil {
+		p.sessionMu.Unlock()
 		return nil, err
 	}
-	defer func() {
-		if err := p.client.logout(); err != nil {
-			slog.Error("error encountered while logging out", "err", err)
+	return func() {
+		end()
+		p.sessionMu.Unlock()
+	}, nil
+}
+
+// Zones logs into INWX and returns the managed zones, sorted by name.
+func (p *INWXProvider) Zones() ([]string, error) {
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	zones, err := p.getZones()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(*zones)
+	return *zones, nil
+}
+
+// ZoneStatus tells whether a zone of the account is managed by the provider.
+type ZoneStatus struct {
+	Name string
+	// Type is MASTER or SLAVE, slave zones are never managed
+	Type    string
+	Managed bool
+}
+
+// ListZones logs into INWX and returns all zones of the account, sorted by name.
+func (p *INWXProvider) ListZones() ([]ZoneStatus, error) {
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	zones, err := p.client.GetZones()
+	if err != nil {
+		return nil, err
+	}
+	managed, err := p.getZones()
+	if err != nil {
+		return nil, err
+	}
+	statuses := []ZoneStatus{}
+	for _, zone := range *zones {
+		statuses = append(statuses, ZoneStatus{Name: zone.Domain, Type: zone.Type, Managed: slices.Contains(*managed, zone.Domain)})
+	}
+	slices.SortFunc(statuses, func(a, b ZoneStatus) int { return strings.Compare(a.Name, b.Name) })
+	return statuses, nil
+}
+
+// ZoneRecords logs into INWX and returns the records of zone as stored by INWX.
+func (p *INWXProvider) ZoneRecords(zone string) ([]inwx.NameserverRecord, error) {
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	records, err := p.client.GetRecords(zone)
+	if err != nil {
+		return nil, err
+	}
+	return *records, nil
+}
+
+// getZones lists the master nameserver zones of the account (or the pinned zones, if configured),
+// dropping those that the domain filter neither includes nor is a parent of (e.g. excluded sub-zones).
+// Slave zones are skipped, as INWX rejects record changes in them.
+func (p *INWXProvider) getZones() (*[]string, error) {
+	var zones *[]string
+	if len(p.zones) > 0 {
+		zones = &p.zones
+	} else {
+		domains, err := p.client.GetZones()
+		if err != nil {
+			return nil, err
 		}
-	}()
+		zones = &[]string{}
+		slaves := []string{}
+		for _, domain := range *domains {
+			if domain.Type == "SLAVE" {
+				slaves = append(slaves, domain.Domain)
+			} else {
+				*zones = append(*zones, domain.Domain)
+			}
+		}
+		p.reportSlaveZones(slaves)
+	}
+	filtered := []string{}
+	skipped := 0
+	for _, zone := range *zones {
+		if p.domainFilter.Match(zone) || p.domainFilter.MatchParent(zone) {
+			filtered = append(filtered, zone)
+		} else {
+			skipped++
+		}
+	}
+	if skipped > 0 {
+		p.logger.Debug("skipping zones not matched by domain filter", "skipped", skipped, "zones", len(filtered))
+	}
+	return &filtered, nil
+}
 
-	zones, err := p.client.getZones()
+// reportSlaveZones logs the skipped slave zones whenever they change and exports them as metric.
+func (p *INWXProvider) reportSlaveZones(slaves []string) {
+	slices.Sort(slaves)
+	if !slices.Equal(slaves, p.slaveZones) {
+		if len(slaves) > 0 {
+			p.logger.Info("skipping slave zones, records cannot be changed in them", "zones", strings.Join(slaves, ","))
+		}
+		for _, zone := range p.slaveZones {
+			skippedZones.DeleteLabelValues(zone, "slave")
+		}
+		p.slaveZones = slaves
+	}
+	for _, zone := range slaves {
+		skippedZones.WithLabelValues(zone, "slave").Set(1)
+	}
+}
+
+// getZone returns the zone an endpoint belongs to, refusing endpoints excluded by the domain filter.
+func (p *INWXProvider) getZone(zones zoneIndex, ep *endpoint.Endpoint) (string, error) {
+	if !p.domainFilter.Match(ep.DNSName) {
+		return "", fmt.Errorf("endpoint %s is %w", ep, errNotMatched)
+	}
+	return zones.zoneOf(ep)
+}
+
+// Records returns the records of the managed zones, served from the records cache while it is refreshed after a start.
+// Every call is summarized by a log line at info level.
+func (p *INWXProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	start := time.Now()
+	if p.cache != nil {
+		refresh := func() error {
+			_, err := p.fetchRecords(context.Background())
+			return err
+		}
+		if stale, ok := p.cache.staleRecords(refresh, p.logger); ok {
+			p.logRecordsSummary(stale, true, nil, start)
+			return stale, nil
+		}
+	}
+	endpoints, err := p.fetchRecords(ctx)
+	p.logRecordsSummary(endpoints, false, err, start)
+	return endpoints, err
+}
+
+// listRecords lists the records of the managed zones from INWX.
+func (p *INWXProvider) listRecords(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	endpoints := []*endpoint.Endpoint{}
+
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	zones, err := p.getZones()
 	if err != nil {
 		return nil, err
 	}
 
 	for _, zone := range *zones {
-		records, err := p.client.getRecords(zone)
+		records, err := p.client.GetRecords(zone)
 		if err != nil {
 			return nil, fmt.Errorf("unable to query DNS zone info for zone '%v': %v", zone, err)
 		}
-		for _, rec := range *records {
-			name := fmt.Sprintf("%s.%s", rec.Name, zone)
-			ep := endpoint.NewEndpointWithTTL(name, rec.Type, endpoint.TTL(rec.TTL), rec.Content)
-			endpoints = append(endpoints, ep)
+		p.reportRecordCount(zone, len(*records))
+		visible := *records
+		if p.deletionGracePeriod > 0 {
+			visible = p.softDeletedRecords(zone, visible, time.Now())
+		}
+		// only the endpoints are kept, the records of the zone are released before fetching the next
+		endpoints = p.appendZoneEndpoints(endpoints, zone, visible)
+	}
+	for _, zone := range p.soaZones {
+		if !slices.Contains(*zones, zone) {
+			zoneSOASerial.DeleteLabelValues(zone)
+			duplicateRecords.DeleteLabelValues(zone)
+			zoneRecordCount.DeleteLabelValues(zone)
+			zoneRecordLimit.DeleteLabelValues(zone)
 		}
 	}
-	for _, endpointItem := range endpoints {
-		p.logger.Debug("endpoints collected", "endpoints", endpointItem.String())
+	p.soaZones = slices.Clone(*zones)
+	p.listedZones.Store(int64(len(*zones)))
+	sortEndpoints(endpoints)
+	if p.registryLabels != nil {
+		p.registryLabels.setRegistryLabels(endpoints)
+	}
+	if p.logEndpoints && p.logger.Enabled(ctx, slog.LevelDebug) {
+		for _, endpointItem := range endpoints {
+			p.logger.Debug("endpoints collected", "endpoints", endpointItem.String())
+		}
 	}
 	return endpoints, nil
 }
 
-func (p *INWXProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
-	if !changes.HasChanges() {
-		p.logger.Debug("no changes detected - nothing to do")
-		return nil
+// appendZoneEndpoints appends the endpoints of the records of a zone matched by the domain filter,
+// growing endpoints once per zone. Records identical to an earlier record, as left by edits in the
+// INWX console, are skipped with a warning per zone, or per record if logEndpoints is set.
+func (p *INWXProvider) appendZoneEndpoints(endpoints []*endpoint.Endpoint, zone string, records []inwx.NameserverRecord) []*endpoint.Endpoint {
+	type recordValue struct {
+		name, recordType, content string
+		ttl                       int
 	}
+	seen := map[recordValue]bool{}
+	duplicates := 0
+	endpoints = slices.Grow(endpoints, len(records))
+	for _, rec := range records {
+		if rec.Type == "SOA" {
+			p.reportSOASerial(zone, rec.Content)
+		}
+		name := recordDNSName(zone, rec.Name)
+		if !p.domainFilter.Match(name) {
+			continue
+		}
+		target := recordTarget(rec.Type, rec.Content, rec.Priority)
+		value := recordValue{name: name, recordType: rec.Type, content: target, ttl: rec.TTL}
+		if seen[value] {
+			if p.logEndpoints {
+				p.logger.Warn("ignoring duplicate record", "zone", zone, "name", name, "type", rec.Type, "content", target, "id", rec.ID)
+			}
+			duplicates++
+			continue
+		}
+		seen[value] = true
+		if ep := endpoint.NewEndpointWithTTL(name, rec.Type, endpoint.TTL(rec.TTL), target); ep != nil {
+			endpoints = append(endpoints, ep)
+		}
+	}
+	if duplicates > 0 && !p.logEndpoints {
+		p.logger.Warn("ignoring duplicate records", "zone", zone, "duplicates", duplicates)
+	}
+	duplicateRecords.WithLabelValues(zone).Set(float64(duplicates))
+	return endpoints
+}
 
-	if _, err := p.client.login(); err != nil {
-		return err
+// sortEndpoints orders endpoints by name, type, targets and TTL, so that listing the same records
+// answers them in the same order.
+func sortEndpoints(endpoints []*endpoint.Endpoint) {
+	slices.SortStableFunc(endpoints, func(a, b *endpoint.Endpoint) int {
+		return cmp.Or(
+			strings.Compare(a.DNSName, b.DNSName),
+			strings.Compare(a.RecordType, b.RecordType),
+			slices.Compare(a.Targets, b.Targets),
+			cmp.Compare(a.RecordTTL, b.RecordTTL),
+		)
+	})
+}
+
+// reportSOASerial exports the serial of the SOA record content of a zone.
+func (p *INWXProvider) reportSOASerial(zone string, content string) {
+	fields := strings.Fields(content)
+	if len(fields) < 3 {
+		p.logger.Debug("unexpected SOA record content", "zone", zone, "content", content)
+		return
 	}
-	defer func() {
-		if err := p.client.logout(); err != nil {
-			slog.Error("error encountered while logging out", "err", err)
-		}
-	}()
+	serial, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		p.logger.Debug("unexpected SOA record serial", "zone", zone, "content", content)
+		return
+	}
+	zoneSOASerial.WithLabelValues(zone).Set(float64(serial))
+}
 
-	zones, err := p.client.getZones()
+// ChangeResult is the outcome of applying the change of a single endpoint.
+type ChangeResult struct {
+	// Action is one of create, update or delete
+	Action   string
+	Endpoint *endpoint.Endpoint
+	// Err is nil if the change was applied
+	Err error
+}
+
+// ApplyChanges applies changes, failing if any change failed.
+func (p *INWXProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	results, err := p.ApplyChangesWithResults(ctx, changes)
 	if err != nil {
 		return err
 	}
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to apply %d of %d changes", failed, len(results))
+	}
+	return nil
+}
+
+// ApplyChangesWithResults applies changes like ApplyChanges, returning the result of every endpoint change.
+// The error is only set if no change could be attempted at all. Every call with changes is summarized
+// by a log line at info level and its results are published as change events, if enabled. The failed
+// creates and deletes are queued for retrying if the retry queue is enabled.
+func (p *INWXProvider) ApplyChangesWithResults(ctx context.Context, changes *plan.Changes) ([]ChangeResult, error) {
+	results, err := p.applyChanges(ctx, changes)
+	if p.retries != nil && err == nil {
+		p.retries.replace(changes, results, p.logger)
+	}
+	return results, err
+}
 
-	errs := []error{}
+func (p *INWXProvider) applyChanges(ctx context.Context, changes *plan.Changes) (results []ChangeResult, err error) {
+	if !changes.HasChanges() {
+		p.logger.Debug("no changes detected - nothing to do")
+		return nil, nil
+	}
+	start := time.Now()
+	var batches []*zoneBatch
+	deduplicated := false
+	defer func() {
+		if !deduplicated {
+			p.logApplySummary(changes, batches, results, err, start)
+			p.publishResults(results)
+		}
+	}()
+	key := changeSetKey(changes)
 
-	recordsCache := map[string]*[]inwx.NameserverRecord{}
-	for _, ep := range changes.Delete {
-		zone, err := getZone(zones, ep)
+	if p.shared != nil {
+		unlock, err := p.lockApply(ctx)
 		if err != nil {
-			errs = append(errs, err)
-			slog.Error("failed to create DNS record for endpoint", "err", err)
-		} else {
-			if _, ok := recordsCache[zone]; !ok {
-				if recs, err := p.client.getRecords(zone); err != nil {
-					errs = append(errs, err)
-					slog.Error("failed to query DNS zone info", "zone", zone, "err", err)
-					continue
-				} else {
-					recordsCache[zone] = recs
-				}
-			}
-			recIDs, err := getRecIDs(zone, recordsCache[zone], *ep)
-			if err != nil {
-				errs = append(errs, err)
-				slog.Error("failed to look up records to delete", "err", err)
-			}
-			for _, id := range recIDs {
-				if err = p.client.deleteRecord(id); err != nil {
-					errs = append(errs, err)
-					slog.Error("failed to delete record", "id", id, "ep", ep, "err", err)
-				}
-			}
+			return nil, err
 		}
+		defer unlock()
+	}
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+	budget := p.newApplyBudget(start)
+	if budget.maxCalls > 0 {
+		// p.client is guarded by sessionMu, so only the calls of this apply are counted
+		client := p.client
+		p.client = budget.count(client)
+		defer func() { p.client = client }()
 	}
 
-	for _, ep := range changes.Create {
-		zone, err := getZone(zones, ep)
-		if err != nil {
-			errs = append(errs, err)
-			slog.Error("failed to create DNS record for endpoint", "err", err)
-		} else {
-			for _, target := range ep.Targets {
-				var name string
-				if ep.DNSName == zone {
-					name = ""
-				} else {
-					name = strings.TrimSuffix(ep.DNSName, fmt.Sprintf(".%s", zone))
-				}
-				rec := &inwx.NameserverRecordRequest{
-					Domain:  zone,
-					Name:    name,
-					Type:    ep.RecordType,
-					TTL:     int(ep.RecordTTL),
-					Content: target,
-				}
-				if err = p.client.createRecord(rec); err != nil {
-					errs = append(errs, err)
-					slog.Error("failed to create record", "rec", rec, "err", err)
-				}
-			}
+	// looked up in the session, so that a change set sent again while still being applied is found
+	if p.dedup != nil {
+		if cached, ok := p.dedup.lookup(key, time.Now()); ok {
+			deduplicated = true
+			dedupedChangeSetsTotal.Inc()
+			p.logger.Info("skipping change set identical to the one applied last", "changes", len(cached), "window", p.dedup.window)
+			return cached, nil
 		}
 	}
 
-	recordsCache = map[string]*[]inwx.NameserverRecord{}
-	for i, oldEp := range changes.UpdateOld {
-		newEp := changes.UpdateNew[i]
-		zone, err := getZone(zones, oldEp)
-		if err != nil {
-			errs = append(errs, err)
-			slog.Error("failed to update DNS record for endpoint", "err", err)
-		} else {
-			if _, ok := recordsCache[zone]; !ok {
-				if recs, err := p.client.getRecords(zone); err != nil {
-					errs = append(errs, err)
-					slog.Error("failed to query DNS zone info", "zone", zone, "err", err)
-					continue
-				} else {
-					recordsCache[zone] = recs
-				}
-			}
-			recIDs, err := getRecIDs(zone, recordsCache[zone], *oldEp)
-			if err != nil {
-				errs = append(errs, err)
-				slog.Error("failed to look up up records to delete", "err", err)
-			}
-			var name string
-			if newEp.DNSName == zone {
-				name = ""
-			} else {
-				name = strings.TrimSuffix(newEp.DNSName, fmt.Sprintf(".%s", zone))
-			}
-			for j := range max(len(oldEp.Targets), len(newEp.Targets), len(recIDs)) {
-				switch {
-				case j >= len(newEp.Targets):
-					if err = p.client.deleteRecord(recIDs[j]); err != nil {
-						errs = append(errs, err)
-						slog.Error("failed to delete record", "target", oldEp.Targets[j], "ep", oldEp, "err", err)
-					}
-				case j >= len(oldEp.Targets):
-					rec := &inwx.NameserverRecordRequest{
-						Domain:  zone,
-						Name:    name,
-						Type:    newEp.RecordType,
-						TTL:     int(newEp.RecordTTL),
-						Content: newEp.Targets[j],
-					}
-					if err = p.client.createRecord(rec); err != nil {
-						errs = append(errs, err)
-						slog.Error("failed to create record", "rec", rec, "err", err)
-					}
-				default:
-					rec := &inwx.NameserverRecordRequest{
-						Domain:  zone,
-						Name:    name,
-						Type:    newEp.RecordType,
-						TTL:     int(oldEp.RecordTTL),
-						Content: newEp.Targets[j],
-					}
-					if err = p.client.updateRecord(recIDs[j], rec); err != nil {
-						errs = append(errs, err)
-						slog.Error("failed to update record", "rec", rec, "err", err)
-					}
-				}
+	zones, err := p.getZones()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.zoneCreation != nil {
+		p.createMissingZones(zones, changes)
+	}
+	index := p.zoneIndexOf(*zones)
+
+	if p.snapshots != nil {
+		touched := []string{}
+		for _, ep := range slices.Concat(changes.Delete, changes.Create, changes.UpdateOld) {
+			if zone, err := p.getZone(index, ep); err == nil && !slices.Contains(touched, zone) {
+				touched = append(touched, zone)
 			}
 		}
+		if err := p.snapshotZones(ctx, touched); err != nil {
+			return nil, fmt.Errorf("refusing to apply changes without snapshot: %w", err)
+		}
 	}
-	if len(errs) > 0 {
-		return fmt.Errorf("encountered %d errors while applying changes", len(errs))
-	} else {
-		return nil
+
+	results, batches = p.zoneBatches(index, changes)
+	for _, batch := range batches {
+		p.applyZoneBatch(batch, results, budget)
+	}
+	p.recordDesired(index, results)
+	if p.dedup != nil {
+		p.dedup.remember(key, results, time.Now())
 	}
+	return results, nil
 }
 
-func getRecIDs(zone string, records *[]inwx.NameserverRecord, ep endpoint.Endpoint) ([]int, error) {
+// recordTTL returns the TTL written for the records of ep, the default TTL if ep has none, or else
+// current, the TTL of the record updated. 0 omits the TTL from the request, so that INWX applies its default.
+func (p *INWXProvider) recordTTL(ep *endpoint.Endpoint, current int) int {
+	if ep.RecordTTL.IsConfigured() {
+		return int(ep.RecordTTL)
+	}
+	if p.defaultTTL > 0 {
+		return p.defaultTTL
+	}
+	return current
+}
+
+// getRecIDs returns the ID of the record of every target of ep, the first if a target has duplicates.
+// The records of the zone apex are not looked up if protected.
+func getRecIDs(records *zoneRecords, ep endpoint.Endpoint) ([]int, error) {
+	if records.protectApex && isApex(records.apex, ep.DNSName) {
+		return nil, fmt.Errorf("refusing to look up the records of endpoint %s at the zone apex, %w", &ep, errApex)
+	}
 	recIDs := []int{}
 	for _, target := range ep.Targets {
-		for _, record := range *records {
-			var targetDNSName string
-			if record.Name == "" {
-				targetDNSName = zone
-			} else {
-				targetDNSName = fmt.Sprintf("%s.%s", record.Name, zone)
-			}
-			if ep.RecordType == record.Type && target == record.Content && targetDNSName == ep.DNSName {
-				recIDs = append(recIDs, record.ID)
-			}
+		if ids := records.ids[recordKey{dnsName: ep.DNSName, recordType: ep.RecordType, content: normalizeTarget(ep.RecordType, target)}]; len(ids) > 0 {
+			recIDs = append(recIDs, ids[0])
 		}
 	}
 	if len(recIDs) != len(ep.Targets) {
-		return nil, fmt.Errorf("failed to map all endpoint targets to entries")
+		return nil, errRecordNotFound
 	}
 	return recIDs, nil
 }
 
-func getZone(zones *[]string, endpoint *endpoint.Endpoint) (string, error) {
-	var matchZoneName = ""
-	err := fmt.Errorf("unable find matching zone for the endpoint %s", endpoint)
-	for _, zone := range *zones {
-		if strings.HasSuffix(endpoint.DNSName, zone) && len(zone) > len(matchZoneName) {
-			matchZoneName = zone
-			err = nil
+// duplicateRecIDs returns the IDs of the records of the targets of ep that getRecIDs skips as duplicates.
+func duplicateRecIDs(records *zoneRecords, ep endpoint.Endpoint) []int {
+	recIDs := []int{}
+	for _, target := range ep.Targets {
+		if ids := records.ids[recordKey{dnsName: ep.DNSName, recordType: ep.RecordType, content: normalizeTarget(ep.RecordType, target)}]; len(ids) > 1 {
+			recIDs = append(recIDs, ids[1:]...)
 		}
 	}
-	return matchZoneName, err
+	return recIDs
 }
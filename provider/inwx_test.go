@@ -1,11 +1,32 @@
 package inwx
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	inwx "github.com/nrdcg/goinwx"
+	"github.com/orbit-online/external-dns-inwx-webhook/journal"
+	"github.com/orbit-online/external-dns-inwx-webhook/sessionstore"
+	"github.com/orbit-online/external-dns-inwx-webhook/sharedcache"
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/stretchr/testify/assert"
 	"sigs.k8s.io/external-dns/endpoint"
@@ -13,10 +34,7 @@ import (
 )
 
 func NewINWXProviderWithMockClient(domainFilter *[]string, logger *slog.Logger) (*MockClientWrapper, *INWXProvider) {
-	wrapper := &MockClientWrapper{
-		db:       make(map[string](*[]inwx.NameserverRecord)),
-		idToZone: make(map[int]string),
-	}
+	wrapper := NewMockClientWrapper()
 	return wrapper, &INWXProvider{
 		client:       wrapper,
 		domainFilter: endpoint.NewDomainFilter(*domainFilter),
@@ -29,14 +47,92 @@ func TestINWXProvider(t *testing.T) {
 	t.Run("GetRecIDs", testGetRecIDs)
 	t.Run("ApplyChanges", testApplyChanges)
 	t.Run("Records", testRecords)
+	t.Run("DomainExclusion", testDomainExclusion)
+	t.Run("PinnedZones", testPinnedZones)
+	t.Run("DiscoverDomainFilter", testDiscoverDomainFilter)
+	t.Run("ReadOnly", testReadOnly)
+	t.Run("OwnershipGuard", testOwnershipGuard)
+	t.Run("Reload", testReload)
+	t.Run("Zones", testZones)
+	t.Run("ListZones", testListZones)
+	t.Run("RestoreZone", testRestoreZone)
+	t.Run("SnapshotBeforeApply", testSnapshotBeforeApply)
+	t.Run("ApplyChangesWithResults", testApplyChangesWithResults)
+	t.Run("Proxy", testProxy)
+	t.Run("TLSConfig", testTLSConfig)
+	t.Run("InstrumentedTransport", testInstrumentedTransport)
+	t.Run("LogPayloads", testLogPayloads)
+	t.Run("MultiAccount", testMultiAccount)
+	t.Run("AutoCreateZones", testAutoCreateZones)
+	t.Run("ZoneTemplates", testZoneTemplates)
+	t.Run("SlaveZones", testSlaveZones)
+	t.Run("ManageDNSSEC", testManageDNSSEC)
+	t.Run("DomainExpiry", testDomainExpiry)
+	t.Run("SOASerial", testSOASerial)
+	t.Run("DetectDrift", testDetectDrift)
+	t.Run("PollMessages", testPollMessages)
+	t.Run("Maintenance", testMaintenance)
+	t.Run("RateLimit", testRateLimit)
+	t.Run("PersistentSession", testPersistentSession)
+	t.Run("LoginLockout", testLoginLockout)
+	t.Run("RecordsCache", testRecordsCache)
+	t.Run("Prefetch", testPrefetch)
+	t.Run("SharedCache", testSharedCache)
+	t.Run("Journal", testJournal)
+	t.Run("NewProvider", testNewProvider)
+	t.Run("Middleware", testMiddleware)
+	t.Run("MockServer", testMockServer)
+	t.Run("MockFaults", testMockFaults)
+	t.Run("MockFixture", testMockFixture)
+	t.Run("SortedRecords", testSortedRecords)
+	t.Run("DuplicateRecords", testDuplicateRecords)
+	t.Run("Priority", testPriority)
+	t.Run("NormalizeTargets", testNormalizeTargets)
+	t.Run("DefaultTTL", testDefaultTTL)
+	t.Run("ApexNames", testApexNames)
+	t.Run("Wildcards", testWildcards)
+	t.Run("ReverseZones", testReverseZones)
+	t.Run("ZoneBatches", testZoneBatches)
+	t.Run("OrphanedRecords", testOrphanedRecords)
+	t.Run("SoftDelete", testSoftDelete)
+	t.Run("PreviewChanges", testPreviewChanges)
+	t.Run("ErrorClass", testErrorClass)
+	t.Run("NegotiateWebhookVersion", testNegotiateWebhookVersion)
+	t.Run("SubdomainsOnly", testSubdomainsOnly)
+	t.Run("UpdateAddresses", testUpdateAddresses)
+	t.Run("Reconcile", testReconcile)
+	t.Run("InstrumentWebhook", testInstrumentWebhook)
+	t.Run("ZoneRecordLimit", testZoneRecordLimit)
+	t.Run("ValidateContent", testValidateContent)
+	t.Run("RegistryLabels", testRegistryLabels)
+	t.Run("PausedZones", testPausedZones)
+	t.Run("LogEndpoints", testLogEndpoints)
+	t.Run("SyncSummary", testSyncSummary)
+	t.Run("RedactContent", testRedactContent)
+	t.Run("MaxErrorRatio", testMaxErrorRatio)
+	t.Run("RetryQueue", testRetryQueue)
+	t.Run("ConcurrentCreates", testConcurrentCreates)
+	t.Run("DedupChangeSets", testDedupChangeSets)
+	t.Run("ApplyBudget", testApplyBudget)
+	t.Run("CacheMetrics", testCacheMetrics)
+	t.Run("LogConnections", testLogConnections)
+	t.Run("TestingRecords", testTestingRecords)
+	t.Run("CloneZone", testCloneZone)
+	t.Run("ImportZone", testImportZone)
+	t.Run("AdoptionRecords", testAdoptionRecords)
+	t.Run("DiffZone", testDiffZone)
+	t.Run("PermissionErrors", testPermissionErrors)
+	t.Run("SessionStore", testSessionStore)
+	t.Run("ChangeEvents", testChangeEvents)
+	t.Run("UnpairedUpdates", testUnpairedUpdates)
 }
 
 func testEndpointZoneName(t *testing.T) {
 	w, p := NewINWXProviderWithMockClient(&[]string{"bar.org", "baz.org"}, slog.Default())
-	w.CreateZone("bar.org")
-	w.CreateZone("baz.org")
-	w.CreateZone("subdomain.bar.org")
-	zones, _ := p.client.getZones()
+	w.AddZone("bar.org")
+	w.AddZone("baz.org")
+	w.AddZone("subdomain.bar.org")
+	zones, _ := p.getZones()
 
 	ep1 := endpoint.Endpoint{
 		DNSName:    "foo.bar.org",
@@ -68,16 +164,24 @@ func testEndpointZoneName(t *testing.T) {
 		RecordType: endpoint.RecordTypeA,
 	}
 
-	z, _ := getZone(zones, &ep1)
+	index := newZoneIndex(*zones)
+	z, _ := index.zoneOf(&ep1)
 	assert.Equal(t, "bar.org", z)
-	z, _ = getZone(zones, &ep2)
+	z, _ = index.zoneOf(&ep2)
 	assert.Equal(t, "", z)
-	z, _ = getZone(zones, &ep3)
+	z, _ = index.zoneOf(&ep3)
 	assert.Equal(t, "baz.org", z)
-	z, _ = getZone(zones, &ep4)
+	z, _ = index.zoneOf(&ep4)
 	assert.Equal(t, "subdomain.bar.org", z)
-	z, _ = getZone(zones, &ep5)
+	z, _ = index.zoneOf(&ep5)
 	assert.Equal(t, "bar.org", z)
+	z, _ = index.zoneOf(&endpoint.Endpoint{DNSName: "foobar.org"})
+	assert.Equal(t, "", z, "zones match whole labels only")
+
+	cached := p.zoneIndexOf(*zones)
+	cached["cached.invalid"] = 0
+	assert.Contains(t, p.zoneIndexOf(*zones), "cached.invalid", "the index is reused while the zones are unchanged")
+	assert.NotContains(t, p.zoneIndexOf(append(*zones, "new.org")), "cached.invalid")
 }
 
 func testGetRecIDs(t *testing.T) {
@@ -112,7 +216,7 @@ func testGetRecIDs(t *testing.T) {
 
 	records := []inwx.NameserverRecord{inwx1, inwx2, inwx3, inwx4}
 
-	recIDs, err := getRecIDs("example.com", &records, endpoint.Endpoint{
+	recIDs, err := getRecIDs(newZoneRecords("example.com", &records), endpoint.Endpoint{
 		DNSName:    "foo.example.com",
 		Targets:    []string{"heritage=external-dns,external-dns/owner=default,external-dns/resource=service/default/nginx"},
 		RecordType: "TXT",
@@ -120,7 +224,7 @@ func testGetRecIDs(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []int{10}, recIDs)
 
-	recIDs, err = getRecIDs("baz.org", &records, endpoint.Endpoint{
+	recIDs, err = getRecIDs(newZoneRecords("baz.org", &records), endpoint.Endpoint{
 		DNSName:    "foo.baz.org",
 		Targets:    []string{"5.5.5.5"},
 		RecordType: "A",
@@ -128,7 +232,7 @@ func testGetRecIDs(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []int{11}, recIDs)
 
-	recIDs, err = getRecIDs("baz.org", &records, endpoint.Endpoint{
+	recIDs, err = getRecIDs(newZoneRecords("baz.org", &records), endpoint.Endpoint{
 		DNSName:    "baz.org",
 		Targets:    []string{"5.5.5.5", "5.5.5.6"},
 		RecordType: "A",
@@ -140,7 +244,7 @@ func testGetRecIDs(t *testing.T) {
 
 func testApplyChanges(t *testing.T) {
 	w, p := NewINWXProviderWithMockClient(&[]string{"example.com"}, slog.Default())
-	w.CreateZone("example.com")
+	w.AddZone("example.com")
 	var err error
 	var recs *[]inwx.NameserverRecord
 	ep1 := &endpoint.Endpoint{
@@ -156,7 +260,7 @@ func testApplyChanges(t *testing.T) {
 		UpdateNew: []*endpoint.Endpoint{},
 	})
 	assert.NoError(t, err)
-	recs, err = w.getRecords("example.com")
+	recs, err = w.GetRecords("example.com")
 	assert.NoError(t, err)
 	assert.Equal(t, &[]inwx.NameserverRecord{{
 		ID:      0,
@@ -179,7 +283,7 @@ func testApplyChanges(t *testing.T) {
 		UpdateNew: []*endpoint.Endpoint{ep2},
 	})
 	assert.NoError(t, err)
-	recs, err = w.getRecords("example.com")
+	recs, err = w.GetRecords("example.com")
 	assert.NoError(t, err)
 	assert.Equal(t, &[]inwx.NameserverRecord{{
 		ID:      0,
@@ -196,7 +300,7 @@ func testApplyChanges(t *testing.T) {
 		UpdateNew: []*endpoint.Endpoint{},
 	})
 	assert.NoError(t, err)
-	recs, err = w.getRecords("example.com")
+	recs, err = w.GetRecords("example.com")
 	assert.NoError(t, err)
 	assert.Equal(t, &[]inwx.NameserverRecord{}, recs)
 }
@@ -207,3 +311,2513 @@ func testRecords(t *testing.T) {
 	assert.Equal(t, []*endpoint.Endpoint{}, ep)
 	assert.NoError(t, err)
 }
+
+func testDomainExclusion(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{"example.com"}, slog.Default())
+	p.domainFilter = endpoint.NewDomainFilterWithExclusions([]string{"example.com"}, []string{"internal.example.com"})
+	w.AddZone("example.com")
+	w.AddZone("internal.example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}))
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "bar.internal", Type: "A", Content: "1.1.1.1", TTL: 60}))
+
+	assert.False(t, p.GetDomainFilter().Match("foo.internal.example.com"))
+	assert.True(t, p.GetDomainFilter().Match("foo.example.com"))
+
+	zones, err := p.getZones()
+	assert.NoError(t, err)
+	assert.Equal(t, &[]string{"example.com"}, zones)
+
+	eps, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.1")}, eps)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("baz.internal.example.com", "A", 60, "1.1.1.1")},
+	})
+	assert.Error(t, err)
+}
+
+func testPinnedZones(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	p.zones = normalizeZones([]string{"Example.com.", "example.com", " example.org "})
+	w.AddZone("example.com")
+	w.AddZone("example.org")
+	w.AddZone("example.net")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.net", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}))
+	discoveries := 0
+	p.client = chainMiddleware(w, []Middleware{Intercept(func(method string, call func() error) error {
+		if method == "GetZones" {
+			discoveries++
+		}
+		return call()
+	})})
+
+	zones, err := p.getZones()
+	assert.NoError(t, err)
+	assert.Equal(t, &[]string{"example.com", "example.org"}, zones)
+
+	eps, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, eps)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.net", "A", 60, "1.1.1.1")},
+	})
+	assert.Error(t, err)
+	assert.Zero(t, discoveries, "pinned zones are never discovered")
+}
+
+func testDiscoverDomainFilter(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	p.excludeDomains = []string{"internal.example.com"}
+	w.AddZone("example.com")
+	w.AddZone("example.org")
+	assert.True(t, p.GetDomainFilter().Match("foo.example.net"))
+
+	assert.NoError(t, p.refreshDomainFilter())
+	df := p.GetDomainFilter()
+	assert.True(t, df.Match("foo.example.com"))
+	assert.True(t, df.Match("example.org"))
+	assert.False(t, df.Match("foo.example.net"))
+	assert.False(t, df.Match("foo.internal.example.com"))
+}
+
+func testReadOnly(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{"example.com"}, slog.Default())
+	p.client = &ReadOnlyClientWrapper{AbstractClientWrapper: w, logger: slog.Default()}
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}))
+	before, err := w.GetRecords("example.com")
+	assert.NoError(t, err)
+
+	eps, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, eps, 1)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("bar.example.com", "A", 60, "2.2.2.2")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.2")},
+	})
+	assert.NoError(t, err)
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.1")},
+	})
+	assert.NoError(t, err)
+
+	after, err := w.GetRecords("example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+func testOwnershipGuard(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{"example.com"}, slog.Default())
+	p.ownership = NewOwnershipGuard("", "default")
+	w.AddZone("example.com")
+	owner := "heritage=external-dns,external-dns/owner=default,external-dns/resource=service/default/nginx"
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}))
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "a-foo", Type: "TXT", Content: owner, TTL: 60}))
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "bar", Type: "A", Content: "2.2.2.2", TTL: 60}))
+
+	err := p.ApplyChanges(context.TODO(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("bar.example.com", "A", 60, "2.2.2.2")},
+	})
+	assert.Error(t, err)
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("bar.example.com", "A", 60, "2.2.2.2")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("bar.example.com", "A", 60, "2.2.2.3")},
+	})
+	assert.Error(t, err)
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.2")},
+	})
+	assert.NoError(t, err)
+
+	recs, err := w.GetRecords("example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.1.1.2", (*recs)[0].Content)
+	assert.Equal(t, "2.2.2.2", (*recs)[2].Content)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("a-foo.example.com", "TXT", 60, owner),
+			endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.2"),
+		},
+	})
+	assert.NoError(t, err)
+	recs, err = w.GetRecords("example.com")
+	assert.NoError(t, err)
+	assert.Len(t, *recs, 1)
+
+	assert.Equal(t, []string{"txt.a-foo.example.com", "txt.foo.example.com"}, NewOwnershipGuard("txt.", "default").txtNames("foo.example.com", "A"))
+	assert.Equal(t, "cname-www.example.com", NewOwnershipGuard("%{record_type}-", "default").txtNames("www.example.com", "CNAME")[0])
+	assert.False(t, NewOwnershipGuard("", "other").isOwnershipRecord(owner))
+}
+
+func testReload(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{"example.com"}, slog.Default())
+	w.AddZone("example.com")
+	w.AddZone("example.org")
+	assert.False(t, p.GetDomainFilter().Match("foo.example.org"))
+
+	p.Reload(Config{DomainFilter: []string{"example.org"}, ExcludeDomains: []string{"internal.example.org"}, Zones: []string{"example.org"}, Ownership: NewOwnershipGuard("", "default")})
+	assert.True(t, p.GetDomainFilter().Match("foo.example.org"))
+	assert.False(t, p.GetDomainFilter().Match("foo.internal.example.org"))
+	assert.NotNil(t, p.ownership)
+	zones, err := p.getZones()
+	assert.NoError(t, err)
+	assert.Equal(t, &[]string{"example.org"}, zones)
+
+	// the default TTL applies to the endpoints applied after the reload
+	p.Reload(Config{Zones: []string{"example.org"}, DefaultTTL: 600})
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.org", "A", "192.0.2.1")}}))
+	records, _ := w.GetRecords("example.org")
+	assert.Equal(t, 600, (*records)[0].TTL)
+
+	// the records of the zone apex are protected after the reload
+	p.Reload(Config{Zones: []string{"example.org"}, SubdomainsOnly: true})
+	apex := endpoint.NewEndpoint("example.org", "A", "192.0.2.2")
+	assert.Empty(t, p.withoutApex([]*endpoint.Endpoint{apex}))
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{apex}})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, results[0].Err, errApex)
+
+	// the limits of an apply apply to the applies after the reload
+	p.Reload(Config{Zones: []string{"example.org"}, MaxApplyDuration: time.Nanosecond})
+	results, err = p.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("api.example.org", "A", "192.0.2.3")}})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, results[0].Err, errAborted)
+	p.Reload(Config{Zones: []string{"example.org"}, MaxApplyCalls: 1})
+	results, err = p.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("api.example.org", "A", "192.0.2.3")}})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, results[0].Err, errAborted)
+	p.Reload(Config{Zones: []string{"example.org"}, MaxErrorRatio: 0.5})
+	assert.Equal(t, 0.5, p.newApplyBudget(time.Now()).maxRatio)
+	assert.False(t, p.subdomainsOnly, "settings not set in the config are reset to their defaults")
+}
+
+func testZones(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{"example.com", "example.org"}, slog.Default())
+	w.AddZone("example.org")
+	w.AddZone("example.net")
+	w.AddZone("example.com")
+	zones, err := p.Zones()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "example.org"}, zones)
+}
+
+func testListZones(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{"example.com"}, slog.Default())
+	w.AddZone("example.org")
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.org", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}))
+	zones, err := p.ListZones()
+	assert.NoError(t, err)
+	assert.Equal(t, []ZoneStatus{{Name: "example.com", Type: "MASTER", Managed: true}, {Name: "example.org", Type: "MASTER", Managed: false}}, zones)
+
+	recs, err := p.ZoneRecords("example.org")
+	assert.NoError(t, err)
+	assert.Len(t, recs, 1)
+	_, err = p.ZoneRecords("example.net")
+	assert.Error(t, err)
+}
+
+func testRestoreZone(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{"example.com"}, slog.Default())
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "", Type: "SOA", Content: "ns.inwx.de. hostmaster.inwx.de. 1 10800 3600 604800 3600", TTL: 86400}))
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}))
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "bar", Type: "A", Content: "2.2.2.2", TTL: 60}))
+	s, err := p.SnapshotZone("example.com")
+	assert.NoError(t, err)
+	assert.Len(t, s.Records, 3)
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("baz.example.com", "A", 60, "3.3.3.3")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("bar.example.com", "A", 60, "2.2.2.2")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.2")},
+	}))
+
+	operations, err := p.RestoreZone(s, true, false)
+	assert.NoError(t, err)
+	assert.Len(t, operations, 4)
+	recs, err := w.GetRecords("example.com")
+	assert.NoError(t, err)
+	assert.Len(t, *recs, 3)
+
+	_, err = p.RestoreZone(s, false, false)
+	assert.NoError(t, err)
+	operations, err = p.RestoreZone(s, true, false)
+	assert.NoError(t, err)
+	assert.Empty(t, operations)
+
+	s.Records[1].TTL = 300
+	operations, err = p.RestoreZone(s, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []RestoreOperation{{Action: "update", Record: snapshot.Record{ID: 4, Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 300}, Previous: &snapshot.Record{ID: 4, Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}}}, operations)
+
+	// duplicate records match one by one rather than all the first duplicate
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 300}))
+	duplicated, err := p.SnapshotZone("example.com")
+	assert.NoError(t, err)
+	operations, err = p.RestoreZone(duplicated, true, false)
+	assert.NoError(t, err)
+	assert.Empty(t, operations)
+
+	// zones outside the managed zones are only restored with force
+	w.AddZone("example.org")
+	other := &snapshot.Snapshot{Zone: "example.org", Records: []snapshot.Record{{Name: "www", Type: "A", Content: "4.4.4.4", TTL: 60}}}
+	_, err = p.RestoreZone(other, false, false)
+	assert.ErrorIs(t, err, errNoZone)
+	recs, _ = w.GetRecords("example.org")
+	assert.Empty(t, *recs)
+	operations, err = p.RestoreZone(other, false, true)
+	assert.NoError(t, err)
+	assert.Len(t, operations, 1)
+}
+
+func testSnapshotBeforeApply(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{"example.com", "example.org"}, slog.Default())
+	dir := t.TempDir()
+	store, err := snapshot.NewStore(dir, snapshot.S3Config{})
+	assert.NoError(t, err)
+	p.snapshots = store
+	w.AddZone("example.com")
+	w.AddZone("example.org")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}))
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("bar.example.com", "A", 60, "2.2.2.2")},
+	}))
+	snapshots, err := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	assert.NoError(t, err)
+	assert.Len(t, snapshots, 1)
+	s, err := snapshot.Load(context.TODO(), snapshots[0], snapshot.S3Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", s.Zone)
+	assert.Len(t, s.Records, 1)
+
+	assert.NoError(t, os.RemoveAll(dir))
+	assert.NoError(t, os.WriteFile(dir, nil, 0o600))
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("baz.example.com", "A", 60, "3.3.3.3")},
+	})
+	assert.Error(t, err)
+	recs, err := w.GetRecords("example.com")
+	assert.NoError(t, err)
+	assert.Len(t, *recs, 2)
+}
+
+func testApplyChangesWithResults(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{"example.com"}, slog.Default())
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}))
+
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("bar.example.com", "A", 60, "2.2.2.2"),
+			endpoint.NewEndpointWithTTL("bar.example.org", "A", 60, "2.2.2.2"),
+		},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.2")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.com", "A", 60, "1.1.1.3")},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	assert.Equal(t, "delete", results[0].Action)
+	assert.Error(t, results[0].Err)
+	assert.Equal(t, "create", results[1].Action)
+	assert.NoError(t, results[1].Err)
+	assert.Error(t, results[2].Err)
+	assert.Equal(t, "update", results[3].Action)
+	assert.NoError(t, results[3].Err)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("bar.example.org", "A", 60, "2.2.2.2")},
+	})
+	assert.EqualError(t, err, "failed to apply 1 of 1 changes")
+}
+
+// xmlrpcResponse is a successful INWX API response without data.
+const xmlrpcResponse = `<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>code</name><value><int>1000</int></value></member>
+<member><name>msg</name><value><string>Command completed successfully</string></value></member>
+</struct></value></param></params></methodResponse>`
+
+func testProxy(t *testing.T) {
+	t.Setenv("NO_PROXY", "")
+	hosts := []string{}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.URL.Host)
+		_, _ = w.Write([]byte(xmlrpcResponse))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	apiURL, _ := url.Parse("http://api.inwx.invalid/xmlrpc/")
+
+	_, err := newClientWrapper(ClientOptions{APIURL: apiURL, ProxyURL: proxyURL}, slog.Default()).Login()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api.inwx.invalid"}, hosts)
+
+	t.Setenv("NO_PROXY", ".inwx.invalid")
+	_, err = newClientWrapper(ClientOptions{APIURL: apiURL, ProxyURL: proxyURL}, slog.Default()).Login()
+	assert.Error(t, err)
+	assert.Len(t, hosts, 1)
+}
+
+func testTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(xmlrpcResponse))
+	}))
+	defer server.Close()
+	apiURL, _ := url.Parse(server.URL)
+
+	_, err := newClientWrapper(ClientOptions{APIURL: apiURL}, slog.Default()).Login()
+	assert.Error(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	_, err = newClientWrapper(ClientOptions{APIURL: apiURL, TLSConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}, slog.Default()).Login()
+	assert.NoError(t, err)
+	_, err = newClientWrapper(ClientOptions{APIURL: apiURL, TLSConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS13}}, slog.Default()).Login()
+	assert.NoError(t, err)
+}
+
+func testInstrumentedTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(xmlrpcResponse))
+	}))
+	defer server.Close()
+	apiURL, _ := url.Parse(server.URL)
+	before := testutil.ToFloat64(apiRequestsTotal.WithLabelValues("account.login", "200"))
+
+	w := newClientWrapper(ClientOptions{APIURL: apiURL, Transport: TransportOptions{DisableKeepAlives: true, DisableHTTP2: true, MaxIdleConns: 1}}, slog.Default())
+	_, err := w.Login()
+	assert.NoError(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(apiRequestsTotal.WithLabelValues("account.login", "200")))
+	assert.Equal(t, "nameserver.info", xmlrpcMethod([]byte(`<?xml version="1.0"?><methodCall><methodName>nameserver.info</methodName></methodCall>`)))
+	assert.Equal(t, "unknown", xmlrpcMethod([]byte("{}")))
+}
+
+func testLogPayloads(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "domrobot", Value: "session-id"})
+		_, _ = w.Write([]byte(xmlrpcResponse))
+	}))
+	defer server.Close()
+	apiURL, _ := url.Parse(server.URL)
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	w := newClientWrapper(ClientOptions{Username: "user", Password: "hunter2", APIURL: apiURL, LogPayloads: true}, logger)
+	_, err := w.Login()
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), "account.login")
+	assert.Contains(t, logs.String(), "Command completed successfully")
+	assert.NotContains(t, logs.String(), "hunter2")
+	assert.NotContains(t, logs.String(), "session-id")
+
+	body := `<member><name>tan</name><value><string>123456</string></value></member><member><name>domain</name><value><string>example.com</string></value></member>`
+	assert.Equal(t, `<member><name>tan</name><value><string>REDACTED</string></value></member><member><name>domain</name><value><string>example.com</string></value></member>`, redactPayload([]byte(body)))
+}
+
+func testMultiAccount(t *testing.T) {
+	wa, pa := NewINWXProviderWithMockClient(&[]string{"example.com"}, slog.Default())
+	wa.AddZone("example.com")
+	pa.excludeDomains = []string{"sub.example.com"}
+	wb, pb := NewINWXProviderWithMockClient(&[]string{"example.org", "sub.example.com"}, slog.Default())
+	wb.AddZone("example.org")
+	wb.AddZone("sub.example.com")
+	assert.NoError(t, wb.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.org", Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}))
+	m := NewMultiAccountProvider([]Account{{Name: "a", Provider: pa}, {Name: "b", Provider: pb}}, slog.Default())
+
+	df := m.GetDomainFilter()
+	assert.True(t, df.Match("foo.example.com"))
+	assert.True(t, df.Match("foo.sub.example.com"))
+	assert.True(t, df.Match("foo.example.org"))
+	assert.False(t, df.Match("foo.example.net"))
+	assert.Same(t, df, m.GetDomainFilter(), "the union is kept while the account filters are")
+	pb.Reload(Config{DomainFilter: []string{"example.org", "sub.example.com", "example.net"}})
+	assert.True(t, m.GetDomainFilter().Match("foo.example.net"), "the union is built again after a reload")
+	pb.Reload(Config{DomainFilter: []string{"example.org", "sub.example.com"}})
+
+	results, err := m.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("bar.example.com", "A", 60, "2.2.2.2"),
+			endpoint.NewEndpointWithTTL("bar.sub.example.com", "A", 60, "3.3.3.3"),
+			endpoint.NewEndpointWithTTL("bar.example.net", "A", 60, "4.4.4.4"),
+		},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.org", "A", 60, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.org", "A", 60, "1.1.1.2")},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	assert.Error(t, results[0].Err)
+	assert.Equal(t, "bar.example.net", results[0].Endpoint.DNSName)
+	for _, result := range results[1:] {
+		assert.NoError(t, result.Err)
+	}
+
+	recs, err := wa.GetRecords("example.com")
+	assert.NoError(t, err)
+	assert.Len(t, *recs, 1)
+	recs, err = wb.GetRecords("sub.example.com")
+	assert.NoError(t, err)
+	assert.Len(t, *recs, 1)
+
+	eps, err := m.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, eps, 3)
+	assert.Error(t, m.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("bar.example.net", "A", 60, "4.4.4.4")},
+	}))
+}
+
+func testAutoCreateZones(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	p.zoneCreation = &ZoneCreation{}
+	w.AddZone("example.com")
+	w.RegisterDomain("example.com")
+	w.RegisterDomain("example.org")
+
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("foo.example.org", "A", 60, "1.1.1.1"),
+			endpoint.NewEndpointWithTTL("bar.example.org", "A", 60, "2.2.2.2"),
+			endpoint.NewEndpointWithTTL("foo.example.net", "A", 60, "3.3.3.3"),
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[1].Err)
+	assert.Error(t, results[2].Err)
+
+	recs, err := w.GetRecords("example.org")
+	assert.NoError(t, err)
+	assert.Len(t, *recs, len(DefaultNameservers)+2)
+	assert.Equal(t, "NS", (*recs)[0].Type)
+	_, err = w.GetRecords("example.net")
+	assert.Error(t, err)
+	assert.Equal(t, "example.org", registeredDomain([]inwx.DomainInfoResponse{{Domain: "org"}, {Domain: "example.org"}}, "foo.example.org"))
+}
+
+func testZoneTemplates(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("template.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "template.com", Type: "NS", Content: "ns.inwx.de", TTL: 86400}))
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "template.com", Type: "TXT", Content: "v=spf1 -all", TTL: 3600}))
+	w.RegisterDomain("example.org")
+	p.zoneCreation = &ZoneCreation{
+		Nameservers: []string{"ns1.example.net"},
+		CloneFrom:   "template.com",
+		Records:     []TemplateRecord{{Name: "_dmarc", Type: "TXT", Content: "v=DMARC1; p=reject; rua=mailto:dmarc@{zone}"}},
+	}
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("foo.example.org", "A", 60, "1.1.1.1")},
+	}))
+	recs, err := w.GetRecords("example.org")
+	assert.NoError(t, err)
+	contents := []string{}
+	for _, rec := range *recs {
+		contents = append(contents, rec.Content)
+	}
+	assert.Equal(t, []string{"ns1.example.net", "v=spf1 -all", "v=DMARC1; p=reject; rua=mailto:dmarc@example.org", "1.1.1.1"}, contents)
+}
+
+func testSlaveZones(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	w.CreateSlaveZone("example.org")
+	zones, err := p.Zones()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com"}, zones)
+	assert.Equal(t, float64(1), testutil.ToFloat64(skippedZones.WithLabelValues("example.org", "slave")))
+
+	statuses, err := p.ListZones()
+	assert.NoError(t, err)
+	assert.Equal(t, ZoneStatus{Name: "example.org", Type: "SLAVE", Managed: false}, statuses[1])
+
+	w.slaves = nil
+	zones, err = p.Zones()
+	assert.NoError(t, err)
+	assert.Len(t, zones, 2)
+	assert.Equal(t, 0, testutil.CollectAndCount(skippedZones))
+}
+
+func testManageDNSSEC(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	w.AddZone("example.org")
+	w.dnssec = map[string]string{"example.org": "MANUAL"}
+	assert.NoError(t, p.checkDNSSEC(false))
+	assert.Equal(t, map[string]string{"example.org": "MANUAL"}, w.dnssec)
+	assert.Equal(t, float64(0), testutil.ToFloat64(dnssecSignedZones.WithLabelValues("example.com")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(dnssecSignedZones.WithLabelValues("example.org")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(dnssecDSPublished.WithLabelValues("example.org")))
+
+	assert.NoError(t, p.checkDNSSEC(true))
+	assert.Equal(t, map[string]string{"example.com": "AUTO", "example.org": "MANUAL"}, w.dnssec)
+	assert.NoError(t, p.checkDNSSEC(false))
+	assert.Equal(t, float64(1), testutil.ToFloat64(dnssecSignedZones.WithLabelValues("example.com")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(dnssecDSPublished.WithLabelValues("example.com")))
+
+	p.client = &ReadOnlyClientWrapper{AbstractClientWrapper: w, logger: slog.Default()}
+	w.AddZone("example.net")
+	assert.NoError(t, p.checkDNSSEC(true))
+	assert.NotContains(t, w.dnssec, "example.net")
+
+	delete(w.db, "example.net")
+	assert.NoError(t, p.checkDNSSEC(false))
+	assert.Equal(t, 4, testutil.CollectAndCount(dnssecSignedZones)+testutil.CollectAndCount(dnssecDSPublished))
+}
+
+func testDomainExpiry(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.RegisterDomainUntil("example.com", time.Unix(1893456000, 0))
+	w.RegisterDomainUntil("example.org", time.Unix(1924992000, 0))
+	w.RegisterDomain("example.net")
+	assert.NoError(t, p.reportDomainExpiry())
+	assert.Equal(t, float64(1893456000), testutil.ToFloat64(domainExpiry.WithLabelValues("example.com")))
+	assert.Equal(t, float64(1924992000), testutil.ToFloat64(domainExpiry.WithLabelValues("example.org")))
+	assert.Equal(t, 2, testutil.CollectAndCount(domainExpiry))
+
+	w.domains = w.domains[1:]
+	assert.NoError(t, p.reportDomainExpiry())
+	assert.Equal(t, 1, testutil.CollectAndCount(domainExpiry))
+}
+
+func testSOASerial(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	w.AddZone("example.org")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Type: "SOA", Content: "ns.inwx.de. hostmaster.inwx.de. 2026101401 10800 3600 604800 3600", TTL: 86400}))
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.org", Type: "SOA", Content: "ns.inwx.de. hostmaster.inwx.de. 2026101402 10800 3600 604800 3600", TTL: 86400}))
+	_, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2026101401), testutil.ToFloat64(zoneSOASerial.WithLabelValues("example.com")))
+	assert.Equal(t, float64(2026101402), testutil.ToFloat64(zoneSOASerial.WithLabelValues("example.org")))
+
+	delete(w.db, "example.org")
+	_, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, testutil.CollectAndCount(zoneSOASerial))
+}
+
+func testDetectDrift(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	_, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("www.example.com", "A", "1.2.3.4", "1.2.3.5"),
+			endpoint.NewEndpoint("example.com", "TXT", "\"v=spf1 -all\""),
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, p.detectDrift())
+	assert.Equal(t, 0, testutil.CollectAndCount(recordsDriftTotal))
+
+	recs, _ := w.GetRecords("example.com")
+	for _, rec := range *recs {
+		if rec.Content == "1.2.3.5" {
+			assert.NoError(t, w.UpdateRecord(rec.ID, &inwx.NameserverRecordRequest{Domain: "example.com", Name: "www", Type: "A", Content: "5.6.7.8"}))
+		}
+	}
+	assert.NoError(t, p.detectDrift())
+	assert.Equal(t, float64(1), testutil.ToFloat64(recordsDriftTotal.WithLabelValues("example.com", "missing")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(recordsDriftTotal.WithLabelValues("example.com", "unexpected")))
+
+	_, err = p.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "1.2.3.4", "5.6.7.8")},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, p.detectDrift())
+	assert.Equal(t, float64(1), testutil.ToFloat64(recordsDriftTotal.WithLabelValues("example.com", "missing")))
+}
+
+func testPollMessages(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.messages = []AccountMessage{
+		{ID: 1, Type: "DOMAIN_TRANSFER", Object: "example.com", Message: "Transfer completed"},
+		{ID: 2, Type: "DOMAIN_TRANSFER", Object: "example.org", Message: "Transfer completed"},
+		{ID: 3, Type: "POLICY", Message: "Terms changed"},
+	}
+
+	p.client = &ReadOnlyClientWrapper{AbstractClientWrapper: w, logger: slog.Default()}
+	assert.NoError(t, p.pollMessages())
+	assert.NoError(t, p.pollMessages())
+	assert.Len(t, w.messages, 3)
+	assert.Equal(t, float64(1), testutil.ToFloat64(accountMessagesTotal.WithLabelValues("DOMAIN_TRANSFER")))
+
+	p.client = w
+	assert.NoError(t, p.pollMessages())
+	assert.Empty(t, w.messages)
+	assert.Equal(t, float64(2), testutil.ToFloat64(accountMessagesTotal.WithLabelValues("DOMAIN_TRANSFER")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(accountMessagesTotal.WithLabelValues("POLICY")))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>code</name><value><int>1000</int></value></member>
+<member><name>resData</name><value><struct>
+<member><name>count</name><value><int>1</int></value></member>
+<member><name>msg</name><value><struct>
+<member><name>id</name><value><int>42</int></value></member>
+<member><name>type</name><value><string>DOMAIN_TRANSFER</string></value></member>
+<member><name>date</name><value><dateTime.iso8601>20261014T10:00:00</dateTime.iso8601></value></member>
+<member><name>object</name><value><string>example.com</string></value></member>
+<member><name>msg</name><value><string>Transfer completed</string></value></member>
+</struct></value></member>
+</struct></value></member>
+</struct></value></param></params></methodResponse>`))
+	}))
+	defer server.Close()
+	apiURL, _ := url.Parse(server.URL)
+	message, err := newClientWrapper(ClientOptions{APIURL: apiURL}, slog.Default()).PollMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, &AccountMessage{ID: 42, Type: "DOMAIN_TRANSFER", Date: time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC), Object: "example.com", Message: "Transfer completed"}, message)
+}
+
+func testMaintenance(t *testing.T) {
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	for reason, until := range map[string]time.Time{
+		"Scheduled maintenance until 2026-10-14 12:30":      time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC),
+		"Maintenance for approximately 30 minutes":          now.Add(30 * time.Minute),
+		"Maintenance in progress":                           now.Add(defaultMaintenanceBackoff),
+		"Maintenance until 2026-10-20 00:00, please wait":   now.Add(maxMaintenanceBackoff),
+		"Maintenance until 2026-10-14 09:00 (already over)": now.Add(defaultMaintenanceBackoff),
+	} {
+		got, ok := maintenanceUntil(&inwx.ErrorResponse{Code: 2400, Reason: reason}, now)
+		assert.True(t, ok, reason)
+		assert.Equal(t, until, got, reason)
+	}
+	_, ok := maintenanceUntil(&inwx.ErrorResponse{Code: 2200, Message: "Authentication error"}, now)
+	assert.False(t, ok)
+
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	w.loginErr = &inwx.ErrorResponse{Code: 2400, Message: "Command failed", Reason: "Maintenance for 10 minutes"}
+	_, err := p.Zones()
+	var maintenance *MaintenanceError
+	assert.ErrorAs(t, err, &maintenance)
+	assert.Equal(t, float64(1), testutil.ToFloat64(apiMaintenance))
+	_, ok = p.Maintenance()
+	assert.True(t, ok)
+
+	w.loginErr = nil
+	_, err = p.Zones()
+	assert.ErrorAs(t, err, &maintenance, "calls are not retried during the maintenance")
+	p.maintenanceUntil.Store(time.Now().Add(-time.Second).UnixNano())
+	_, err = p.Zones()
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), testutil.ToFloat64(apiMaintenance))
+	assert.Zero(t, p.maintenanceUntil.Load())
+}
+
+func testRateLimit(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, 10*time.Second, retryAfter("10", now))
+	assert.Equal(t, 2*time.Minute, retryAfter(now.Add(2*time.Minute).UTC().Format(http.TimeFormat), now.Truncate(time.Second)))
+	assert.Equal(t, maxRateLimitPause, retryAfter("86400", now))
+	assert.Equal(t, defaultRateLimitPause, retryAfter("", now))
+
+	limited := `<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>code</name><value><int>2502</int></value></member>
+<member><name>msg</name><value><string>Request limit exceeded, retry in 120 seconds</string></value></member>
+</struct></value></param></params></methodResponse>`
+	pause, ok, err := rateLimited(&http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(limited))})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 120*time.Second, pause)
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(xmlrpcResponse))}
+	_, ok, err = rateLimited(resp)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, xmlrpcResponse, string(body))
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(xmlrpcResponse))
+	}))
+	defer server.Close()
+	apiURL, _ := url.Parse(server.URL)
+	before := testutil.ToFloat64(rateLimitedTotal)
+	_, err = newClientWrapper(ClientOptions{APIURL: apiURL}, slog.Default()).Login()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, before+1, testutil.ToFloat64(rateLimitedTotal))
+}
+
+func testPersistentSession(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	p.persistentSession = true
+	for range 3 {
+		_, err := p.Zones()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, w.logins)
+
+	p.keepSessionAlive()
+	assert.True(t, p.loggedIn)
+	w.loginErr = fmt.Errorf("session expired")
+	p.keepSessionAlive()
+	assert.False(t, p.loggedIn)
+	w.loginErr = nil
+	_, err := p.Zones()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, w.logins)
+
+	p.sessionUsed = time.Now().Add(-sessionIdleTimeout)
+	_, err = p.Zones()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, w.logins)
+}
+
+func testLoginLockout(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	p.clientOptions = ClientOptions{Username: "user", Password: "wrong", MaxLoginFailures: 2}
+	w.loginErr = &inwx.ErrorResponse{Code: authenticationErrorCode, Message: "Authentication error"}
+	before := testutil.ToFloat64(loginsTotal.WithLabelValues("invalid_credentials"))
+	_, err := p.Zones()
+	assert.Error(t, err)
+	_, err = p.Zones()
+	assert.ErrorContains(t, err, "not logging into INWX before")
+	assert.Equal(t, 1, w.logins)
+
+	p.loginBackoffUntil = time.Time{}
+	_, err = p.Zones()
+	assert.Error(t, err)
+	assert.True(t, p.LoginLocked())
+	_, err = p.Zones()
+	var locked *LoginLockedError
+	assert.ErrorAs(t, err, &locked)
+	assert.Equal(t, 2, w.logins)
+	assert.Equal(t, before+2, testutil.ToFloat64(loginsTotal.WithLabelValues("invalid_credentials")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(loginLocked))
+
+	p.SetCredentials("user", "wrong")
+	assert.True(t, p.LoginLocked())
+	p.SetCredentials("user", "right")
+	assert.False(t, p.LoginLocked())
+	assert.Equal(t, float64(0), testutil.ToFloat64(loginLocked))
+	assert.NotSame(t, w, p.client)
+
+	w.loginErr = fmt.Errorf("connection refused")
+	p.client = w
+	for range 3 {
+		_, err = p.Zones()
+		assert.Error(t, err)
+	}
+	assert.False(t, p.LoginLocked(), "only credential failures count")
+}
+
+func testRecordsCache(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "live", Type: "A", Content: "1.2.3.4", TTL: 300}))
+	path := filepath.Join(t.TempDir(), "records.json")
+	p.cache = newRecordsCache(path)
+	stale := []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("cached.example.com", "A", 300, "5.6.7.8")}
+	assert.NoError(t, p.cache.save(stale))
+
+	p.sessionMu.Lock()
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "cached.example.com", endpoints[0].DNSName)
+	assert.Equal(t, float64(1), testutil.ToFloat64(recordsCacheStale))
+	p.sessionMu.Unlock()
+
+	assert.Eventually(t, func() bool { return testutil.ToFloat64(recordsCacheStale) == 0 }, time.Second, 10*time.Millisecond)
+	endpoints, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "live.example.com", endpoints[0].DNSName)
+	file, err := p.cache.read()
+	assert.NoError(t, err)
+	assert.Equal(t, "live.example.com", file.Endpoints[0].DNSName)
+}
+
+func testPrefetch(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "www", Type: "A", Content: "1.2.3.4", TTL: 300}))
+	p.Prefetch()
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, endpoints, 1)
+	assert.Equal(t, 1, w.logins, "Records takes over the prefetch")
+
+	_, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, w.logins)
+}
+
+// memStore is a shared cache store of a single process, recording the locks taken and failing to
+// take them with lockErr, if set.
+type memStore struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	locks   []string
+	lockErr error
+}
+
+func (s *memStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	return value, ok, nil
+}
+
+func (s *memStore) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	return nil
+}
+
+func (s *memStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+func (s *memStore) Lock(_ context.Context, key string, _ time.Duration) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lockErr != nil {
+		return nil, s.lockErr
+	}
+	s.locks = append(s.locks, key)
+	return func() {}, nil
+}
+
+func testSharedCache(t *testing.T) {
+	store := &memStore{values: map[string][]byte{}}
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "www", Type: "A", Content: "1.2.3.4", TTL: 300}))
+	p.shared = &SharedCache{Store: store, Key: "test", TTL: time.Minute}
+	_, replica := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	replica.client = w
+	replica.shared = p.shared
+
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, endpoints, 1)
+	assert.Contains(t, store.values, "test/records")
+	assert.Equal(t, []string{"test/records.lock"}, store.locks)
+	logins := w.logins
+	endpoints, err = replica.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, "www.example.com", endpoints[0].DNSName)
+	assert.Equal(t, logins, w.logins, "the replica serves the shared records")
+
+	assert.NoError(t, replica.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("api.example.com", "A", 300, "5.6.7.8")}}))
+	assert.Equal(t, "test/apply.lock", store.locks[len(store.locks)-1])
+	assert.NotContains(t, store.values, "test/records", "changes drop the shared records")
+
+	// changes are never applied without the lock, but failed for external-dns to apply them again
+	store.lockErr = fmt.Errorf("%w: test/apply.lock", sharedcache.ErrLockTimeout)
+	_, err = replica.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("blocked.example.com", "A", 300, "5.6.7.8")}})
+	assert.ErrorIs(t, err, sharedcache.ErrLockTimeout)
+	records, _ := w.GetRecords("example.com")
+	assert.Len(t, *records, 2)
+}
+
+func testJournal(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	j := journal.New(filepath.Join(t.TempDir(), "journal.jsonl"))
+	p.client = newJournalingClientWrapper(w, j, false, slog.Default())
+	v1 := endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "1.1.1.1")
+	v2 := endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "2.2.2.2")
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{v1}}))
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{UpdateOld: []*endpoint.Endpoint{v1}, UpdateNew: []*endpoint.Endpoint{v2}}))
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Delete: []*endpoint.Endpoint{v2}}))
+
+	entries, err := journal.Read(j.Path(), 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, journal.Update, entries[1].Action)
+	assert.Equal(t, "1.1.1.1", entries[1].Previous.Content)
+	assert.Equal(t, "2.2.2.2", entries[1].Record.Content)
+	assert.Equal(t, "example.com", entries[2].Zone)
+	assert.Equal(t, "2.2.2.2", entries[2].Previous.Content)
+
+	operations, err := p.ReplayJournal(entries[1:], true, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{journal.Create, journal.Update}, []string{operations[0].Action, operations[1].Action})
+	records, _ := w.GetRecords("example.com")
+	assert.Empty(t, *records, "a dry run changes nothing")
+
+	_, err = p.ReplayJournal(entries[1:], true, false)
+	assert.NoError(t, err)
+	records, _ = w.GetRecords("example.com")
+	assert.Len(t, *records, 1)
+	assert.Equal(t, "1.1.1.1", (*records)[0].Content)
+	entries, _ = journal.Read(j.Path(), 4, 0)
+	assert.Len(t, entries, 2, "replayed changes are journaled")
+
+	// the record updated by entry 5 is gone
+	_, err = p.ReplayJournal(entries[1:], false, false)
+	assert.ErrorContains(t, err, "journal entry 5")
+	_, err = p.ReplayJournal([]journal.Entry{{Seq: 9, Action: journal.Delete}}, false, true)
+	assert.ErrorContains(t, err, "record is unknown")
+}
+
+func testNewProvider(t *testing.T) {
+	_, err := NewProvider(Config{SharedCache: &SharedCache{}, DefaultTTL: -1})
+	assert.ErrorContains(t, err, "missing INWX username or password")
+	assert.ErrorContains(t, err, "invalid DefaultTTL -1")
+	assert.ErrorContains(t, err, "invalid SharedCache")
+
+	p, err := NewProvider(Config{Client: ClientOptions{Username: "user", Password: "secret"}, DomainFilter: []string{"example.com"}, ReadOnly: true})
+	assert.NoError(t, err)
+	assert.IsType(t, &INWXProvider{}, p)
+	assert.True(t, p.GetDomainFilter().Match("www.example.com"))
+	assert.False(t, p.GetDomainFilter().Match("example.org"))
+	assert.IsType(t, &ReadOnlyClientWrapper{}, p.(*INWXProvider).client)
+
+	shared := &SharedCache{Store: &memStore{}, TTL: time.Minute}
+	ip := NewINWXProvider(Config{Client: ClientOptions{Username: "user", MaxLoginFailures: 5}, RecordsCacheFile: "records.json", SharedCache: shared})
+	assert.NotNil(t, ip.cache)
+	assert.Same(t, shared, ip.shared)
+	assert.Equal(t, 5, ip.clientOptions.MaxLoginFailures)
+	assert.NotNil(t, ip.logger)
+
+	// a backend replaces the INWX API and makes the credentials optional
+	mock := NewMockClientWrapper()
+	mock.AddZone("example.com")
+	p, err = NewProvider(Config{Client: ClientOptions{Backend: mock}})
+	assert.NoError(t, err)
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "1.1.1.1")}}))
+	records, _ := mock.GetRecords("example.com")
+	assert.Len(t, *records, 1)
+}
+
+func testMiddleware(t *testing.T) {
+	w, _ := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	calls := []string{}
+	record := func(name string) Middleware {
+		return Intercept(func(method string, call func() error) error {
+			calls = append(calls, name+" "+method)
+			return call()
+		})
+	}
+	client := chainMiddleware(w, []Middleware{record("outer"), RetryMiddleware(3, time.Millisecond), MetricsMiddleware(), record("inner")})
+	records, err := client.GetRecords("example.com")
+	assert.NoError(t, err)
+	assert.NotNil(t, records)
+	assert.Equal(t, []string{"outer GetRecords", "inner GetRecords"}, calls)
+
+	calls = nil
+	_, err = client.GetRecords("example.org")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"outer GetRecords", "inner GetRecords", "inner GetRecords", "inner GetRecords"}, calls, "reads are retried")
+	assert.Equal(t, float64(3), testutil.ToFloat64(clientCallsTotal.WithLabelValues("GetRecords", "error")))
+
+	calls = nil
+	assert.Error(t, client.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.org", Type: "A", Content: "1.2.3.4"}))
+	assert.Equal(t, []string{"outer CreateRecord", "inner CreateRecord"}, calls, "changes are not retried")
+
+	start := time.Now()
+	limited := chainMiddleware(w, []Middleware{RateLimitMiddleware(20 * time.Millisecond)})
+	for range 3 {
+		assert.NoError(t, limited.Ping())
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+}
+
+func testMockServer(t *testing.T) {
+	mock := NewMockClientWrapper()
+	mock.AddZone("example.com")
+	mock.AddZone("example.org")
+	mock.RegisterDomainUntil("example.net", time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC))
+	mock.messages = []AccountMessage{{ID: 7, Type: "domain", Message: "renewed"}}
+	server := httptest.NewServer(NewMockServer(mock, "user", "secret", slog.Default()))
+	defer server.Close()
+	apiURL, _ := url.Parse(server.URL + "/xmlrpc/")
+
+	_, err := newClientWrapper(ClientOptions{Username: "user", Password: "wrong", APIURL: apiURL}, slog.Default()).Login()
+	assert.ErrorContains(t, err, "(2200) Authentication error")
+	_, err = newClientWrapper(ClientOptions{Username: "user", Password: "secret", APIURL: apiURL}, slog.Default()).GetZones()
+	assert.ErrorContains(t, err, "2200", "calls require a session")
+
+	p := NewINWXProvider(Config{Client: ClientOptions{Username: "user", Password: "secret", APIURL: apiURL}, ZoneCreation: &ZoneCreation{}})
+	www := endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "1.1.1.1", "2.2.2.2")
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{www, endpoint.NewEndpointWithTTL("mail.example.org", "MX", 300, "10 mx.example.org")}}))
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	names := []string{}
+	for _, ep := range endpoints {
+		names = append(names, ep.DNSName+" "+ep.Targets[0])
+	}
+	assert.ElementsMatch(t, []string{"www.example.com 1.1.1.1", "www.example.com 2.2.2.2", "mail.example.org 10 mx.example.org"}, names)
+
+	// the IDs of records are unique across zones, so that the right record is changed
+	updated := endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "3.3.3.3")
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{UpdateOld: []*endpoint.Endpoint{www}, UpdateNew: []*endpoint.Endpoint{updated}}))
+	records, _ := mock.GetRecords("example.com")
+	assert.Len(t, *records, 1)
+	assert.Equal(t, "3.3.3.3", (*records)[0].Content)
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Delete: []*endpoint.Endpoint{updated}}))
+	records, _ = mock.GetRecords("example.com")
+	assert.Empty(t, *records)
+	records, _ = mock.GetRecords("example.org")
+	assert.Len(t, *records, 1)
+
+	client := newClientWrapper(ClientOptions{Username: "user", Password: "secret", APIURL: apiURL}, slog.Default())
+	_, err = client.Login()
+	assert.NoError(t, err)
+	domains, err := client.GetDomains()
+	assert.NoError(t, err)
+	assert.Equal(t, "example.net", (*domains)[0].Domain)
+	assert.Equal(t, 2030, (*domains)[0].ExDate.Year())
+	assert.NoError(t, client.EnableDNSSEC("example.org"))
+	statuses, err := client.GetDNSSECStatus([]string{"example.com", "example.org"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"example.org": "AUTO"}, statuses)
+	keys, err := client.GetDNSKeys("example.org")
+	assert.NoError(t, err)
+	assert.Equal(t, 257, keys[0].FlagID)
+	message, err := client.PollMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, "renewed", message.Message)
+	assert.NoError(t, client.AckMessage(7))
+	message, err = client.PollMessage()
+	assert.NoError(t, err)
+	assert.Nil(t, message)
+	assert.NoError(t, client.CreateZone(&inwx.NameserverCreateRequest{Domain: "example.net", Type: "MASTER", Nameservers: []string{"ns.inwx.de"}}))
+	assert.Contains(t, mock.db, "example.net")
+	assert.NoError(t, client.Logout())
+	assert.ErrorContains(t, client.Ping(), "2200", "the session ends with the logout")
+}
+
+func testMockFaults(t *testing.T) {
+	w := NewMockClientWrapper()
+	w.AddZone("example.com")
+	failures := func(faults MockFaults) []bool {
+		client := chainMiddleware(w, []Middleware{FaultMiddleware(faults)})
+		failed := []bool{}
+		for range 20 {
+			_, err := client.GetZones()
+			failed = append(failed, err != nil)
+		}
+		return failed
+	}
+	random := failures(MockFaults{ErrorRate: 0.5, Seed: 42})
+	assert.Equal(t, random, failures(MockFaults{ErrorRate: 0.5, Seed: 42}), "faults are reproducible")
+	assert.Contains(t, random, true)
+	assert.Contains(t, random, false)
+	assert.NotContains(t, failures(MockFaults{ErrorRate: 1}), false)
+
+	client := chainMiddleware(w, []Middleware{FaultMiddleware(MockFaults{RateLimitRate: 1, RateLimitPause: 3 * time.Second})})
+	_, err := client.GetZones()
+	pause, limited := retryAfterError(t, err)
+	assert.True(t, limited)
+	assert.Equal(t, 3*time.Second, pause)
+
+	client = chainMiddleware(w, []Middleware{FaultMiddleware(MockFaults{SessionExpiry: 20 * time.Millisecond})})
+	_, err = client.Login()
+	assert.NoError(t, err)
+	assert.NoError(t, client.Ping())
+	time.Sleep(30 * time.Millisecond)
+	assert.ErrorContains(t, client.Ping(), "session expired")
+
+	server := NewMockServer(w, "", "", slog.Default())
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	apiURL, _ := url.Parse(httpServer.URL + "/xmlrpc/")
+	api := newClientWrapper(ClientOptions{Username: "user", Password: "secret", APIURL: apiURL}, slog.Default())
+	server.SetFaults(MockFaults{SessionExpiry: 20 * time.Millisecond})
+	_, err = api.Login()
+	assert.NoError(t, err)
+	assert.NoError(t, api.Ping())
+	time.Sleep(30 * time.Millisecond)
+	assert.ErrorContains(t, api.Ping(), "(2200) Authentication error")
+
+	server.SetFaults(MockFaults{ErrorRate: 1, Latency: 10 * time.Millisecond})
+	start := time.Now()
+	_, err = api.Login()
+	assert.ErrorContains(t, err, "injected fault of account.login")
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+}
+
+// retryAfterError returns the pause hinted by a rate-limit error as the API would send it.
+func retryAfterError(t *testing.T, err error) (time.Duration, bool) {
+	apiErr := &inwx.ErrorResponse{}
+	if !assert.ErrorAs(t, err, &apiErr) {
+		return 0, false
+	}
+	body := fmt.Sprintf(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>code</name><value><int>%d</int></value></member>
+<member><name>reason</name><value><string>%s</string></value></member>
+</struct></value></param></params></methodResponse>`, apiErr.Code, apiErr.Reason)
+	pause, limited, err := rateLimited(&http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))})
+	assert.NoError(t, err)
+	return pause, limited
+}
+
+func testMockFixture(t *testing.T) {
+	fixture := &MockFixture{
+		Zones: []MockFixtureZone{
+			{Name: "example.com", DNSSEC: true, Records: []TemplateRecord{
+				{Name: "www", Type: "A", Content: "1.1.1.1", TTL: 300},
+				{Name: "www", Type: "A", Content: "2.2.2.2", TTL: 300},
+				{Name: "", Type: "MX", Content: "mx.example.com", Priority: 10},
+			}},
+			{Name: "xn--bcher-kva.example", Records: []TemplateRecord{{Name: "shop", Type: "CNAME", Content: "example.com"}}},
+			{Name: "example.org", Slave: true},
+		},
+		Domains: []MockFixtureDomain{{Name: "example.com", Expires: time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)}},
+	}
+	w := NewMockClientWrapper()
+	assert.NoError(t, w.LoadFixture(fixture))
+
+	zones, _ := w.GetZones()
+	assert.Equal(t, []inwx.NameserverDomain{{Domain: "example.com", Type: "MASTER"}, {Domain: "example.org", Type: "SLAVE"}, {Domain: "xn--bcher-kva.example", Type: "MASTER"}}, *zones)
+	records, _ := w.GetRecords("example.com")
+	assert.Len(t, *records, 3)
+	assert.Equal(t, inwx.NameserverRecord{ID: 2, Name: "", Type: "MX", Content: "mx.example.com", TTL: 3600, Priority: 10}, (*records)[2], "the TTL defaults to 3600")
+	records, _ = w.GetRecords("xn--bcher-kva.example")
+	assert.Equal(t, 3, (*records)[0].ID, "record IDs are unique across zones")
+	statuses, _ := w.GetDNSSECStatus([]string{"example.com", "example.org"})
+	assert.Equal(t, map[string]string{"example.com": "AUTO"}, statuses)
+	domains, _ := w.GetDomains()
+	assert.Equal(t, 2030, (*domains)[0].ExDate.Year())
+
+	err := w.LoadFixture(&MockFixture{Zones: []MockFixtureZone{{Name: "example.com"}, {Name: "example.net"}}, Domains: []MockFixtureDomain{{Name: "example.com"}}})
+	assert.ErrorContains(t, err, "zone example.com already exists")
+	assert.ErrorContains(t, err, "domain example.com already registered")
+	assert.Contains(t, w.db, "example.net", "the other zones are loaded")
+}
+
+func testSortedRecords(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	assert.NoError(t, w.LoadFixture(&MockFixture{Zones: []MockFixtureZone{
+		{Name: "example.org", Records: []TemplateRecord{{Name: "www", Type: "A", Content: "2.2.2.2"}, {Name: "www", Type: "A", Content: "1.1.1.1"}}},
+		{Name: "example.com", Records: []TemplateRecord{{Name: "www", Type: "TXT", Content: "text"}, {Name: "www", Type: "A", Content: "3.3.3.3"}, {Name: "api", Type: "A", Content: "4.4.4.4"}}},
+	}}))
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	listed := []string{}
+	for _, ep := range endpoints {
+		listed = append(listed, ep.DNSName+" "+ep.RecordType+" "+ep.Targets[0])
+	}
+	assert.Equal(t, []string{
+		"api.example.com A 4.4.4.4",
+		"www.example.com A 3.3.3.3",
+		"www.example.com TXT text",
+		"www.example.org A 1.1.1.1",
+		"www.example.org A 2.2.2.2",
+	}, listed)
+}
+
+func testDuplicateRecords(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	assert.NoError(t, w.LoadFixture(&MockFixture{Zones: []MockFixtureZone{{Name: "example.com", Records: []TemplateRecord{
+		{Name: "www", Type: "A", Content: "1.1.1.1", TTL: 300},
+		{Name: "www", Type: "A", Content: "1.1.1.1", TTL: 300},
+		{Name: "www", Type: "A", Content: "1.1.1.1", TTL: 600},
+		{Name: "www", Type: "A", Content: "2.2.2.2", TTL: 300},
+	}}}}))
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Len(t, endpoints, 3, "only records identical in TTL too are duplicates")
+	assert.Equal(t, float64(1), testutil.ToFloat64(duplicateRecords.WithLabelValues("example.com")))
+
+	// updating the endpoint updates a record and deletes its duplicates, as does deleting it
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "2.2.2.2")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "3.3.3.3")},
+	}))
+	assert.NoError(t, w.LoadFixture(&MockFixture{Zones: []MockFixtureZone{{Name: "example.org", Records: []TemplateRecord{
+		{Name: "www", Type: "A", Content: "3.3.3.3", TTL: 300},
+		{Name: "www", Type: "A", Content: "3.3.3.3", TTL: 300},
+	}}}}))
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.org", "A", 300, "3.3.3.3")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.org", "A", 300, "4.4.4.4")},
+	}))
+	records, _ := w.GetRecords("example.org")
+	assert.Equal(t, []string{"4.4.4.4"}, recordContents(*records))
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 300, "1.1.1.1")}}))
+	records, _ = w.GetRecords("example.com")
+	assert.Equal(t, []string{"3.3.3.3"}, recordContents(*records))
+	_, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), testutil.ToFloat64(duplicateRecords.WithLabelValues("example.com")))
+}
+
+func testPriority(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	assert.NoError(t, w.LoadFixture(&MockFixture{Zones: []MockFixtureZone{{Name: "example.com", Records: []TemplateRecord{
+		{Name: "", Type: "MX", Content: "mx1.example.com", Priority: 10, TTL: 300},
+		{Name: "_sip._tcp", Type: "SRV", Content: "5 5060 sip.example.com", Priority: 20, TTL: 300},
+		// created with the priority in the content by earlier versions
+		{Name: "mail", Type: "MX", Content: "30 mx3.example.com", TTL: 300},
+	}}}}))
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	targets := []string{}
+	for _, ep := range endpoints {
+		targets = append(targets, ep.Targets...)
+	}
+	assert.ElementsMatch(t, []string{"10 mx1.example.com", "20 5 5060 sip.example.com", "30 mx3.example.com"}, targets)
+
+	// the records of the targets keep the priority apart from the content, so that they round-trip
+	mx := endpoint.NewEndpointWithTTL("example.com", "MX", 300, "10 mx1.example.com")
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{mx},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("example.com", "MX", 300, "15 mx1.example.com", "25 mx2.example.com")},
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("_ldap._tcp.example.com", "SRV", 300, "0 100 389 ldap.example.com")},
+	}))
+	records, _ := w.GetRecords("example.com")
+	priorities := map[string]int{}
+	for _, rec := range *records {
+		priorities[rec.Content] = rec.Priority
+	}
+	assert.Equal(t, map[string]int{"mx1.example.com": 15, "mx2.example.com": 25, "5 5060 sip.example.com": 20, "30 mx3.example.com": 0, "100 389 ldap.example.com": 0}, priorities)
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Delete: []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("_sip._tcp.example.com", "SRV", 300, "20 5 5060 sip.example.com"),
+		endpoint.NewEndpointWithTTL("mail.example.com", "MX", 300, "30 mx3.example.com"),
+	}}))
+	records, _ = w.GetRecords("example.com")
+	assert.Len(t, *records, 3)
+}
+
+func testNormalizeTargets(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	// as decoded from the requests of external-dns, which keep the trailing dots NewEndpoint removes
+	desired := []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: "CNAME", RecordTTL: 300, Targets: endpoint.Targets{"Target.Example.org."}},
+		{DNSName: "mail.example.com", RecordType: "MX", RecordTTL: 300, Targets: endpoint.Targets{"10 MX.example.com."}},
+		{DNSName: "_sip._tcp.example.com", RecordType: "SRV", RecordTTL: 300, Targets: endpoint.Targets{"10 5 5060 SIP.example.com."}},
+		{DNSName: "txt.example.com", RecordType: "TXT", RecordTTL: 300, Targets: endpoint.Targets{"Keep.Me."}},
+	}
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: desired}))
+	records, _ := w.GetRecords("example.com")
+	assert.ElementsMatch(t, []string{"target.example.org", "mx.example.com", "5 5060 sip.example.com", "Keep.Me."}, recordContents(*records))
+
+	// the adjusted desired endpoints equal the records listed, so that no changes are planned
+	adjusted, err := p.AdjustEndpoints(desired)
+	assert.NoError(t, err)
+	listed, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	changes := (&plan.Plan{Current: listed, Desired: adjusted, ManagedRecords: []string{"CNAME", "MX", "SRV", "TXT"}}).Calculate().Changes
+	assert.False(t, changes.HasChanges(), "unexpected changes %v", changes)
+
+	// changes of targets with a trailing dot find the records stored without
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Delete: []*endpoint.Endpoint{{DNSName: "www.example.com", RecordType: "CNAME", RecordTTL: 300, Targets: endpoint.Targets{"Target.example.org."}}}}))
+	records, _ = w.GetRecords("example.com")
+	assert.Len(t, *records, 3)
+}
+
+func testDefaultTTL(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	ttls := func() map[string]int {
+		records, _ := w.GetRecords("example.com")
+		ttls := map[string]int{}
+		for _, rec := range *records {
+			ttls[rec.Name] = rec.TTL
+		}
+		return ttls
+	}
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpoint("a.example.com", "A", "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("b.example.com", "A", 300, "1.1.1.1"),
+	}}))
+	assert.Equal(t, map[string]int{"a": 3600, "b": 300}, ttls(), "records created without a TTL get the INWX default")
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.example.com", "A", 3600, "1.1.1.1"), endpoint.NewEndpointWithTTL("b.example.com", "A", 300, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.example.com", "A", 600, "2.2.2.2"), endpoint.NewEndpoint("b.example.com", "A", "2.2.2.2")},
+	}))
+	assert.Equal(t, map[string]int{"a": 600, "b": 300}, ttls(), "updates apply new TTLs and keep the TTL otherwise")
+
+	p.defaultTTL = 900
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("c.example.com", "A", "1.1.1.1")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("b.example.com", "A", 300, "2.2.2.2")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("b.example.com", "A", "3.3.3.3")},
+	}))
+	assert.Equal(t, map[string]int{"a": 600, "b": 900, "c": 900}, ttls())
+}
+
+func testApexNames(t *testing.T) {
+	for name, dnsName := range map[string]string{"": "example.com", "@": "example.com", "www": "www.example.com", "example.com": "example.com.example.com", "ns.example.net.": "ns.example.net"} {
+		assert.Equal(t, dnsName, recordDNSName("example.com", name), name)
+	}
+	for dnsName, name := range map[string]string{"example.com": "", "example.com.": "", "Example.COM": "", "www.example.com": "www", "example.com.example.com": "example.com", "www.example.com.example.com.": "www.example.com", "www.myexample.com": "www.myexample.com"} {
+		assert.Equal(t, name, relativeName("example.com", dnsName), dnsName)
+	}
+
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	assert.NoError(t, w.LoadFixture(&MockFixture{Zones: []MockFixtureZone{{Name: "example.com", Records: []TemplateRecord{
+		{Name: "", Type: "A", Content: "1.1.1.1"},
+		{Name: "@", Type: "TXT", Content: "apex"},
+	}}}}))
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpoint("example.com.example.com", "A", "2.2.2.2"),
+		endpoint.NewEndpoint("example.com", "AAAA", "::1"),
+	}}))
+	records, _ := w.GetRecords("example.com")
+	names := []string{}
+	for _, rec := range *records {
+		names = append(names, rec.Type+" "+rec.Name)
+	}
+	assert.ElementsMatch(t, []string{"A ", "TXT @", "A example.com", "AAAA "}, names)
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	listed := []string{}
+	for _, ep := range endpoints {
+		listed = append(listed, ep.DNSName+" "+ep.RecordType)
+	}
+	assert.Equal(t, []string{"example.com A", "example.com AAAA", "example.com TXT", "example.com.example.com A"}, listed)
+}
+
+func testWildcards(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	desired, err := p.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("*.apps.example.com", "A", 300, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL(`\052.example.com`, "CNAME", 300, "apps.example.com"),
+		endpoint.NewEndpointWithTTL("a.*.example.com", "A", 300, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("foo*.example.com", "A", 300, "1.1.1.1"),
+	})
+	assert.NoError(t, err)
+	names := []string{}
+	for _, ep := range desired {
+		names = append(names, ep.DNSName)
+	}
+	assert.Equal(t, []string{"*.apps.example.com", "*.example.com"}, names, "escaped wildcards are unescaped and invalid ones left out")
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: desired}))
+	records, _ := w.GetRecords("example.com")
+	assert.ElementsMatch(t, []string{"*.apps", "*"}, []string{(*records)[0].Name, (*records)[1].Name})
+	listed, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	changes := (&plan.Plan{Current: listed, Desired: desired, ManagedRecords: []string{"A", "CNAME"}}).Calculate().Changes
+	assert.False(t, changes.HasChanges(), "wildcard records round-trip, unexpected changes %v", changes)
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Delete: listed}))
+	records, _ = w.GetRecords("example.com")
+	assert.Empty(t, *records)
+}
+
+func testReverseZones(t *testing.T) {
+	for zone, want := range map[string][]int{"0/26.2.0.192.in-addr.arpa": {0, 63}, "64-26.2.0.192.in-addr.arpa": {64, 127}, "128-191.2.0.192.in-addr.arpa": {128, 191}, "254/31.2.0.192.in-addr.arpa": {254, 255}} {
+		parent, first, last, ok := classlessZone(zone)
+		assert.True(t, ok, zone)
+		assert.Equal(t, "2.0.192.in-addr.arpa", parent, zone)
+		assert.Equal(t, want, []int{first, last}, zone)
+	}
+	for _, zone := range []string{"2.0.192.in-addr.arpa", "0/24.2.0.192.in-addr.arpa", "64-60.2.0.192.in-addr.arpa", "0/26.example.com", "0/26.0.192.in-addr.arpa"} {
+		_, _, _, ok := classlessZone(zone)
+		assert.False(t, ok, zone)
+	}
+
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	for _, zone := range []string{"2.0.192.in-addr.arpa", "0/26.2.0.192.in-addr.arpa", "64-127.2.0.192.in-addr.arpa", "8.b.d.0.1.0.0.2.ip6.arpa"} {
+		w.AddZone(zone)
+	}
+	desired := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("5.2.0.192.in-addr.arpa", "PTR", 300, "a.example.com"),
+		endpoint.NewEndpointWithTTL("70.2.0.192.in-addr.arpa", "PTR", 300, "b.example.com"),
+		endpoint.NewEndpointWithTTL("200.2.0.192.in-addr.arpa", "PTR", 300, "c.example.com"),
+		endpoint.NewEndpointWithTTL("1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa", "PTR", 300, "d.example.com"),
+	}
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: desired}))
+	for zone, name := range map[string]string{"0/26.2.0.192.in-addr.arpa": "5", "64-127.2.0.192.in-addr.arpa": "70", "2.0.192.in-addr.arpa": "200", "8.b.d.0.1.0.0.2.ip6.arpa": "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0"} {
+		records, _ := w.GetRecords(zone)
+		if assert.Len(t, *records, 1, zone) {
+			assert.Equal(t, name, (*records)[0].Name, zone)
+		}
+	}
+
+	// the records of classless zones are listed with the names of their addresses
+	listed, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	changes := (&plan.Plan{Current: listed, Desired: desired, ManagedRecords: []string{"PTR"}}).Calculate().Changes
+	assert.False(t, changes.HasChanges(), "unexpected changes %v", changes)
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Delete: listed}))
+	records, _ := w.GetRecords("0/26.2.0.192.in-addr.arpa")
+	assert.Empty(t, *records)
+}
+
+func testZoneBatches(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "old", Type: "A", Content: "1.1.1.1", TTL: 300}))
+	// the records of the pinned zone missing from the account cannot be fetched
+	p.zones = []string{"example.com", "broken.example"}
+	updated := testutil.ToFloat64(zoneChangesTotal.WithLabelValues("example.com", "update", "success"))
+
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("a.broken.example", "A", 300, "1.1.1.1")},
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.example.com", "A", 300, "2.2.2.2"), endpoint.NewEndpointWithTTL("www.example.net", "A", 300, "2.2.2.2")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("b.broken.example", "A", 300, "1.1.1.1"), endpoint.NewEndpointWithTTL("old.example.com", "A", 300, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("b.broken.example", "A", 300, "3.3.3.3"), endpoint.NewEndpointWithTTL("old.example.com", "A", 300, "3.3.3.3")},
+	})
+	assert.NoError(t, err)
+	outcomes := []string{}
+	for _, result := range results {
+		outcomes = append(outcomes, fmt.Sprintf("%s %s %t", result.Action, result.Endpoint.DNSName, result.Err == nil))
+	}
+	assert.Equal(t, []string{
+		"delete a.broken.example false",
+		"create new.example.com true",
+		"create www.example.net false",
+		"update b.broken.example false",
+		"update old.example.com true",
+	}, outcomes, "the results are in the order of the changes and the failure of a zone does not fail the others")
+	records, _ := w.GetRecords("example.com")
+	assert.ElementsMatch(t, []string{"2.2.2.2", "3.3.3.3"}, recordContents(*records))
+	assert.Equal(t, updated+1, testutil.ToFloat64(zoneChangesTotal.WithLabelValues("example.com", "update", "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(zoneChangesTotal.WithLabelValues("broken.example", "delete", "error")))
+}
+
+func testOrphanedRecords(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	for _, rec := range []inwx.NameserverRecordRequest{
+		{Name: "", Type: "SOA", Content: "ns.inwx.de. hostmaster.inwx.de. 1 10800 3600 604800 3600"},
+		{Name: "", Type: "NS", Content: "ns.inwx.de"},
+		{Name: "www", Type: "A", Content: "192.0.2.1"},
+		{Name: "a-www", Type: "TXT", Content: `"heritage=external-dns,external-dns/owner=other,external-dns/resource=service/default/www"`},
+		{Name: "legacy", Type: "A", Content: "192.0.2.2"},
+		{Name: "legacy", Type: "TXT", Content: "heritage=external-dns,external-dns/owner=default"},
+		{Name: "left", Type: "A", Content: "192.0.2.3"},
+		{Name: "left", Type: "AAAA", Content: "2001:db8::3"},
+		{Name: "sub", Type: "NS", Content: "ns.example.net"},
+		{Name: "note", Type: "TXT", Content: "hello"},
+	} {
+		rec.Domain = "example.com"
+		assert.NoError(t, w.CreateRecord(&rec))
+	}
+
+	orphans, err := p.OrphanedRecords(context.TODO(), NewOwnershipGuard("", "default"))
+	assert.NoError(t, err)
+	names := []string{}
+	for _, ep := range orphans {
+		names = append(names, ep.RecordType+" "+ep.DNSName)
+	}
+	assert.Equal(t, []string{"A left.example.com", "AAAA left.example.com", "TXT note.example.com", "NS sub.example.com"}, names)
+
+	_, err = p.ApplyChangesWithResults(context.TODO(), &plan.Changes{Delete: orphans})
+	assert.NoError(t, err)
+	orphans, err = p.OrphanedRecords(context.TODO(), NewOwnershipGuard("", "default"))
+	assert.NoError(t, err)
+	assert.Empty(t, orphans)
+	records, _ := w.GetRecords("example.com")
+	assert.Len(t, *records, 6)
+}
+
+func testSoftDelete(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	p.deletionGracePeriod = time.Hour
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600}))
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "gone", Type: "A", Content: "192.0.2.2", TTL: 3600}))
+	www := endpoint.NewEndpointWithTTL("www.example.com", "A", 3600, "192.0.2.1")
+	gone := endpoint.NewEndpointWithTTL("gone.example.com", "A", 3600, "192.0.2.2")
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Delete: []*endpoint.Endpoint{www, gone}}))
+	records, _ := w.GetRecords("example.com")
+	assert.Len(t, *records, 4, "the records are kept along with their markers")
+	for _, rec := range *records {
+		if rec.Type == "A" {
+			assert.Equal(t, softDeleteTTL, rec.TTL)
+		}
+	}
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Empty(t, endpoints, "soft-deleted records are hidden")
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1")}}))
+	records, _ = w.GetRecords("example.com")
+	assert.Len(t, *records, 3, "the record created again is restored instead of created")
+	endpoints, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{www}, endpoints, "the restored record has its TTL")
+
+	visible := p.softDeletedRecords("example.com", *records, time.Now().Add(2*time.Hour))
+	assert.Equal(t, []string{"192.0.2.1"}, recordContents(visible))
+	records, _ = w.GetRecords("example.com")
+	assert.Equal(t, []string{"192.0.2.1"}, recordContents(*records), "records are deleted after the grace period")
+}
+
+func testPreviewChanges(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600}))
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "old", Type: "A", Content: "192.0.2.2", TTL: 3600}))
+	before, _ := w.GetRecords("example.com")
+	before = &[]inwx.NameserverRecord{(*before)[0], (*before)[1]}
+
+	results, operations, err := p.PreviewChanges(context.TODO(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("new.example.com", "A", "192.0.2.3")},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", "A", 3600, "192.0.2.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "192.0.2.4")},
+		Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.example.com", "A", 3600, "192.0.2.2"), endpoint.NewEndpoint("missing.example.com", "A", "192.0.2.5")},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+	assert.Error(t, results[1].Err, "changes that would fail fail in the preview")
+
+	assert.Equal(t, []PreviewOperation{
+		{Zone: "example.com", Action: "delete", ID: (*before)[1].ID, Before: &(*before)[1]},
+		{Zone: "example.com", Action: "create", After: &inwx.NameserverRecord{ID: -1, Name: "new", Type: "A", Content: "192.0.2.3"}},
+		{Zone: "example.com", Action: "update", ID: (*before)[0].ID, Before: &(*before)[0], After: &inwx.NameserverRecord{ID: (*before)[0].ID, Name: "www", Type: "A", Content: "192.0.2.4", TTL: 3600}},
+	}, operations)
+	records, _ := w.GetRecords("example.com")
+	assert.Equal(t, []string{"192.0.2.1", "192.0.2.2"}, recordContents(*records), "nothing is applied")
+}
+
+func testErrorClass(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	p.ownership = NewOwnershipGuard("", "default")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "www", Type: "A", Content: "192.0.2.1"}))
+
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.org", "A", "192.0.2.1"), endpoint.NewEndpoint("new.example.com", "A", "192.0.2.1")},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1")},
+	})
+	assert.NoError(t, err)
+	classes := []string{}
+	for _, result := range results {
+		classes = append(classes, ErrorClass(result.Err))
+	}
+	assert.Equal(t, []string{"not_owned", "no_zone", ""}, classes)
+
+	p.ownership = nil
+	assert.Equal(t, "record_not_found", ErrorClass(p.applyDelete("example.com", endpoint.NewEndpoint("missing.example.com", "A", "192.0.2.1"), func() (*zoneRecords, error) {
+		return newZoneRecords("example.com", &[]inwx.NameserverRecord{}), nil
+	}, p.logger)))
+	assert.Equal(t, "maintenance", ErrorClass(fmt.Errorf("account a: %w", &MaintenanceError{Until: time.Now()})))
+	assert.Equal(t, "rate_limited", ErrorClass(&inwx.ErrorResponse{Code: rateLimitCode}))
+	assert.Equal(t, "api", ErrorClass(&inwx.ErrorResponse{Code: 2303}))
+	assert.Equal(t, "unknown", ErrorClass(errors.New("connection reset")))
+}
+
+func testNegotiateWebhookVersion(t *testing.T) {
+	handler := NegotiateWebhookVersion(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), slog.Default())
+	for _, tc := range []struct {
+		header, value string
+		status        int
+	}{
+		{"Accept", "", http.StatusOK},
+		{"Accept", "*/*", http.StatusOK},
+		{"Accept", "application/external.dns.webhook+json;version=1", http.StatusOK},
+		{"Accept", "application/external.dns.webhook+json", http.StatusOK},
+		{"Accept", "application/external.dns.webhook+json;version=2, application/external.dns.webhook+json;version=1;q=0.5", http.StatusOK},
+		{"Accept", "application/external.dns.webhook+json;version=2", http.StatusNotAcceptable},
+		{"Content-Type", "application/external.dns.webhook+json;version=2", http.StatusUnsupportedMediaType},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.value != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tc.status, rec.Code, tc.value)
+		assert.Equal(t, "1", rec.Header().Get("X-Webhook-Versions"))
+	}
+	assert.Equal(t, float64(2), testutil.ToFloat64(webhookUnsupportedVersionRequests.WithLabelValues("2")))
+}
+
+func testSubdomainsOnly(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	p.subdomainsOnly = true
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "", Type: "A", Content: "192.0.2.1"}))
+	_, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+
+	adjusted, err := p.AdjustEndpoints([]*endpoint.Endpoint{endpoint.NewEndpoint("example.com", "A", "192.0.2.2"), endpoint.NewEndpoint("www.example.com", "A", "192.0.2.2")})
+	assert.NoError(t, err)
+	assert.Len(t, adjusted, 1)
+	assert.Equal(t, "www.example.com", adjusted[0].DNSName)
+
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "192.0.2.2")},
+		Delete: []*endpoint.Endpoint{endpoint.NewEndpoint("example.com", "A", "192.0.2.1")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "apex", ErrorClass(results[0].Err))
+	assert.NoError(t, results[1].Err)
+	records, _ := w.GetRecords("example.com")
+	assert.ElementsMatch(t, []string{"192.0.2.1", "192.0.2.2"}, recordContents(*records))
+
+	zoneRecords := newZoneRecords("example.com", records)
+	zoneRecords.protectApex = true
+	_, err = getRecIDs(zoneRecords, *endpoint.NewEndpoint("example.com", "A", "192.0.2.1"))
+	assert.ErrorIs(t, err, errApex)
+}
+
+func testUpdateAddresses(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "home", Type: "A", Content: "192.0.2.1", TTL: 600}))
+
+	changed, err := UpdateAddresses(context.TODO(), p, "Home.example.com.", []netip.Addr{netip.MustParseAddr("192.0.2.2"), netip.MustParseAddr("2001:db8::1")})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	records, _ := w.GetRecords("example.com")
+	assert.ElementsMatch(t, []string{"192.0.2.2", "2001:db8::1"}, recordContents(*records))
+	for _, rec := range *records {
+		if rec.Type == "A" {
+			assert.Equal(t, 600, rec.TTL)
+		}
+	}
+
+	changed, err = UpdateAddresses(context.TODO(), p, "home.example.com", []netip.Addr{netip.MustParseAddr("::ffff:192.0.2.2")})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = UpdateAddresses(context.TODO(), p, "home.example.com", []netip.Addr{netip.MustParseAddr("192.0.2.3")})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	records, _ = w.GetRecords("example.com")
+	assert.ElementsMatch(t, []string{"192.0.2.3", "2001:db8::1"}, recordContents(*records))
+
+	_, err = UpdateAddresses(context.TODO(), p, "home.example.org", []netip.Addr{netip.MustParseAddr("192.0.2.3")})
+	assert.Equal(t, "no_zone", ErrorClass(err))
+}
+
+func testReconcile(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.com", Name: "www", Type: "A", Content: "192.0.2.1", TTL: 300}))
+	p.cache = newRecordsCache(filepath.Join(t.TempDir(), "records.json"))
+	before := testutil.ToFloat64(reconciliationsTotal.WithLabelValues("success"))
+
+	assert.NoError(t, p.reconcile(context.TODO()))
+	assert.Equal(t, before+1, testutil.ToFloat64(reconciliationsTotal.WithLabelValues("success")))
+	assert.NotZero(t, testutil.ToFloat64(lastReconciliation))
+	cached, err := p.cache.read()
+	assert.NoError(t, err)
+	assert.Len(t, cached.Endpoints, 1)
+
+	before = testutil.ToFloat64(reconciliationsTotal.WithLabelValues("error"))
+	w.loginErr = errors.New("connection refused")
+	assert.Error(t, p.reconcile(context.TODO()))
+	assert.Equal(t, before+1, testutil.ToFloat64(reconciliationsTotal.WithLabelValues("error")))
+}
+
+func testInstrumentWebhook(t *testing.T) {
+	handler := InstrumentWebhook(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/tenants/team-a/records", nil))
+	assert.Equal(t, 1, testutil.CollectAndCount(webhookRequestDuration, "external_dns_inwx_webhook_request_duration_seconds"))
+
+	for path, endpoint := range map[string]string{"/": "negotiate", "/tenants/team-a": "negotiate", "/adjustendpoints": "adjustendpoints", "/tenants/team-a/records/": "records", "/healthz": "other"} {
+		assert.Equal(t, endpoint, webhookEndpoint(path), path)
+	}
+}
+
+func testZoneRecordLimit(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	p.zoneRecordLimit = 4
+	w.AddZone("limit.example")
+	for _, content := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "limit.example", Name: "www", Type: "A", Content: content}))
+	}
+	_, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), testutil.ToFloat64(zoneRecordCount.WithLabelValues("limit.example")))
+	assert.Equal(t, float64(4), testutil.ToFloat64(zoneRecordLimit.WithLabelValues("limit.example")))
+
+	delete(w.db, "limit.example")
+	_, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.False(t, zoneRecordCount.DeleteLabelValues("limit.example"))
+}
+
+func testValidateContent(t *testing.T) {
+	long := strings.Repeat("a", 256)
+	for _, test := range []struct {
+		recordType string
+		target     string
+		valid      bool
+	}{
+		{"A", "192.0.2.1", true},
+		{"A", "2001:db8::1", false},
+		{"A", "192.0.2", false},
+		{"AAAA", "2001:db8::1", true},
+		{"AAAA", "192.0.2.1", false},
+		{"CNAME", "www.example.com.", true},
+		{"CNAME", "_acme-challenge.example.com", true},
+		{"CNAME", "www..example.com", false},
+		{"CNAME", "http://example.com", false},
+		{"MX", "10 mail.example.com", true},
+		{"MX", "0 .", true},
+		{"MX", "mail.example.com", false},
+		{"MX", "70000 mail.example.com", false},
+		{"TXT", `"v=spf1 -all"`, true},
+		{"TXT", `"` + long[1:] + `" "` + long[1:] + `"`, true},
+		{"TXT", `"` + long + `"`, false},
+		{"TXT", long, false},
+		{"SRV", "anything", true},
+	} {
+		err := validateContent(endpoint.NewEndpoint("www.example.com", test.recordType, test.target))
+		if test.valid {
+			assert.NoError(t, err, test.target)
+		} else {
+			assert.ErrorIs(t, err, errInvalidContent, test.target)
+		}
+	}
+
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	adjusted, err := p.AdjustEndpoints([]*endpoint.Endpoint{endpoint.NewEndpoint("a.example.com", "A", "192.0.2.256"), endpoint.NewEndpoint("b.example.com", "A", "192.0.2.1")})
+	assert.NoError(t, err)
+	assert.Len(t, adjusted, 1)
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("a.example.com", "A", "192.0.2.256")}})
+	assert.NoError(t, err)
+	assert.Equal(t, "invalid_content", ErrorClass(results[0].Err))
+	records, _ := w.GetRecords("example.com")
+	assert.Empty(t, *records)
+}
+
+func testRegistryLabels(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	p.registryLabels = NewOwnershipGuard("", "default")
+	w.AddZone("example.com")
+	for _, rec := range []inwx.NameserverRecordRequest{
+		{Domain: "example.com", Name: "www", Type: "A", Content: "192.0.2.1"},
+		{Domain: "example.com", Name: "a-www", Type: "TXT", Content: `"heritage=external-dns,external-dns/owner=default,external-dns/resource=ingress/default/web"`},
+		{Domain: "example.com", Name: "legacy", Type: "CNAME", Content: "www.example.com"},
+		{Domain: "example.com", Name: "legacy", Type: "TXT", Content: `"heritage=external-dns,external-dns/owner=other"`},
+		{Domain: "example.com", Name: "manual", Type: "A", Content: "192.0.2.2"},
+	} {
+		assert.NoError(t, w.CreateRecord(&rec))
+	}
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	labels := map[string]endpoint.Labels{}
+	for _, ep := range endpoints {
+		labels[ep.DNSName+" "+ep.RecordType] = ep.Labels
+	}
+	assert.Equal(t, endpoint.Labels{"owner": "default", "resource": "ingress/default/web"}, labels["www.example.com A"])
+	assert.Equal(t, endpoint.Labels{"owner": "other"}, labels["legacy.example.com CNAME"])
+	assert.Empty(t, labels["manual.example.com A"])
+	assert.Empty(t, labels["legacy.example.com TXT"])
+}
+
+func testPausedZones(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	w.AddZone("example.org")
+	w.AddZone("example.net")
+	p.SetPausedZones([]string{"Example.org."})
+	assert.NoError(t, w.CreateRecord(&inwx.NameserverRecordRequest{Domain: "example.net", Name: pauseLabel, Type: "TXT", Content: `"change freeze"`}))
+
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1"),
+		endpoint.NewEndpoint("www.example.org", "A", "192.0.2.1"),
+		endpoint.NewEndpoint("www.example.net", "A", "192.0.2.1"),
+	}})
+	assert.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "paused", ErrorClass(results[1].Err))
+	assert.Equal(t, "paused", ErrorClass(results[2].Err))
+	assert.Contains(t, results[2].Err.Error(), "change freeze")
+	for zone, count := range map[string]int{"example.com": 1, "example.org": 0, "example.net": 1} {
+		records, _ := w.GetRecords(zone)
+		assert.Len(t, *records, count, zone)
+	}
+}
+
+func testLogEndpoints(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	w, p := NewINWXProviderWithMockClient(&[]string{}, logger)
+	assert.NoError(t, w.LoadFixture(&MockFixture{Zones: []MockFixtureZone{{Name: "example.com", Records: []TemplateRecord{
+		{Name: "www", Type: "A", Content: "192.0.2.1", TTL: 300},
+		{Name: "www", Type: "A", Content: "192.0.2.1", TTL: 300},
+		{Name: "api", Type: "A", Content: "192.0.2.2", TTL: 300},
+	}}}}))
+
+	_, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), `msg="listed records" zones=1 records=2 stale=false`)
+	assert.Contains(t, logs.String(), `msg="ignoring duplicate records" zone=example.com duplicates=1`)
+	assert.NotContains(t, logs.String(), "msg=\"endpoints collected\"")
+
+	logs.Reset()
+	p.logEndpoints = true
+	_, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(logs.String(), "msg=\"endpoints collected\""))
+	assert.Contains(t, logs.String(), `msg="ignoring duplicate record" zone=example.com name=www.example.com`)
+}
+
+func testSyncSummary(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+	w, p := NewINWXProviderWithMockClient(&[]string{}, logger)
+	w.AddZone("example.com")
+	w.AddZone("example.org")
+
+	_, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1"),
+			endpoint.NewEndpoint("www.example.org", "A", "192.0.2.1"),
+			endpoint.NewEndpoint("www.example.net", "A", "192.0.2.1"),
+		},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), `msg="applied changes" zones=2 creates=3 updates=0 deletes=0 failed=1`)
+
+	_, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), `msg="listed records" zones=2 records=2 stale=false`)
+
+	logs.Reset()
+	w.loginErr = errors.New("login failed")
+	_, err = p.Records(context.TODO())
+	assert.Error(t, err)
+	assert.Contains(t, logs.String(), `msg="failed to list records"`)
+}
+
+func testRedactContent(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger := slog.New(NewRedactingHandler(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	w, p := NewINWXProviderWithMockClient(&[]string{}, logger)
+	w.AddZone("example.com")
+	p.readOnly = true
+	p.client = &ReadOnlyClientWrapper{AbstractClientWrapper: w, logger: logger}
+	p.logEndpoints = true
+	challenge := endpoint.NewEndpoint("_acme-challenge.example.com", "TXT", "acme-token")
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{challenge}}))
+	logger.With("target", "acme-token").Info("grouped", slog.Group("records", "ep", challenge))
+	assert.NotContains(t, logs.String(), "acme-token")
+	assert.Contains(t, logs.String(), "name=_acme-challenge type=TXT content="+RedactContent("acme-token"))
+	assert.Contains(t, logs.String(), "records.ep=\"_acme-challenge.example.com 0 IN TXT  "+RedactContent("acme-token")+" []\"")
+
+	body := `<member><name>content</name><value><string>acme-token</string></value></member><member><name>type</name><value><string>TXT</string></value></member>`
+	transport := &instrumentedTransport{redactContent: true}
+	assert.Equal(t, `<member><name>content</name><value><string>`+RedactContent("acme-token")+`</string></value></member><member><name>type</name><value><string>TXT</string></value></member>`, transport.payload([]byte(body)))
+
+	j := journal.New(filepath.Join(t.TempDir(), "journal.jsonl"))
+	p.client = newJournalingClientWrapper(w, j, true, slog.Default())
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{challenge}}))
+	entries, err := journal.Read(j.Path(), 0, 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.True(t, entries[0].Redacted)
+	assert.Equal(t, RedactContent("acme-token"), entries[0].Record.Content)
+	_, err = p.ReplayJournal(entries, true, true)
+	assert.ErrorContains(t, err, "record content is redacted")
+}
+
+func testMaxErrorRatio(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	w.AddZone("example.org")
+	creates := 0
+	p.client = chainMiddleware(w, []Middleware{Intercept(func(method string, call func() error) error {
+		if method == "CreateRecord" {
+			creates++
+			return &inwx.ErrorResponse{Code: codeFailed, Message: "Command failed"}
+		}
+		return call()
+	})})
+	changes := &plan.Changes{}
+	for i := range 15 {
+		changes.Create = append(changes.Create, endpoint.NewEndpoint(fmt.Sprintf("host%d.example.%s", i, []string{"com", "org"}[i%2]), "A", "192.0.2.1"))
+	}
+
+	_, err := p.ApplyChangesWithResults(context.TODO(), changes)
+	assert.NoError(t, err)
+	assert.Equal(t, 15, creates, "changes are never aborted by default")
+
+	creates = 0
+	p.maxErrorRatio = 0.5
+	results, err := p.ApplyChangesWithResults(context.TODO(), changes)
+	assert.NoError(t, err)
+	assert.Equal(t, errorBudgetMinChanges, creates, "the remaining changes are aborted once the ratio is exceeded")
+	classes := map[string]int{}
+	for _, result := range results {
+		classes[ErrorClass(result.Err)]++
+	}
+	assert.Equal(t, map[string]int{"api": 10, "aborted": 5}, classes)
+	assert.ErrorContains(t, results[13].Err, "10 of 10 changes failed")
+
+	budget := &applyBudget{maxRatio: 0.5}
+	for range 20 {
+		budget.record(fmt.Errorf("refused, %w", errNotOwned))
+	}
+	assert.False(t, budget.exhausted(), "changes refused by the provider do not count")
+}
+
+func testRetryQueue(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	failing := true
+	p.client = chainMiddleware(w, []Middleware{Intercept(func(method string, call func() error) error {
+		if method == "CreateRecord" && failing {
+			return &inwx.ErrorResponse{Code: codeFailed, Message: "Command failed"}
+		}
+		return call()
+	})})
+	p.retries = newRetryQueue(1, time.Minute)
+	depth := testutil.ToFloat64(retryQueueDepth)
+	www := endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1")
+	api := endpoint.NewEndpoint("api.example.com", "A", "192.0.2.2")
+
+	assert.Error(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{www, api}}))
+	assert.Len(t, p.retries.entries, 1, "the queue is bounded")
+	assert.Equal(t, depth+1, testutil.ToFloat64(retryQueueDepth))
+
+	p.retryFailedChanges(context.TODO())
+	assert.Equal(t, 0, p.retries.entries[0].attempts, "changes are retried after the backoff")
+	p.retries.entries[0].next = time.Time{}
+	p.retryFailedChanges(context.TODO())
+	assert.Equal(t, 1, p.retries.entries[0].attempts)
+	assert.True(t, p.retries.entries[0].next.After(time.Now().Add(time.Minute)), "the backoff doubles")
+
+	failing = false
+	p.retries.entries[0].next = time.Time{}
+	p.retryFailedChanges(context.TODO())
+	assert.Empty(t, p.retries.entries)
+	assert.Equal(t, depth, testutil.ToFloat64(retryQueueDepth))
+	records, _ := w.GetRecords("example.com")
+	assert.Equal(t, []string{"192.0.2.1"}, recordContents(*records))
+
+	// a sync changing the endpoint again supersedes the queued change
+	failing = true
+	assert.Error(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{api}}))
+	assert.Len(t, p.retries.entries, 1)
+	failing = false
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{api}}))
+	assert.Empty(t, p.retries.entries)
+	assert.Equal(t, depth, testutil.ToFloat64(retryQueueDepth))
+}
+
+func testConcurrentCreates(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	mu := sync.Mutex{}
+	inFlight, maxInFlight := 0, 0
+	p.client = chainMiddleware(w, []Middleware{Intercept(func(method string, call func() error) error {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		inFlight--
+		return call()
+	})})
+	p.createConcurrency = 4
+	changes := &plan.Changes{}
+	for i := range 8 {
+		changes.Create = append(changes.Create, endpoint.NewEndpoint(fmt.Sprintf("host%d.example.com", i), "A", "192.0.2.1"))
+	}
+
+	results, err := p.ApplyChangesWithResults(context.TODO(), changes)
+	assert.NoError(t, err)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+	}
+	records, _ := w.GetRecords("example.com")
+	assert.Len(t, *records, 8)
+	assert.Equal(t, 4, maxInFlight, "the creates of a zone are bounded by the concurrency")
+
+	// the clients creating records reuse the session of the main client
+	sessions := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			sessions = append(sessions, cookie.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "session-id"})
+	}))
+	defer server.Close()
+	transport := &sessionCookieTransport{next: http.DefaultTransport}
+	for range 2 {
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	assert.Equal(t, []string{"session-id"}, sessions)
+}
+
+func testDedupChangeSets(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	p.dedup = newChangeSetDedup(time.Minute)
+	deduplicated := testutil.ToFloat64(dedupedChangeSetsTotal)
+	create := func(target string) *plan.Changes {
+		return &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", target)}}
+	}
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), create("192.0.2.1")))
+	results, err := p.ApplyChangesWithResults(context.TODO(), create("192.0.2.1"))
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, deduplicated+1, testutil.ToFloat64(dedupedChangeSetsTotal))
+	records, _ := w.GetRecords("example.com")
+	assert.Len(t, *records, 1, "the change set sent again is not applied twice")
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), create("192.0.2.2")))
+	records, _ = w.GetRecords("example.com")
+	assert.Len(t, *records, 2, "other change sets are applied")
+
+	p.dedup.applied = time.Now().Add(-2 * time.Minute)
+	assert.NoError(t, p.ApplyChanges(context.TODO(), create("192.0.2.2")))
+	records, _ = w.GetRecords("example.com")
+	assert.Len(t, *records, 3, "the change set is applied again after the window")
+
+	// a change set with failures is never skipped
+	assert.Error(t, p.ApplyChanges(context.TODO(), create("192.0.2.256")))
+	assert.Error(t, p.ApplyChanges(context.TODO(), create("192.0.2.256")))
+	assert.Equal(t, deduplicated+1, testutil.ToFloat64(dedupedChangeSetsTotal))
+}
+
+func testApplyBudget(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	changes := &plan.Changes{}
+	for i := range 5 {
+		changes.Create = append(changes.Create, endpoint.NewEndpoint(fmt.Sprintf("host%d.example.com", i), "A", "192.0.2.1"))
+	}
+	classes := func(results []ChangeResult) []string {
+		classes := []string{}
+		for _, result := range results {
+			classes = append(classes, ErrorClass(result.Err))
+		}
+		return classes
+	}
+
+	// listing the zones and the records of the zone and two creates use up the calls
+	p.maxApplyCalls = 4
+	results, err := p.ApplyChangesWithResults(context.TODO(), changes)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "", "aborted", "aborted", "aborted"}, classes(results))
+	assert.ErrorContains(t, results[4].Err, "maximum of 4 API calls")
+	assert.Same(t, w, p.client.(*MockClientWrapper), "the calls are only counted during the apply")
+	records, _ := w.GetRecords("example.com")
+	assert.Len(t, *records, 2)
+
+	p.maxApplyCalls = 0
+	p.maxApplyDuration = time.Nanosecond
+	results, err = p.ApplyChangesWithResults(context.TODO(), changes)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"aborted", "aborted", "aborted", "aborted", "aborted"}, classes(results))
+	assert.ErrorContains(t, results[0].Err, "maximum duration")
+}
+
+func testCacheMetrics(t *testing.T) {
+	_, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	lookups := func(cache string, result string) float64 {
+		return testutil.ToFloat64(cacheLookupsTotal.WithLabelValues(cache, result))
+	}
+
+	hits, misses := lookups(cacheZoneIndex, "hit"), lookups(cacheZoneIndex, "miss")
+	p.zoneIndexOf([]string{"example.com", "example.org"})
+	p.zoneIndexOf([]string{"example.com", "example.org"})
+	assert.Equal(t, hits+1, lookups(cacheZoneIndex, "hit"))
+	assert.Equal(t, misses+1, lookups(cacheZoneIndex, "miss"))
+	assert.Equal(t, 2.0, testutil.ToFloat64(cacheEntries.WithLabelValues(cacheZoneIndex)))
+
+	before := float64(time.Now().Unix())
+	cache := newRecordsCache(filepath.Join(t.TempDir(), "records.json"))
+	misses = lookups(cacheRecordsFile, "miss")
+	_, ok := cache.staleRecords(func() error { return nil }, slog.Default())
+	assert.False(t, ok)
+	assert.Equal(t, misses+1, lookups(cacheRecordsFile, "miss"), "a missing file is a miss")
+	assert.NoError(t, cache.save([]*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1")}))
+	assert.Equal(t, 1.0, testutil.ToFloat64(cacheEntries.WithLabelValues(cacheRecordsFile)))
+	assert.GreaterOrEqual(t, testutil.ToFloat64(cacheUpdated.WithLabelValues(cacheRecordsFile)), before)
+}
+
+func testLogConnections(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(xmlrpcResponse))
+	}))
+	defer server.Close()
+	apiURL, _ := url.Parse(server.URL)
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	w := newClientWrapper(ClientOptions{APIURL: apiURL, TLSConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, LogConnections: true}, logger)
+	_, err := w.Login()
+	assert.NoError(t, err)
+	_, err = w.Login()
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), `msg="INWX API TLS handshake" method=account.login`)
+	assert.Contains(t, logs.String(), "reused=false")
+	assert.Contains(t, logs.String(), "reused=true", "the second login reuses the connection")
+
+	logs.Reset()
+	BridgeClientLog(logger)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	}()
+	log.Print("http: unsolicited response")
+	assert.Contains(t, logs.String(), `level=WARN msg="http: unsolicited response"`+"\n")
+}
+
+func testTestingRecords(t *testing.T) {
+	mock := NewMockClientWrapper()
+	mock.AddZone("example.com")
+	server := httptest.NewServer(NewMockServer(mock, "user", "secret", slog.Default()))
+	defer server.Close()
+	apiURL, _ := url.Parse(server.URL + "/xmlrpc/")
+	served := NewINWXProvider(Config{Client: ClientOptions{Username: "user", Password: "secret", APIURL: apiURL}})
+
+	staged := endpoint.NewEndpoint("staged.example.com", "A", "192.0.2.1").WithProviderSpecific(testingProperty, "true")
+	missing := endpoint.NewEndpoint("www.example.org", "A", "192.0.2.1").WithProviderSpecific(testingProperty, "true")
+	results, err := served.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{staged, endpoint.NewEndpoint("www.example.com", "A", "192.0.2.2"), missing}})
+	assert.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, "no_zone", ErrorClass(results[2].Err))
+	records, _ := mock.GetRecords("example.com")
+	assert.Equal(t, []string{"192.0.2.2"}, recordContents(*records), "the staged record is only validated")
+
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	p.client = chainMiddleware(p.client, []Middleware{Intercept(func(method string, call func() error) error {
+		if method == "TestRecord" {
+			return &inwx.ErrorResponse{Code: codeParameter, Message: "Parameter value policy error"}
+		}
+		return call()
+	})})
+	results, err = p.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{staged}})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, results[0].Err, "Parameter value policy error", "the validation fails like the creation would")
+}
+
+func testCloneZone(t *testing.T) {
+	mock := NewMockClientWrapper()
+	mock.AddZone("old.example")
+	for _, rec := range []inwx.NameserverRecordRequest{
+		{Name: "app", Type: "A", Content: "192.0.2.1"},
+		{Name: "www", Type: "CNAME", Content: "app.old.example"},
+		{Name: "", Type: "MX", Content: "mail.old.example", Priority: 10},
+		{Name: "_sip._tcp", Type: "SRV", Content: "5 5060 sip.old.example."},
+		{Name: "ext", Type: "CNAME", Content: "cdn.notold.example"},
+		{Name: "", Type: "TXT", Content: "v=spf1 include:old.example"},
+	} {
+		rec.Domain = "old.example"
+		assert.NoError(t, mock.CreateRecord(&rec))
+	}
+	server := httptest.NewServer(NewMockServer(mock, "user", "secret", slog.Default()))
+	defer server.Close()
+	apiURL, _ := url.Parse(server.URL + "/xmlrpc/")
+	p := NewINWXProvider(Config{Client: ClientOptions{Username: "user", Password: "secret", APIURL: apiURL}})
+
+	rewrites, err := p.CloneZone("old.example", "new.example", true)
+	assert.NoError(t, err)
+	assert.Len(t, rewrites, 3)
+	records, _ := mock.GetRecords("new.example")
+	assert.Equal(t, []string{"192.0.2.1", "app.new.example", "mail.new.example", "5 5060 sip.new.example.", "cdn.notold.example", "v=spf1 include:old.example"}, recordContents(*records))
+	source, _ := mock.GetRecords("old.example")
+	assert.Equal(t, "app.old.example", (*source)[1].Content, "the source zone is unchanged")
+
+	_, err = p.CloneZone("old.example", "new.example", false)
+	assert.ErrorContains(t, err, "Object exists")
+	_, err = p.CloneZone("missing.example", "other.example", false)
+	assert.ErrorContains(t, err, "Object does not exist")
+	_, err = p.CloneZone("old.example", "OLD.example.", false)
+	assert.ErrorContains(t, err, "to itself")
+}
+
+func testImportZone(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	for _, rec := range []inwx.NameserverRecordRequest{
+		{Name: "", Type: "NS", Content: "ns.inwx.de", TTL: 86400},
+		{Name: "www", Type: "A", Content: "192.0.2.1", TTL: 300},
+		{Name: "www", Type: "A", Content: "192.0.2.2", TTL: 300},
+		{Name: "mail", Type: "A", Content: "192.0.2.3", TTL: 300},
+	} {
+		rec.Domain = "example.com"
+		assert.NoError(t, w.CreateRecord(&rec))
+	}
+	records := []snapshot.Record{
+		{Name: "", Type: "SOA", Content: "ns.example.org hostmaster.example.org 1 2 3 4 5", TTL: 3600},
+		{Name: "", Type: "NS", Content: "ns.example.org", TTL: 3600},
+		{Name: "www", Type: "A", Content: "192.0.2.1", TTL: 60},
+		{Name: "api", Type: "CNAME", Content: "www.example.com", TTL: 300},
+	}
+	actions := func(operations []RestoreOperation) []string {
+		actions := []string{}
+		for _, op := range operations {
+			actions = append(actions, op.Action+" "+op.Record.Name+" "+op.Record.Content)
+		}
+		return actions
+	}
+
+	operations, err := p.ImportZone("example.com", records, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"update www 192.0.2.1", "create api www.example.com", "delete www 192.0.2.2"}, actions(operations))
+	current, _ := w.GetRecords("example.com")
+	assert.Len(t, *current, 4, "a dry run changes nothing")
+
+	_, err = p.ImportZone("example.com", records, false)
+	assert.NoError(t, err)
+	current, _ = w.GetRecords("example.com")
+	assert.Equal(t, []string{"ns.inwx.de", "192.0.2.1", "192.0.2.3", "www.example.com"}, recordContents(*current), "the apex NS and the other names are left alone")
+	operations, err = p.ImportZone("example.com", records, false)
+	assert.NoError(t, err)
+	assert.Empty(t, operations)
+}
+
+func testAdoptionRecords(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	for _, rec := range []inwx.NameserverRecordRequest{
+		{Name: "www", Type: "A", Content: "192.0.2.1", TTL: 300},
+		{Name: "www", Type: "A", Content: "192.0.2.2", TTL: 300},
+		{Name: "www", Type: "AAAA", Content: "2001:db8::1", TTL: 300},
+		{Name: "owned", Type: "A", Content: "192.0.2.3"},
+		{Name: "a-owned", Type: "TXT", Content: `"heritage=external-dns,external-dns/owner=other"`},
+	} {
+		rec.Domain = "example.com"
+		assert.NoError(t, w.CreateRecord(&rec))
+	}
+	registry := NewOwnershipGuard("", "cluster")
+
+	orphans, err := p.OrphanedRecords(context.TODO(), registry)
+	assert.NoError(t, err)
+	adoptions := registry.AdoptionRecords(orphans)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("a-www.example.com", "TXT", 300, `"heritage=external-dns,external-dns/owner=cluster"`),
+		endpoint.NewEndpointWithTTL("aaaa-www.example.com", "TXT", 300, `"heritage=external-dns,external-dns/owner=cluster"`),
+	}, adoptions, "one record for every name and type, the records of other owners left alone")
+	_, err = p.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: adoptions})
+	assert.NoError(t, err)
+	orphans, err = p.OrphanedRecords(context.TODO(), registry)
+	assert.NoError(t, err)
+	assert.Empty(t, orphans)
+
+	records, _ := w.GetRecords("example.com")
+	zone := newZoneRecords("example.com", records)
+	assert.True(t, registry.owns(zone, endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1")), "the adopted records are owned")
+	prefixed := NewOwnershipGuard("%{record_type}-prefix-", "cluster").AdoptionRecords([]*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "AAAA", "2001:db8::1")})
+	assert.Equal(t, "aaaa-prefix-www.example.com", prefixed[0].DNSName)
+}
+
+func testDiffZone(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	for _, rec := range []inwx.NameserverRecordRequest{
+		{Name: "", Type: "NS", Content: "ns.inwx.de", TTL: 86400},
+		{Name: "www", Type: "A", Content: "192.0.2.1", TTL: 300},
+		{Name: "www", Type: "A", Content: "192.0.2.2", TTL: 300},
+		{Name: "", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 10},
+	} {
+		rec.Domain = "example.com"
+		assert.NoError(t, w.CreateRecord(&rec))
+	}
+	records := p.EndpointRecords("example.com", []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 60, "192.0.2.1"),
+		endpoint.NewEndpoint("example.com", "MX", "20 mail.example.com"),
+		endpoint.NewEndpoint("www.example.org", "A", "192.0.2.9"),
+	})
+	assert.Equal(t, []snapshot.Record{
+		{Name: "www", Type: "A", Content: "192.0.2.1", TTL: 60},
+		{Name: "", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 20},
+	}, records, "the endpoints of other zones are left out")
+	describe := func(operations []RestoreOperation) []string {
+		descriptions := []string{}
+		for _, op := range operations {
+			description := fmt.Sprintf("%s %s %s %d", op.Action, op.Record.Name, op.Record.Type, op.Record.TTL)
+			if op.Previous != nil {
+				description += fmt.Sprintf(" from %d", op.Previous.TTL)
+			}
+			descriptions = append(descriptions, description)
+		}
+		return descriptions
+	}
+
+	operations, err := p.DiffZone("example.com", records, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"update www A 60 from 300", "update  MX 3600 from 3600", "delete www A 300"}, describe(operations))
+	operations, err = p.DiffZone("example.com", records, false)
+	assert.NoError(t, err)
+	assert.Contains(t, describe(operations), "delete  NS 86400", "the whole zone is compared")
+	current, _ := w.GetRecords("example.com")
+	assert.Len(t, *current, 4, "the zone is left alone")
+}
+
+func testPermissionErrors(t *testing.T) {
+	mock := NewMockClientWrapper()
+	mock.AddZone("example.com")
+	deny := Intercept(func(method string, call func() error) error {
+		if method == "CreateRecord" || method == "TestRecord" {
+			return &inwx.ErrorResponse{Code: permissionDeniedCode, Message: "Authorization failed"}
+		}
+		return call()
+	})
+	p := NewINWXProvider(Config{Client: ClientOptions{Backend: mock, Middleware: []Middleware{deny}}})
+	before := testutil.ToFloat64(permissionDeniedTotal.WithLabelValues("CreateRecord"))
+
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1")}})
+	assert.NoError(t, err)
+	assert.Equal(t, "permission_denied", ErrorClass(results[0].Err))
+	var permission *PermissionError
+	assert.ErrorAs(t, results[0].Err, &permission)
+	assert.Equal(t, "CreateRecord", permission.Method)
+	assert.ErrorContains(t, results[0].Err, "not permitted to CreateRecord: (2201) Authorization failed")
+	assert.Equal(t, before+1, testutil.ToFloat64(permissionDeniedTotal.WithLabelValues("CreateRecord")))
+
+	assert.NoError(t, p.CheckPermissions([]string{PermissionRead}))
+	err = p.CheckPermissions([]string{PermissionRead, PermissionWrite})
+	assert.ErrorContains(t, err, "failed to validate a record in zone example.com")
+	assert.Equal(t, "permission_denied", ErrorClass(err))
+	assert.NoError(t, NewINWXProvider(Config{Client: ClientOptions{Backend: mock}}).CheckPermissions([]string{PermissionWrite}))
+	records, _ := mock.GetRecords("example.com")
+	assert.Empty(t, *records, "the permission check creates nothing")
+	assert.ErrorContains(t, NewINWXProvider(Config{Client: ClientOptions{Backend: NewMockClientWrapper()}}).CheckPermissions([]string{PermissionRead}), "no managed zones")
+}
+
+func testSessionStore(t *testing.T) {
+	mock := NewMockClientWrapper()
+	mock.AddZone("example.com")
+	server := NewMockServer(mock, "user", "secret", slog.Default())
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	apiURL, _ := url.Parse(httpServer.URL + "/xmlrpc/")
+	store, err := sessionstore.New(filepath.Join(t.TempDir(), "sessions.json"), "0123456789abcdef")
+	assert.NoError(t, err)
+	logins := 0
+	countLogins := Intercept(func(method string, call func() error) error {
+		if method == "Login" {
+			logins++
+		}
+		return call()
+	})
+	restart := func() *INWXProvider {
+		return NewINWXProvider(Config{Client: ClientOptions{Username: "user", Password: "secret", APIURL: apiURL, PersistentSession: true, SessionStore: store, Middleware: []Middleware{countLogins}}})
+	}
+
+	_, err = restart().Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, logins)
+	_, err = restart().Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, logins, "the restarted provider reuses the saved session")
+
+	server.SetFaults(MockFaults{SessionExpiry: 50 * time.Millisecond})
+	time.Sleep(60 * time.Millisecond)
+	_, err = restart().Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, logins, "an expired session is replaced by a login")
+	server.SetFaults(MockFaults{})
+	_, err = restart().Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, logins, "the session of the login is saved")
+
+	other := NewINWXProvider(Config{Client: ClientOptions{Username: "other", Password: "secret", APIURL: apiURL, PersistentSession: true, SessionStore: store, Middleware: []Middleware{countLogins}}})
+	_, err = other.Records(context.TODO())
+	assert.ErrorContains(t, err, "Authentication error", "the session of another account is not reused")
+}
+
+func testChangeEvents(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	failing := false
+	p.client = chainMiddleware(w, []Middleware{Intercept(func(method string, call func() error) error {
+		if method == "CreateRecord" && failing {
+			return &inwx.ErrorResponse{Code: codeFailed, Message: "Command failed"}
+		}
+		return call()
+	})})
+	p.events, p.account = NewEventBroker(), "customer"
+	events, unsubscribe := p.events.Subscribe()
+	www := endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1")
+	www.RecordTTL = 300
+
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{www}}))
+	applied := <-events
+	assert.False(t, applied.Time.IsZero())
+	assert.Equal(t, ChangeEvent{Time: applied.Time, Account: "customer", Action: "create", Name: "www.example.com", Type: "A", Targets: []string{"192.0.2.1"}, TTL: 300, Result: EventApplied}, applied)
+	failing = true
+	assert.Error(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("api.example.com", "A", "192.0.2.2")}}))
+	failed := <-events
+	assert.Equal(t, EventFailed, failed.Result)
+	assert.Equal(t, "api.example.com", failed.Name)
+	assert.Contains(t, failed.Error, "Command failed")
+	assert.NotEmpty(t, failed.Class)
+	failing = false
+
+	// redacted content is redacted in the events as well
+	p.clientOptions.RedactContent = true
+	p.client = w
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("txt.example.com", "TXT", "token")}}))
+	assert.Equal(t, []string{RedactContent("token")}, (<-events).Targets)
+
+	// slow subscribers miss events rather than block
+	dropped := testutil.ToFloat64(eventsDroppedTotal)
+	for range eventsBufferSize + 1 {
+		p.events.Publish(ChangeEvent{})
+	}
+	assert.Equal(t, dropped+1, testutil.ToFloat64(eventsDroppedTotal))
+	unsubscribe()
+	unsubscribe()
+	count := 0
+	for range events {
+		count++
+	}
+	assert.Equal(t, eventsBufferSize, count, "unsubscribing closes the channel")
+}
+
+func testUnpairedUpdates(t *testing.T) {
+	w, p := NewINWXProviderWithMockClient(&[]string{}, slog.Default())
+	w.AddZone("example.com")
+	www := endpoint.NewEndpoint("www.example.com", "A", "192.0.2.1")
+	assert.NoError(t, p.ApplyChanges(context.TODO(), &plan.Changes{Create: []*endpoint.Endpoint{www}}))
+
+	api := endpoint.NewEndpoint("api.example.com", "A", "192.0.2.2")
+	results, err := p.ApplyChangesWithResults(context.TODO(), &plan.Changes{
+		UpdateOld: []*endpoint.Endpoint{www, api},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", "A", "192.0.2.3")},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, errUnpairedUpdate)
+	assert.Equal(t, api, results[1].Endpoint)
+
+	results, err = p.ApplyChangesWithResults(context.TODO(), &plan.Changes{UpdateNew: []*endpoint.Endpoint{api}})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.ErrorIs(t, results[0].Err, errUnpairedUpdate)
+	records, _ := w.GetRecords("example.com")
+	assert.Equal(t, []string{"192.0.2.3"}, recordContents(*records))
+}
+
+func recordContents(records []inwx.NameserverRecord) []string {
+	contents := []string{}
+	for _, rec := range records {
+		contents = append(contents, rec.Content)
+	}
+	return contents
+}
@@ -0,0 +1,170 @@
+package inwx
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	inwx "github.com/nrdcg/goinwx"
+	"github.com/orbit-online/external-dns-inwx-webhook/journal"
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+)
+
+// JournalingClientWrapper passes calls through to the wrapped client and appends every record change
+// applied to the journal. The records updated and deleted are known from the records listed before.
+type JournalingClientWrapper struct {
+	AbstractClientWrapper
+	journal *journal.Journal
+	// redactContent journals the hashes of the record content instead of the content
+	redactContent bool
+	logger        *slog.Logger
+
+	mu sync.Mutex
+	// listed are the records last listed by ID, along with their zone
+	listed map[int]listedRecord
+}
+
+type listedRecord struct {
+	zone   string
+	record snapshot.Record
+}
+
+func newJournalingClientWrapper(client AbstractClientWrapper, j *journal.Journal, redactContent bool, logger *slog.Logger) *JournalingClientWrapper {
+	return &JournalingClientWrapper{AbstractClientWrapper: client, journal: j, redactContent: redactContent, logger: logger, listed: map[int]listedRecord{}}
+}
+
+func (w *JournalingClientWrapper) GetRecords(domain string) (*[]inwx.NameserverRecord, error) {
+	records, err := w.AbstractClientWrapper.GetRecords(domain)
+	if err == nil {
+		w.mu.Lock()
+		for _, rec := range *records {
+			w.listed[rec.ID] = listedRecord{zone: domain, record: snapshotRecord(rec)}
+		}
+		w.mu.Unlock()
+	}
+	return records, err
+}
+
+func (w *JournalingClientWrapper) CreateRecord(request *inwx.NameserverRecordRequest) error {
+	if err := w.AbstractClientWrapper.CreateRecord(request); err != nil {
+		return err
+	}
+	w.append(&journal.Entry{Zone: request.Domain, Action: journal.Create, Record: requestRecord(0, request)})
+	return nil
+}
+
+func (w *JournalingClientWrapper) UpdateRecord(recID int, request *inwx.NameserverRecordRequest) error {
+	if err := w.AbstractClientWrapper.UpdateRecord(recID, request); err != nil {
+		return err
+	}
+	record := requestRecord(recID, request)
+	w.mu.Lock()
+	previous, ok := w.listed[recID]
+	w.listed[recID] = listedRecord{zone: request.Domain, record: *record}
+	w.mu.Unlock()
+	entry := &journal.Entry{Zone: request.Domain, Action: journal.Update, Record: record}
+	if ok {
+		entry.Previous = &previous.record
+	}
+	w.append(entry)
+	return nil
+}
+
+func (w *JournalingClientWrapper) DeleteRecord(recID int) error {
+	if err := w.AbstractClientWrapper.DeleteRecord(recID); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	previous, ok := w.listed[recID]
+	delete(w.listed, recID)
+	w.mu.Unlock()
+	entry := &journal.Entry{Action: journal.Delete, Previous: &snapshot.Record{ID: recID}}
+	if ok {
+		entry.Zone, entry.Previous = previous.zone, &previous.record
+	}
+	w.append(entry)
+	return nil
+}
+
+// append logs rather than returns failures, as the change has been applied already.
+func (w *JournalingClientWrapper) append(entry *journal.Entry) {
+	if w.redactContent {
+		entry.Redacted = true
+		for _, rec := range []*snapshot.Record{entry.Record, entry.Previous} {
+			if rec != nil && rec.Content != "" {
+				rec.Content = RedactContent(rec.Content)
+			}
+		}
+	}
+	if err := w.journal.Append(entry); err != nil {
+		w.logger.Error("failed to journal record change", "journal", w.journal.Path(), "zone", entry.Zone, "action", entry.Action, "err", err)
+	}
+}
+
+func requestRecord(id int, request *inwx.NameserverRecordRequest) *snapshot.Record {
+	return &snapshot.Record{ID: id, Name: request.Name, Type: request.Type, Content: request.Content, TTL: request.TTL, Priority: request.Priority}
+}
+
+// ReplayJournal logs into INWX and applies the journal entries again in order or, with invert set,
+// undoes them in reverse order, returning the operations applied up to the first failure. With dryRun
+// set, the operations are only computed. Records updated and deleted are looked up by name, type and
+// content, as their IDs may have changed since.
+func (p *INWXProvider) ReplayJournal(entries []journal.Entry, invert, dryRun bool) ([]journal.Entry, error) {
+	operations := []journal.Entry{}
+	for _, e := range entries {
+		if invert {
+			e = e.Invert()
+		}
+		if e.Redacted {
+			return nil, fmt.Errorf("journal entry %d: the %s cannot be replayed, the record content is redacted", e.Seq, e.Action)
+		}
+		if (e.Action != journal.Delete && e.Record == nil) || (e.Action != journal.Create && (e.Previous == nil || e.Previous.Type == "")) {
+			return nil, fmt.Errorf("journal entry %d: the %s cannot be replayed, the record is unknown", e.Seq, e.Action)
+		}
+		operations = append(operations, e)
+	}
+	if invert {
+		slices.Reverse(operations)
+	}
+	if dryRun {
+		return operations, nil
+	}
+
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	for i, op := range operations {
+		if err := p.replay(op); err != nil {
+			return operations[:i], fmt.Errorf("journal entry %d: failed to %s record: %w", op.Seq, op.Action, err)
+		}
+	}
+	return operations, nil
+}
+
+func (p *INWXProvider) replay(op journal.Entry) error {
+	if op.Action == journal.Create {
+		return p.client.CreateRecord(recordRequest(op.Zone, op.Record))
+	}
+	records, err := p.client.GetRecords(op.Zone)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(*records, func(rec inwx.NameserverRecord) bool {
+		return rec.Name == op.Previous.Name && rec.Type == op.Previous.Type && rec.Content == op.Previous.Content
+	})
+	if i < 0 {
+		return fmt.Errorf("no record %s %s %s in zone %s", op.Previous.Name, op.Previous.Type, op.Previous.Content, op.Zone)
+	}
+	if op.Action == journal.Delete {
+		return p.client.DeleteRecord((*records)[i].ID)
+	}
+	return p.client.UpdateRecord((*records)[i].ID, recordRequest(op.Zone, op.Record))
+}
+
+func recordRequest(zone string, rec *snapshot.Record) *inwx.NameserverRecordRequest {
+	return &inwx.NameserverRecordRequest{Domain: zone, Name: rec.Name, Type: rec.Type, Content: rec.Content, TTL: rec.TTL, Priority: rec.Priority}
+}
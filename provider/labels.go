@@ -0,0 +1,50 @@
+package inwx
+
+import (
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// setRegistryLabels sets the labels of the external-dns TXT registry records among endpoints, e.g.
+// owner and resource, on the endpoints they own, keeping labels set already. The registry records
+// are found by the names g derives.
+func (g *OwnershipGuard) setRegistryLabels(endpoints []*endpoint.Endpoint) {
+	txt := map[string][]string{}
+	for _, ep := range endpoints {
+		if ep.RecordType == endpoint.RecordTypeTXT {
+			name := strings.ToLower(ep.DNSName)
+			txt[name] = append(txt[name], ep.Targets...)
+		}
+	}
+	for _, ep := range endpoints {
+		if ep.RecordType == endpoint.RecordTypeTXT && g.registered(nil, ep) {
+			continue
+		}
+		for _, txtName := range g.txtNames(ep.DNSName, ep.RecordType) {
+			labels, ok := registryLabels(txt[txtName])
+			if !ok {
+				continue
+			}
+			if ep.Labels == nil {
+				ep.Labels = endpoint.NewLabels()
+			}
+			for key, value := range labels {
+				if _, ok := ep.Labels[key]; !ok {
+					ep.Labels[key] = value
+				}
+			}
+			break
+		}
+	}
+}
+
+// registryLabels returns the labels of the first TXT registry record among contents.
+func registryLabels(contents []string) (endpoint.Labels, bool) {
+	for _, content := range contents {
+		if labels, err := endpoint.NewLabelsFromStringPlain(content); err == nil {
+			return labels, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,88 @@
+package inwx
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+const (
+	// defaultMaintenanceBackoff applies if a maintenance announces no end
+	defaultMaintenanceBackoff = 5 * time.Minute
+	// maxMaintenanceBackoff bounds the announced end of a maintenance
+	maxMaintenanceBackoff = 6 * time.Hour
+)
+
+var (
+	maintenanceEnd      = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}(:\d{2})?`)
+	maintenanceDuration = regexp.MustCompile(`(?i)(\d+)\s*(minute|min|hour|h)`)
+)
+
+// MaintenanceError is returned instead of calling INWX while it is in maintenance.
+type MaintenanceError struct {
+	Until time.Time
+}
+
+func (e *MaintenanceError) Error() string {
+	return fmt.Sprintf("INWX is in maintenance until %s", e.Until.Format(time.RFC3339))
+}
+
+// maintenanceUntil returns the announced end of an INWX maintenance error, false if err is none.
+func maintenanceUntil(err error, now time.Time) (time.Time, bool) {
+	var response *inwx.ErrorResponse
+	if !errors.As(err, &response) {
+		return time.Time{}, false
+	}
+	text := response.Message + " " + response.Reason
+	if response.ReasonCode != "MAINTENANCE" && !strings.Contains(strings.ToLower(text), "maintenance") {
+		return time.Time{}, false
+	}
+	until := now.Add(defaultMaintenanceBackoff)
+	if match := maintenanceEnd.FindString(text); match != "" {
+		for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04"} {
+			if end, err := time.ParseInLocation(layout, strings.Replace(match, "T", " ", 1), time.UTC); err == nil && end.After(now) {
+				until = end
+				break
+			}
+		}
+	} else if match := maintenanceDuration.FindStringSubmatch(text); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		unit := time.Minute
+		if strings.HasPrefix(strings.ToLower(match[2]), "h") {
+			unit = time.Hour
+		}
+		until = now.Add(time.Duration(n) * unit)
+	}
+	if limit := now.Add(maxMaintenanceBackoff); until.After(limit) {
+		until = limit
+	}
+	return until, true
+}
+
+// Maintenance returns the announced end of the INWX maintenance the provider backs off for, if any.
+func (p *INWXProvider) Maintenance() (time.Time, bool) {
+	until := time.Unix(0, p.maintenanceUntil.Load())
+	return until, time.Now().Before(until)
+}
+
+// noteMaintenance backs off for the maintenance a login error reports, and notes the end of a
+// maintenance once INWX answers otherwise.
+func (p *INWXProvider) noteMaintenance(loginErr error) error {
+	until, ok := maintenanceUntil(loginErr, time.Now())
+	if !ok {
+		if p.maintenanceUntil.Swap(0) != 0 {
+			p.logger.Info("INWX maintenance ended")
+			apiMaintenance.Set(0)
+		}
+		return loginErr
+	}
+	p.maintenanceUntil.Store(until.UnixNano())
+	apiMaintenance.Set(1)
+	p.logger.Warn("INWX is in maintenance, backing off", "until", until, "err", loginErr)
+	return &MaintenanceError{Until: until}
+}
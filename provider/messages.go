@@ -0,0 +1,62 @@
+package inwx
+
+import (
+	"context"
+	"time"
+)
+
+// maxMessagesPerPoll bounds the messages handled by a single poll, should acknowledging them fail.
+const maxMessagesPerPoll = 100
+
+// AccountMessage is a notice INWX delivers through its message queue, e.g. about a domain transfer.
+type AccountMessage struct {
+	ID      int       `mapstructure:"id"`
+	Type    string    `mapstructure:"type"`
+	Date    time.Time `mapstructure:"date"`
+	Object  string    `mapstructure:"object"`
+	Message string    `mapstructure:"msg"`
+}
+
+// PollMessages logs and acknowledges the new messages of the account every interval until ctx is done.
+func (p *INWXProvider) PollMessages(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.pollMessages(); err != nil {
+			p.logger.Error("failed to poll account messages", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *INWXProvider) pollMessages() error {
+	logout, err := p.login()
+	if err != nil {
+		return err
+	}
+	defer logout()
+
+	for range maxMessagesPerPoll {
+		message, err := p.client.PollMessage()
+		if err != nil || message == nil {
+			return err
+		}
+		// in read-only mode messages are not acknowledged, and polled again
+		if message.ID != p.lastMessageID {
+			p.logger.Info("INWX account message", "id", message.ID, "type", message.Type, "date", message.Date, "object", message.Object, "message", message.Message)
+			accountMessagesTotal.WithLabelValues(message.Type).Inc()
+			p.lastMessageID = message.ID
+		}
+		if _, ok := p.client.(*ReadOnlyClientWrapper); ok {
+			return nil
+		}
+		if err := p.client.AckMessage(message.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
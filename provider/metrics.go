@@ -0,0 +1,200 @@
+package inwx
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "external_dns_inwx"
+
+// The latency histograms are exposed as native histograms to scrapers negotiating them, with a
+// resolution of about 10%, and with the classic buckets to the others.
+const (
+	nativeHistogramBucketFactor     = 1.1
+	nativeHistogramMaxBucketNumber  = 100
+	nativeHistogramMinResetDuration = time.Hour
+)
+
+var (
+	apiRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_requests_total",
+		Help:      "The number of INWX API requests by XML-RPC method and HTTP status code, or error if no response was received.",
+	}, []string{"method", "code"})
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "The duration of INWX API requests by XML-RPC method.",
+		Buckets:   prometheus.DefBuckets,
+
+		NativeHistogramBucketFactor:     nativeHistogramBucketFactor,
+		NativeHistogramMaxBucketNumber:  nativeHistogramMaxBucketNumber,
+		NativeHistogramMinResetDuration: nativeHistogramMinResetDuration,
+	}, []string{"method"})
+	webhookRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "webhook_request_duration_seconds",
+		Help:      "The duration of webhook requests by endpoint, negotiate, records, adjustendpoints or other, HTTP method and status code.",
+		Buckets:   prometheus.DefBuckets,
+
+		NativeHistogramBucketFactor:     nativeHistogramBucketFactor,
+		NativeHistogramMaxBucketNumber:  nativeHistogramMaxBucketNumber,
+		NativeHistogramMinResetDuration: nativeHistogramMinResetDuration,
+	}, []string{"endpoint", "method", "code"})
+	skippedZones = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "skipped_zones",
+		Help:      "Zones of the INWX account skipped by the provider, by reason; 1 for every skipped zone.",
+	}, []string{"zone", "reason"})
+	dnssecSignedZones = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "dnssec_signed",
+		Help:      "Whether a managed zone is signed by INWX DNSSEC; 1 if signed, 0 if not.",
+	}, []string{"zone"})
+	dnssecDSPublished = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "dnssec_ds_published",
+		Help:      "Whether an active DS record of a managed zone is published at the registry; 1 if published, 0 if not.",
+	}, []string{"zone"})
+	domainExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "domain_expiry_timestamp_seconds",
+		Help:      "The expiry date of a domain registered with the INWX account, in seconds since the epoch.",
+	}, []string{"domain"})
+	zoneSOASerial = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "zone_soa_serial",
+		Help:      "The SOA serial of a managed zone as published by INWX, refreshed whenever the records are listed.",
+	}, []string{"zone"})
+	duplicateRecords = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "duplicate_records",
+		Help:      "The number of records of a managed zone identical to another record in name, type, content and TTL, ignored when the records are listed.",
+	}, []string{"zone"})
+	zoneRecordCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "zone_records",
+		Help:      "The number of records of a managed zone, SOA and NS records included, refreshed whenever the records are listed.",
+	}, []string{"zone"})
+	zoneRecordLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "zone_record_limit",
+		Help:      "The number of records INWX allows in a managed zone, as configured, for alerting on zone_records / zone_record_limit.",
+	}, []string{"zone"})
+	zoneChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "zone_changes_total",
+		Help:      "The number of endpoint changes applied by zone, action and result, success or error.",
+	}, []string{"zone", "action", "result"})
+	webhookUnsupportedVersionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "webhook_unsupported_version_requests_total",
+		Help:      "The number of webhook requests refused for asking for an unsupported version of the webhook API, by the version requested.",
+	}, []string{"version"})
+	recordsDriftTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "records_drift_total",
+		Help:      "The number of record contents found drifted from the last applied state by zone and kind, missing or unexpected.",
+	}, []string{"zone", "kind"})
+	reconciliationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "reconciliations_total",
+		Help:      "The number of scheduled listings of the managed zones by result, success or error.",
+	}, []string{"result"})
+	lastReconciliation = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_reconciliation_timestamp_seconds",
+		Help:      "The time of the last successful scheduled listing of the managed zones, in seconds since the epoch.",
+	})
+	accountMessagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "account_messages_total",
+		Help:      "The number of INWX account messages received by message type.",
+	}, []string{"type"})
+	clientCallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "client_calls_total",
+		Help:      "The number of INWX client calls by client method and result, success or error, if counted by MetricsMiddleware.",
+	}, []string{"method", "result"})
+	rateLimitedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limited_total",
+		Help:      "The number of INWX API requests refused for exceeding the request limit, pausing further requests.",
+	})
+	loginsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "logins_total",
+		Help:      "The number of INWX API logins by result, success, invalid_credentials or error.",
+	}, []string{"result"})
+	sessionRestoresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "session_restores_total",
+		Help:      "The number of INWX sessions loaded from the session store by result, restored, expired or error.",
+	}, []string{"result"})
+	loginLocked = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "login_locked_accounts",
+		Help:      "The number of INWX accounts not logged into after repeated credential failures, until the credentials change.",
+	})
+	recordsCacheStale = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "records_cache_stale",
+		Help:      "Whether records are served from the records cache file while they are refreshed from INWX after a start; 1 if stale.",
+	})
+	permissionDeniedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "permission_denied_total",
+		Help:      "The number of calls INWX refused as the account lacks the permission, e.g. sub-accounts with restricted permissions, by method.",
+	}, []string{"method"})
+	cacheLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_lookups_total",
+		Help:      "The number of lookups of the caches by cache, records_file, shared_records or zone_index, and result, hit or miss.",
+	}, []string{"cache", "result"})
+	cacheEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_entries",
+		Help:      "The number of entries of the caches by cache: endpoints for records_file and shared_records, zones for zone_index.",
+	}, []string{"cache"})
+	cacheUpdated = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_updated_timestamp_seconds",
+		Help:      "The time the entries of the caches were last updated as Unix timestamp by cache; the age of the entries is time() minus this.",
+	}, []string{"cache"})
+	retryQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "retry_queue_depth",
+		Help:      "The number of failed changes queued for retrying between syncs.",
+	})
+	retriedChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retried_changes_total",
+		Help:      "The number of retries of failed changes by result: success, failure to retry again, or dropped after the last attempt or for a full queue.",
+	}, []string{"result"})
+	eventSubscribers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "event_subscribers",
+		Help:      "The number of clients subscribed to the change events.",
+	})
+	eventsDroppedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_dropped_total",
+		Help:      "The number of change events dropped for subscribers falling too far behind.",
+	})
+	dedupedChangeSetsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "deduplicated_change_sets_total",
+		Help:      "The number of change sets acknowledged without applying them, as identical to the change set applied last.",
+	})
+	apiMaintenance = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_maintenance",
+		Help:      "Whether INWX announced a maintenance the provider backs off for; 1 during a maintenance, 0 otherwise.",
+	})
+)
+
+// RegisterMetrics registers the metrics of the provider.
+func RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(apiRequestsTotal, apiRequestDuration, webhookRequestDuration, skippedZones, dnssecSignedZones, dnssecDSPublished, domainExpiry, zoneSOASerial, duplicateRecords, zoneRecordCount, zoneRecordLimit, zoneChangesTotal, webhookUnsupportedVersionRequests, recordsDriftTotal, reconciliationsTotal, lastReconciliation, accountMessagesTotal, apiMaintenance, clientCallsTotal, rateLimitedTotal, loginsTotal, sessionRestoresTotal, loginLocked, recordsCacheStale, retryQueueDepth, retriedChangesTotal, dedupedChangeSetsTotal, eventSubscribers, eventsDroppedTotal, cacheLookupsTotal, cacheEntries, cacheUpdated, permissionDeniedTotal)
+}
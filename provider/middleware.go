@@ -0,0 +1,168 @@
+package inwx
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+// Middleware wraps a client, e.g. to instrument, retry or throttle its calls, or replaces it altogether.
+type Middleware func(next AbstractClientWrapper) AbstractClientWrapper
+
+// chainMiddleware wraps client in middleware, the first middleware being called first.
+func chainMiddleware(client AbstractClientWrapper, middleware []Middleware) AbstractClientWrapper {
+	for _, m := range slices.Backward(middleware) {
+		client = m(client)
+	}
+	return client
+}
+
+// readMethods are the methods of AbstractClientWrapper changing nothing, which are safe to retry.
+var readMethods = []string{"GetRecords", "GetZones", "GetDomains", "GetDNSSECStatus", "GetDNSKeys", "Ping"}
+
+// Intercept returns the middleware passing every call of the client to around, along with the name
+// of the method called and the function calling the wrapped client.
+func Intercept(around func(method string, call func() error) error) Middleware {
+	return func(next AbstractClientWrapper) AbstractClientWrapper {
+		return &interceptedClient{next: next, around: around}
+	}
+}
+
+// LoggingMiddleware logs every call at debug level with its duration and error.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return Intercept(func(method string, call func() error) error {
+		start := time.Now()
+		err := call()
+		logger.Debug("INWX client call", "method", method, "duration", time.Since(start), "err", err)
+		return err
+	})
+}
+
+// MetricsMiddleware counts every call in the client_calls_total metric by method and result.
+func MetricsMiddleware() Middleware {
+	return Intercept(func(method string, call func() error) error {
+		err := call()
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		clientCallsTotal.WithLabelValues(method, result).Inc()
+		return err
+	})
+}
+
+// RetryMiddleware retries failed calls changing nothing up to attempts times in total, waiting backoff
+// and then twice as long as before between attempts. Calls changing records are never retried, as they
+// may have succeeded.
+func RetryMiddleware(attempts int, backoff time.Duration) Middleware {
+	return Intercept(func(method string, call func() error) error {
+		err := call()
+		if !slices.Contains(readMethods, method) {
+			return err
+		}
+		for delay, attempt := backoff, 1; err != nil && attempt < attempts; delay, attempt = delay*2, attempt+1 {
+			time.Sleep(delay)
+			err = call()
+		}
+		return err
+	})
+}
+
+// RateLimitMiddleware spaces the calls of the client at least interval apart.
+func RateLimitMiddleware(interval time.Duration) Middleware {
+	mu := sync.Mutex{}
+	next := time.Time{}
+	return Intercept(func(method string, call func() error) error {
+		mu.Lock()
+		wait := time.Until(next)
+		next = time.Now().Add(max(wait, 0) + interval)
+		mu.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		return call()
+	})
+}
+
+type interceptedClient struct {
+	next   AbstractClientWrapper
+	around func(method string, call func() error) error
+}
+
+func (c *interceptedClient) Login() (response *inwx.LoginResponse, err error) {
+	err = c.around("Login", func() (err error) { response, err = c.next.Login(); return err })
+	return response, err
+}
+
+func (c *interceptedClient) Logout() error {
+	return c.around("Logout", c.next.Logout)
+}
+
+func (c *interceptedClient) GetRecords(domain string) (records *[]inwx.NameserverRecord, err error) {
+	err = c.around("GetRecords", func() (err error) { records, err = c.next.GetRecords(domain); return err })
+	return records, err
+}
+
+func (c *interceptedClient) GetZones() (zones *[]inwx.NameserverDomain, err error) {
+	err = c.around("GetZones", func() (err error) { zones, err = c.next.GetZones(); return err })
+	return zones, err
+}
+
+func (c *interceptedClient) GetDomains() (domains *[]inwx.DomainInfoResponse, err error) {
+	err = c.around("GetDomains", func() (err error) { domains, err = c.next.GetDomains(); return err })
+	return domains, err
+}
+
+func (c *interceptedClient) CreateZone(request *inwx.NameserverCreateRequest) error {
+	return c.around("CreateZone", func() error { return c.next.CreateZone(request) })
+}
+
+func (c *interceptedClient) CloneZone(source string, target string) error {
+	return c.around("CloneZone", func() error { return c.next.CloneZone(source, target) })
+}
+
+func (c *interceptedClient) GetDNSSECStatus(domains []string) (status map[string]string, err error) {
+	err = c.around("GetDNSSECStatus", func() (err error) { status, err = c.next.GetDNSSECStatus(domains); return err })
+	return status, err
+}
+
+func (c *interceptedClient) GetDNSKeys(domain string) (keys []inwx.DNSSecServiceListResponse, err error) {
+	err = c.around("GetDNSKeys", func() (err error) { keys, err = c.next.GetDNSKeys(domain); return err })
+	return keys, err
+}
+
+func (c *interceptedClient) EnableDNSSEC(domain string) error {
+	return c.around("EnableDNSSEC", func() error { return c.next.EnableDNSSEC(domain) })
+}
+
+func (c *interceptedClient) Ping() error {
+	return c.around("Ping", c.next.Ping)
+}
+
+func (c *interceptedClient) PollMessage() (message *AccountMessage, err error) {
+	err = c.around("PollMessage", func() (err error) { message, err = c.next.PollMessage(); return err })
+	return message, err
+}
+
+func (c *interceptedClient) AckMessage(id int) error {
+	return c.around("AckMessage", func() error { return c.next.AckMessage(id) })
+}
+
+func (c *interceptedClient) CreateRecord(request *inwx.NameserverRecordRequest) error {
+	return c.around("CreateRecord", func() error { return c.next.CreateRecord(request) })
+}
+
+func (c *interceptedClient) TestRecord(request *inwx.NameserverRecordRequest) error {
+	return c.around("TestRecord", func() error { return c.next.TestRecord(request) })
+}
+
+func (c *interceptedClient) UpdateRecord(recID int, request *inwx.NameserverRecordRequest) error {
+	return c.around("UpdateRecord", func() error { return c.next.UpdateRecord(recID, request) })
+}
+
+func (c *interceptedClient) DeleteRecord(recID int) error {
+	return c.around("DeleteRecord", func() error { return c.next.DeleteRecord(recID) })
+}
@@ -4,16 +4,36 @@ import (
 	"fmt"
 	"maps"
 	"slices"
+	"time"
 
 	inwx "github.com/nrdcg/goinwx"
 )
 
+// MockClientWrapper is a client keeping an INWX account in memory, for tests and the mock-server command.
 type MockClientWrapper struct {
 	db       map[string]*[]inwx.NameserverRecord
 	idToZone map[int]string
+	// nextID is the ID of the next record created
+	nextID   int
+	domains  []inwx.DomainInfoResponse
+	slaves   []string
+	dnssec   map[string]string
+	dnskeys  map[string][]inwx.DNSSecServiceListResponse
+	messages []AccountMessage
+	loginErr error
+	logins   int
 }
 
-func (w *MockClientWrapper) login() (*inwx.LoginResponse, error) {
+// NewMockClientWrapper returns a mock client of an account without zones.
+func NewMockClientWrapper() *MockClientWrapper {
+	return &MockClientWrapper{db: map[string]*[]inwx.NameserverRecord{}, idToZone: map[int]string{}}
+}
+
+func (w *MockClientWrapper) Login() (*inwx.LoginResponse, error) {
+	w.logins++
+	if w.loginErr != nil {
+		return nil, w.loginErr
+	}
 	return &inwx.LoginResponse{
 		CustomerID: 1000,
 		AccountID:  1000,
@@ -23,11 +43,11 @@ func (w *MockClientWrapper) login() (*inwx.LoginResponse, error) {
 	}, nil
 }
 
-func (w *MockClientWrapper) logout() error {
+func (w *MockClientWrapper) Logout() error {
 	return nil
 }
 
-func (w *MockClientWrapper) getRecords(domain string) (*[]inwx.NameserverRecord, error) {
+func (w *MockClientWrapper) GetRecords(domain string) (*[]inwx.NameserverRecord, error) {
 	if recs, ok := w.db[domain]; !ok {
 		return nil, fmt.Errorf("unable to retrieve records for zone %s: key not found in mock db", domain)
 	} else {
@@ -41,75 +61,209 @@ func (w *MockClientWrapper) getRecords(domain string) (*[]inwx.NameserverRecord,
 	}
 }
 
-func (w *MockClientWrapper) getZones() (*[]string, error) {
-	zones := slices.Collect(maps.Keys(w.db))
+func (w *MockClientWrapper) GetZones() (*[]inwx.NameserverDomain, error) {
+	zones := []inwx.NameserverDomain{}
+	for _, zone := range slices.Sorted(maps.Keys(w.db)) {
+		zoneType := "MASTER"
+		if slices.Contains(w.slaves, zone) {
+			zoneType = "SLAVE"
+		}
+		zones = append(zones, inwx.NameserverDomain{Domain: zone, Type: zoneType})
+	}
 	return &zones, nil
 }
 
-func (w *MockClientWrapper) createRecord(r *inwx.NameserverRecordRequest) error {
-	if recs, ok := w.db[r.Domain]; !ok {
-		return fmt.Errorf("zone %s not found", r.Domain)
-	} else {
-		id := len(*recs)
-		newRecs := append(*recs, inwx.NameserverRecord{
-			ID:       id,
-			Name:     r.Name,
-			Type:     r.Type,
-			Content:  r.Content,
-			TTL:      r.TTL,
-			Priority: r.Priority,
-		})
-		w.idToZone[id] = r.Domain
-		w.db[r.Domain] = &newRecs
-		return nil
-	}
-}
-
-func (w *MockClientWrapper) updateRecord(recID int, r *inwx.NameserverRecordRequest) error {
-	if recs, ok := w.db[r.Domain]; !ok {
-		return fmt.Errorf("zone %s not found", r.Domain)
-	} else {
-		if recID >= len(*recs) {
-			return fmt.Errorf("record ID %d not found", recID)
-		}
-		if (*recs)[recID].ID == -1 {
-			return fmt.Errorf("record ID %d has been deleted", recID)
+func (w *MockClientWrapper) GetDomains() (*[]inwx.DomainInfoResponse, error) {
+	domains := slices.Clone(w.domains)
+	return &domains, nil
+}
+
+func (w *MockClientWrapper) CreateZone(r *inwx.NameserverCreateRequest) error {
+	if _, ok := w.db[r.Domain]; ok {
+		return fmt.Errorf("zone %s already exists", r.Domain)
+	}
+	w.db[r.Domain] = &[]inwx.NameserverRecord{}
+	for _, ns := range r.Nameservers {
+		if err := w.CreateRecord(&inwx.NameserverRecordRequest{Domain: r.Domain, Type: "NS", Content: ns, TTL: 86400}); err != nil {
+			return err
 		}
-		(*recs)[recID] = inwx.NameserverRecord{
-			ID:       recID,
-			Name:     r.Name,
-			Type:     r.Type,
-			Content:  r.Content,
-			TTL:      r.TTL,
-			Priority: r.Priority,
+	}
+	return nil
+}
+
+func (w *MockClientWrapper) CloneZone(source string, target string) error {
+	if _, ok := w.db[target]; ok {
+		return fmt.Errorf("zone %s already exists", target)
+	}
+	records, err := w.GetRecords(source)
+	if err != nil {
+		return err
+	}
+	w.db[target] = &[]inwx.NameserverRecord{}
+	for _, rec := range *records {
+		if _, err := w.createRecord(&inwx.NameserverRecordRequest{Domain: target, Name: rec.Name, Type: rec.Type, Content: rec.Content, TTL: rec.TTL, Priority: rec.Priority}); err != nil {
+			return err
 		}
-		return nil
 	}
+	return nil
 }
 
-func (w *MockClientWrapper) deleteRecord(recID int) error {
-	if zone, ok := w.idToZone[recID]; !ok {
-		return fmt.Errorf("zone for record ID %d not found", recID)
-	} else {
-		if recs, ok := w.db[zone]; !ok {
-			return fmt.Errorf("zone %s not found", zone)
-		} else {
-			if recID >= len(*recs) {
-				return fmt.Errorf("record ID %d not found", recID)
-			}
-			if (*recs)[recID].ID == -1 {
-				return fmt.Errorf("record ID %d has already been deleted", recID)
-			}
-			(*recs)[recID].ID = -1
-			return nil
+func (w *MockClientWrapper) GetDNSSECStatus(domains []string) (map[string]string, error) {
+	statuses := map[string]string{}
+	for _, domain := range domains {
+		if status, ok := w.dnssec[domain]; ok {
+			statuses[domain] = status
 		}
 	}
+	return statuses, nil
+}
+
+func (w *MockClientWrapper) GetDNSKeys(domain string) ([]inwx.DNSSecServiceListResponse, error) {
+	return w.dnskeys[domain], nil
+}
+
+func (w *MockClientWrapper) EnableDNSSEC(domain string) error {
+	if _, ok := w.db[domain]; !ok {
+		return fmt.Errorf("zone %s not found", domain)
+	}
+	if w.dnssec == nil {
+		w.dnssec = map[string]string{}
+	}
+	w.dnssec[domain] = "AUTO"
+	if w.dnskeys == nil {
+		w.dnskeys = map[string][]inwx.DNSSecServiceListResponse{}
+	}
+	w.dnskeys[domain] = []inwx.DNSSecServiceListResponse{{OwnerName: domain, FlagID: 257, Status: "OK", Active: 1}}
+	return nil
+}
+
+func (w *MockClientWrapper) Ping() error {
+	return w.loginErr
+}
+
+func (w *MockClientWrapper) PollMessage() (*AccountMessage, error) {
+	if len(w.messages) == 0 {
+		return nil, nil
+	}
+	message := w.messages[0]
+	return &message, nil
+}
+
+func (w *MockClientWrapper) AckMessage(id int) error {
+	if len(w.messages) == 0 || w.messages[0].ID != id {
+		return fmt.Errorf("message %d not found", id)
+	}
+	w.messages = w.messages[1:]
+	return nil
+}
+
+func (w *MockClientWrapper) CreateRecord(r *inwx.NameserverRecordRequest) error {
+	_, err := w.createRecord(r)
+	return err
+}
+
+func (w *MockClientWrapper) TestRecord(r *inwx.NameserverRecordRequest) error {
+	if _, ok := w.db[r.Domain]; !ok {
+		return fmt.Errorf("zone %s not found", r.Domain)
+	}
+	return nil
+}
+
+// createRecord returns the ID of the record created, unique across zones.
+func (w *MockClientWrapper) createRecord(r *inwx.NameserverRecordRequest) (int, error) {
+	recs, ok := w.db[r.Domain]
+	if !ok {
+		return 0, fmt.Errorf("zone %s not found", r.Domain)
+	}
+	id := w.nextID
+	w.nextID++
+	ttl := r.TTL
+	if ttl == 0 {
+		// the default TTL of INWX, applied to records created without one
+		ttl = 3600
+	}
+	newRecs := append(*recs, inwx.NameserverRecord{
+		ID:       id,
+		Name:     r.Name,
+		Type:     r.Type,
+		Content:  r.Content,
+		TTL:      ttl,
+		Priority: r.Priority,
+	})
+	w.idToZone[id] = r.Domain
+	w.db[r.Domain] = &newRecs
+	return id, nil
+}
+
+// recordIndex returns the zone of the record recID and its index among the records of the zone.
+func (w *MockClientWrapper) recordIndex(recID int) (string, int, error) {
+	zone, ok := w.idToZone[recID]
+	if !ok {
+		return "", 0, fmt.Errorf("record ID %d not found", recID)
+	}
+	recs, ok := w.db[zone]
+	if !ok {
+		return "", 0, fmt.Errorf("zone %s not found", zone)
+	}
+	i := slices.IndexFunc(*recs, func(rec inwx.NameserverRecord) bool { return rec.ID == recID })
+	if i < 0 {
+		return "", 0, fmt.Errorf("record ID %d has been deleted", recID)
+	}
+	return zone, i, nil
 }
 
-func (w *MockClientWrapper) CreateZone(zone string) {
+func (w *MockClientWrapper) UpdateRecord(recID int, r *inwx.NameserverRecordRequest) error {
+	if _, ok := w.db[r.Domain]; !ok && r.Domain != "" {
+		return fmt.Errorf("zone %s not found", r.Domain)
+	}
+	zone, i, err := w.recordIndex(recID)
+	if err != nil {
+		return err
+	}
+	ttl := r.TTL
+	if ttl == 0 {
+		ttl = (*w.db[zone])[i].TTL
+	}
+	(*w.db[zone])[i] = inwx.NameserverRecord{
+		ID:       recID,
+		Name:     r.Name,
+		Type:     r.Type,
+		Content:  r.Content,
+		TTL:      ttl,
+		Priority: r.Priority,
+	}
+	return nil
+}
+
+func (w *MockClientWrapper) DeleteRecord(recID int) error {
+	zone, i, err := w.recordIndex(recID)
+	if err != nil {
+		return err
+	}
+	(*w.db[zone])[i].ID = -1
+	return nil
+}
+
+func (w *MockClientWrapper) AddZone(zone string) {
 	if _, ok := w.db[zone]; ok {
 		panic(fmt.Errorf("zone %s already exists", zone))
 	} else {
 		w.db[zone] = &[]inwx.NameserverRecord{}
 	}
 }
+
+// RegisterDomain adds a domain to the domains registered with the mock account.
+func (w *MockClientWrapper) RegisterDomain(domain string) {
+	w.RegisterDomainUntil(domain, time.Time{})
+}
+
+// RegisterDomainUntil adds a domain expiring at exDate to the domains registered with the mock account.
+func (w *MockClientWrapper) RegisterDomainUntil(domain string, exDate time.Time) {
+	w.domains = append(w.domains, inwx.DomainInfoResponse{Domain: domain, ExDate: exDate})
+}
+
+// CreateSlaveZone adds a zone of type SLAVE.
+func (w *MockClientWrapper) CreateSlaveZone(zone string) {
+	w.AddZone(zone)
+	w.slaves = append(w.slaves, zone)
+}
@@ -0,0 +1,85 @@
+package inwx
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+// MockFaults configures the faults injected into the calls of the mock server or of a client wrapped
+// by FaultMiddleware. Random faults are drawn from Seed, so that a sequence of calls fails alike in
+// every run.
+type MockFaults struct {
+	// ErrorRate is the share of calls failing with a command error, from 0 to 1
+	ErrorRate float64
+	// RateLimitRate is the share of calls refused for exceeding the request limit, from 0 to 1
+	RateLimitRate float64
+	// RateLimitPause is the retry hint of refused calls, 1s if not set
+	RateLimitPause time.Duration
+	// Latency delays every call
+	Latency time.Duration
+	// SessionExpiry ends sessions this long after their login, if set
+	SessionExpiry time.Duration
+	Seed          uint64
+}
+
+// faultInjector draws the faults of calls.
+type faultInjector struct {
+	faults MockFaults
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+func newFaultInjector(faults MockFaults) *faultInjector {
+	return &faultInjector{faults: faults, random: rand.New(rand.NewPCG(faults.Seed, faults.Seed))}
+}
+
+// inject delays the call of method and returns the error it fails with, if any.
+func (f *faultInjector) inject(method string) error {
+	time.Sleep(f.faults.Latency)
+	f.mu.Lock()
+	draw := f.random.Float64()
+	f.mu.Unlock()
+	switch {
+	case draw < f.faults.RateLimitRate:
+		pause := f.faults.RateLimitPause
+		if pause <= 0 {
+			pause = time.Second
+		}
+		return &inwx.ErrorResponse{Code: rateLimitCode, Message: "Request limit exceeded", Reason: fmt.Sprintf("retry in %d seconds", int(pause.Seconds()))}
+	case draw < f.faults.RateLimitRate+f.faults.ErrorRate:
+		return &inwx.ErrorResponse{Code: codeFailed, Message: "Command failed", Reason: "injected fault of " + method}
+	}
+	return nil
+}
+
+// expired tells whether a session logged in at login has expired.
+func (f *faultInjector) expired(login time.Time) bool {
+	return f.faults.SessionExpiry > 0 && time.Since(login) >= f.faults.SessionExpiry
+}
+
+var errSessionExpired = &inwx.ErrorResponse{Code: authenticationErrorCode, Message: "Authentication error", Reason: "session expired"}
+
+// FaultMiddleware injects faults into the calls of the client, ending its session SessionExpiry after every login.
+func FaultMiddleware(faults MockFaults) Middleware {
+	injector := newFaultInjector(faults)
+	mu := sync.Mutex{}
+	login := time.Time{}
+	return Intercept(func(method string, call func() error) error {
+		if err := injector.inject(method); err != nil {
+			return err
+		}
+		mu.Lock()
+		if method == "Login" {
+			login = time.Now()
+		} else if injector.expired(login) {
+			mu.Unlock()
+			return errSessionExpired
+		}
+		mu.Unlock()
+		return call()
+	})
+}
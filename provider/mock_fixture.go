@@ -0,0 +1,65 @@
+package inwx
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+// MockFixture is the initial state of a mock account, such as read from a YAML or JSON file to
+// reproduce a scenario.
+type MockFixture struct {
+	Zones   []MockFixtureZone   `yaml:"zones"`
+	Domains []MockFixtureDomain `yaml:"domains"`
+}
+
+// MockFixtureZone is a zone of a mock account with its records, named relative to the zone as
+// INWX names them: the apex records have an empty name.
+type MockFixtureZone struct {
+	Name    string           `yaml:"name"`
+	Slave   bool             `yaml:"slave"`
+	DNSSEC  bool             `yaml:"dnssec"`
+	Records []TemplateRecord `yaml:"records"`
+}
+
+// MockFixtureDomain is a domain registered with a mock account, never expiring if Expires is zero.
+type MockFixtureDomain struct {
+	Name    string    `yaml:"name"`
+	Expires time.Time `yaml:"expires"`
+}
+
+// LoadFixture adds the zones, records and domains of a fixture, reporting the zones that exist
+// already and the records that could not be created.
+func (w *MockClientWrapper) LoadFixture(fixture *MockFixture) error {
+	errs := []error{}
+	for _, zone := range fixture.Zones {
+		if _, ok := w.db[zone.Name]; ok {
+			errs = append(errs, fmt.Errorf("zone %s already exists", zone.Name))
+			continue
+		}
+		w.AddZone(zone.Name)
+		if zone.Slave {
+			w.slaves = append(w.slaves, zone.Name)
+		}
+		if zone.DNSSEC {
+			_ = w.EnableDNSSEC(zone.Name)
+		}
+		for _, rec := range zone.Records {
+			request := &inwx.NameserverRecordRequest{Domain: zone.Name, Name: rec.Name, Type: rec.Type, Content: rec.Content, TTL: rec.TTL, Priority: rec.Priority}
+			if _, err := w.createRecord(request); err != nil {
+				errs = append(errs, fmt.Errorf("zone %s record %s %s: %w", zone.Name, rec.Name, rec.Type, err))
+			}
+		}
+	}
+	for _, domain := range fixture.Domains {
+		if slices.ContainsFunc(w.domains, func(d inwx.DomainInfoResponse) bool { return d.Domain == domain.Name }) {
+			errs = append(errs, fmt.Errorf("domain %s already registered", domain.Name))
+			continue
+		}
+		w.RegisterDomainUntil(domain.Name, domain.Expires)
+	}
+	return errors.Join(errs...)
+}
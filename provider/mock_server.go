@@ -0,0 +1,390 @@
+package inwx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/kolo/xmlrpc"
+	inwx "github.com/nrdcg/goinwx"
+)
+
+// Result codes of the INWX API returned by the mock server.
+const (
+	codeSuccess       = 1000
+	codeAuthFailed    = 2200
+	codeUnknownMethod = 2101
+	codeParameter     = 2005
+	codeFailed        = 2400
+)
+
+const mockSessionCookie = "domrobot"
+
+// MockServer serves the INWX XML-RPC API backed by a MockClientWrapper, so that the real client,
+// the provider and external-dns can be tested end to end. Calls other than account.login require
+// the session cookie of a login.
+type MockServer struct {
+	mu   sync.Mutex
+	mock *MockClientWrapper
+	// username and password are the credentials accepted by account.login, any if empty
+	username string
+	password string
+	// sessions are the login times of the sessions
+	sessions map[string]time.Time
+	faults   *faultInjector
+	logger   *slog.Logger
+}
+
+// NewMockServer returns the server of mock, accepting logins with username and password or, if
+// they are empty, with any credentials.
+func NewMockServer(mock *MockClientWrapper, username, password string, logger *slog.Logger) *MockServer {
+	return &MockServer{mock: mock, username: username, password: password, sessions: map[string]time.Time{}, faults: newFaultInjector(MockFaults{}), logger: logger}
+}
+
+// SetFaults replaces the faults injected into the calls of the server.
+func (s *MockServer) SetFaults(faults MockFaults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = newFaultInjector(faults)
+}
+
+type mockMethod func(s *MockServer, params map[string]any) (any, error)
+
+var mockMethods = map[string]mockMethod{
+	"account.info":            func(s *MockServer, _ map[string]any) (any, error) { return nil, s.mock.Ping() },
+	"account.logout":          func(s *MockServer, _ map[string]any) (any, error) { return nil, s.mock.Logout() },
+	"nameserver.info":         (*MockServer).nameserverInfo,
+	"nameserver.list":         (*MockServer).nameserverList,
+	"nameserver.create":       (*MockServer).nameserverCreate,
+	"nameserver.clone":        (*MockServer).nameserverClone,
+	"nameserver.createRecord": (*MockServer).createRecord,
+	"nameserver.updateRecord": (*MockServer).updateRecord,
+	"nameserver.deleteRecord": (*MockServer).deleteRecord,
+	"domain.list":             (*MockServer).domainList,
+	"dnssec.info":             (*MockServer).dnssecInfo,
+	"dnssec.listkeys":         (*MockServer).dnssecKeys,
+	"dnssec.enablednssec":     (*MockServer).enableDNSSEC,
+	"message.poll":            (*MockServer).pollMessage,
+	"message.ack":             (*MockServer).ackMessage,
+}
+
+func (s *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	method := xmlrpcMethod(body)
+	params := map[string]any{}
+	if bytes.Contains(body, []byte("<param>")) {
+		if err := xmlrpc.Response(body).Unmarshal(&params); err != nil {
+			http.Error(w, fmt.Sprintf("invalid XML-RPC request: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	faults := s.faults
+	s.mu.Unlock()
+	var response map[string]any
+	if err := faults.inject(method); err != nil {
+		response = errorResponse(err)
+	} else {
+		s.mu.Lock()
+		response = s.call(w, r, method, params)
+		s.mu.Unlock()
+	}
+	s.logger.Debug("mock INWX API call", "method", method, "code", response["code"])
+
+	encoded, err := xmlrpc.EncodeMethodCall("", response)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the encoding of a response only differs from that of a call in its envelope
+	encoded = bytes.Replace(encoded, []byte("<methodCall><methodName></methodName>"), []byte("<methodResponse>"), 1)
+	encoded = bytes.Replace(encoded, []byte("</methodCall>"), []byte("</methodResponse>"), 1)
+	w.Header().Set("Content-Type", "text/xml")
+	_, _ = w.Write(encoded)
+}
+
+// call returns the response of method, the INWX result code and message along with the result data.
+func (s *MockServer) call(w http.ResponseWriter, r *http.Request, method string, params map[string]any) map[string]any {
+	if method == "account.login" {
+		return s.login(w, params)
+	}
+	cookie, err := r.Cookie(mockSessionCookie)
+	if err != nil {
+		return map[string]any{"code": codeAuthFailed, "msg": "Authentication error"}
+	}
+	if login, ok := s.sessions[cookie.Value]; !ok {
+		return map[string]any{"code": codeAuthFailed, "msg": "Authentication error"}
+	} else if s.faults.expired(login) {
+		delete(s.sessions, cookie.Value)
+		return errorResponse(errSessionExpired)
+	}
+	if method == "account.logout" {
+		delete(s.sessions, cookie.Value)
+	}
+	f, ok := mockMethods[method]
+	if !ok {
+		return map[string]any{"code": codeUnknownMethod, "msg": "Command syntax error", "reason": "unknown method " + method}
+	}
+	result, err := f(s, params)
+	if err != nil {
+		return errorResponse(err)
+	}
+	response := map[string]any{"code": codeSuccess, "msg": "Command completed successfully"}
+	if result != nil {
+		response["resData"] = apiValue(reflect.ValueOf(result))
+	}
+	return response
+}
+
+func (s *MockServer) login(w http.ResponseWriter, params map[string]any) map[string]any {
+	if s.username != "" || s.password != "" {
+		if params["user"] != s.username || params["pass"] != s.password {
+			return map[string]any{"code": codeAuthFailed, "msg": "Authentication error"}
+		}
+	}
+	response, err := s.mock.Login()
+	if err != nil {
+		return errorResponse(err)
+	}
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	session := hex.EncodeToString(token)
+	s.sessions[session] = time.Now()
+	http.SetCookie(w, &http.Cookie{Name: mockSessionCookie, Value: session, Path: "/", HttpOnly: true})
+	return map[string]any{"code": codeSuccess, "msg": "Command completed successfully", "resData": apiValue(reflect.ValueOf(response))}
+}
+
+func errorResponse(err error) map[string]any {
+	apiErr := &inwx.ErrorResponse{}
+	if errors.As(err, &apiErr) {
+		return map[string]any{"code": apiErr.Code, "msg": apiErr.Message, "reasonCode": apiErr.ReasonCode, "reason": apiErr.Reason}
+	}
+	return map[string]any{"code": codeFailed, "msg": "Command failed", "reason": err.Error()}
+}
+
+// decodeParams decodes params into a request of goinwx, whose fields are tagged for the structs package.
+func decodeParams(params map[string]any, request any) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{TagName: "structs", WeaklyTypedInput: true, Result: request})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(params); err != nil {
+		return &inwx.ErrorResponse{Code: codeParameter, Message: "Parameter value policy error", Reason: err.Error()}
+	}
+	return nil
+}
+
+// apiValue converts v to the values of an API response: structs become maps keyed like goinwx expects.
+func apiValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return apiValue(v.Elem())
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t
+		}
+		m := map[string]any{}
+		for i := range v.NumField() {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("mapstructure"), ",")
+			if name == "" {
+				name = v.Type().Field(i).Name
+			}
+			m[name] = apiValue(v.Field(i))
+		}
+		return m
+	case reflect.Slice:
+		values := []any{}
+		for i := range v.Len() {
+			values = append(values, apiValue(v.Index(i)))
+		}
+		return values
+	case reflect.Map:
+		m := map[string]any{}
+		for _, key := range v.MapKeys() {
+			m[fmt.Sprint(key.Interface())] = apiValue(v.MapIndex(key))
+		}
+		return m
+	default:
+		return v.Interface()
+	}
+}
+
+func (s *MockServer) nameserverInfo(params map[string]any) (any, error) {
+	request := inwx.NameserverInfoRequest{}
+	if err := decodeParams(params, &request); err != nil {
+		return nil, err
+	}
+	records, err := s.mock.GetRecords(request.Domain)
+	if err != nil {
+		return nil, &inwx.ErrorResponse{Code: 2303, Message: "Object does not exist", Reason: err.Error()}
+	}
+	return &inwx.NameserverInfoResponse{Domain: request.Domain, Type: "MASTER", Count: len(*records), Records: *records}, nil
+}
+
+func (s *MockServer) nameserverList(_ map[string]any) (any, error) {
+	zones, err := s.mock.GetZones()
+	if err != nil {
+		return nil, err
+	}
+	return &inwx.NameserverListResponse{Count: len(*zones), Domains: *zones}, nil
+}
+
+func (s *MockServer) nameserverCreate(params map[string]any) (any, error) {
+	request := inwx.NameserverCreateRequest{}
+	if err := decodeParams(params, &request); err != nil {
+		return nil, err
+	}
+	return map[string]int{"roId": 0}, s.mock.CreateZone(&request)
+}
+
+func (s *MockServer) nameserverClone(params map[string]any) (any, error) {
+	request := struct {
+		SourceDomain string `structs:"sourceDomain"`
+		TargetDomain string `structs:"targetDomain"`
+	}{}
+	if err := decodeParams(params, &request); err != nil {
+		return nil, err
+	}
+	if _, ok := s.mock.db[request.SourceDomain]; !ok {
+		return nil, &inwx.ErrorResponse{Code: 2303, Message: "Object does not exist", Reason: "zone " + request.SourceDomain + " not found"}
+	}
+	if err := s.mock.CloneZone(request.SourceDomain, request.TargetDomain); err != nil {
+		return nil, &inwx.ErrorResponse{Code: 2302, Message: "Object exists", Reason: err.Error()}
+	}
+	return nil, nil
+}
+
+func (s *MockServer) createRecord(params map[string]any) (any, error) {
+	request := inwx.NameserverRecordRequest{}
+	testing := struct {
+		Testing bool `structs:"testing"`
+	}{}
+	if err := errors.Join(decodeParams(params, &request), decodeParams(params, &testing)); err != nil {
+		return nil, err
+	}
+	if testing.Testing {
+		return map[string]int{"id": 0}, s.mock.TestRecord(&request)
+	}
+	id, err := s.mock.createRecord(&request)
+	return map[string]int{"id": id}, err
+}
+
+func (s *MockServer) updateRecord(params map[string]any) (any, error) {
+	request := inwx.NameserverRecordRequest{}
+	id := struct {
+		ID int `structs:"id"`
+	}{}
+	if err := errors.Join(decodeParams(params, &request), decodeParams(params, &id)); err != nil {
+		return nil, err
+	}
+	return nil, s.mock.UpdateRecord(id.ID, &request)
+}
+
+func (s *MockServer) deleteRecord(params map[string]any) (any, error) {
+	id := struct {
+		ID int `structs:"id"`
+	}{}
+	if err := decodeParams(params, &id); err != nil {
+		return nil, err
+	}
+	return nil, s.mock.DeleteRecord(id.ID)
+}
+
+func (s *MockServer) domainList(params map[string]any) (any, error) {
+	request := inwx.DomainListRequest{}
+	if err := decodeParams(params, &request); err != nil {
+		return nil, err
+	}
+	domains, err := s.mock.GetDomains()
+	if err != nil {
+		return nil, err
+	}
+	page := *domains
+	if request.PageLimit > 0 {
+		start := min(max(request.Page-1, 0)*request.PageLimit, len(page))
+		page = page[start:min(start+request.PageLimit, len(page))]
+	}
+	return &inwx.DomainList{Count: len(*domains), Domains: page}, nil
+}
+
+func (s *MockServer) dnssecInfo(params map[string]any) (any, error) {
+	request := struct {
+		Domains []string `structs:"domains"`
+	}{}
+	if err := decodeParams(params, &request); err != nil {
+		return nil, err
+	}
+	statuses, err := s.mock.GetDNSSECStatus(request.Domains)
+	if err != nil {
+		return nil, err
+	}
+	response := &inwx.DNSSecInfoResponse{Data: []inwx.DNSSecInfo{}}
+	for _, domain := range request.Domains {
+		if status, ok := statuses[domain]; ok {
+			response.Data = append(response.Data, inwx.DNSSecInfo{Domain: domain, DNSSecStatus: status, KeyCount: len(s.mock.dnskeys[domain])})
+		}
+	}
+	return response, nil
+}
+
+func (s *MockServer) dnssecKeys(params map[string]any) (any, error) {
+	request := inwx.DNSSecServiceListRequest{}
+	if err := decodeParams(params, &request); err != nil {
+		return nil, err
+	}
+	keys, err := s.mock.GetDNSKeys(request.DomainName)
+	if err != nil {
+		return nil, err
+	}
+	return &inwx.DNSSecServiceList{DNSKeys: keys}, nil
+}
+
+func (s *MockServer) enableDNSSEC(params map[string]any) (any, error) {
+	request := struct {
+		DomainName string `structs:"domainName"`
+	}{}
+	if err := decodeParams(params, &request); err != nil {
+		return nil, err
+	}
+	return nil, s.mock.EnableDNSSEC(request.DomainName)
+}
+
+func (s *MockServer) pollMessage(_ map[string]any) (any, error) {
+	message, err := s.mock.PollMessage()
+	if err != nil || message == nil {
+		return map[string]any{"count": 0}, err
+	}
+	return map[string]any{"count": len(s.mock.messages), "msg": message}, nil
+}
+
+func (s *MockServer) ackMessage(params map[string]any) (any, error) {
+	request := struct {
+		ID int `structs:"id"`
+	}{}
+	if err := decodeParams(params, &request); err != nil {
+		return nil, err
+	}
+	return nil, s.mock.AckMessage(request.ID)
+}
@@ -0,0 +1,225 @@
+package inwx
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+)
+
+// Account is a named INWX account managed by a MultiAccountProvider.
+type Account struct {
+	Name     string
+	Provider *INWXProvider
+}
+
+// MultiAccountProvider manages the zones of several INWX accounts, routing every change to the
+// account holding the zone of its endpoint.
+type MultiAccountProvider struct {
+	provider.BaseProvider
+	accounts []Account
+	// filter is the union of accountFilters, the domain filters of the accounts, guarded by filterMu
+	filterMu       sync.Mutex
+	accountFilters []*endpoint.DomainFilter
+	filter         *endpoint.DomainFilter
+	logger         *slog.Logger
+}
+
+// NewMultiAccountProvider returns the provider of accounts. Zones held by several accounts are managed by the first.
+func NewMultiAccountProvider(accounts []Account, logger *slog.Logger) *MultiAccountProvider {
+	return &MultiAccountProvider{accounts: accounts, logger: logger}
+}
+
+// Accounts returns the accounts of the provider.
+func (m *MultiAccountProvider) Accounts() []Account {
+	return m.accounts
+}
+
+// GetDomainFilter returns the union of the domain filters of the accounts. Exclusions of an
+// account are kept only if no other account includes the excluded domain. The union is built again
+// only once an account returns another domain filter, e.g. after a reload.
+func (m *MultiAccountProvider) GetDomainFilter() endpoint.DomainFilterInterface {
+	accountFilters := []*endpoint.DomainFilter{}
+	for _, account := range m.accounts {
+		df, ok := account.Provider.GetDomainFilter().(*endpoint.DomainFilter)
+		if !ok || !df.IsConfigured() {
+			return &endpoint.DomainFilter{}
+		}
+		accountFilters = append(accountFilters, df)
+	}
+	m.filterMu.Lock()
+	defer m.filterMu.Unlock()
+	if m.filter != nil && slices.Equal(accountFilters, m.accountFilters) {
+		return m.filter
+	}
+
+	filters := []string{}
+	excludes := []string{}
+	for i, account := range m.accounts {
+		filters = append(filters, accountFilters[i].Filters...)
+		account.Provider.configMu.RLock()
+		excludes = append(excludes, account.Provider.excludeDomains...)
+		account.Provider.configMu.RUnlock()
+	}
+	excludes = slices.DeleteFunc(excludes, func(exclude string) bool {
+		return slices.ContainsFunc(accountFilters, func(df *endpoint.DomainFilter) bool {
+			return df.Match(exclude)
+		})
+	})
+	m.accountFilters, m.filter = accountFilters, endpoint.NewDomainFilterWithExclusions(filters, excludes)
+	return m.filter
+}
+
+// AdjustEndpoints normalizes the desired endpoints and drops those at the zone apex of an account
+// managing only subdomains, as every account does.
+func (m *MultiAccountProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	endpoints = adjustEndpoints(endpoints, m.logger)
+	for _, account := range m.accounts {
+		endpoints = account.Provider.withoutApex(endpoints)
+	}
+	return endpoints, nil
+}
+
+func (m *MultiAccountProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	endpoints := []*endpoint.Endpoint{}
+	for _, account := range m.accounts {
+		records, err := account.Provider.Records(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", account.Name, err)
+		}
+		endpoints = append(endpoints, records...)
+	}
+	sortEndpoints(endpoints)
+	return endpoints, nil
+}
+
+func (m *MultiAccountProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	results, err := m.ApplyChangesWithResults(ctx, changes)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to apply %d of %d changes", failed, len(results))
+	}
+	return nil
+}
+
+// ApplyChangesWithResults splits changes by account and applies them like INWXProvider.ApplyChangesWithResults.
+// Endpoints in no zone of any account fail without being sent to an account.
+func (m *MultiAccountProvider) ApplyChangesWithResults(ctx context.Context, changes *plan.Changes) ([]ChangeResult, error) {
+	if !changes.HasChanges() {
+		m.logger.Debug("no changes detected - nothing to do")
+		return nil, nil
+	}
+
+	results, accountChanges, err := m.routeChanges(changes)
+	if err != nil {
+		return nil, err
+	}
+	for i, account := range m.accounts {
+		accountResults, err := account.Provider.ApplyChangesWithResults(ctx, &accountChanges[i])
+		if err != nil {
+			m.logger.Error("failed to apply changes", "account", account.Name, "err", err)
+			accountResults = failedResults(&accountChanges[i], fmt.Errorf("account %s: %w", account.Name, err))
+		}
+		results = append(results, accountResults...)
+	}
+	return results, nil
+}
+
+// PreviewChanges splits changes by account and previews them like INWXProvider.PreviewChanges.
+func (m *MultiAccountProvider) PreviewChanges(ctx context.Context, changes *plan.Changes) ([]ChangeResult, []PreviewOperation, error) {
+	if !changes.HasChanges() {
+		return nil, nil, nil
+	}
+	results, accountChanges, err := m.routeChanges(changes)
+	if err != nil {
+		return nil, nil, err
+	}
+	operations := []PreviewOperation{}
+	for i, account := range m.accounts {
+		accountResults, accountOperations, err := account.Provider.PreviewChanges(ctx, &accountChanges[i])
+		if err != nil {
+			accountResults = failedResults(&accountChanges[i], fmt.Errorf("account %s: %w", account.Name, err))
+		}
+		for _, operation := range accountOperations {
+			operation.Account = account.Name
+			operations = append(operations, operation)
+		}
+		results = append(results, accountResults...)
+	}
+	return results, operations, nil
+}
+
+// routeChanges splits changes by the account holding the zone of their endpoints, returning the
+// failed results of the endpoints in no zone of any account.
+func (m *MultiAccountProvider) routeChanges(changes *plan.Changes) ([]ChangeResult, []plan.Changes, error) {
+	zones := zoneIndex{}
+	for i, account := range m.accounts {
+		accountZones, err := account.Provider.Zones()
+		if err != nil {
+			return nil, nil, fmt.Errorf("account %s: %w", account.Name, err)
+		}
+		for _, zone := range accountZones {
+			if _, ok := zones[zone]; !ok {
+				zones[zone] = i
+			}
+		}
+	}
+
+	results := []ChangeResult{}
+	accountChanges := make([]plan.Changes, len(m.accounts))
+	route := func(action string, ep *endpoint.Endpoint) int {
+		_, i, ok := zones.lookup(ep.DNSName)
+		if !ok {
+			err := fmt.Errorf("%w in any account for the endpoint %s", errNoZone, ep)
+			m.logger.Error("failed to route change to an account", "err", err)
+			results = append(results, ChangeResult{Action: action, Endpoint: ep, Err: err})
+			return -1
+		}
+		return i
+	}
+	for _, ep := range changes.Delete {
+		if i := route("delete", ep); i >= 0 {
+			accountChanges[i].Delete = append(accountChanges[i].Delete, ep)
+		}
+	}
+	for _, ep := range changes.Create {
+		if i := route("create", ep); i >= 0 {
+			accountChanges[i].Create = append(accountChanges[i].Create, ep)
+		}
+	}
+	for j, oldEp := range changes.UpdateOld {
+		if i := route("update", changes.UpdateNew[j]); i >= 0 {
+			accountChanges[i].UpdateOld = append(accountChanges[i].UpdateOld, oldEp)
+			accountChanges[i].UpdateNew = append(accountChanges[i].UpdateNew, changes.UpdateNew[j])
+		}
+	}
+
+	return results, accountChanges, nil
+}
+
+func failedResults(changes *plan.Changes, err error) []ChangeResult {
+	results := []ChangeResult{}
+	for _, ep := range changes.Delete {
+		results = append(results, ChangeResult{Action: "delete", Endpoint: ep, Err: err})
+	}
+	for _, ep := range changes.Create {
+		results = append(results, ChangeResult{Action: "create", Endpoint: ep, Err: err})
+	}
+	for _, ep := range changes.UpdateNew {
+		results = append(results, ChangeResult{Action: "update", Endpoint: ep, Err: err})
+	}
+	return results
+}
@@ -0,0 +1,40 @@
+package inwx
+
+import (
+	"strings"
+)
+
+// recordDNSName returns the fully qualified name of a record named relative to zone: the zone for
+// the apex, named "" or "@", and names ending in a dot as they are. The records of classless reverse
+// zones are named in their parent zone, as the addresses they resolve.
+func recordDNSName(zone string, name string) string {
+	switch {
+	case name == "" || name == "@":
+		return zone
+	case strings.HasSuffix(name, "."):
+		return strings.TrimSuffix(name, ".")
+	}
+	if parent, _, _, ok := classlessZone(zone); ok {
+		return name + "." + parent
+	}
+	return name + "." + zone
+}
+
+// relativeName returns the name of the record of dnsName relative to zone, "" for the apex. Only the
+// zone at the end of dnsName is removed, so that names repeating the zone in a label, such as
+// example.com.example.com, keep the repeat.
+func relativeName(zone string, dnsName string) string {
+	dnsName = strings.TrimSuffix(dnsName, ".")
+	if strings.EqualFold(dnsName, zone) {
+		return ""
+	}
+	if parent, _, _, ok := classlessZone(zone); ok {
+		if name := relativeName(parent, dnsName); name != dnsName {
+			return name
+		}
+	}
+	if suffix := len(dnsName) - len(zone) - 1; suffix > 0 && dnsName[suffix] == '.' && strings.EqualFold(dnsName[suffix+1:], zone) {
+		return dnsName[:suffix]
+	}
+	return dnsName
+}
@@ -0,0 +1,82 @@
+package inwx
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// hostnameTypes are the record types whose target ends in a host name, which INWX stores in lower
+// case without the trailing dot.
+var hostnameTypes = []string{"CNAME", "MX", "NS", "PTR", "SRV"}
+
+// normalizeTarget returns the target as INWX stores it, so that targets sent with a trailing dot or
+// in another case compare equal to the records and are not updated over and over.
+func normalizeTarget(recordType string, target string) string {
+	if !slices.Contains(hostnameTypes, recordType) {
+		return target
+	}
+	fields := strings.Fields(target)
+	if len(fields) == 0 {
+		return target
+	}
+	fields[len(fields)-1] = strings.ToLower(strings.TrimSuffix(fields[len(fields)-1], "."))
+	return strings.Join(fields, " ")
+}
+
+// normalizeEndpoints normalizes the targets of endpoints in place.
+func normalizeEndpoints(endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	for _, ep := range endpoints {
+		for i, target := range ep.Targets {
+			ep.Targets[i] = normalizeTarget(ep.RecordType, target)
+		}
+	}
+	return endpoints
+}
+
+// normalizeDNSName returns the name of an endpoint as INWX stores it, with the asterisk of wildcard
+// names escaped by some sources, as in \052.apps.example.com, unescaped.
+func normalizeDNSName(dnsName string) string {
+	return strings.TrimSuffix(strings.ReplaceAll(dnsName, `\052`, "*"), ".")
+}
+
+// validateWildcard checks that an asterisk in a name is the whole first label, the only wildcard
+// INWX and DNS resolvers support.
+func validateWildcard(dnsName string) error {
+	labels := strings.Split(dnsName, ".")
+	if slices.ContainsFunc(labels[1:], func(label string) bool { return strings.Contains(label, "*") }) {
+		return errors.New("the wildcard must be the first label")
+	}
+	if strings.Contains(labels[0], "*") && labels[0] != "*" {
+		return errors.New("the wildcard must be a whole label")
+	}
+	return nil
+}
+
+// adjustEndpoints normalizes the names and targets of the desired endpoints the way Records returns
+// them, so that external-dns plans no changes for endpoints INWX stores differently. Endpoints with
+// invalid wildcard names or targets are left out, as INWX would refuse them.
+func adjustEndpoints(endpoints []*endpoint.Endpoint, logger *slog.Logger) []*endpoint.Endpoint {
+	adjusted := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		ep.DNSName = normalizeDNSName(ep.DNSName)
+		if err := validateWildcard(ep.DNSName); err != nil {
+			logger.Warn("ignoring endpoint with an invalid wildcard name", "name", ep.DNSName, "type", ep.RecordType, "err", err)
+			continue
+		}
+		if err := validateContent(ep); err != nil {
+			logger.Warn("ignoring endpoint with an invalid target", "name", ep.DNSName, "type", ep.RecordType, "err", err)
+			continue
+		}
+		adjusted = append(adjusted, ep)
+	}
+	return normalizeEndpoints(adjusted)
+}
+
+// AdjustEndpoints normalizes the desired endpoints the way Records returns them.
+func (p *INWXProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	return p.withoutApex(adjustEndpoints(endpoints, p.logger)), nil
+}
@@ -0,0 +1,94 @@
+package inwx
+
+import (
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const recordTypeTemplate = "%{record_type}"
+
+// OwnershipGuard only lets records be updated or deleted if they are owned according to the
+// external-dns TXT registry stored in the same zone.
+type OwnershipGuard struct {
+	prefix  string
+	ownerID string
+}
+
+// NewOwnershipGuard returns the guard of the TXT registry of external-dns with the given --txt-prefix and --txt-owner-id.
+func NewOwnershipGuard(prefix string, ownerID string) *OwnershipGuard {
+	return &OwnershipGuard{prefix: strings.ToLower(prefix), ownerID: ownerID}
+}
+
+// owns reports whether ep is an ownership record of the owner itself or has one in the zone records.
+func (g *OwnershipGuard) owns(records *zoneRecords, ep *endpoint.Endpoint) bool {
+	if ep.RecordType == endpoint.RecordTypeTXT && g.isOwnershipRecord(ep.Targets...) {
+		return true
+	}
+	for _, txtName := range g.txtNames(ep.DNSName, ep.RecordType) {
+		if g.isOwnershipRecord(records.txt[txtName]...) {
+			return true
+		}
+	}
+	return false
+}
+
+// txtNames returns the names of the registry records that may own the given record, in the
+// current external-dns format and the legacy format without record type.
+func (g *OwnershipGuard) txtNames(dnsName string, recordType string) []string {
+	dnsName = strings.ToLower(strings.TrimSuffix(dnsName, "."))
+	recordType = strings.ToLower(recordType)
+	labels := strings.SplitN(dnsName, ".", 2)
+	if strings.Contains(g.prefix, recordTypeTemplate) {
+		labels[0] = strings.ReplaceAll(g.prefix, recordTypeTemplate, recordType) + labels[0]
+	} else {
+		labels[0] = g.prefix + recordType + "-" + labels[0]
+	}
+	return []string{
+		strings.Join(labels, "."),
+		strings.ReplaceAll(g.prefix, recordTypeTemplate, "") + dnsName,
+	}
+}
+
+func (g *OwnershipGuard) isOwnershipRecord(contents ...string) bool {
+	for _, content := range contents {
+		if owner, ok := registryOwner(content); ok && owner == g.ownerID {
+			return true
+		}
+	}
+	return false
+}
+
+// registered reports whether ep is an ownership record or has one of any owner among the
+// contents of the TXT records by lower-case fully qualified name.
+func (g *OwnershipGuard) registered(txt map[string][]string, ep *endpoint.Endpoint) bool {
+	contents := [][]string{}
+	if ep.RecordType == endpoint.RecordTypeTXT {
+		contents = append(contents, ep.Targets)
+	}
+	for _, txtName := range g.txtNames(ep.DNSName, ep.RecordType) {
+		contents = append(contents, txt[txtName])
+	}
+	for _, content := range slices.Concat(contents...) {
+		if _, ok := registryOwner(content); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// registryOwner returns the owner of a TXT registry record of external-dns, or false if the
+// content is not one.
+func registryOwner(content string) (string, bool) {
+	var heritage, hasOwner bool
+	var owner string
+	for _, label := range strings.Split(strings.Trim(content, `"`), ",") {
+		if label == "heritage=external-dns" {
+			heritage = true
+		} else if value, ok := strings.CutPrefix(label, "external-dns/owner="); ok {
+			owner, hasOwner = value, true
+		}
+	}
+	return owner, heritage && hasOwner
+}
@@ -0,0 +1,43 @@
+package inwx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// pauseLabel is the name of the TXT record below a zone apex pausing the management of the zone, with
+// the reason of the pause as content, e.g. _external-dns-inwx-paused.example.com.
+const pauseLabel = "_external-dns-inwx-paused"
+
+// SetPausedZones replaces the zones paused by configuration, e.g. on reload.
+func (p *INWXProvider) SetPausedZones(zones []string) {
+	p.sessionMu.Lock()
+	defer p.sessionMu.Unlock()
+	p.pausedZones = normalizeZones(zones)
+}
+
+// pause returns why the management of a zone is paused, paused by configuration or by a pause TXT
+// record among its records, or false if it is not paused. The records are not fetched if the zone is
+// paused by configuration.
+func (p *INWXProvider) pause(zone string, zoneRecords func() (*zoneRecords, error)) (string, bool) {
+	if slices.Contains(p.pausedZones, zone) {
+		return "paused by configuration", true
+	}
+	records, err := zoneRecords()
+	if err != nil {
+		return "", false
+	}
+	if reasons, ok := records.txt[pauseLabel+"."+zone]; ok {
+		return "paused by " + pauseLabel + " record " + strings.Join(reasons, " "), true
+	}
+	return "", false
+}
+
+// pauseBatch fails every change of a batch of a paused zone, leaving its records untouched.
+func (p *INWXProvider) pauseBatch(batch *zoneBatch, results []ChangeResult, reason string) {
+	p.logger.Warn("refusing to change the records of a paused zone", "zone", batch.zone, "reason", reason)
+	for _, change := range batch.changes() {
+		results[change.result].Err = fmt.Errorf("refusing to change endpoint %s of zone %s %s, %w", change.ep, batch.zone, reason, errPaused)
+	}
+}
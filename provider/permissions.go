@@ -0,0 +1,85 @@
+package inwx
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+// permissionDeniedCode is the INWX error code of calls the account is not authorized for, e.g. the
+// record changes of a sub-account with restricted permissions.
+const permissionDeniedCode = 2201
+
+// The permissions checked by CheckPermissions.
+const (
+	// PermissionRead lists the zones and their records
+	PermissionRead = "read"
+	// PermissionWrite changes the records of the zones
+	PermissionWrite = "write"
+)
+
+// permissionCheckName is the name of the TXT record whose creation CheckPermissions validates.
+const permissionCheckName = "_external-dns-inwx-permission-check"
+
+// PermissionError fails a call INWX refused as the account lacks the permission, e.g. a sub-account
+// allowed to list but not to change records.
+type PermissionError struct {
+	// Method is the method of AbstractClientWrapper refused, e.g. CreateRecord
+	Method string
+	Err    error
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("the INWX account is not permitted to %s: %s", e.Method, e.Err)
+}
+
+func (e *PermissionError) Unwrap() error {
+	return e.Err
+}
+
+// permissionErrors returns the middleware failing the calls refused for a lack of permission with a
+// PermissionError, counting them in the permission_denied_total metric by method.
+func permissionErrors() Middleware {
+	return Intercept(func(method string, call func() error) error {
+		err := call()
+		var response *inwx.ErrorResponse
+		if errors.As(err, &response) && response.Code == permissionDeniedCode {
+			permissionDeniedTotal.WithLabelValues(method).Inc()
+			return &PermissionError{Method: method, Err: err}
+		}
+		return err
+	})
+}
+
+// CheckPermissions logs into INWX and checks that the account has permissions, e.g. a sub-account
+// with restricted permissions at startup: read lists the zones and the records of the first managed
+// zone, write validates the creation of a TXT record in it in the testing mode of INWX, which creates
+// nothing.
+func (p *INWXProvider) CheckPermissions(permissions []string) error {
+	logout, err := p.login()
+	if err != nil {
+		return err
+	}
+	defer logout()
+
+	zones, err := p.getZones()
+	if err != nil {
+		return err
+	}
+	if len(*zones) == 0 {
+		return fmt.Errorf("no managed zones to check the permissions in")
+	}
+	zone := slices.Min(*zones)
+	if _, err := p.client.GetRecords(zone); err != nil {
+		return err
+	}
+	if slices.Contains(permissions, PermissionWrite) {
+		request := &inwx.NameserverRecordRequest{Domain: zone, Name: permissionCheckName, Type: "TXT", Content: "permission check", TTL: 300}
+		if err := p.client.TestRecord(request); err != nil {
+			return fmt.Errorf("failed to validate a record in zone %s: %w", zone, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package inwx
+
+import (
+	"context"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// prefetch is a listing of the records running in the background.
+type prefetch struct {
+	done      chan struct{}
+	endpoints []*endpoint.Endpoint
+	err       error
+}
+
+// Prefetch lists the records of the managed zones in the background, e.g. right after a start, so
+// that the next Records call takes over the listing instead of starting with a large account.
+func (p *INWXProvider) Prefetch() {
+	pf := &prefetch{done: make(chan struct{})}
+	p.prefetched.Store(pf)
+	go func() {
+		defer close(pf.done)
+		start := time.Now()
+		if pf.endpoints, pf.err = p.listRecords(context.Background()); pf.err != nil {
+			p.logger.Error("failed to prefetch records", "err", pf.err)
+			return
+		}
+		p.logger.Info("prefetched records", "endpoints", len(pf.endpoints), "duration", time.Since(start))
+	}()
+}
+
+// takePrefetch returns the records of a prefetch not taken yet, waiting for it to finish; false if
+// there is none or it failed.
+func (p *INWXProvider) takePrefetch(ctx context.Context) ([]*endpoint.Endpoint, bool, error) {
+	pf := p.prefetched.Swap(nil)
+	if pf == nil {
+		return nil, false, nil
+	}
+	select {
+	case <-pf.done:
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+	return pf.endpoints, pf.err == nil, nil
+}
+
+// fetchRecords lists the records from INWX, taking over a prefetch, and keeps them in the cache file.
+func (p *INWXProvider) fetchRecords(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	endpoints, ok, err := p.takePrefetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if p.shared != nil {
+			endpoints, err = p.sharedRecords(ctx)
+		} else {
+			endpoints, err = p.listRecords(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.cache != nil {
+		if err := p.cache.save(endpoints); err != nil {
+			p.logger.Warn("failed to save records cache", "path", p.cache.path, "err", err)
+		}
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,138 @@
+package inwx
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	inwx "github.com/nrdcg/goinwx"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// PreviewOperation is a record operation of the INWX API that applying changes would execute.
+type PreviewOperation struct {
+	// Account is the account of the zone, only set by MultiAccountProvider
+	Account string
+	Zone    string
+	// Action is one of create, update or delete, or test for a creation validated in the testing mode of INWX
+	Action string
+	// ID is the ID of the record updated or deleted, 0 for creates
+	ID int
+	// Before is the record updated or deleted, After the record created or updated as requested;
+	// a TTL of 0 is the default TTL of INWX
+	Before *inwx.NameserverRecord
+	After  *inwx.NameserverRecord
+}
+
+// PreviewChanges returns the result of every change and the record operations applying changes would
+// execute, without executing them. Missing zones are not created and no snapshots are saved.
+func (p *INWXProvider) PreviewChanges(ctx context.Context, changes *plan.Changes) ([]ChangeResult, []PreviewOperation, error) {
+	if !changes.HasChanges() {
+		return nil, nil, nil
+	}
+	logout, err := p.login()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer logout()
+
+	zones, err := p.getZones()
+	if err != nil {
+		return nil, nil, err
+	}
+	index := p.zoneIndexOf(*zones)
+
+	client := &previewClientWrapper{AbstractClientWrapper: p.client, zones: map[string][]inwx.NameserverRecord{}}
+	// the settings read by applying changes, guarded by sessionMu like those of p
+	preview := &INWXProvider{
+		client:              client,
+		domainFilter:        p.domainFilter,
+		defaultTTL:          p.defaultTTL,
+		deletionGracePeriod: p.deletionGracePeriod,
+		pausedZones:         p.pausedZones,
+		ownership:           p.ownership,
+		logger:              p.logger.With("preview", true),
+	}
+	results, batches := preview.zoneBatches(index, changes)
+	// the operations previewed do not fail, so the changes are never aborted
+	budget := &applyBudget{}
+	for _, batch := range batches {
+		preview.applyBatch(batch, results, budget)
+	}
+	return results, client.operations, nil
+}
+
+// previewClientWrapper records the record operations instead of executing them, answering the records
+// of zones with the operations recorded applied.
+type previewClientWrapper struct {
+	AbstractClientWrapper
+	// zones are the records of the zones fetched, with the operations recorded applied
+	zones      map[string][]inwx.NameserverRecord
+	operations []PreviewOperation
+	// created numbers the records created from -1 down, which INWX never uses
+	created int
+}
+
+func (w *previewClientWrapper) GetRecords(domain string) (*[]inwx.NameserverRecord, error) {
+	if _, ok := w.zones[domain]; !ok {
+		records, err := w.AbstractClientWrapper.GetRecords(domain)
+		if err != nil {
+			return nil, err
+		}
+		w.zones[domain] = slices.Clone(*records)
+	}
+	records := slices.Clone(w.zones[domain])
+	return &records, nil
+}
+
+func (w *previewClientWrapper) CreateRecord(request *inwx.NameserverRecordRequest) error {
+	w.created--
+	rec := inwx.NameserverRecord{ID: w.created, Name: request.Name, Type: request.Type, Content: request.Content, TTL: request.TTL, Priority: request.Priority}
+	if records, ok := w.zones[request.Domain]; ok {
+		w.zones[request.Domain] = append(records, rec)
+	}
+	w.operations = append(w.operations, PreviewOperation{Zone: request.Domain, Action: "create", After: &rec})
+	return nil
+}
+
+func (w *previewClientWrapper) TestRecord(request *inwx.NameserverRecordRequest) error {
+	rec := inwx.NameserverRecord{Name: request.Name, Type: request.Type, Content: request.Content, TTL: request.TTL, Priority: request.Priority}
+	w.operations = append(w.operations, PreviewOperation{Zone: request.Domain, Action: "test", After: &rec})
+	return nil
+}
+
+func (w *previewClientWrapper) UpdateRecord(recID int, request *inwx.NameserverRecordRequest) error {
+	zone, i, err := w.record(recID)
+	if err != nil {
+		return err
+	}
+	before := w.zones[zone][i]
+	after := inwx.NameserverRecord{ID: recID, Name: request.Name, Type: request.Type, Content: request.Content, TTL: request.TTL, Priority: request.Priority}
+	if after.TTL == 0 {
+		after.TTL = before.TTL
+	}
+	w.zones[zone][i] = after
+	w.operations = append(w.operations, PreviewOperation{Zone: zone, Action: "update", ID: recID, Before: &before, After: &after})
+	return nil
+}
+
+func (w *previewClientWrapper) DeleteRecord(recID int) error {
+	zone, i, err := w.record(recID)
+	if err != nil {
+		return err
+	}
+	before := w.zones[zone][i]
+	w.zones[zone] = slices.Delete(w.zones[zone], i, i+1)
+	w.operations = append(w.operations, PreviewOperation{Zone: zone, Action: "delete", ID: recID, Before: &before})
+	return nil
+}
+
+// record returns the zone and index of the record with an ID among the records fetched.
+func (w *previewClientWrapper) record(recID int) (string, int, error) {
+	for zone, records := range w.zones {
+		if i := slices.IndexFunc(records, func(rec inwx.NameserverRecord) bool { return rec.ID == recID }); i >= 0 {
+			return zone, i, nil
+		}
+	}
+	return "", 0, fmt.Errorf("record %d not found", recID)
+}
@@ -0,0 +1,36 @@
+package inwx
+
+import (
+	"strconv"
+	"strings"
+)
+
+// priorityFields are the number of fields of the targets of the record types with a priority, which
+// external-dns puts in front of the target while INWX keeps it apart from the content.
+var priorityFields = map[string]int{"MX": 2, "SRV": 4}
+
+// recordTarget returns the normalized endpoint target of a record, the content with the priority in
+// front for the record types with a priority. Contents holding a priority already are kept.
+func recordTarget(recordType string, content string, priority int) string {
+	content = normalizeTarget(recordType, content)
+	fields, ok := priorityFields[recordType]
+	if !ok || len(strings.Fields(content)) >= fields {
+		return content
+	}
+	return strconv.Itoa(priority) + " " + content
+}
+
+// splitPriority returns the content and priority of the record of a normalized endpoint target, the
+// target and 0 for record types without a priority.
+func splitPriority(recordType string, target string) (string, int) {
+	target = normalizeTarget(recordType, target)
+	fields := strings.Fields(target)
+	if n, ok := priorityFields[recordType]; !ok || len(fields) != n {
+		return target, 0
+	}
+	priority, err := strconv.Atoi(fields[0])
+	if err != nil || priority < 0 {
+		return target, 0
+	}
+	return strings.Join(fields[1:], " "), priority
+}
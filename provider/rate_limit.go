@@ -0,0 +1,122 @@
+package inwx
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// rateLimitCode is the result code of INWX API responses refused for exceeding the request limit
+	rateLimitCode = 2502
+	// defaultRateLimitPause applies if a rate-limit response gives no retry hint
+	defaultRateLimitPause = 30 * time.Second
+	// maxRateLimitPause bounds the retry hint of a rate-limit response
+	maxRateLimitPause = 5 * time.Minute
+)
+
+var (
+	resultCode = regexp.MustCompile(`<name>\s*code\s*</name>\s*<value>\s*<(?:int|i4)>\s*(\d+)\s*</(?:int|i4)>`)
+	retryHint  = regexp.MustCompile(`(?i)(\d+)\s*(?:seconds|second|secs|sec|s)\b`)
+)
+
+// rateLimitedTransport pauses all requests after INWX refused one for exceeding the request limit,
+// retrying that request once the pause is over.
+type rateLimitedTransport struct {
+	next http.RoundTripper
+	// pausedUntil is the end of the current pause in Unix nanoseconds
+	pausedUntil atomic.Int64
+	logger      *slog.Logger
+}
+
+func (t *rateLimitedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(r); err != nil {
+			return nil, err
+		}
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := t.next.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		pause, limited, err := rateLimited(resp)
+		if err != nil || !limited {
+			return resp, err
+		}
+		rateLimitedTotal.Inc()
+		t.pausedUntil.Store(time.Now().Add(pause).UnixNano())
+		if attempt > 0 {
+			t.logger.Warn("INWX API rate limit exceeded again, giving up", "method", xmlrpcMethod(body), "pause", pause)
+			return resp, nil
+		}
+		t.logger.Warn("INWX API rate limit exceeded, pausing requests", "method", xmlrpcMethod(body), "pause", pause)
+		_ = resp.Body.Close()
+	}
+}
+
+// wait blocks until the current pause is over or the request is canceled.
+func (t *rateLimitedTransport) wait(r *http.Request) error {
+	pause := time.Until(time.Unix(0, t.pausedUntil.Load()))
+	if pause <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+		return r.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateLimited tells whether resp refuses a request for exceeding the request limit, and for how
+// long requests should pause; the body of resp is restored for the caller.
+func rateLimited(resp *http.Response) (time.Duration, bool, error) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return retryAfter(resp.Header.Get("Retry-After"), time.Now()), true, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return 0, false, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	match := resultCode.FindSubmatch(body)
+	if match == nil || string(match[1]) != strconv.Itoa(rateLimitCode) {
+		return 0, false, nil
+	}
+	pause := defaultRateLimitPause
+	if hint := retryHint.FindSubmatch(body); hint != nil {
+		seconds, _ := strconv.Atoi(string(hint[1]))
+		pause = time.Duration(seconds) * time.Second
+	}
+	return min(pause, maxRateLimitPause), true, nil
+}
+
+// retryAfter returns the pause a Retry-After header asks for, in seconds or as an HTTP date.
+func retryAfter(value string, now time.Time) time.Duration {
+	pause := defaultRateLimitPause
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		pause = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		pause = date.Sub(now)
+	}
+	return max(0, min(pause, maxRateLimitPause))
+}
@@ -0,0 +1,53 @@
+package inwx
+
+import (
+	"log/slog"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+// ReadOnlyClientWrapper passes reads through to the wrapped client and only logs mutations.
+type ReadOnlyClientWrapper struct {
+	AbstractClientWrapper
+	logger *slog.Logger
+}
+
+func (w *ReadOnlyClientWrapper) CreateZone(request *inwx.NameserverCreateRequest) error {
+	w.logger.Info("read-only mode, skipping zone creation", "domain", request.Domain, "type", request.Type, "nameservers", request.Nameservers)
+	return nil
+}
+
+func (w *ReadOnlyClientWrapper) CloneZone(source string, target string) error {
+	w.logger.Info("read-only mode, skipping zone cloning", "source", source, "target", target)
+	return nil
+}
+
+func (w *ReadOnlyClientWrapper) EnableDNSSEC(domain string) error {
+	w.logger.Info("read-only mode, skipping DNSSEC enablement", "domain", domain)
+	return nil
+}
+
+func (w *ReadOnlyClientWrapper) AckMessage(id int) error {
+	w.logger.Info("read-only mode, skipping account message acknowledgement", "id", id)
+	return nil
+}
+
+func (w *ReadOnlyClientWrapper) CreateRecord(request *inwx.NameserverRecordRequest) error {
+	w.logger.Info("read-only mode, skipping record creation", "domain", request.Domain, "name", request.Name, "type", request.Type, "content", request.Content, "prio", request.Priority, "ttl", request.TTL)
+	return nil
+}
+
+func (w *ReadOnlyClientWrapper) TestRecord(request *inwx.NameserverRecordRequest) error {
+	w.logger.Info("read-only mode, skipping record validation in testing mode", "domain", request.Domain, "name", request.Name, "type", request.Type, "content", request.Content, "prio", request.Priority, "ttl", request.TTL)
+	return nil
+}
+
+func (w *ReadOnlyClientWrapper) UpdateRecord(recID int, request *inwx.NameserverRecordRequest) error {
+	w.logger.Info("read-only mode, skipping record update", "id", recID, "domain", request.Domain, "name", request.Name, "type", request.Type, "content", request.Content, "prio", request.Priority, "ttl", request.TTL)
+	return nil
+}
+
+func (w *ReadOnlyClientWrapper) DeleteRecord(recID int) error {
+	w.logger.Info("read-only mode, skipping record deletion", "id", recID)
+	return nil
+}
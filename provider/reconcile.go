@@ -0,0 +1,47 @@
+package inwx
+
+import (
+	"context"
+	"time"
+)
+
+// Reconcile lists the records of the managed zones from INWX at every multiple of interval since the
+// epoch, e.g. at every full hour for 1h, until ctx is done, like a cron schedule. Every listing
+// refreshes the records cache and the zone metrics and reports drift like DetectDrift, so that they
+// stay current while external-dns syncs rarely or not at all.
+func (p *INWXProvider) Reconcile(ctx context.Context, interval time.Duration) error {
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(interval).Add(interval).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+		if err := p.reconcile(ctx); err != nil {
+			p.logger.Error("failed to reconcile managed zones", "err", err)
+		}
+	}
+}
+
+func (p *INWXProvider) reconcile(ctx context.Context) error {
+	start := time.Now()
+	endpoints, err := p.listRecords(ctx)
+	if err == nil {
+		err = p.detectDrift()
+	}
+	if err != nil {
+		reconciliationsTotal.WithLabelValues("error").Inc()
+		return err
+	}
+	if p.cache != nil {
+		if err := p.cache.save(endpoints); err != nil {
+			p.logger.Warn("failed to save records cache", "path", p.cache.path, "err", err)
+		}
+	}
+	reconciliationsTotal.WithLabelValues("success").Inc()
+	lastReconciliation.SetToCurrentTime()
+	p.logger.Info("reconciled managed zones", "endpoints", len(endpoints), "duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,51 @@
+package inwx
+
+import (
+	"strings"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+// recordKey identifies the records of a zone with the same name, type and content.
+type recordKey struct {
+	dnsName    string
+	recordType string
+	content    string
+}
+
+// zoneRecords are the records of a zone, indexed when the zone is fetched so that looking up the
+// records of an endpoint does not scan the whole zone.
+type zoneRecords struct {
+	// ids are the record IDs by fully qualified name, type and content
+	ids map[recordKey][]int
+	// txt are the contents of the TXT records by lower-case fully qualified name
+	txt map[string][]string
+	// apex is the zone, whose records getRecIDs refuses to look up if protectApex is set
+	apex        string
+	protectApex bool
+}
+
+func newZoneRecords(zone string, records *[]inwx.NameserverRecord) *zoneRecords {
+	z := &zoneRecords{ids: make(map[recordKey][]int, len(*records)), txt: map[string][]string{}, apex: zone}
+	for _, rec := range *records {
+		dnsName := recordDNSName(zone, rec.Name)
+		key := recordKey{dnsName: dnsName, recordType: rec.Type, content: recordTarget(rec.Type, rec.Content, rec.Priority)}
+		z.ids[key] = append(z.ids[key], rec.ID)
+		if rec.Type == "TXT" {
+			name := strings.ToLower(dnsName)
+			z.txt[name] = append(z.txt[name], rec.Content)
+		}
+	}
+	return z
+}
+
+// byName returns the IDs of the records of a fully qualified name and type by content.
+func (z *zoneRecords) byName(dnsName string, recordType string) map[string][]int {
+	contents := map[string][]int{}
+	for key, ids := range z.ids {
+		if key.recordType == recordType && strings.EqualFold(key.dnsName, dnsName) {
+			contents[key.content] = append(contents[key.content], ids...)
+		}
+	}
+	return contents
+}
@@ -0,0 +1,18 @@
+package inwx
+
+// recordLimitWarningRatio is the share of the zone record limit from which zones are warned about.
+const recordLimitWarningRatio = 0.9
+
+// reportRecordCount exports the number of records of a zone, warning if it comes close to the zone
+// record limit, as creates fail once it is reached.
+func (p *INWXProvider) reportRecordCount(zone string, count int) {
+	zoneRecordCount.WithLabelValues(zone).Set(float64(count))
+	if p.zoneRecordLimit == 0 {
+		return
+	}
+	zoneRecordLimit.WithLabelValues(zone).Set(float64(p.zoneRecordLimit))
+	if float64(count) >= recordLimitWarningRatio*float64(p.zoneRecordLimit) {
+		p.logger.Warn("zone is close to the record limit of INWX, creating records fails once it is reached",
+			"zone", zone, "records", count, "limit", p.zoneRecordLimit)
+	}
+}
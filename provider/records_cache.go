@@ -0,0 +1,109 @@
+package inwx
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// recordsCache keeps the endpoints last listed in a file, so that a restarted provider answers its
+// first Records calls from the file while the records are refreshed from INWX in the background.
+type recordsCache struct {
+	path string
+	mu   sync.Mutex
+	// loaded is set once the file was read at the first Records call
+	loaded bool
+	// stale are the endpoints of the file served until the refresh is done, nil afterwards
+	stale []*endpoint.Endpoint
+}
+
+type recordsCacheFile struct {
+	Updated   time.Time            `json:"updated"`
+	Endpoints []*endpoint.Endpoint `json:"endpoints"`
+}
+
+func newRecordsCache(path string) *recordsCache {
+	if path == "" {
+		return nil
+	}
+	return &recordsCache{path: path}
+}
+
+// staleRecords returns the endpoints of the file while they are being refreshed, starting refresh at
+// the first call if the file exists, and false once INWX answered.
+func (c *recordsCache) staleRecords(refresh func() error, logger *slog.Logger) ([]*endpoint.Endpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.loaded {
+		c.loaded = true
+		file, err := c.read()
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				logger.Warn("failed to read records cache, listing records from INWX", "path", c.path, "err", err)
+			}
+			reportCacheLookup(cacheRecordsFile, false)
+			return nil, false
+		}
+		logger.Warn("serving stale records from the cache while refreshing them from INWX", "path", c.path, "updated", file.Updated, "endpoints", len(file.Endpoints))
+		c.stale = file.Endpoints
+		reportCacheUpdate(cacheRecordsFile, len(file.Endpoints), file.Updated)
+		recordsCacheStale.Set(1)
+		go func() {
+			err := refresh()
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if err != nil {
+				logger.Warn("failed to refresh the cached records from INWX, listing records from INWX", "err", err)
+			}
+			c.stale = nil
+			recordsCacheStale.Set(0)
+		}()
+	}
+	reportCacheLookup(cacheRecordsFile, c.stale != nil)
+	return c.stale, c.stale != nil
+}
+
+func (c *recordsCache) read() (*recordsCacheFile, error) {
+	content, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	file := &recordsCacheFile{}
+	if err := json.Unmarshal(content, file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// save replaces the file with endpoints atomically.
+func (c *recordsCache) save(endpoints []*endpoint.Endpoint) error {
+	updated := time.Now().UTC()
+	content, err := json.Marshal(recordsCacheFile{Updated: updated, Endpoints: endpoints})
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	if _, err := f.Write(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), c.path); err != nil {
+		return err
+	}
+	reportCacheUpdate(cacheRecordsFile, len(endpoints), updated)
+	return nil
+}
@@ -0,0 +1,114 @@
+package inwx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"regexp"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// redactedContentPrefix marks record content replaced by RedactContent.
+const redactedContentPrefix = "sha256:"
+
+// contentLogKeys are the keys of log attributes holding record content.
+var contentLogKeys = []string{"content", "target"}
+
+// RedactContent returns the record content replaced by a prefix of its SHA-256 hash, so that log lines
+// about the same content can still be correlated without revealing it, e.g. verification tokens and
+// ACME challenges in TXT records.
+func RedactContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return redactedContentPrefix + hex.EncodeToString(sum[:8])
+}
+
+// redactEndpoint returns ep as logged, with its targets redacted.
+func redactEndpoint(ep *endpoint.Endpoint) string {
+	redacted := ep.DeepCopy()
+	for i, target := range redacted.Targets {
+		redacted.Targets[i] = RedactContent(target)
+	}
+	return redacted.String()
+}
+
+// RedactingHandler redacts record content from the log records passed to the wrapped handler: the
+// values of content and target attributes and the targets of endpoints, keeping names and types.
+type RedactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler returns a handler redacting record content before passing records to next.
+func NewRedactingHandler(next slog.Handler) *RedactingHandler {
+	return &RedactingHandler{next: next}
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		redacted = append(redacted, redactAttr(attr))
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name)}
+}
+
+func redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindGroup:
+		attrs := []any{}
+		for _, member := range value.Group() {
+			attrs = append(attrs, redactAttr(member))
+		}
+		return slog.Group(attr.Key, attrs...)
+	case slog.KindString:
+		for _, key := range contentLogKeys {
+			if attr.Key == key {
+				return slog.String(attr.Key, RedactContent(value.String()))
+			}
+		}
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case *endpoint.Endpoint:
+			if v != nil {
+				return slog.String(attr.Key, redactEndpoint(v))
+			}
+		case []*endpoint.Endpoint:
+			endpoints := make([]string, 0, len(v))
+			for _, ep := range v {
+				endpoints = append(endpoints, redactEndpoint(ep))
+			}
+			return slog.Any(attr.Key, endpoints)
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// contentMember matches the values of the content members of XML-RPC structs, the record content of
+// API requests and responses.
+var contentMember = regexp.MustCompile(`(?is)(<member>\s*<name>\s*content\s*</name>\s*<value>\s*(?:<string>)?)(.*?)((?:</string>)?\s*</value>\s*</member>)`)
+
+// redactPayloadContent redacts the record content of an API request or response body.
+func redactPayloadContent(body string) string {
+	return contentMember.ReplaceAllStringFunc(body, func(member string) string {
+		parts := contentMember.FindStringSubmatch(member)
+		return parts[1] + RedactContent(parts[2]) + parts[3]
+	})
+}
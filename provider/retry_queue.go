@@ -0,0 +1,166 @@
+package inwx
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// retryMaxAttempts is the number of retries of a failed change before it is dropped.
+const retryMaxAttempts = 5
+
+// retryableClasses are the classes of failures worth retrying between syncs, as they may be
+// temporary, unlike the changes refused by the provider.
+var retryableClasses = []string{"maintenance", "rate_limited", "aborted", "api", "unknown"}
+
+// retryQueue keeps the failed creates and deletes of endpoints for retrying them with backoff
+// between syncs, until they succeed, are superseded by a change of the same endpoint or have been
+// retried retryMaxAttempts times. It holds at most size changes.
+type retryQueue struct {
+	size int
+	// interval is the backoff of the first retry, doubled for every further retry
+	interval time.Duration
+	mu       sync.Mutex
+	entries  []*retryEntry
+	// reported is the depth of the queue last added to external_dns_inwx_retry_queue_depth
+	reported int
+}
+
+type retryEntry struct {
+	// action is create or delete
+	action   string
+	ep       *endpoint.Endpoint
+	attempts int
+	next     time.Time
+}
+
+func newRetryQueue(size int, interval time.Duration) *retryQueue {
+	if size <= 0 {
+		return nil
+	}
+	return &retryQueue{size: size, interval: interval}
+}
+
+// sameEndpoint tells whether a and b are changes of the same record set.
+func sameEndpoint(a, b *endpoint.Endpoint) bool {
+	return a.DNSName == b.DNSName && a.RecordType == b.RecordType && a.SetIdentifier == b.SetIdentifier
+}
+
+// replace drops the queued changes of the endpoints of changes, which supersede them, and queues the
+// failed creates and deletes of results for retrying.
+func (q *retryQueue) replace(changes *plan.Changes, results []ChangeResult, logger *slog.Logger) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, ep := range slices.Concat(changes.Create, changes.UpdateOld, changes.UpdateNew, changes.Delete) {
+		q.entries = slices.DeleteFunc(q.entries, func(entry *retryEntry) bool {
+			return sameEndpoint(entry.ep, ep)
+		})
+	}
+	now := time.Now()
+	for _, result := range results {
+		if result.Err == nil || (result.Action != "create" && result.Action != "delete") || !slices.Contains(retryableClasses, ErrorClass(result.Err)) {
+			continue
+		}
+		if len(q.entries) >= q.size {
+			logger.Warn("retry queue full, not retrying failed change", "action", result.Action, "ep", result.Endpoint, "size", q.size)
+			retriedChangesTotal.WithLabelValues("dropped").Inc()
+			continue
+		}
+		q.entries = append(q.entries, &retryEntry{action: result.Action, ep: result.Endpoint, next: now.Add(q.interval)})
+	}
+	q.report()
+}
+
+// due returns the queued changes due for a retry at now, the deletes first.
+func (q *retryQueue) due(now time.Time) []*retryEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	due := []*retryEntry{}
+	for _, action := range []string{"delete", "create"} {
+		for _, entry := range q.entries {
+			if entry.action == action && !now.Before(entry.next) {
+				due = append(due, entry)
+			}
+		}
+	}
+	return due
+}
+
+// complete records the outcome of the retry of entry, unless entry has been superseded meanwhile.
+func (q *retryQueue) complete(entry *retryEntry, err error, now time.Time, logger *slog.Logger) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.Index(q.entries, entry)
+	if i < 0 {
+		return
+	}
+	entry.attempts++
+	switch {
+	case err == nil:
+		retriedChangesTotal.WithLabelValues("success").Inc()
+		q.entries = slices.Delete(q.entries, i, i+1)
+	case entry.attempts >= retryMaxAttempts || !slices.Contains(retryableClasses, ErrorClass(err)):
+		logger.Warn("giving up retrying failed change", "action", entry.action, "ep", entry.ep, "attempts", entry.attempts, "err", err)
+		retriedChangesTotal.WithLabelValues("dropped").Inc()
+		q.entries = slices.Delete(q.entries, i, i+1)
+	default:
+		retriedChangesTotal.WithLabelValues("failure").Inc()
+		entry.next = now.Add(q.interval << entry.attempts)
+	}
+	q.report()
+}
+
+// report exports the depth of the queue, summed up over the queues of all accounts; q.mu must be held.
+func (q *retryQueue) report() {
+	retryQueueDepth.Add(float64(len(q.entries) - q.reported))
+	q.reported = len(q.entries)
+}
+
+// RetryFailedChanges retries the failed creates and deletes queued by the applies of changes every
+// interval until ctx is done, if the retry queue is enabled.
+func (p *INWXProvider) RetryFailedChanges(ctx context.Context, interval time.Duration) error {
+	if p.retries == nil {
+		return nil
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		p.retryFailedChanges(ctx)
+	}
+}
+
+func (p *INWXProvider) retryFailedChanges(ctx context.Context) {
+	due := p.retries.due(time.Now())
+	if len(due) == 0 {
+		return
+	}
+	changes := &plan.Changes{}
+	for _, entry := range due {
+		if entry.action == "delete" {
+			changes.Delete = append(changes.Delete, entry.ep)
+		} else {
+			changes.Create = append(changes.Create, entry.ep)
+		}
+	}
+	p.logger.Info("retrying failed changes", "changes", len(due))
+	results, err := p.applyChanges(ctx, changes)
+	now := time.Now()
+	for i, entry := range due {
+		if err == nil {
+			// the results are in the order of the deletes, then the creates, as are the changes due
+			p.retries.complete(entry, results[i].Err, now, p.logger)
+		} else {
+			p.retries.complete(entry, err, now, p.logger)
+		}
+	}
+}
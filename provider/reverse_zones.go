@@ -0,0 +1,83 @@
+package inwx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// classlessZone returns the parent zone and the range of the last octet of the addresses of an
+// RFC 2317 classless reverse zone, whose first label is the first address with the prefix length
+// (0/26 or 0-26) or with the last address (0-63), such as 0/26.2.0.192.in-addr.arpa.
+func classlessZone(zone string) (string, int, int, bool) {
+	label, parent, ok := strings.Cut(zone, ".")
+	if !ok || strings.Count(parent, ".") != 4 || !strings.HasSuffix(parent, ".in-addr.arpa") {
+		return "", 0, 0, false
+	}
+	first, second, ok := strings.Cut(label, "/")
+	isPrefix := ok
+	if !ok {
+		if first, second, ok = strings.Cut(label, "-"); !ok {
+			return "", 0, 0, false
+		}
+	}
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 0 || start > 255 {
+		return "", 0, 0, false
+	}
+	value, err := strconv.Atoi(second)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	last := value
+	if isPrefix || (value >= 25 && value <= 32) {
+		if value < 25 || value > 32 {
+			return "", 0, 0, false
+		}
+		last = start + 1<<(32-value) - 1
+	}
+	if last < start || last > 255 {
+		return "", 0, 0, false
+	}
+	return parent, start, last, true
+}
+
+// classlessName returns the name of the address of dnsName, such as 5.2.0.192.in-addr.arpa, in the
+// parent zone of a classless reverse zone, its last octet and the parent, false if it is no such name.
+func classlessName(dnsName string) (int, string, bool) {
+	label, parent, ok := strings.Cut(dnsName, ".")
+	if !ok || strings.Count(parent, ".") != 4 || !strings.HasSuffix(parent, ".in-addr.arpa") {
+		return 0, "", false
+	}
+	octet, err := strconv.Atoi(label)
+	if err != nil || octet < 0 || octet > 255 || strconv.Itoa(octet) != label {
+		return 0, "", false
+	}
+	return octet, parent, true
+}
+
+// lookupClassless returns the smallest classless reverse zone holding the address of dnsName and its
+// value, false if there is none. The names of the zones that may hold the address are looked up
+// instead of scanning all zones.
+func (index zoneIndex) lookupClassless(dnsName string) (string, int, bool) {
+	octet, parent, ok := classlessName(dnsName)
+	if !ok {
+		return "", 0, false
+	}
+	for prefix := 32; prefix >= 25; prefix-- {
+		size := 1 << (32 - prefix)
+		start := octet &^ (size - 1)
+		for _, label := range []string{fmt.Sprintf("%d/%d", start, prefix), fmt.Sprintf("%d-%d", start, prefix), fmt.Sprintf("%d-%d", start, start+size-1)} {
+			zone := label + "." + parent
+			value, ok := index[zone]
+			if !ok {
+				continue
+			}
+			// 0-31 is the prefix 31 rather than the range up to 31, for example
+			if _, first, last, ok := classlessZone(zone); ok && first <= octet && octet <= last {
+				return zone, value, true
+			}
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,161 @@
+package inwx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	inwx "github.com/nrdcg/goinwx"
+)
+
+const (
+	// sessionIdleTimeout is how long a persistent session is trusted without a successful call; INWX
+	// ends idle sessions, so an older session is replaced by a new login.
+	sessionIdleTimeout = 15 * time.Minute
+	// authenticationErrorCode is the result code of INWX logins refused for invalid credentials
+	authenticationErrorCode = 2200
+	// defaultMaxLoginFailures applies if ClientOptions.MaxLoginFailures is not set
+	defaultMaxLoginFailures = 3
+	// loginBackoff is the pause after the first credential failure, doubling with every further one
+	loginBackoff = time.Minute
+)
+
+// LoginLockedError is returned instead of logging in once the credentials were refused too often, as
+// INWX locks accounts after repeated failed logins.
+type LoginLockedError struct {
+	Failures int
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("not logging into INWX after %d logins refused for invalid credentials, change the credentials", e.Failures)
+}
+
+// credentialError tells whether err refuses a login for invalid credentials.
+func credentialError(err error) bool {
+	var response *inwx.ErrorResponse
+	return errors.As(err, &response) && response.Code == authenticationErrorCode
+}
+
+// LoginLocked tells whether logins are disabled after repeated credential failures.
+func (p *INWXProvider) LoginLocked() bool {
+	return p.loginLocked.Load()
+}
+
+// SetCredentials replaces the credentials of the account if they changed, lifting a login lock.
+func (p *INWXProvider) SetCredentials(username string, password string) {
+	p.sessionMu.Lock()
+	defer p.sessionMu.Unlock()
+	if username == p.clientOptions.Username && password == p.clientOptions.Password {
+		return
+	}
+	p.clientOptions.Username, p.clientOptions.Password = username, password
+	if cookies := p.clientOptions.sessionCookies; cookies != nil {
+		// the session saved is that of the credentials replaced
+		cookies.setSession("")
+		p.sessionRestoreTried = true
+	}
+	p.client = newClient(p.clientOptions, p.readOnly, p.logger)
+	p.loggedIn = false
+	p.loginFailures = 0
+	p.loginBackoffUntil = time.Time{}
+	if p.loginLocked.Swap(false) {
+		loginLocked.Dec()
+		p.logger.Info("credentials changed, logging into INWX again")
+	}
+}
+
+// loginClient logs into INWX unless the credentials were refused too often, backing off after every
+// credential failure. sessionMu must be held.
+func (p *INWXProvider) loginClient() error {
+	if p.loginLocked.Load() {
+		return &LoginLockedError{Failures: p.loginFailures}
+	}
+	if until := p.loginBackoffUntil; time.Now().Before(until) {
+		return fmt.Errorf("not logging into INWX before %s after %d logins refused for invalid credentials", until.Format(time.RFC3339), p.loginFailures)
+	}
+	_, err := p.client.Login()
+	switch {
+	case err == nil:
+		loginsTotal.WithLabelValues("success").Inc()
+		p.loginFailures = 0
+		p.saveSession()
+	case credentialError(err):
+		loginsTotal.WithLabelValues("invalid_credentials").Inc()
+		p.loginFailures++
+		maxFailures := p.clientOptions.MaxLoginFailures
+		if maxFailures <= 0 {
+			maxFailures = defaultMaxLoginFailures
+		}
+		if p.loginFailures >= maxFailures {
+			p.loginLocked.Store(true)
+			loginLocked.Inc()
+			p.logger.Error("INWX refused the credentials repeatedly, not logging in until they change", "failures", p.loginFailures, "err", err)
+		} else {
+			p.loginBackoffUntil = time.Now().Add(loginBackoff << (p.loginFailures - 1))
+			p.logger.Warn("INWX refused the credentials, backing off", "failures", p.loginFailures, "until", p.loginBackoffUntil, "err", err)
+		}
+	default:
+		loginsTotal.WithLabelValues("error").Inc()
+	}
+	return err
+}
+
+// startSession logs in unless the persistent session can be reused, and returns the function ending
+// the use of the session, which logs out unless the session is persistent. sessionMu must be held.
+func (p *INWXProvider) startSession() (func(), error) {
+	if p.persistentSession && p.loggedIn && time.Since(p.sessionUsed) < sessionIdleTimeout {
+		p.sessionUsed = time.Now()
+		return func() {}, nil
+	}
+	if p.persistentSession && !p.loggedIn && p.restoreSession() {
+		p.loggedIn = true
+		p.sessionUsed = time.Now()
+		return func() {}, nil
+	}
+	if err := p.loginClient(); err != nil || p.maintenanceUntil.Load() != 0 {
+		if err = p.noteMaintenance(err); err != nil {
+			p.loggedIn = false
+			return nil, err
+		}
+	}
+	if p.persistentSession {
+		p.loggedIn = true
+		p.sessionUsed = time.Now()
+		return func() {}, nil
+	}
+	return func() {
+		if err := p.client.Logout(); err != nil {
+			p.logger.Error("error encountered while logging out", "err", err)
+		}
+	}, nil
+}
+
+// KeepSessionAlive pings INWX with the persistent session every interval until ctx is done, so that
+// the session does not expire between infrequent syncs.
+func (p *INWXProvider) KeepSessionAlive(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		p.keepSessionAlive()
+	}
+}
+
+func (p *INWXProvider) keepSessionAlive() {
+	p.sessionMu.Lock()
+	defer p.sessionMu.Unlock()
+	if !p.loggedIn {
+		return
+	}
+	if err := p.client.Ping(); err != nil {
+		p.logger.Warn("INWX session keep-alive failed, logging in again on the next call", "err", err)
+		p.loggedIn = false
+		return
+	}
+	p.sessionUsed = time.Now()
+}
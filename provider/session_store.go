@@ -0,0 +1,71 @@
+package inwx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// sessionStoreTimeout bounds loading and saving the session, so that a slow store only delays a login.
+const sessionStoreTimeout = 10 * time.Second
+
+// sessionAccount identifies the account of the session in the session store by the API and the
+// username, hashed so that it is a valid key of a Kubernetes Secret and does not disclose the username.
+func (p *INWXProvider) sessionAccount() string {
+	hash := sha256.Sum256([]byte(p.clientOptions.apiURL() + "\x00" + p.clientOptions.Username))
+	return "session-" + hex.EncodeToString(hash[:16])
+}
+
+// restoreSession reuses the session saved by an earlier run of the webhook if INWX still accepts it,
+// so that restarts do not log in again. It is tried once, the first login of the provider being
+// replaced by it. sessionMu must be held.
+func (p *INWXProvider) restoreSession() bool {
+	cookies := p.clientOptions.sessionCookies
+	if cookies == nil || p.sessionRestoreTried {
+		return false
+	}
+	p.sessionRestoreTried = true
+	ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+	defer cancel()
+	session, ok, err := p.clientOptions.SessionStore.Load(ctx, p.sessionAccount())
+	if err != nil {
+		sessionRestoresTotal.WithLabelValues("error").Inc()
+		p.logger.Warn("failed to load the saved INWX session, logging in", "err", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	cookies.setSession(string(session))
+	if err := p.client.Ping(); err != nil {
+		cookies.setSession("")
+		sessionRestoresTotal.WithLabelValues("expired").Inc()
+		p.logger.Info("the saved INWX session is no longer valid, logging in", "err", err)
+		return false
+	}
+	sessionRestoresTotal.WithLabelValues("restored").Inc()
+	p.logger.Info("restored the saved INWX session")
+	return true
+}
+
+// saveSession saves the session of a login to the session store, if configured. A failure is logged
+// only, as it merely costs a login after the next restart. sessionMu must be held.
+func (p *INWXProvider) saveSession() {
+	cookies := p.clientOptions.sessionCookies
+	if cookies == nil {
+		return
+	}
+	session := cookies.session()
+	if session == "" {
+		p.logger.Warn("INWX answered the login without a session cookie, not saving the session")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sessionStoreTimeout)
+	defer cancel()
+	if err := p.clientOptions.SessionStore.Save(ctx, p.sessionAccount(), []byte(session)); err != nil {
+		p.logger.Warn("failed to save the INWX session", "err", err)
+		return
+	}
+	p.logger.Debug("saved the INWX session")
+}
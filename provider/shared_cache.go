@@ -0,0 +1,100 @@
+package inwx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/sharedcache"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	// sharedLockTTL bounds how long a lock outlives a replica failing to release or renew it.
+	sharedLockTTL = 30 * time.Second
+	// sharedLockWait bounds how long a replica waits for a lock held by another one.
+	sharedLockWait = 2 * time.Minute
+)
+
+// SharedCache shares the listed records and an apply lock of an account between replicas, so that
+// they neither list the account twice nor change its zones concurrently.
+type SharedCache struct {
+	Store sharedcache.Store
+	// Key identifies the account among the accounts sharing the store
+	Key string
+	// TTL is how long listed records are shared
+	TTL time.Duration
+}
+
+// sharedRecords returns the records another replica listed recently, or lists and shares them holding
+// a lock, so that only one replica lists them. Errors of the store are logged and the records listed.
+func (p *INWXProvider) sharedRecords(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	recordsKey := p.shared.Key + "/records"
+	if endpoints, ok := p.sharedEndpoints(ctx, recordsKey); ok {
+		return endpoints, nil
+	}
+	lockCtx, cancel := context.WithTimeout(ctx, sharedLockWait)
+	defer cancel()
+	unlock, err := p.shared.Store.Lock(lockCtx, recordsKey+".lock", sharedLockTTL)
+	if err != nil {
+		p.logger.Warn("failed to lock the shared records, listing them anyway", "err", err)
+		return p.listRecords(ctx)
+	}
+	defer unlock()
+	// another replica may have listed them while waiting for the lock
+	if endpoints, ok := p.sharedEndpoints(ctx, recordsKey); ok {
+		return endpoints, nil
+	}
+	endpoints, err := p.listRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if value, err := json.Marshal(endpoints); err != nil {
+		p.logger.Warn("failed to encode the shared records", "err", err)
+	} else if err := p.shared.Store.Set(ctx, recordsKey, value, p.shared.TTL); err != nil {
+		p.logger.Warn("failed to share the records", "err", err)
+	} else {
+		reportCacheUpdate(cacheSharedRecords, len(endpoints), time.Now())
+	}
+	return endpoints, nil
+}
+
+func (p *INWXProvider) sharedEndpoints(ctx context.Context, key string) ([]*endpoint.Endpoint, bool) {
+	value, ok, err := p.shared.Store.Get(ctx, key)
+	if err != nil {
+		p.logger.Warn("failed to read the shared records", "err", err)
+		return nil, false
+	}
+	if !ok {
+		reportCacheLookup(cacheSharedRecords, false)
+		return nil, false
+	}
+	endpoints := []*endpoint.Endpoint{}
+	if err := json.Unmarshal(value, &endpoints); err != nil {
+		p.logger.Warn("failed to decode the shared records", "err", err)
+		return nil, false
+	}
+	reportCacheLookup(cacheSharedRecords, true)
+	cacheEntries.WithLabelValues(cacheSharedRecords).Set(float64(len(endpoints)))
+	p.logger.Debug("using records shared by another replica", "endpoints", len(endpoints))
+	return endpoints, true
+}
+
+// lockApply holds the apply lock of the account until the returned function is called, and drops
+// the shared records then, as they are outdated by the changes. It fails if the lock cannot be taken,
+// e.g. as another replica held it for sharedLockWait, so that external-dns applies the changes again.
+func (p *INWXProvider) lockApply(ctx context.Context) (func(), error) {
+	lockCtx, cancel := context.WithTimeout(ctx, sharedLockWait)
+	defer cancel()
+	unlock, err := p.shared.Store.Lock(lockCtx, p.shared.Key+"/apply.lock", sharedLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock the account for applying changes: %w", err)
+	}
+	return func() {
+		if err := p.shared.Store.Delete(context.Background(), p.shared.Key+"/records"); err != nil {
+			p.logger.Warn("failed to drop the shared records", "err", err)
+		}
+		unlock()
+	}, nil
+}
@@ -0,0 +1,160 @@
+package inwx
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	inwx "github.com/nrdcg/goinwx"
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+)
+
+// RestoreOperation is a change made (or, in a dry run, planned) to restore a snapshot.
+type RestoreOperation struct {
+	// Action is one of create, update or delete
+	Action string
+	Record snapshot.Record
+	// Previous is the record updated, only set for updates
+	Previous *snapshot.Record
+}
+
+// SnapshotZone logs into INWX and returns the full record set of zone.
+func (p *INWXProvider) SnapshotZone(zone string) (*snapshot.Snapshot, error) {
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	records, err := p.client.GetRecords(zone)
+	if err != nil {
+		return nil, err
+	}
+	return newSnapshot(zone, records), nil
+}
+
+// RestoreZone logs into INWX and restores the records of the snapshot zone to the snapshot,
+// returning the operations applied. With dryRun set, the operations are only computed.
+// SOA records are left alone, as they are maintained by INWX. Zones outside the managed zones are
+// refused unless force is set, as a snapshot may name any zone of the account.
+func (p *INWXProvider) RestoreZone(s *snapshot.Snapshot, dryRun bool, force bool) ([]RestoreOperation, error) {
+	logout, err := p.login()
+	if err != nil {
+		return nil, err
+	}
+	defer logout()
+
+	if !force {
+		zones, err := p.getZones()
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(*zones, s.Zone) {
+			return nil, fmt.Errorf("refusing to restore zone %s outside the managed zones: %w", s.Zone, errNoZone)
+		}
+	}
+	records, err := p.client.GetRecords(s.Zone)
+	if err != nil {
+		return nil, err
+	}
+	operations := restoreOperations(*records, s.Records)
+	if dryRun {
+		return operations, nil
+	}
+	if err := p.applyRestoreOperations(s.Zone, operations); err != nil {
+		return nil, err
+	}
+	return operations, nil
+}
+
+// applyRestoreOperations applies operations to the records of zone in order, stopping at the first
+// failure.
+func (p *INWXProvider) applyRestoreOperations(zone string, operations []RestoreOperation) error {
+	var err error
+	for _, op := range operations {
+		rec := &inwx.NameserverRecordRequest{
+			Domain:   zone,
+			Name:     op.Record.Name,
+			Type:     op.Record.Type,
+			Content:  op.Record.Content,
+			TTL:      op.Record.TTL,
+			Priority: op.Record.Priority,
+		}
+		switch op.Action {
+		case "create":
+			err = p.client.CreateRecord(rec)
+		case "update":
+			err = p.client.UpdateRecord(op.Record.ID, rec)
+		case "delete":
+			err = p.client.DeleteRecord(op.Record.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to %s record %s %s %s: %w", op.Action, op.Record.Name, op.Record.Type, op.Record.Content, err)
+		}
+	}
+	return nil
+}
+
+// restoreOperations matches records by name, type and content; updates carry the ID of the current record.
+func restoreOperations(current []inwx.NameserverRecord, wanted []snapshot.Record) []RestoreOperation {
+	operations := []RestoreOperation{}
+	matched := make([]bool, len(current))
+	for _, want := range wanted {
+		if want.Type == "SOA" {
+			continue
+		}
+		// duplicates of a record match the current duplicates one by one
+		i := -1
+		for j, rec := range current {
+			if !matched[j] && rec.Name == want.Name && rec.Type == want.Type && rec.Content == want.Content {
+				i = j
+				break
+			}
+		}
+		if i >= 0 {
+			matched[i] = true
+			if current[i].TTL != want.TTL || current[i].Priority != want.Priority {
+				want.ID = current[i].ID
+				previous := snapshotRecord(current[i])
+				operations = append(operations, RestoreOperation{Action: "update", Record: want, Previous: &previous})
+			}
+			continue
+		}
+		operations = append(operations, RestoreOperation{Action: "create", Record: want})
+	}
+	for i, rec := range current {
+		if !matched[i] && rec.Type != "SOA" {
+			operations = append(operations, RestoreOperation{Action: "delete", Record: snapshotRecord(rec)})
+		}
+	}
+	return operations
+}
+
+// snapshotZones saves a snapshot of every zone touched by changes before they are applied.
+func (p *INWXProvider) snapshotZones(ctx context.Context, zones []string) error {
+	for _, zone := range zones {
+		records, err := p.client.GetRecords(zone)
+		if err != nil {
+			return err
+		}
+		ref, err := p.snapshots.Save(ctx, newSnapshot(zone, records))
+		if err != nil {
+			return fmt.Errorf("failed to save snapshot of zone %s: %w", zone, err)
+		}
+		p.logger.Info("saved zone snapshot", "zone", zone, "snapshot", ref)
+	}
+	return nil
+}
+
+func newSnapshot(zone string, records *[]inwx.NameserverRecord) *snapshot.Snapshot {
+	s := &snapshot.Snapshot{Zone: zone, Created: time.Now().UTC(), Records: []snapshot.Record{}}
+	for _, rec := range *records {
+		s.Records = append(s.Records, snapshotRecord(rec))
+	}
+	return s
+}
+
+func snapshotRecord(rec inwx.NameserverRecord) snapshot.Record {
+	return snapshot.Record{ID: rec.ID, Name: rec.Name, Type: rec.Type, Content: rec.Content, TTL: rec.TTL, Priority: rec.Priority}
+}
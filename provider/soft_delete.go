@@ -0,0 +1,194 @@
+package inwx
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	inwx "github.com/nrdcg/goinwx"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+const (
+	// softDeleteLabel is prepended to the name of soft-deleted records for the TXT records marking them
+	softDeleteLabel = "_external-dns-inwx-deleted"
+	// softDeleteTTL is the TTL of soft-deleted records, the lowest INWX accepts
+	softDeleteTTL = 300
+)
+
+// softDeletion is the content of the TXT record marking the records of a name and type soft-deleted
+// since a time, with the TTL they had.
+type softDeletion struct {
+	recordType string
+	since      time.Time
+	ttl        int
+}
+
+func (d softDeletion) content() string {
+	return fmt.Sprintf("deleted=%s,since=%d,ttl=%d", d.recordType, d.since.Unix(), d.ttl)
+}
+
+func parseSoftDeletion(content string) (softDeletion, bool) {
+	var d softDeletion
+	var since, ttl bool
+	for _, field := range strings.Split(strings.Trim(content, `"`), ",") {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "deleted":
+			d.recordType = value
+		case "since":
+			unix, err := strconv.ParseInt(value, 10, 64)
+			d.since, since = time.Unix(unix, 0), err == nil
+		case "ttl":
+			var err error
+			d.ttl, err = strconv.Atoi(value)
+			ttl = err == nil
+		}
+	}
+	return d, d.recordType != "" && since && ttl
+}
+
+// softDeletionName returns the name of the TXT records marking the soft-deleted records of dnsName.
+func softDeletionName(dnsName string) string {
+	return softDeleteLabel + "." + dnsName
+}
+
+// softDeletedName returns the name of the records marked by a TXT record of dnsName, or false if it
+// is not a marker name.
+func softDeletedName(dnsName string) (string, bool) {
+	return strings.CutPrefix(strings.ToLower(dnsName), softDeleteLabel+".")
+}
+
+// softDeletion returns the marker of the soft-deleted records of ep and the IDs of its TXT records,
+// or false if they are not soft-deleted.
+func (z *zoneRecords) softDeletion(ep *endpoint.Endpoint) (softDeletion, []int, bool) {
+	for content, ids := range z.byName(softDeletionName(ep.DNSName), endpoint.RecordTypeTXT) {
+		if d, ok := parseSoftDeletion(content); ok && d.recordType == ep.RecordType {
+			return d, ids, true
+		}
+	}
+	return softDeletion{}, nil, false
+}
+
+// softDelete marks the records of ep in zone soft-deleted and lowers their TTL, leaving them to be
+// deleted by softDeletedRecords once the deletion grace period is over.
+func (p *INWXProvider) softDelete(zone string, ep *endpoint.Endpoint, records *zoneRecords, logger *slog.Logger) error {
+	recIDs, err := getRecIDs(records, *ep)
+	if err != nil {
+		logger.Error("failed to look up records to delete", "err", err)
+		return err
+	}
+	if _, _, ok := records.softDeletion(ep); ok {
+		return nil
+	}
+	// the marker is created first, so that a failure leaves the records visible to be deleted again
+	marker := &inwx.NameserverRecordRequest{
+		Domain:  zone,
+		Name:    relativeName(zone, softDeletionName(ep.DNSName)),
+		Type:    endpoint.RecordTypeTXT,
+		Content: softDeletion{recordType: ep.RecordType, since: time.Now(), ttl: int(ep.RecordTTL)}.content(),
+		TTL:     softDeleteTTL,
+	}
+	if err := p.client.CreateRecord(marker); err != nil {
+		logger.Error("failed to mark records soft-deleted", "ep", ep, "err", err)
+		return err
+	}
+	errs := []error{}
+	for i, target := range ep.Targets {
+		rec := p.recordRequest(zone, ep, target, 0)
+		rec.TTL = softDeleteTTL
+		if err := p.client.UpdateRecord(recIDs[i], rec); err != nil {
+			errs = append(errs, err)
+			logger.Error("failed to lower the TTL of soft-deleted record", "rec", rec, "err", err)
+		}
+	}
+	logger.Info("soft-deleted records", "ep", ep, "grace_period", p.deletionGracePeriod)
+	return errors.Join(errs...)
+}
+
+// restoreSoftDeleted turns the soft-deleted records of ep back into the records of its targets,
+// with the TTL they had, instead of creating them again.
+func (p *INWXProvider) restoreSoftDeleted(zone string, ep *endpoint.Endpoint, records *zoneRecords, deletion softDeletion, markerIDs []int, logger *slog.Logger) error {
+	existing := records.byName(ep.DNSName, ep.RecordType)
+	errs := []error{}
+	for _, target := range ep.Targets {
+		key := normalizeTarget(ep.RecordType, target)
+		if ids := existing[key]; len(ids) > 0 {
+			rec := p.recordRequest(zone, ep, target, deletion.ttl)
+			if err := p.client.UpdateRecord(ids[0], rec); err != nil {
+				errs = append(errs, err)
+				logger.Error("failed to restore record", "rec", rec, "err", err)
+			}
+			existing[key] = ids[1:]
+			continue
+		}
+		rec := p.recordRequest(zone, ep, target, 0)
+		if err := p.client.CreateRecord(rec); err != nil {
+			errs = append(errs, err)
+			logger.Error("failed to create record", "rec", rec, "err", err)
+		}
+	}
+	if len(errs) > 0 {
+		// the records stay soft-deleted until the creation is retried
+		return errors.Join(errs...)
+	}
+	for _, ids := range existing {
+		markerIDs = append(markerIDs, ids...)
+	}
+	for _, id := range markerIDs {
+		if err := p.client.DeleteRecord(id); err != nil {
+			errs = append(errs, err)
+			logger.Error("failed to delete record", "id", id, "ep", ep, "err", err)
+		}
+	}
+	logger.Info("restored soft-deleted records", "ep", ep)
+	return errors.Join(errs...)
+}
+
+// softDeletedRecords returns the records of zone without the soft-deleted records and their markers,
+// deleting those whose deletion grace period is over at now.
+func (p *INWXProvider) softDeletedRecords(zone string, records []inwx.NameserverRecord, now time.Time) []inwx.NameserverRecord {
+	type nameType struct{ name, recordType string }
+	deletions := map[nameType]softDeletion{}
+	for _, rec := range records {
+		if rec.Type != endpoint.RecordTypeTXT {
+			continue
+		}
+		if name, ok := softDeletedName(recordDNSName(zone, rec.Name)); ok {
+			if d, ok := parseSoftDeletion(rec.Content); ok {
+				deletions[nameType{name, d.recordType}] = d
+			}
+		}
+	}
+	if len(deletions) == 0 {
+		return records
+	}
+
+	visible := make([]inwx.NameserverRecord, 0, len(records))
+	for _, rec := range records {
+		dnsName := strings.ToLower(recordDNSName(zone, rec.Name))
+		d, ok := deletions[nameType{dnsName, rec.Type}]
+		if markedName, marker := softDeletedName(dnsName); marker && rec.Type == endpoint.RecordTypeTXT {
+			d, ok = parseSoftDeletion(rec.Content)
+			if ok {
+				_, ok = deletions[nameType{markedName, d.recordType}]
+			}
+		}
+		if !ok {
+			visible = append(visible, rec)
+			continue
+		}
+		if now.Sub(d.since) < p.deletionGracePeriod {
+			continue
+		}
+		if err := p.client.DeleteRecord(rec.ID); err != nil {
+			p.logger.Error("failed to delete soft-deleted record", "zone", zone, "name", dnsName, "type", rec.Type, "id", rec.ID, "err", err)
+			continue
+		}
+		p.logger.Info("deleted soft-deleted record after the deletion grace period", "zone", zone, "name", dnsName, "type", rec.Type, "content", rec.Content)
+	}
+	return visible
+}
@@ -0,0 +1,42 @@
+package inwx
+
+import (
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// logRecordsSummary logs a single line at info level summarizing a call of Records started at start,
+// so that every sync of external-dns is observable without the debug logs.
+func (p *INWXProvider) logRecordsSummary(endpoints []*endpoint.Endpoint, stale bool, err error, start time.Time) {
+	if err != nil {
+		p.logger.Error("failed to list records", "duration", time.Since(start), "class", ErrorClass(err), "err", err)
+		return
+	}
+	p.logger.Info("listed records", "zones", p.listedZones.Load(), "records", len(endpoints), "stale", stale, "duration", time.Since(start))
+}
+
+// logApplySummary logs a single line at info level summarizing a call of ApplyChangesWithResults
+// started at start: the zones touched, the changes requested by action and the changes failed.
+func (p *INWXProvider) logApplySummary(changes *plan.Changes, batches []*zoneBatch, results []ChangeResult, err error, start time.Time) {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	attrs := []any{
+		"zones", len(batches),
+		"creates", len(changes.Create),
+		"updates", len(changes.UpdateNew),
+		"deletes", len(changes.Delete),
+		"failed", failed,
+		"duration", time.Since(start),
+	}
+	if err != nil {
+		p.logger.Error("failed to apply changes", append(attrs, "class", ErrorClass(err), "err", err)...)
+		return
+	}
+	p.logger.Info("applied changes", attrs...)
+}
@@ -0,0 +1,16 @@
+package inwx
+
+import "sigs.k8s.io/external-dns/endpoint"
+
+// testingProperty is the provider-specific property of the endpoints whose records are created in the
+// testing mode of INWX if set to true, set by the annotation
+// external-dns.alpha.kubernetes.io/webhook-inwx-testing. INWX validates the records without creating
+// them, so that a record is staged until the property is removed; as the records stay missing, their
+// creation is validated again on every sync.
+const testingProperty = "webhook/inwx-testing"
+
+// testingMode returns whether the records of ep are created in the testing mode of INWX.
+func testingMode(ep *endpoint.Endpoint) bool {
+	value, ok := ep.GetProviderSpecificProperty(testingProperty)
+	return ok && value == "true"
+}
@@ -0,0 +1,156 @@
+package inwx
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// TransportOptions tunes the HTTP transport of the INWX API client. Zero values keep the defaults of net/http.
+type TransportOptions struct {
+	DisableKeepAlives     bool
+	MaxIdleConns          int
+	MaxConnsPerHost       int
+	IdleConnTimeout       time.Duration
+	ResponseHeaderTimeout time.Duration
+	DisableHTTP2          bool
+}
+
+// newTransport builds the HTTP transport of the INWX API client.
+func newTransport(options ClientOptions, logger *slog.Logger) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// The default transport honors HTTP_PROXY, HTTPS_PROXY and NO_PROXY already; an explicit
+	// proxy replaces the former two, while hosts in NO_PROXY are still reached directly.
+	if options.ProxyURL != nil {
+		transport.Proxy = proxyFunc(options.ProxyURL, os.Getenv("NO_PROXY"))
+	}
+	if options.TLSConfig != nil {
+		transport.TLSClientConfig = options.TLSConfig
+	}
+
+	tuning := options.Transport
+	transport.DisableKeepAlives = tuning.DisableKeepAlives
+	if tuning.MaxIdleConns > 0 {
+		transport.MaxIdleConns = tuning.MaxIdleConns
+		transport.MaxIdleConnsPerHost = tuning.MaxIdleConns
+	}
+	transport.MaxConnsPerHost = tuning.MaxConnsPerHost
+	if tuning.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = tuning.IdleConnTimeout
+	}
+	transport.ResponseHeaderTimeout = tuning.ResponseHeaderTimeout
+	if tuning.DisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &rateLimitedTransport{next: &instrumentedTransport{next: transport, logPayloads: options.LogPayloads, logConnections: options.LogConnections, redactContent: options.RedactContent, logger: logger}, logger: logger}
+}
+
+func proxyFunc(proxyURL *url.URL, noProxy string) func(*http.Request) (*url.URL, error) {
+	proxy := (&httpproxy.Config{HTTPProxy: proxyURL.String(), HTTPSProxy: proxyURL.String(), NoProxy: noProxy}).ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return proxy(r.URL)
+	}
+}
+
+// instrumentedTransport records metrics and debug logs of every API request, labeled by XML-RPC method.
+type instrumentedTransport struct {
+	next http.RoundTripper
+	// logPayloads adds the redacted request and response bodies to the debug logs
+	logPayloads bool
+	// logConnections adds how the connections of the requests are obtained to the debug logs
+	logConnections bool
+	// redactContent redacts the record content of the logged bodies too
+	redactContent bool
+	logger        *slog.Logger
+}
+
+func (t *instrumentedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	method := "unknown"
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		method = xmlrpcMethod(body)
+	}
+	if t.logConnections {
+		r = t.traceConnections(r, method)
+	}
+	if t.logPayloads {
+		t.logger.Debug("INWX API request payload", "method", method, "headers", redactHeaders(r.Header), "body", t.payload(body))
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(r)
+	duration := time.Since(start)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	apiRequestsTotal.WithLabelValues(method, code).Inc()
+	apiRequestDuration.WithLabelValues(method).Observe(duration.Seconds())
+	t.logger.Debug("INWX API request", "method", method, "code", code, "duration", duration)
+	if t.logPayloads && err == nil {
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		t.logger.Debug("INWX API response payload", "method", method, "headers", redactHeaders(resp.Header), "body", t.payload(body))
+	}
+	return resp, err
+}
+
+// secretMember matches the values of XML-RPC struct members holding secrets: the account password,
+// TOTP codes of two-factor authentication and domain transfer auth codes.
+var secretMember = regexp.MustCompile(`(?is)(<member>\s*<name>\s*(?:pass|password|tan|otp|totp|authcode|secret)\s*</name>\s*<value>).*?(</value>\s*</member>)`)
+
+func redactPayload(body []byte) string {
+	return string(secretMember.ReplaceAll(body, []byte("${1}<string>REDACTED</string>${2}")))
+}
+
+// payload returns a request or response body as logged.
+func (t *instrumentedTransport) payload(body []byte) string {
+	if t.redactContent {
+		return redactPayloadContent(redactPayload(body))
+	}
+	return redactPayload(body)
+}
+
+// redactHeaders returns the headers with session cookies and credentials replaced.
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"} {
+		if _, ok := redacted[name]; ok {
+			redacted[name] = []string{"REDACTED"}
+		}
+	}
+	return redacted
+}
+
+// xmlrpcMethod returns the method name of an XML-RPC request body.
+func xmlrpcMethod(body []byte) string {
+	call := struct {
+		MethodName string `xml:"methodName"`
+	}{}
+	if err := xml.Unmarshal(body, &call); err != nil || call.MethodName == "" {
+		return "unknown"
+	}
+	return call.MethodName
+}
@@ -0,0 +1,55 @@
+package inwx
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InstrumentWebhook observes the duration of every request of the webhook API of next as
+// external_dns_inwx_webhook_request_duration_seconds, the API of every tenant included.
+func InstrumentWebhook(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		webhookRequestDuration.WithLabelValues(webhookEndpoint(r.URL.Path), r.Method, strconv.Itoa(recorder.status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// webhookEndpoint returns the endpoint of the webhook API of a path, keeping the label values few.
+func webhookEndpoint(path string) string {
+	path = strings.TrimSuffix(path, "/")
+	if tenant, ok := strings.CutPrefix(path, "/tenants/"); ok {
+		_, path, _ = strings.Cut(tenant, "/")
+		path = "/" + path
+	}
+	switch path {
+	case "", "/":
+		return "negotiate"
+	case "/records":
+		return "records"
+	case "/adjustendpoints":
+		return "adjustendpoints"
+	}
+	return "other"
+}
+
+// statusRecorder remembers the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,76 @@
+package inwx
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	webhookapi "sigs.k8s.io/external-dns/provider/webhook/api"
+)
+
+const (
+	// webhookMediaType is the media type of the webhook API, versioned by its version parameter
+	webhookMediaType = "application/external.dns.webhook+json"
+	// webhookVersionsHeader advertises the supported versions of the webhook API on every response
+	webhookVersionsHeader = "X-Webhook-Versions"
+)
+
+// webhookVersions are the versions of the webhook API served, the first being served to clients
+// not asking for a version.
+var webhookVersions = []string{"1"}
+
+// NegotiateWebhookVersion serves the webhook API of next to clients accepting a supported version,
+// advertising the supported versions. Clients not asking for a version of the webhook media type, as
+// older external-dns releases and tools like curl, are served the first version. Requests only
+// accepting or sending unsupported versions are refused with the supported media types, logged and
+// counted as external_dns_inwx_webhook_unsupported_version_requests_total.
+func NegotiateWebhookVersion(next http.Handler, logger *slog.Logger) http.Handler {
+	supported := []string{}
+	for _, version := range webhookVersions {
+		supported = append(supported, webhookMediaType+";version="+version)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(webhookVersionsHeader, strings.Join(webhookVersions, ","))
+		for _, check := range []struct {
+			header string
+			status int
+		}{{"Accept", http.StatusNotAcceptable}, {webhookapi.ContentTypeHeader, http.StatusUnsupportedMediaType}} {
+			if versions := requestedWebhookVersions(r.Header.Values(check.header)); len(versions) > 0 && !slices.ContainsFunc(versions, isWebhookVersion) {
+				webhookUnsupportedVersionRequests.WithLabelValues(versions[0]).Inc()
+				logger.Warn("refusing webhook request of an unsupported API version, upgrade the webhook or pin the external-dns version",
+					"path", r.URL.Path, "header", check.header, "requested", versions, "supported", webhookVersions)
+				http.Error(w, fmt.Sprintf("unsupported webhook API version %s, supported: %s", strings.Join(versions, ", "), strings.Join(supported, ", ")), check.status)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestedWebhookVersions returns the versions of the webhook media type of the values of an Accept
+// or Content-Type header, the first supported version for the media type without a version; other
+// media types are ignored.
+func requestedWebhookVersions(values []string) []string {
+	versions := []string{}
+	for _, value := range values {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil || mediaType != webhookMediaType {
+				continue
+			}
+			version, ok := params["version"]
+			if !ok {
+				version = webhookVersions[0]
+			}
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+func isWebhookVersion(version string) bool {
+	return slices.Contains(webhookVersions, version)
+}
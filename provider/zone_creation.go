@@ -0,0 +1,134 @@
+package inwx
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	inwx "github.com/nrdcg/goinwx"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// DefaultNameservers are the INWX nameservers, delegated to by zones created without explicit nameservers.
+var DefaultNameservers = []string{"ns.inwx.de", "ns2.inwx.de", "ns3.inwx.eu"}
+
+// ZoneCreation configures the creation of missing zones for domains registered with the account.
+type ZoneCreation struct {
+	// Nameservers are the NS records of created zones, DefaultNameservers if empty
+	Nameservers []string
+	// CloneFrom is a zone whose records, except for SOA and NS records, are copied into created zones, if set
+	CloneFrom string
+	// Records are created in created zones, after those of CloneFrom
+	Records []TemplateRecord
+}
+
+// TemplateRecord is a record created in new zones. Its name is relative to the zone, and {zone} in its
+// content is replaced by the name of the zone.
+type TemplateRecord struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Content  string `yaml:"content"`
+	TTL      int    `yaml:"ttl"`
+	Priority int    `yaml:"prio"`
+}
+
+// createMissingZones creates the zones of created endpoints whose domain is registered with the account
+// but has no nameserver zone yet, adding them to zones. Endpoints whose zone could not be created fail
+// later on like other endpoints without zone. Pinned zones are never added to.
+func (p *INWXProvider) createMissingZones(zones *[]string, changes *plan.Changes) {
+	if len(p.zones) > 0 {
+		return
+	}
+	var domains *[]inwx.DomainInfoResponse
+	index := newZoneIndex(*zones)
+	for _, ep := range changes.Create {
+		if !p.domainFilter.Match(ep.DNSName) {
+			continue
+		}
+		if _, err := index.zoneOf(ep); err == nil {
+			continue
+		}
+		if domains == nil {
+			var err error
+			if domains, err = p.client.GetDomains(); err != nil {
+				p.logger.Error("failed to list domains, not creating missing zones", "err", err)
+				return
+			}
+		}
+		domain := registeredDomain(*domains, ep.DNSName)
+		if domain == "" || slices.Contains(*zones, domain) {
+			continue
+		}
+		nameservers := p.zoneCreation.Nameservers
+		if len(nameservers) == 0 {
+			nameservers = DefaultNameservers
+		}
+		if err := p.client.CreateZone(&inwx.NameserverCreateRequest{Domain: domain, Type: "MASTER", Nameservers: nameservers}); err != nil {
+			p.logger.Error("failed to create missing zone", "zone", domain, "ep", ep, "err", err)
+			continue
+		}
+		p.logger.Info("created missing zone", "zone", domain, "nameservers", nameservers)
+		*zones = append(*zones, domain)
+		index[domain] = len(*zones) - 1
+		select {
+		case p.zoneCreated <- struct{}{}:
+		default:
+		}
+		if err := p.populateZone(domain); err != nil {
+			p.logger.Error("failed to populate created zone", "zone", domain, "err", err)
+		}
+	}
+}
+
+// populateZone creates the records of the clone source and the template in a created zone.
+func (p *INWXProvider) populateZone(zone string) error {
+	records := []TemplateRecord{}
+	if p.zoneCreation.CloneFrom != "" {
+		source, err := p.client.GetRecords(p.zoneCreation.CloneFrom)
+		if err != nil {
+			return fmt.Errorf("failed to read clone source: %w", err)
+		}
+		for _, rec := range *source {
+			if rec.Type != "SOA" && rec.Type != "NS" {
+				records = append(records, TemplateRecord{Name: rec.Name, Type: rec.Type, Content: rec.Content, TTL: rec.TTL, Priority: rec.Priority})
+			}
+		}
+	}
+	records = append(records, p.zoneCreation.Records...)
+
+	errs := []error{}
+	for _, rec := range records {
+		ttl := rec.TTL
+		if ttl == 0 {
+			ttl = 3600
+		}
+		request := &inwx.NameserverRecordRequest{
+			Domain:   zone,
+			Name:     relativeName(zone, recordDNSName(zone, rec.Name)),
+			Type:     rec.Type,
+			Content:  strings.ReplaceAll(rec.Content, "{zone}", zone),
+			TTL:      ttl,
+			Priority: rec.Priority,
+		}
+		if err := p.client.CreateRecord(request); err != nil {
+			errs = append(errs, fmt.Errorf("record %s %s: %w", rec.Name, rec.Type, err))
+		}
+	}
+	if len(records) > 0 {
+		p.logger.Info("populated created zone", "zone", zone, "records", len(records)-len(errs))
+	}
+	return errors.Join(errs...)
+}
+
+// registeredDomain returns the registered domain dnsName belongs to, or the empty string.
+func registeredDomain(domains []inwx.DomainInfoResponse, dnsName string) string {
+	match := ""
+	for _, info := range domains {
+		domain := strings.ToLower(info.Domain)
+		if (dnsName == domain || strings.HasSuffix(dnsName, "."+domain)) && len(domain) > len(match) {
+			match = domain
+		}
+	}
+	return match
+}
@@ -0,0 +1,62 @@
+package inwx
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+// zoneIndex resolves DNS names to their closest zone with one lookup per label of the name instead
+// of scanning all zones. Zones map to a value, e.g. the account holding them.
+type zoneIndex map[string]int
+
+func newZoneIndex(zones []string) zoneIndex {
+	index := make(zoneIndex, len(zones))
+	for i, zone := range zones {
+		index[zone] = i
+	}
+	return index
+}
+
+// lookup returns the closest zone of dnsName and its value, false if there is none. The addresses of
+// classless reverse zones are in these zones rather than in their parent zone.
+func (index zoneIndex) lookup(dnsName string) (string, int, bool) {
+	if zone, value, ok := index.lookupClassless(dnsName); ok {
+		return zone, value, true
+	}
+	for name := dnsName; ; {
+		if value, ok := index[name]; ok {
+			return name, value, true
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return "", 0, false
+		}
+		name = name[i+1:]
+	}
+}
+
+// zoneOf returns the closest zone of an endpoint.
+func (index zoneIndex) zoneOf(ep *endpoint.Endpoint) (string, error) {
+	zone, _, ok := index.lookup(ep.DNSName)
+	if !ok {
+		return "", fmt.Errorf("%w for the endpoint %s", errNoZone, ep)
+	}
+	return zone, nil
+}
+
+// zoneIndexOf returns the index of zones, rebuilt only if the zones changed since the last call.
+// sessionMu must be held.
+func (p *INWXProvider) zoneIndexOf(zones []string) zoneIndex {
+	hit := p.zoneIndex != nil && slices.Equal(zones, p.indexedZones)
+	reportCacheLookup(cacheZoneIndex, hit)
+	if !hit {
+		p.zoneIndex = newZoneIndex(zones)
+		p.indexedZones = slices.Clone(zones)
+		reportCacheUpdate(cacheZoneIndex, len(zones), time.Now())
+	}
+	return p.zoneIndex
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"github.com/prometheus/client_golang/prometheus"
+	cversion "github.com/prometheus/client_golang/prometheus/collectors/version"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// runPushingMetrics runs a one-shot command and pushes the metrics of the provider with the duration,
+// exit code and completion time of the command to the Pushgateway of --pushgateway-url, if set,
+// replacing the metrics of the last run of the command. A failed push is logged without failing the
+// command.
+func runPushingMetrics(cfg *config, command string, logger *slog.Logger, run func(cfg *config, command string, logger *slog.Logger) int) int {
+	if cfg.pushgatewayURL == "" {
+		return run(cfg, command, logger)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(cversion.NewCollector("external_dns_inwx"))
+	provider.RegisterMetrics(registry)
+	duration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "external_dns_inwx",
+		Name:      "command_duration_seconds",
+		Help:      "The duration of the last run of the command.",
+	})
+	exitCode := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "external_dns_inwx",
+		Name:      "command_exit_code",
+		Help:      "The exit code of the last run of the command, 0 if it succeeded.",
+	})
+	completion := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "external_dns_inwx",
+		Name:      "command_last_completion_timestamp_seconds",
+		Help:      "The time the last run of the command finished, in seconds since the epoch.",
+	})
+	registry.MustRegister(duration, exitCode, completion, journalEntriesDropped)
+
+	start := time.Now()
+	code := run(cfg, command, logger)
+	duration.Set(time.Since(start).Seconds())
+	exitCode.Set(float64(code))
+	completion.SetToCurrentTime()
+
+	if err := push.New(cfg.pushgatewayURL, cfg.pushgatewayJob).Gatherer(registry).Grouping("command", command).Push(); err != nil {
+		logger.Error("failed to push metrics to the Pushgateway", "command", command, "error", err.Error())
+	} else {
+		logger.Debug("pushed metrics to the Pushgateway", "command", command, "exit_code", code)
+	}
+	return code
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/journal"
+)
+
+type journalEntryView struct {
+	Seq      int    `json:"seq"`
+	Zone     string `json:"zone"`
+	Action   string `json:"action"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// runReplay replays the journal of the default account, which the replayed changes are journaled to as well.
+func runReplay(cfg *config, logger *slog.Logger) int {
+	if cfg.journalFile == "" {
+		logger.Error("no journal to replay, set --journal-file")
+		return 1
+	}
+	entries, err := journal.Read(cfg.journalFile, cfg.from, cfg.to)
+	if err != nil {
+		logger.Error("failed to read journal", "file", cfg.journalFile, "error", err.Error())
+		return 1
+	}
+	if len(entries) == 0 {
+		logger.Error("no journal entries in range", "file", cfg.journalFile, "from", cfg.from, "to", cfg.to)
+		return 1
+	}
+
+	operations, replayErr := cfg.newProvider(logger).ReplayJournal(entries, cfg.invert, cfg.dryRun)
+	views := []journalEntryView{}
+	for _, op := range operations {
+		view := journalEntryView{Seq: op.Seq, Zone: op.Zone, Action: op.Action}
+		rec := op.Record
+		if rec == nil {
+			rec = op.Previous
+		} else if op.Previous != nil {
+			view.Previous = op.Previous.Content
+		}
+		view.Name, view.Type, view.Content = rec.Name, rec.Type, rec.Content
+		if view.Name == "" {
+			view.Name = "@"
+		}
+		views = append(views, view)
+	}
+	code := printOutput(cfg.output, logger, views, func(w io.Writer) {
+		fmt.Fprintln(w, "SEQ\tZONE\tACTION\tNAME\tTYPE\tCONTENT\tPREVIOUS")
+		for _, view := range views {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", view.Seq, view.Zone, view.Action, view.Name, view.Type, view.Content, view.Previous)
+		}
+	})
+	if replayErr != nil {
+		logger.Error("failed to replay journal", "file", cfg.journalFile, "applied", len(operations), "error", replayErr.Error())
+		return 1
+	}
+	return code
+}
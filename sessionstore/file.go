@@ -0,0 +1,74 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileStore keeps the sealed sessions of all accounts in a JSON file readable by its owner only,
+// replacing the file atomically on every save.
+type fileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (s *fileStore) get(_ context.Context, account string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions, err := s.read()
+	if err != nil {
+		return nil, false, err
+	}
+	sealed, ok := sessions[account]
+	return sealed, ok, nil
+}
+
+func (s *fileStore) put(_ context.Context, account string, sealed []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions, err := s.read()
+	if err != nil {
+		return err
+	}
+	sessions[account] = sealed
+	content, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// read returns the sealed sessions of the file by account, none if the file does not exist.
+func (s *fileStore) read() (map[string][]byte, error) {
+	sessions := map[string][]byte{}
+	content, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return sessions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &sessions); err != nil {
+		return nil, fmt.Errorf("invalid session store file %s: %w", s.path, err)
+	}
+	return sessions, nil
+}
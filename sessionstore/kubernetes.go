@@ -0,0 +1,49 @@
+package sessionstore
+
+import (
+	"context"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/kubesecret"
+)
+
+// secretStore keeps the sealed session of every account as a data key of a Kubernetes Secret. The
+// service account of the pod needs the get and patch verbs on the Secret, and create unless it exists.
+type secretStore struct {
+	client    *kubesecret.Client
+	namespace string
+	name      string
+}
+
+// newSecretStore returns the store of the Secret name in namespace, the namespace of the pod if
+// empty, using the service account of the pod.
+func newSecretStore(namespace string, name string) (*secretStore, error) {
+	config, err := kubesecret.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		if namespace, err = kubesecret.PodNamespace(); err != nil {
+			return nil, err
+		}
+	}
+	return &secretStore{client: kubesecret.New(config), namespace: namespace, name: name}, nil
+}
+
+func (s *secretStore) get(ctx context.Context, account string) ([]byte, bool, error) {
+	secret, found, err := s.client.Get(ctx, s.namespace, s.name)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	sealed, ok := secret.Data[account]
+	return sealed, ok, nil
+}
+
+// put merges the session of account into the data of the Secret, creating the Secret if missing.
+func (s *secretStore) put(ctx context.Context, account string, sealed []byte) error {
+	data := map[string][]byte{account: sealed}
+	found, err := s.client.Patch(ctx, s.namespace, s.name, data)
+	if err != nil || found {
+		return err
+	}
+	return s.client.Create(ctx, s.namespace, s.name, data)
+}
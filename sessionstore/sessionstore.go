@@ -0,0 +1,131 @@
+// Package sessionstore keeps the INWX API sessions of the webhook across restarts, sealed with a key,
+// in a file or a Kubernetes Secret.
+package sessionstore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	kubernetesScheme = "kubernetes://"
+	// minKeyLength is the length of the shortest key accepted for sealing the sessions
+	minKeyLength = 16
+)
+
+// ErrUnsealed is returned for a saved session that cannot be opened with the key, e.g. after the key
+// was changed.
+var ErrUnsealed = errors.New("the saved session cannot be opened with the session store key")
+
+// Store keeps the sessions of the accounts by a key identifying the account. Sessions are sealed with
+// AES-256-GCM, so that the store only holds encrypted sessions.
+type Store interface {
+	// Load returns the session saved for account, false if there is none.
+	Load(ctx context.Context, account string) ([]byte, bool, error)
+	Save(ctx context.Context, account string, session []byte) error
+}
+
+// backend keeps the sealed sessions.
+type backend interface {
+	get(ctx context.Context, account string) ([]byte, bool, error)
+	put(ctx context.Context, account string, sealed []byte) error
+}
+
+// New returns the store for location, a file path or a kubernetes://[namespace/]name URL of a Secret
+// in the namespace of the pod if the namespace is omitted, sealing the sessions with key.
+func New(location string, key string) (Store, error) {
+	namespace, name, secret, err := parseLocation(location, key)
+	if err != nil {
+		return nil, err
+	}
+	var b backend
+	if secret {
+		s, err := newSecretStore(namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		b = s
+	} else {
+		b = &fileStore{path: location}
+	}
+	return newSealedStore(b, key)
+}
+
+// Check reports the problems of location and key as New does, without constructing the client of a
+// Secret, e.g. when validating the configuration.
+func Check(location string, key string) error {
+	_, _, _, err := parseLocation(location, key)
+	return err
+}
+
+// parseLocation returns the namespace and name of the Secret of location, false for a file path.
+func parseLocation(location string, key string) (string, string, bool, error) {
+	if len(key) < minKeyLength {
+		return "", "", false, fmt.Errorf("the session store key must be at least %d characters long", minKeyLength)
+	}
+	if name, ok := strings.CutPrefix(location, kubernetesScheme); ok {
+		namespace, name, found := strings.Cut(name, "/")
+		if !found {
+			namespace, name = "", namespace
+		}
+		if name == "" || strings.Contains(name, "/") {
+			return "", "", false, fmt.Errorf("expected a kubernetes://[namespace/]name URL of a Secret, got %s", location)
+		}
+		return namespace, name, true, nil
+	}
+	if location == "" {
+		return "", "", false, fmt.Errorf("no session store location configured")
+	}
+	return "", "", false, nil
+}
+
+// sealedStore seals the sessions of backend with an AES-256-GCM key derived from the key configured.
+// The account is authenticated along with the session, so that the session of one account is not
+// opened for another.
+type sealedStore struct {
+	backend backend
+	aead    cipher.AEAD
+}
+
+func newSealedStore(b backend, key string) (*sealedStore, error) {
+	derived := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(derived[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealedStore{backend: b, aead: aead}, nil
+}
+
+func (s *sealedStore) Load(ctx context.Context, account string) ([]byte, bool, error) {
+	sealed, ok, err := s.backend.get(ctx, account)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	size := s.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, false, ErrUnsealed
+	}
+	session, err := s.aead.Open(nil, sealed[:size], sealed[size:], []byte(account))
+	if err != nil {
+		return nil, false, ErrUnsealed
+	}
+	return session, true, nil
+}
+
+func (s *sealedStore) Save(ctx context.Context, account string, session []byte) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	return s.backend.put(ctx, account, s.aead.Seal(nonce, nonce, session, []byte(account)))
+}
@@ -0,0 +1,140 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/orbit-online/external-dns-inwx-webhook/kubesecret"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "0123456789abcdef0123"
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := New(path, testKey)
+	assert.NoError(t, err)
+
+	_, ok, err := store.Load(context.TODO(), "account")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, store.Save(context.TODO(), "account", []byte("session")))
+	assert.NoError(t, store.Save(context.TODO(), "other", []byte("other session")))
+	session, ok, err := store.Load(context.TODO(), "account")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("session"), session)
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "c2Vzc2lvbg", "the session must be stored sealed")
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	rekeyed, err := New(path, "another key of the store")
+	assert.NoError(t, err)
+	_, _, err = rekeyed.Load(context.TODO(), "account")
+	assert.ErrorIs(t, err, ErrUnsealed)
+
+	// a session sealed for one account is not opened for another
+	sessions := map[string][]byte{}
+	assert.NoError(t, json.Unmarshal(content, &sessions))
+	sessions["other"] = sessions["account"]
+	content, _ = json.Marshal(sessions)
+	assert.NoError(t, os.WriteFile(path, content, 0o600))
+	_, _, err = store.Load(context.TODO(), "other")
+	assert.ErrorIs(t, err, ErrUnsealed)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("sessions.json", "short")
+	assert.ErrorContains(t, err, "at least 16 characters")
+	_, err = New("kubernetes://", testKey)
+	assert.ErrorContains(t, err, "expected a kubernetes://[namespace/]name URL")
+	_, err = New("kubernetes://a/b/c", testKey)
+	assert.ErrorContains(t, err, "expected a kubernetes://[namespace/]name URL")
+	_, err = New("", testKey)
+	assert.ErrorContains(t, err, "no session store location configured")
+	assert.NoError(t, Check("kubernetes://namespace/sessions", testKey))
+	assert.ErrorContains(t, Check("kubernetes://a/b/c", testKey), "expected a kubernetes://[namespace/]name URL")
+}
+
+// fakeSecrets serves the Secret API used by the store from memory.
+type fakeSecrets struct {
+	mu       sync.Mutex
+	data     map[string][]byte
+	requests []string
+}
+
+func (f *fakeSecrets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization"))
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces/dns/secrets":
+		created := struct {
+			Data map[string][]byte `json:"data"`
+		}{}
+		_ = json.Unmarshal(body, &created)
+		f.data = created.Data
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(created)
+	case r.URL.Path != "/api/v1/namespaces/dns/secrets/sessions":
+		w.WriteHeader(http.StatusBadRequest)
+	case f.data == nil:
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodPatch:
+		patch := struct {
+			Data map[string][]byte `json:"data"`
+		}{}
+		_ = json.Unmarshal(body, &patch)
+		for account, sealed := range patch.Data {
+			f.data[account] = sealed
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": f.data})
+	case r.Method == http.MethodGet:
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": f.data})
+	}
+}
+
+func TestSecretStore(t *testing.T) {
+	secrets := &fakeSecrets{}
+	server := httptest.NewServer(secrets)
+	defer server.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("token\n"), 0o600))
+	b := &secretStore{client: kubesecret.New(kubesecret.Config{API: server.URL, TokenFile: tokenFile}), namespace: "dns", name: "sessions"}
+	store, err := newSealedStore(b, testKey)
+	assert.NoError(t, err)
+
+	_, ok, err := store.Load(context.TODO(), "account")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, store.Save(context.TODO(), "account", []byte("session")))
+	assert.NoError(t, store.Save(context.TODO(), "other", []byte("other session")))
+	session, ok, err := store.Load(context.TODO(), "account")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("session"), session)
+	session, _, _ = store.Load(context.TODO(), "other")
+	assert.Equal(t, []byte("other session"), session)
+
+	assert.Equal(t, []string{
+		"GET /api/v1/namespaces/dns/secrets/sessions Bearer token",
+		"PATCH /api/v1/namespaces/dns/secrets/sessions Bearer token",
+		"POST /api/v1/namespaces/dns/secrets Bearer token",
+		"PATCH /api/v1/namespaces/dns/secrets/sessions Bearer token",
+		"GET /api/v1/namespaces/dns/secrets/sessions Bearer token",
+		"GET /api/v1/namespaces/dns/secrets/sessions Bearer token",
+	}, secrets.requests)
+}
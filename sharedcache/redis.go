@@ -0,0 +1,104 @@
+package sharedcache
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// unlockScript deletes a lock only if it is still held with the token of the caller
+	unlockScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`)
+	// renewScript extends a lock only if it is still held with the token of the caller
+	renewScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`)
+)
+
+// redisStore keeps the values and locks in Redis over the connection pool of a go-redis client.
+type redisStore struct {
+	client *redis.Client
+}
+
+func newRedis(location string, tlsConfig *tls.Config) (*redisStore, error) {
+	options, err := redis.ParseURL(location)
+	if err != nil {
+		return nil, err
+	}
+	if options.TLSConfig != nil && tlsConfig != nil {
+		serverName := options.TLSConfig.ServerName
+		options.TLSConfig = tlsConfig.Clone()
+		options.TLSConfig.ServerName = serverName
+	}
+	return &redisStore{client: redis.NewClient(options)}, nil
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
+
+func (s *redisStore) Lock(ctx context.Context, key string, ttl time.Duration) (func(), error) {
+	token := lockToken()
+	for {
+		locked, err := s.client.SetNX(ctx, key, token, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			stop := s.renew(key, token, ttl)
+			return func() {
+				stop()
+				// the lock expires should releasing it fail
+				_ = unlockScript.Run(context.Background(), s.client, []string{key}, token).Err()
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %s", ErrLockTimeout, key)
+		case <-time.After(lockRetry):
+		}
+	}
+}
+
+// renew extends the lock key every third of ttl until the returned function is called or the lock
+// is no longer held with token, e.g. as it expired while Redis was unreachable.
+func (s *redisStore) renew(key string, token string, ttl time.Duration) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if renewed, err := renewScript.Run(ctx, s.client, []string{key}, token, ttl.Milliseconds()).Int(); err == nil && renewed == 0 {
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,64 @@
+// Package sharedcache shares cached state and locks between replicas of the webhook through Redis.
+package sharedcache
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// lockRetry is how often a lock held by another replica is tried again.
+const lockRetry = 100 * time.Millisecond
+
+// ErrLockTimeout is returned if a lock is still held by another replica when the context is done.
+var ErrLockTimeout = errors.New("timed out waiting for a lock held by another replica")
+
+// Store keeps values and locks shared between replicas. Values expire after their TTL, locks after
+// their TTL once no longer renewed by their holder.
+type Store interface {
+	// Get returns the value of key, false if there is none.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Lock acquires the lock key, waiting while another replica holds it, and returns the function
+	// releasing it. The lock is renewed until released, and expires after ttl should the replica
+	// fail to renew it, e.g. as it exited.
+	Lock(ctx context.Context, key string, ttl time.Duration) (func(), error)
+}
+
+// New returns the store for location, a redis://[[user]:password@]host:port[/db] or rediss:// URL.
+// tlsConfig, if set, configures the connections of rediss:// URLs, e.g. trusting a private CA.
+func New(location string, tlsConfig *tls.Config) (Store, error) {
+	if err := Check(location); err != nil {
+		return nil, err
+	}
+	return newRedis(location, tlsConfig)
+}
+
+// Check reports the problems of location as New does, without constructing a client, e.g. when
+// validating the configuration.
+func Check(location string) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return fmt.Errorf("expected a redis:// or rediss:// URL, got %s", location)
+	}
+	_, err = redis.ParseURL(location)
+	return err
+}
+
+// lockToken returns a random token identifying the holder of a lock.
+func lockToken() string {
+	token := make([]byte, 16)
+	_, _ = rand.Read(token)
+	return hex.EncodeToString(token)
+}
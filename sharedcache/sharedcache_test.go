@@ -0,0 +1,88 @@
+package sharedcache
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	store, err := New("redis://:secret@"+server.Addr()+"/2", nil)
+	assert.NoError(t, err)
+	ctx := context.TODO()
+
+	_, ok, err := store.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, store.Set(ctx, "key", []byte("value\r\nwith newline"), time.Minute))
+	value, ok, err := store.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "value\r\nwith newline", string(value))
+	assert.Equal(t, time.Minute, server.DB(2).TTL("key"))
+	assert.NoError(t, store.Delete(ctx, "key"))
+	_, ok, _ = store.Get(ctx, "key")
+	assert.False(t, ok)
+
+	unlock, err := store.Lock(ctx, "lock", time.Minute)
+	assert.NoError(t, err)
+	timeout, cancel := context.WithTimeout(ctx, 3*lockRetry)
+	defer cancel()
+	_, err = store.Lock(timeout, "lock", time.Minute)
+	assert.ErrorIs(t, err, ErrLockTimeout)
+	unlock()
+	assert.False(t, server.DB(2).Exists("lock"))
+	unlock, err = store.Lock(ctx, "lock", time.Minute)
+	assert.NoError(t, err)
+	unlock()
+
+	_, err = New("memcache://localhost", nil)
+	assert.Error(t, err)
+	assert.NoError(t, Check("rediss://cache:6380/1"))
+	assert.Error(t, Check("redis://cache/db"), "the database must be a number")
+}
+
+func TestRedisStoreRenewsLocks(t *testing.T) {
+	server := miniredis.RunT(t)
+	store, err := New("redis://"+server.Addr(), nil)
+	assert.NoError(t, err)
+	ttl := 300 * time.Millisecond
+
+	unlock, err := store.Lock(context.TODO(), "lock", ttl)
+	assert.NoError(t, err)
+	defer unlock()
+	// the lock outlives its TTL as it is renewed while held
+	for range 2 {
+		server.FastForward(200 * time.Millisecond)
+		assert.Eventually(t, func() bool { return server.TTL("lock") > 100*time.Millisecond }, time.Second, 10*time.Millisecond)
+	}
+	assert.True(t, server.Exists("lock"))
+}
+
+func TestRedisStoreTLS(t *testing.T) {
+	// the certificate of httptest, issued for 127.0.0.1, serves as certificate of a private CA
+	https := httptest.NewTLSServer(http.NotFoundHandler())
+	defer https.Close()
+	server := miniredis.NewMiniRedis()
+	assert.NoError(t, server.StartTLS(&tls.Config{Certificates: https.TLS.Certificates}))
+	defer server.Close()
+
+	store, err := New("rediss://"+server.Addr(), nil)
+	assert.NoError(t, err)
+	assert.Error(t, store.Set(context.TODO(), "key", []byte("value"), time.Minute), "the CA is not trusted by default")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(https.Certificate())
+	store, err = New("rediss://"+server.Addr(), &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12})
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set(context.TODO(), "key", []byte("value"), time.Minute))
+}
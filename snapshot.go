@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+	"github.com/orbit-online/external-dns-inwx-webhook/snapshot"
+)
+
+func runSnapshot(cfg *config, logger *slog.Logger) int {
+	s, err := cfg.newProvider(logger).SnapshotZone(cfg.zone)
+	if err != nil {
+		logger.Error("failed to snapshot zone", "zone", cfg.zone, "error", err.Error())
+		return 1
+	}
+
+	if cfg.snapshotLocation == "" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(s); err != nil {
+			logger.Error("failed to encode snapshot", "error", err.Error())
+			return 1
+		}
+		return 0
+	}
+	store, err := snapshot.NewStore(cfg.snapshotLocation, cfg.snapshotS3)
+	if err != nil {
+		logger.Error("invalid snapshot location", "error", err.Error())
+		return 1
+	}
+	ref, err := store.Save(context.Background(), s)
+	if err != nil {
+		logger.Error("failed to save snapshot", "zone", cfg.zone, "error", err.Error())
+		return 1
+	}
+	fmt.Fprintln(os.Stdout, ref)
+	return 0
+}
+
+func runRestore(cfg *config, logger *slog.Logger) int {
+	s, err := snapshot.Load(context.Background(), cfg.snapshotRef, cfg.snapshotS3)
+	if err != nil {
+		logger.Error("failed to load snapshot", "error", err.Error())
+		return 1
+	}
+	operations, err := cfg.newProvider(logger).RestoreZone(s, cfg.dryRun, cfg.force)
+	if err != nil {
+		logger.Error("failed to restore snapshot", "zone", s.Zone, "snapshot", cfg.snapshotRef, "error", err.Error())
+		return 1
+	}
+	if len(operations) == 0 {
+		logger.Info("zone already matches snapshot", "zone", s.Zone, "created", s.Created)
+		return 0
+	}
+	return printRestoreOperations(logger, operations)
+}
+
+// printRestoreOperations prints a table of the record operations of a restore or an import.
+func printRestoreOperations(logger *slog.Logger, operations []provider.RestoreOperation) int {
+	return printOutput("table", logger, nil, func(w io.Writer) {
+		fmt.Fprintln(w, "ACTION\tNAME\tTYPE\tTTL\tPRIO\tCONTENT")
+		for _, op := range operations {
+			name := op.Record.Name
+			if name == "" {
+				name = "@"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", op.Action, name, op.Record.Type, op.Record.TTL, op.Record.Priority, op.Record.Content)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// s3Store is a minimal S3 client that only puts and gets objects.
+type s3Store struct {
+	bucket string
+	prefix string
+	config S3Config
+	client *http.Client
+	signer *v4.Signer
+}
+
+func newS3Store(bucket string, prefix string, config S3Config) *s3Store {
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &s3Store{
+		bucket: bucket,
+		prefix: strings.Trim(prefix, "/"),
+		config: config,
+		client: &http.Client{Timeout: time.Minute},
+		signer: v4.NewSigner(func(o *v4.SignerOptions) { o.DisableURIPathEscaping = true }),
+	}
+}
+
+func (s *s3Store) Save(ctx context.Context, snap *Snapshot) (string, error) {
+	content, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	key := path.Join(s.prefix, objectName(snap))
+	if _, err := s.do(ctx, http.MethodPut, key, content); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%s/%s", s3Scheme, s.bucket, key), nil
+}
+
+func (s *s3Store) get(ctx context.Context, key string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, key, nil)
+}
+
+// objectURL uses path-style addressing for custom endpoints, as most S3-compatible services expect.
+func (s *s3Store) objectURL(key string) string {
+	if s.config.Endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.config.Endpoint, "/"), s.bucket, key)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.config.Region, key)
+}
+
+func (s *s3Store) do(ctx context.Context, method string, key string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(hash[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	credentials := aws.Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if err := s.signer.SignHTTP(ctx, credentials, req, payloadHash, "s3", s.config.Region, time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: unexpected status %s: %s", method, key, resp.Status, strings.TrimSpace(string(content)))
+	}
+	return content, nil
+}
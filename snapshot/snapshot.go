@@ -0,0 +1,115 @@
+// Package snapshot stores point-in-time copies of zone record sets in a directory or an S3-compatible bucket.
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const s3Scheme = "s3://"
+
+// Record is a record as stored by INWX, relative to its zone.
+type Record struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Content  string `json:"content"`
+	TTL      int    `json:"ttl"`
+	Priority int    `json:"prio,omitempty"`
+}
+
+// Snapshot is the full record set of a zone at a point in time.
+type Snapshot struct {
+	Zone    string    `json:"zone"`
+	Created time.Time `json:"created"`
+	Records []Record  `json:"records"`
+}
+
+// Store persists snapshots. Save returns a reference that Load accepts.
+type Store interface {
+	Save(ctx context.Context, s *Snapshot) (string, error)
+}
+
+// S3Config configures access to S3-compatible buckets. Credentials are taken from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+type S3Config struct {
+	// Endpoint of an S3-compatible service, AWS S3 of Region is used if empty
+	Endpoint string
+	Region   string
+}
+
+// NewStore returns the store for location, which is either a directory or an s3://bucket/prefix URL.
+func NewStore(location string, s3 S3Config) (Store, error) {
+	if err := CheckStore(location); err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(location, s3Scheme) {
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, s3Scheme), "/")
+		return newS3Store(bucket, prefix, s3), nil
+	}
+	return &dirStore{dir: location}, nil
+}
+
+// CheckStore reports the problems of location as NewStore does, without constructing the client of a
+// bucket, e.g. when validating the configuration.
+func CheckStore(location string) error {
+	if bucketPath, ok := strings.CutPrefix(location, s3Scheme); ok {
+		if bucket, _, _ := strings.Cut(bucketPath, "/"); bucket == "" {
+			return fmt.Errorf("missing bucket in snapshot location %s", location)
+		}
+		return nil
+	}
+	if location == "" {
+		return fmt.Errorf("no snapshot location configured")
+	}
+	return nil
+}
+
+// Load reads the snapshot referenced by ref, a file path or an s3://bucket/key URL.
+func Load(ctx context.Context, ref string, s3 S3Config) (*Snapshot, error) {
+	var content []byte
+	var err error
+	if strings.HasPrefix(ref, s3Scheme) {
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(ref, s3Scheme), "/")
+		content, err = newS3Store(bucket, "", s3).get(ctx, key)
+	} else {
+		content, err = os.ReadFile(ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", ref, err)
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %s: %w", ref, err)
+	}
+	return s, nil
+}
+
+// objectName returns the name of a snapshot below its store, grouping snapshots by zone.
+func objectName(s *Snapshot) string {
+	return fmt.Sprintf("%s/%s.json", s.Zone, s.Created.UTC().Format("20060102T150405.000Z"))
+}
+
+type dirStore struct {
+	dir string
+}
+
+func (d *dirStore) Save(_ context.Context, s *Snapshot) (string, error) {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(d.dir, filepath.FromSlash(objectName(s)))
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, content, 0o640); err != nil {
+		return "", err
+	}
+	return path, nil
+}
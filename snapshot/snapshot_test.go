@@ -0,0 +1,83 @@
+package snapshot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSnapshot() *Snapshot {
+	return &Snapshot{
+		Zone:    "example.com",
+		Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Records: []Record{{ID: 1, Name: "foo", Type: "A", Content: "1.1.1.1", TTL: 60}},
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir, S3Config{})
+	assert.NoError(t, err)
+
+	ref, err := store.Save(context.TODO(), testSnapshot())
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "example.com", "20240102T030405.000Z.json"), ref)
+
+	s, err := Load(context.TODO(), ref, S3Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, testSnapshot(), s)
+
+	assert.NoError(t, CheckStore("s3://bucket/prefix"))
+	assert.ErrorContains(t, CheckStore("s3:///prefix"), "missing bucket")
+	assert.ErrorContains(t, CheckStore(""), "no snapshot location configured")
+}
+
+func TestS3Store(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path], _ = io.ReadAll(r.Body)
+		case http.MethodGet:
+			if content, ok := objects[r.URL.Path]; ok {
+				_, _ = w.Write(content)
+			} else {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}
+	}))
+	defer server.Close()
+
+	config := S3Config{Endpoint: server.URL, Region: "eu-central-1"}
+	store, err := NewStore("s3://backups/dns/", config)
+	assert.NoError(t, err)
+
+	ref, err := store.Save(context.TODO(), testSnapshot())
+	assert.NoError(t, err)
+	assert.Equal(t, "s3://backups/dns/example.com/20240102T030405.000Z.json", ref)
+	assert.Contains(t, objects, "/backups/dns/example.com/20240102T030405.000Z.json")
+
+	s, err := Load(context.TODO(), ref, config)
+	assert.NoError(t, err)
+	assert.Equal(t, testSnapshot(), s)
+
+	_, err = Load(context.TODO(), "s3://backups/missing.json", config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	provider "github.com/orbit-online/external-dns-inwx-webhook/provider"
+)
+
+// vaultReadTimeout bounds reading the credentials from Vault.
+const vaultReadTimeout = 30 * time.Second
+
+// readVaultCredentials replaces the credentials of the default account with those of the secret of
+// --vault-secret-path, keeping --inwx-username if the secret holds no username.
+func (cfg *config) readVaultCredentials(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, vaultReadTimeout)
+	defer cancel()
+	data, err := cfg.vaultClient.Read(ctx, cfg.vaultSecretPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the INWX credentials from Vault: %w", err)
+	}
+	password, ok := data[cfg.vaultPasswordKey].(string)
+	if !ok || password == "" {
+		return fmt.Errorf("the Vault secret %s has no password %s", cfg.vaultSecretPath, cfg.vaultPasswordKey)
+	}
+	if username, ok := data[cfg.vaultUsernameKey].(string); ok && username != "" {
+		cfg.username = username
+	}
+	cfg.password = password
+	return nil
+}
+
+// refreshVaultCredentials reads the credentials from Vault every --vault-refresh-interval until ctx is
+// done, replacing those of the default account once rotated. The credentials in use are kept if
+// Vault cannot be read.
+func refreshVaultCredentials(ctx context.Context, cfg *config, accounts []provider.Account, logger *slog.Logger) error {
+	p := defaultProvider(accounts)
+	if p == nil {
+		return nil
+	}
+	// the credentials are read into a copy, as cfg is shared with the other goroutines
+	username, password := cfg.username, cfg.password
+	ticker := time.NewTicker(cfg.vaultRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		read := &config{vaultClient: cfg.vaultClient, vaultSecretPath: cfg.vaultSecretPath, vaultUsernameKey: cfg.vaultUsernameKey, vaultPasswordKey: cfg.vaultPasswordKey, username: username}
+		if err := read.readVaultCredentials(ctx); err != nil {
+			logger.Warn("failed to refresh the INWX credentials from Vault, keeping those in use", "err", err)
+			continue
+		}
+		if read.username == username && read.password == password {
+			continue
+		}
+		username, password = read.username, read.password
+		logger.Info("the INWX credentials were rotated in Vault, logging in with the new credentials")
+		p.SetCredentials(username, password)
+	}
+}
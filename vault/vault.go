@@ -0,0 +1,235 @@
+// Package vault reads secrets from HashiCorp Vault, authenticating with a token or with the
+// Kubernetes auth method and the service account of the pod.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultKubernetesMount is the mount path of the Kubernetes auth method if not configured
+	defaultKubernetesMount = "kubernetes"
+	// defaultTokenFile is the service account token of the pod presented to the Kubernetes auth method
+	defaultTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+)
+
+// Config configures the client of Vault.
+type Config struct {
+	// Addr is the address of Vault, e.g. https://vault.example.com:8200
+	Addr string
+	// Token authenticates with Vault if set, instead of the Kubernetes auth method
+	Token string
+	// KubernetesRole is the role of the Kubernetes auth method
+	KubernetesRole string
+	// KubernetesMount is the mount path of the Kubernetes auth method, kubernetes if empty
+	KubernetesMount string
+	// KubernetesTokenFile is the service account token presented to Vault, that of the pod if empty
+	KubernetesTokenFile string
+	// Namespace is the Vault Enterprise namespace of the requests, if set
+	Namespace string
+	// TLSConfig configures the TLS connections to Vault, e.g. with the CA of Vault, if set
+	TLSConfig *tls.Config
+}
+
+// Client reads secrets from Vault. With the Kubernetes auth method it logs in on the first read,
+// renews its token once two thirds of the lease have passed and logs in again if the renewal fails.
+type Client struct {
+	config Config
+	http   *http.Client
+	// mu guards the token
+	mu    sync.Mutex
+	token string
+	// renewAt is when the token is renewed, or replaced by a login unless renewable; never if zero
+	renewAt   time.Time
+	renewable bool
+}
+
+type response struct {
+	Data map[string]any `json:"data"`
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// New returns the client of config, which needs either a token or a role of the Kubernetes auth method.
+func New(config Config) (*Client, error) {
+	if err := Check(config); err != nil {
+		return nil, err
+	}
+	if config.KubernetesMount == "" {
+		config.KubernetesMount = defaultKubernetesMount
+	}
+	if config.KubernetesTokenFile == "" {
+		config.KubernetesTokenFile = defaultTokenFile
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config.TLSConfig
+	return &Client{config: config, http: &http.Client{Transport: transport, Timeout: 30 * time.Second}, token: config.Token}, nil
+}
+
+// Check reports the problems of config as New does, without constructing a client, e.g. when
+// validating the configuration.
+func Check(config Config) error {
+	if config.Addr == "" {
+		return fmt.Errorf("no Vault address configured")
+	}
+	if config.Token == "" && config.KubernetesRole == "" {
+		return fmt.Errorf("either a Vault token or a role of the Kubernetes auth method is required")
+	}
+	return nil
+}
+
+// Read returns the data of the secret at path, e.g. secret/data/inwx, the data of the latest version
+// for a path of a KV version 2 secrets engine.
+func (c *Client) Read(ctx context.Context, path string) (map[string]any, error) {
+	token, err := c.currentToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, status, err := c.do(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"), token, nil)
+	if status == http.StatusForbidden && c.config.Token == "" {
+		// the token was revoked or expired early, log in again once
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+		if token, err = c.currentToken(ctx); err != nil {
+			return nil, err
+		}
+		resp, status, err = c.do(ctx, http.MethodGet, "/v1/"+strings.TrimPrefix(path, "/"), token, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the Vault secret %s: %w", path, err)
+	}
+	if status == http.StatusNotFound {
+		return nil, fmt.Errorf("the Vault secret %s does not exist", path)
+	}
+	data := resp.Data
+	if nested, ok := data["data"].(map[string]any); ok && data["metadata"] != nil {
+		// KV version 2 wraps the data of the secret with its metadata
+		data = nested
+	}
+	if data == nil {
+		return nil, fmt.Errorf("the Vault secret %s has no data", path)
+	}
+	return data, nil
+}
+
+// ReadString returns the value of key of the secret at path, which must be a string.
+func (c *Client) ReadString(ctx context.Context, path string, key string) (string, error) {
+	data, err := c.Read(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[key].(string)
+	if !ok {
+		return "", fmt.Errorf("the Vault secret %s has no string value %s", path, key)
+	}
+	return value, nil
+}
+
+// currentToken returns the token of the requests, logging in or renewing the token when due.
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.config.Token != "" {
+		return c.config.Token, nil
+	}
+	if c.token != "" && (c.renewAt.IsZero() || time.Now().Before(c.renewAt)) {
+		return c.token, nil
+	}
+	if c.token != "" && c.renewable {
+		resp, _, err := c.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", c.token, map[string]any{})
+		if err == nil && resp.Auth != nil {
+			c.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+			return c.token, nil
+		}
+	}
+	jwt, err := os.ReadFile(c.config.KubernetesTokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the service account token of the Kubernetes auth method: %w", err)
+	}
+	login := map[string]any{"role": c.config.KubernetesRole, "jwt": strings.TrimSpace(string(jwt))}
+	resp, _, err := c.do(ctx, http.MethodPost, "/v1/auth/"+strings.Trim(c.config.KubernetesMount, "/")+"/login", "", login)
+	if err != nil {
+		return "", fmt.Errorf("failed to log into Vault with the Kubernetes auth method: %w", err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("failed to log into Vault with the Kubernetes auth method: no token issued")
+	}
+	c.setToken(resp.Auth.ClientToken, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return c.token, nil
+}
+
+// setToken sets the token of a login or renewal, due for renewal after two thirds of its lease, or for
+// a new login if it is not renewable. mu must be held.
+func (c *Client) setToken(token string, leaseSeconds int, renewable bool) {
+	c.token, c.renewable = token, renewable
+	c.renewAt = time.Time{}
+	if leaseSeconds > 0 {
+		c.renewAt = time.Now().Add(time.Duration(leaseSeconds) * time.Second * 2 / 3)
+	}
+}
+
+// do calls the Vault API, returning an error with the errors of Vault for failed requests other than 404.
+func (c *Client) do(ctx context.Context, method string, path string, token string, body any) (*response, int, error) {
+	var content []byte
+	if body != nil {
+		var err error
+		if content, err = json.Marshal(body); err != nil {
+			return nil, 0, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.config.Addr, "/")+path, bytes.NewReader(content))
+	if err != nil {
+		return nil, 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.config.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	httpResp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = httpResp.Body.Close() }()
+	content, err = io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, httpResp.StatusCode, err
+	}
+	resp := &response{}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, resp); err != nil {
+			return nil, httpResp.StatusCode, fmt.Errorf("invalid response of Vault, status %d: %w", httpResp.StatusCode, err)
+		}
+	}
+	if httpResp.StatusCode == http.StatusNotFound {
+		return resp, httpResp.StatusCode, nil
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		msg := strings.Join(resp.Errors, "; ")
+		if msg == "" {
+			msg = http.StatusText(httpResp.StatusCode)
+		}
+		return resp, httpResp.StatusCode, errors.New("status " + httpResp.Status + ": " + msg)
+	}
+	return resp, httpResp.StatusCode, nil
+}
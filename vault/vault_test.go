@@ -0,0 +1,120 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVault serves a KV version 2 secret and the Kubernetes auth method from memory.
+type fakeVault struct {
+	mu       sync.Mutex
+	tokens   map[string]bool
+	logins   int
+	renewals int
+	password string
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body := map[string]any{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	switch r.URL.Path {
+	case "/v1/auth/kubernetes/login":
+		if body["role"] != "webhook" || body["jwt"] != "service-account-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		f.logins++
+		token := "token-" + string(rune('0'+f.logins))
+		f.tokens[token] = true
+		_ = json.NewEncoder(w).Encode(map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": 3600, "renewable": true}})
+	case "/v1/auth/token/renew-self":
+		f.renewals++
+		_ = json.NewEncoder(w).Encode(map[string]any{"auth": map[string]any{"client_token": r.Header.Get("X-Vault-Token"), "lease_duration": 3600, "renewable": true}})
+	case "/v1/secret/data/inwx":
+		if !f.tokens[r.Header.Get("X-Vault-Token")] {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": map[string]any{"username": "user", "password": f.password}, "metadata": map[string]any{"version": 1}}})
+	case "/v1/kv/inwx":
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"username": "user", "password": "v1"}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"errors":[]}`))
+	}
+}
+
+func TestKubernetesAuth(t *testing.T) {
+	vault := &fakeVault{tokens: map[string]bool{}, password: "secret"}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("service-account-token\n"), 0o600))
+	client, err := New(Config{Addr: server.URL, KubernetesRole: "webhook", KubernetesTokenFile: tokenFile})
+	assert.NoError(t, err)
+
+	password, err := client.ReadString(context.TODO(), "secret/data/inwx", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", password)
+	vault.password = "rotated"
+	password, err = client.ReadString(context.TODO(), "secret/data/inwx", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", password)
+	assert.Equal(t, 1, vault.logins, "the token is reused")
+
+	// a token past two thirds of its lease is renewed
+	client.mu.Lock()
+	client.renewAt = time.Now().Add(-time.Second)
+	client.mu.Unlock()
+	_, err = client.Read(context.TODO(), "secret/data/inwx")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, vault.renewals)
+	assert.Equal(t, 1, vault.logins)
+
+	// a revoked token is replaced by a login
+	vault.tokens = map[string]bool{}
+	_, err = client.Read(context.TODO(), "secret/data/inwx")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, vault.logins)
+
+	_, err = client.ReadString(context.TODO(), "secret/data/inwx", "otp")
+	assert.ErrorContains(t, err, "has no string value otp")
+	_, err = client.Read(context.TODO(), "secret/data/missing")
+	assert.ErrorContains(t, err, "does not exist")
+
+	refused, _ := New(Config{Addr: server.URL, KubernetesRole: "other", KubernetesTokenFile: tokenFile})
+	_, err = refused.Read(context.TODO(), "secret/data/inwx")
+	assert.ErrorContains(t, err, "failed to log into Vault with the Kubernetes auth method: status 403 Forbidden: permission denied")
+}
+
+func TestTokenAuth(t *testing.T) {
+	vault := &fakeVault{tokens: map[string]bool{"static": true}, password: "secret"}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	client, err := New(Config{Addr: server.URL, Token: "static"})
+	assert.NoError(t, err)
+	password, err := client.ReadString(context.TODO(), "secret/data/inwx", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", password)
+	password, err = client.ReadString(context.TODO(), "kv/inwx", "password")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", password, "KV version 1 secrets are read as they are")
+	assert.Equal(t, 0, vault.logins)
+
+	_, err = New(Config{Addr: server.URL})
+	assert.ErrorContains(t, err, "either a Vault token or a role")
+	assert.ErrorContains(t, Check(Config{Token: "static"}), "no Vault address configured")
+}
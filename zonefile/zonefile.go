@@ -0,0 +1,404 @@
+// Package zonefile converts INWX records to and from the BIND zone file format.
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Record is a resource record relative to its zone, with the apex named "".
+type Record struct {
+	Name     string
+	Type     string
+	TTL      int
+	Priority int
+	Content  string
+}
+
+// INWX specific record types that have no zone file representation.
+var unsupportedTypes = []string{"URL", "FRAME", "ALIAS"}
+
+// Types whose content is a single host name stored by INWX without the trailing dot.
+var hostContentTypes = []string{"CNAME", "NS", "PTR", "MX", "DNAME"}
+
+// Write writes the records of zone in zone file format. Records that cannot be represented
+// in a zone file are written as comments.
+func Write(w io.Writer, zone string, records []Record) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s.\n", strings.TrimSuffix(zone, "."))
+
+	sorted := slices.Clone(records)
+	slices.SortStableFunc(sorted, func(a, b Record) int {
+		if a.Type == "SOA" || b.Type == "SOA" {
+			return compareBool(a.Type != "SOA", b.Type != "SOA")
+		}
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Type, b.Type)
+	})
+
+	for _, rec := range sorted {
+		name := rec.Name
+		if name == "" {
+			name = "@"
+		}
+		line := fmt.Sprintf("%s\t%d\tIN\t%s\t%s", name, rec.TTL, rec.Type, formatContent(rec))
+		if slices.Contains(unsupportedTypes, rec.Type) {
+			line = "; " + line
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
+
+func formatContent(rec Record) string {
+	switch {
+	case rec.Type == "MX":
+		return fmt.Sprintf("%d %s", rec.Priority, absolute(rec.Content))
+	case rec.Type == "SRV":
+		fields := strings.Fields(rec.Content)
+		if len(fields) == 3 {
+			fields[2] = absolute(fields[2])
+		}
+		return fmt.Sprintf("%d %s", rec.Priority, strings.Join(fields, " "))
+	case rec.Type == "SOA":
+		fields := strings.Fields(rec.Content)
+		for i := 0; i < len(fields) && i < 2; i++ {
+			fields[i] = absolute(fields[i])
+		}
+		return strings.Join(fields, " ")
+	case rec.Type == "TXT" || rec.Type == "SPF":
+		return quoteTXT(rec.Content)
+	case slices.Contains(hostContentTypes, rec.Type):
+		return absolute(rec.Content)
+	default:
+		return rec.Content
+	}
+}
+
+func absolute(name string) string {
+	if name == "" || strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// quoteTXT quotes TXT content unless already quoted, splitting it into strings of at most 255 bytes.
+func quoteTXT(content string) string {
+	if strings.HasPrefix(content, `"`) && strings.HasSuffix(content, `"`) && len(content) > 1 {
+		return content
+	}
+	chunks := []string{}
+	for len(content) > 255 {
+		chunks = append(chunks, content[:255])
+		content = content[255:]
+	}
+	chunks = append(chunks, content)
+	for i, chunk := range chunks {
+		chunks[i] = `"` + strings.ReplaceAll(strings.ReplaceAll(chunk, `\`, `\\`), `"`, `\"`) + `"`
+	}
+	return strings.Join(chunks, " ")
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case !a:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// Parse reads the records of zone from a zone file, the inverse of Write: names become relative to
+// zone, the priorities of MX and SRV records move to Priority, host names lose the trailing dot and
+// the strings of TXT records are unquoted and joined, as INWX stores them. $ORIGIN and $TTL are
+// honored and $INCLUDE is refused. Records without a TTL get the one of $TTL, or else of the record
+// before.
+func Parse(r io.Reader, zone string) ([]Record, error) {
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	entries, err := readEntries(r)
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	origin, owner := zone, ""
+	defaultTTL, lastTTL := -1, 0
+	for _, e := range entries {
+		fields := e.fields
+		if strings.HasPrefix(fields[0], "$") {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: %s needs a value", e.line, fields[0])
+			}
+			switch strings.ToUpper(fields[0]) {
+			case "$ORIGIN":
+				origin = resolve(fields[1], origin)
+			case "$TTL":
+				if defaultTTL, err = parseTTL(fields[1]); err != nil {
+					return nil, fmt.Errorf("line %d: %w", e.line, err)
+				}
+			default:
+				return nil, fmt.Errorf("line %d: unsupported directive %s", e.line, fields[0])
+			}
+			continue
+		}
+		if !e.continued {
+			owner, fields = resolve(fields[0], origin), fields[1:]
+		} else if owner == "" {
+			return nil, fmt.Errorf("line %d: record without an owner name", e.line)
+		}
+		ttl := -1
+		for len(fields) > 0 {
+			if strings.EqualFold(fields[0], "IN") {
+				fields = fields[1:]
+			} else if value, err := parseTTL(fields[0]); err == nil && ttl < 0 {
+				ttl, fields = value, fields[1:]
+			} else {
+				break
+			}
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a record type and data", e.line)
+		}
+		switch {
+		case ttl >= 0:
+		case defaultTTL >= 0:
+			ttl = defaultTTL
+		default:
+			ttl = lastTTL
+		}
+		lastTTL = ttl
+		name, ok := relative(owner, zone)
+		if !ok {
+			return nil, fmt.Errorf("line %d: %s is not in zone %s", e.line, owner, zone)
+		}
+		rec, err := parseRecord(name, strings.ToUpper(fields[0]), ttl, fields[1:], origin)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", e.line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// entry is a logical line of a zone file, its parentheses joining physical lines.
+type entry struct {
+	line int
+	// continued is set if the owner name is left out, the line starting with a blank
+	continued bool
+	fields    []string
+}
+
+func readEntries(r io.Reader) ([]entry, error) {
+	entries := []entry{}
+	scanner := bufio.NewScanner(r)
+	current, depth := entry{}, 0
+	for n := 1; scanner.Scan(); n++ {
+		text := scanner.Text()
+		tokens, err := tokenize(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if depth == 0 {
+			current = entry{line: n, continued: strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")}
+		}
+		for _, token := range tokens {
+			switch token {
+			case "(":
+				depth++
+			case ")":
+				if depth--; depth < 0 {
+					return nil, fmt.Errorf("line %d: unbalanced parentheses", n)
+				}
+			default:
+				current.fields = append(current.fields, token)
+			}
+		}
+		if depth == 0 && len(current.fields) > 0 {
+			entries = append(entries, current)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("line %d: unbalanced parentheses", current.line)
+	}
+	return entries, nil
+}
+
+// tokenize splits a line of a zone file into its fields, dropping the comment. Quoted strings keep
+// their quotes and escapes are kept, while parentheses are fields of their own.
+func tokenize(line string) ([]string, error) {
+	tokens := []string{}
+	var token strings.Builder
+	inToken, quoted, escaped := false, false, false
+	flush := func() {
+		if inToken {
+			tokens = append(tokens, token.String())
+			token.Reset()
+			inToken = false
+		}
+	}
+	for _, c := range line {
+		switch {
+		case escaped:
+			token.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			token.WriteRune(c)
+			inToken, escaped = true, true
+		case quoted:
+			token.WriteRune(c)
+			if c == '"' {
+				quoted = false
+				flush()
+			}
+		case c == '"':
+			flush()
+			token.WriteRune(c)
+			inToken, quoted = true, true
+		case c == ';':
+			flush()
+			return tokens, nil
+		case c == ' ' || c == '\t':
+			flush()
+		case c == '(' || c == ')':
+			flush()
+			tokens = append(tokens, string(c))
+		default:
+			token.WriteRune(c)
+			inToken = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quoted string")
+	}
+	flush()
+	return tokens, nil
+}
+
+func parseRecord(name string, recordType string, ttl int, data []string, origin string) (Record, error) {
+	rec := Record{Name: name, Type: recordType, TTL: ttl}
+	switch {
+	case recordType == "MX":
+		if len(data) != 2 {
+			return rec, fmt.Errorf("expected a priority and a host name in MX record %s", name)
+		}
+		priority, err := strconv.Atoi(data[0])
+		if err != nil {
+			return rec, fmt.Errorf("invalid priority %s of MX record %s", data[0], name)
+		}
+		rec.Priority, rec.Content = priority, resolve(data[1], origin)
+	case recordType == "SRV":
+		if len(data) != 4 {
+			return rec, fmt.Errorf("expected a priority, weight, port and target in SRV record %s", name)
+		}
+		priority, err := strconv.Atoi(data[0])
+		if err != nil {
+			return rec, fmt.Errorf("invalid priority %s of SRV record %s", data[0], name)
+		}
+		rec.Priority, rec.Content = priority, strings.Join([]string{data[1], data[2], resolve(data[3], origin)}, " ")
+	case recordType == "TXT" || recordType == "SPF":
+		var content strings.Builder
+		for _, s := range data {
+			content.WriteString(unquoteTXT(s))
+		}
+		rec.Content = content.String()
+	case recordType == "SOA":
+		fields := slices.Clone(data)
+		for i := 0; i < len(fields) && i < 2; i++ {
+			fields[i] = resolve(fields[i], origin)
+		}
+		rec.Content = strings.Join(fields, " ")
+	case slices.Contains(hostContentTypes, recordType):
+		if len(data) != 1 {
+			return rec, fmt.Errorf("expected a host name in %s record %s", recordType, name)
+		}
+		rec.Content = resolve(data[0], origin)
+	default:
+		rec.Content = strings.Join(data, " ")
+	}
+	return rec, nil
+}
+
+// resolve returns the absolute name of name relative to origin, without the trailing dot.
+func resolve(name string, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case name == ".":
+		return name
+	case strings.HasSuffix(name, "."):
+		return strings.ToLower(strings.TrimSuffix(name, "."))
+	default:
+		return strings.ToLower(name) + "." + origin
+	}
+}
+
+// relative returns name relative to zone, "" for the apex, if name is in zone.
+func relative(name string, zone string) (string, bool) {
+	if name == zone {
+		return "", true
+	}
+	return strings.CutSuffix(name, "."+zone)
+}
+
+// parseTTL parses a TTL in seconds or with the units of BIND, e.g. 1h30m.
+func parseTTL(s string) (int, error) {
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, fmt.Errorf("invalid TTL %s", s)
+	}
+	total, value := 0, 0
+	units := map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			value = value*10 + int(s[i]-'0')
+		case units[c] > 0 && i > 0 && s[i-1] >= '0' && s[i-1] <= '9':
+			total, value = total+value*units[c], 0
+		default:
+			return 0, fmt.Errorf("invalid TTL %s", s)
+		}
+	}
+	return total + value, nil
+}
+
+// unquoteTXT returns a string of a TXT record with the quotes removed and the escapes resolved.
+func unquoteTXT(s string) string {
+	if len(s) > 1 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		s = s[1 : len(s)-1]
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+4 <= len(s) && isDigits(s[i+1:i+4]) {
+			value, _ := strconv.Atoi(s[i+1 : i+4])
+			b.WriteByte(byte(value))
+			i += 3
+			continue
+		}
+		i++
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package zonefile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, "example.com", []Record{
+		{Name: "www", Type: "CNAME", TTL: 300, Content: "example.com"},
+		{Name: "", Type: "MX", TTL: 3600, Priority: 10, Content: "mail.example.com"},
+		{Name: "", Type: "SOA", TTL: 86400, Content: "ns.inwx.de hostmaster.inwx.de 2024010101 10800 3600 604800 3600"},
+		{Name: "_sip._tcp", Type: "SRV", TTL: 3600, Priority: 10, Content: "5 5060 sip.example.com"},
+		{Name: "", Type: "TXT", TTL: 3600, Content: `v=spf1 include:"x" -all`},
+		{Name: "", Type: "A", TTL: 3600, Content: "1.2.3.4"},
+		{Name: "go", Type: "URL", TTL: 3600, Content: "https://example.org"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"$ORIGIN example.com.",
+		"@\t86400\tIN\tSOA\tns.inwx.de. hostmaster.inwx.de. 2024010101 10800 3600 604800 3600",
+		"@\t3600\tIN\tA\t1.2.3.4",
+		"@\t3600\tIN\tMX\t10 mail.example.com.",
+		"@\t3600\tIN\tTXT\t\"v=spf1 include:\\\"x\\\" -all\"",
+		"_sip._tcp\t3600\tIN\tSRV\t10 5 5060 sip.example.com.",
+		"; go\t3600\tIN\tURL\thttps://example.org",
+		"www\t300\tIN\tCNAME\texample.com.",
+		"",
+	}, "\n"), buf.String())
+}
+
+func TestQuoteTXT(t *testing.T) {
+	assert.Equal(t, `"already quoted"`, quoteTXT(`"already quoted"`))
+	long := quoteTXT(strings.Repeat("a", 300))
+	assert.Equal(t, `"`+strings.Repeat("a", 255)+`" "`+strings.Repeat("a", 45)+`"`, long)
+}
+
+func TestParse(t *testing.T) {
+	records, err := Parse(strings.NewReader(strings.Join([]string{
+		"$ORIGIN example.com.",
+		"$TTL 1h",
+		"@\tIN\tSOA\tns.inwx.de. hostmaster.inwx.de. (",
+		"\t\t2024010101 ; serial",
+		"\t\t10800 3600 604800 3600 )",
+		"\tIN\tMX\t10 mail ; the apex again",
+		"www\t300\tIN\tCNAME\t@",
+		"_sip._tcp 3600 SRV 10 5 5060 sip.example.com.",
+		`txt IN 60 TXT "v=spf1 include:\"x\" -all" " more\059"`,
+		"$ORIGIN sub.example.com.",
+		"host A 192.0.2.1",
+		"; go\t3600\tIN\tURL\thttps://example.org",
+	}, "\n")), "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []Record{
+		{Name: "", Type: "SOA", TTL: 3600, Content: "ns.inwx.de hostmaster.inwx.de 2024010101 10800 3600 604800 3600"},
+		{Name: "", Type: "MX", TTL: 3600, Priority: 10, Content: "mail.example.com"},
+		{Name: "www", Type: "CNAME", TTL: 300, Content: "example.com"},
+		{Name: "_sip._tcp", Type: "SRV", TTL: 3600, Priority: 10, Content: "5 5060 sip.example.com"},
+		{Name: "txt", Type: "TXT", TTL: 60, Content: `v=spf1 include:"x" -all more;`},
+		{Name: "host.sub", Type: "A", TTL: 3600, Content: "192.0.2.1"},
+	}, records)
+
+	var buf bytes.Buffer
+	assert.NoError(t, Write(&buf, "example.com", records))
+	written, err := Parse(&buf, "example.com")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, records, written, "written records parse back")
+
+	_, err = Parse(strings.NewReader("www.example.org. 300 IN A 192.0.2.1"), "example.com")
+	assert.ErrorContains(t, err, "line 1: www.example.org is not in zone example.com")
+	_, err = Parse(strings.NewReader("$INCLUDE other.zone"), "example.com")
+	assert.ErrorContains(t, err, "unsupported directive $INCLUDE")
+	_, err = Parse(strings.NewReader("@ SOA ns. host. (1 2 3"), "example.com")
+	assert.ErrorContains(t, err, "unbalanced parentheses")
+}